@@ -0,0 +1,3 @@
+package dns
+
+// Find better solution
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/docker/libnetwork"
 	"github.com/docker/libnetwork/netlabel"
@@ -26,11 +28,14 @@ const (
 	// to have mux eventually build a query regex which matches empty or word string (`^$|[\w]+`)
 	regex = "[a-zA-Z_0-9-]+"
 	qregx = "$|" + regex
+	// Label query regex, matches a label key or a key=value pair, possibly url encoded
+	lregx = "$|[a-zA-Z_0-9.%=/-]+"
 	// Router URL variable definition
 	nwName   = "{" + urlNwName + ":" + regex + "}"
 	nwNameQr = "{" + urlNwName + ":" + qregx + "}"
 	nwID     = "{" + urlNwID + ":" + regex + "}"
 	nwPIDQr  = "{" + urlNwPID + ":" + qregx + "}"
+	nwLblQr  = "{" + urlNwLbl + ":" + lregx + "}"
 	epName   = "{" + urlEpName + ":" + regex + "}"
 	epNameQr = "{" + urlEpName + ":" + qregx + "}"
 	epID     = "{" + urlEpID + ":" + regex + "}"
@@ -45,6 +50,7 @@ const (
 	urlNwName = "network-name"
 	urlNwID   = "network-id"
 	urlNwPID  = "network-partial-id"
+	urlNwLbl  = "network-label"
 	urlEpName = "endpoint-name"
 	urlEpID   = "endpoint-id"
 	urlEpPID  = "endpoint-partial-id"
@@ -101,6 +107,7 @@ func (h *httpHandler) initRouter() {
 			// Order matters
 			{"/networks", []string{"name", nwNameQr}, procGetNetworks},
 			{"/networks", []string{"partial-id", nwPIDQr}, procGetNetworks},
+			{"/networks", []string{"label", nwLblQr}, procGetNetworks},
 			{"/networks", nil, procGetNetworks},
 			{"/networks/" + nwID, nil, procGetNetwork},
 			{"/networks/" + nwID + "/endpoints", []string{"name", epNameQr}, procGetEndpoints},
@@ -118,6 +125,7 @@ func (h *httpHandler) initRouter() {
 			{"/sandboxes", []string{"partial-id", sbPIDQr}, procGetSandboxes},
 			{"/sandboxes", nil, procGetSandboxes},
 			{"/sandboxes/" + sbID, nil, procGetSandbox},
+			{"/drift", nil, procGetDrift},
 		},
 		"POST": {
 			{"/networks", nil, procCreateNetwork},
@@ -127,6 +135,9 @@ func (h *httpHandler) initRouter() {
 			{"/services/" + epID + "/backend", nil, procAttachBackend},
 			{"/sandboxes", nil, procCreateSandbox},
 		},
+		"PUT": {
+			{"/networks/" + nwID + "/policy", nil, procUpdateNetworkPolicy},
+		},
 		"DELETE": {
 			{"/networks/" + nwID, nil, procDeleteNetwork},
 			{"/networks/" + nwID + "/endpoints/" + epID, nil, procDeleteEndpoint},
@@ -151,6 +162,10 @@ func (h *httpHandler) initRouter() {
 			}
 		}
 	}
+
+	// Events are streamed, they do not fit the processor model
+	h.r.Path("/{.*}/events").Methods("GET").HandlerFunc(h.handleEvents)
+	h.r.Path("/events").Methods("GET").HandlerFunc(h.handleEvents)
 }
 
 func makeHandler(ctrl libnetwork.NetworkController, fct processor) http.HandlerFunc {
@@ -178,6 +193,71 @@ func makeHandler(ctrl libnetwork.NetworkController, fct processor) http.HandlerF
 	}
 }
 
+// handleEvents streams the controller events as a chunked sequence of json
+// objects until the client goes away or the controller is stopped.
+// The "type" and "network" query fields can be repeated to filter the events.
+func (h *httpHandler) handleEvents(w http.ResponseWriter, req *http.Request) {
+	ch, cancel := h.c.Subscribe(buildEventFilter(req.URL.Query()))
+	defer cancel()
+
+	var closeCh <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closeCh = cn.CloseNotify()
+	}
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-closeCh:
+			return
+		}
+	}
+}
+
+func buildEventFilter(q url.Values) libnetwork.EventFilter {
+	evTypes := q["type"]
+	networks := q["network"]
+	if len(evTypes) == 0 && len(networks) == 0 {
+		return nil
+	}
+
+	return func(ev libnetwork.Event) bool {
+		if len(evTypes) > 0 && !contains(evTypes, string(ev.Type)) {
+			return false
+		}
+		if len(networks) > 0 && !contains(networks, ev.NetworkID) && !contains(networks, ev.NetworkName) {
+			return false
+		}
+		return true
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
 /*****************
  Resource Builders
 ******************/
@@ -188,6 +268,9 @@ func buildNetworkResource(nw libnetwork.Network) *networkResource {
 		r.Name = nw.Name()
 		r.ID = nw.ID()
 		r.Type = nw.Type()
+		r.Labels = nw.Labels()
+		r.Internal = nw.Internal()
+		r.Policy = nw.Policy()
 		epl := nw.Endpoints()
 		r.Endpoints = make([]*endpointResource, 0, len(epl))
 		for _, e := range epl {
@@ -204,6 +287,10 @@ func buildEndpointResource(ep libnetwork.Endpoint) *endpointResource {
 		r.Name = ep.Name()
 		r.ID = ep.ID()
 		r.Network = ep.Network()
+		r.Labels = ep.Labels()
+		if info := ep.Info(); info != nil && info.VirtualIP() != nil {
+			r.VirtualIP = info.VirtualIP().String()
+		}
 	}
 	return r
 }
@@ -228,6 +315,15 @@ func (nc *networkCreate) parseOptions() []libnetwork.NetworkOption {
 	if nc.Options != nil {
 		setFctList = append(setFctList, libnetwork.NetworkOptionGeneric(nc.Options))
 	}
+	if nc.Labels != nil {
+		setFctList = append(setFctList, libnetwork.NetworkOptionLabels(nc.Labels))
+	}
+	if nc.Internal {
+		setFctList = append(setFctList, libnetwork.NetworkOptionInternal())
+	}
+	if nc.Policy != nil {
+		setFctList = append(setFctList, libnetwork.NetworkOptionPolicy(nc.Policy))
+	}
 
 	return setFctList
 }
@@ -252,6 +348,9 @@ func (sc *sandboxCreate) parseOptions() []libnetwork.SandboxOption {
 	if sc.UseExternalKey {
 		setFctList = append(setFctList, libnetwork.OptionUseExternalKey())
 	}
+	if sc.UseEmbeddedDNS {
+		setFctList = append(setFctList, libnetwork.OptionUseEmbeddedDNS())
+	}
 	if sc.DNS != nil {
 		for _, d := range sc.DNS {
 			setFctList = append(setFctList, libnetwork.OptionDNS(d))
@@ -324,13 +423,34 @@ func procGetNetwork(c libnetwork.NetworkController, vars map[string]string, body
 	return buildNetworkResource(nw), &successResponse
 }
 
+func procUpdateNetworkPolicy(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	var rules []types.PolicyRule
+
+	err := json.Unmarshal(body, &rules)
+	if err != nil {
+		return nil, &responseStatus{Status: "Invalid body: " + err.Error(), StatusCode: http.StatusBadRequest}
+	}
+
+	t, by := detectNetworkTarget(vars)
+	nw, errRsp := findNetwork(c, t, by)
+	if !errRsp.isOK() {
+		return nil, errRsp
+	}
+
+	if err := nw.UpdatePolicy(rules); err != nil {
+		return nil, convertNetworkError(err)
+	}
+	return nil, &successResponse
+}
+
 func procGetNetworks(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
 	var list []*networkResource
 
 	// Look for query filters and validate
 	name, queryByName := vars[urlNwName]
 	shortID, queryByPid := vars[urlNwPID]
-	if queryByName && queryByPid {
+	label, queryByLabel := vars[urlNwLbl]
+	if queryByName && queryByPid || queryByName && queryByLabel || queryByPid && queryByLabel {
 		return nil, &badQueryResponse
 	}
 
@@ -347,6 +467,14 @@ func procGetNetworks(c libnetwork.NetworkController, vars map[string]string, bod
 			return false
 		}
 		c.WalkNetworks(l)
+	} else if queryByLabel {
+		selector, err := url.QueryUnescape(label)
+		if err != nil {
+			return nil, &badQueryResponse
+		}
+		for _, nw := range c.NetworksByLabel(selector) {
+			list = append(list, buildNetworkResource(nw))
+		}
 	} else {
 		for _, nw := range c.Networks() {
 			list = append(list, buildNetworkResource(nw))
@@ -390,6 +518,9 @@ func procCreateEndpoint(c libnetwork.NetworkController, vars map[string]string,
 	}
 
 	var setFctList []libnetwork.EndpointOption
+	if ec.Labels != nil {
+		setFctList = append(setFctList, libnetwork.CreateOptionLabels(ec.Labels))
+	}
 	if ec.ExposedPorts != nil {
 		setFctList = append(setFctList, libnetwork.CreateOptionExposedPorts(ec.ExposedPorts))
 	}
@@ -626,12 +757,26 @@ func procPublishService(c libnetwork.NetworkController, vars map[string]string,
 	}
 
 	var setFctList []libnetwork.EndpointOption
+	if sp.Aliases != nil {
+		setFctList = append(setFctList, libnetwork.CreateOptionAlias(sp.Aliases...))
+	}
 	if sp.ExposedPorts != nil {
 		setFctList = append(setFctList, libnetwork.CreateOptionExposedPorts(sp.ExposedPorts))
 	}
 	if sp.PortMapping != nil {
 		setFctList = append(setFctList, libnetwork.CreateOptionPortMapping(sp.PortMapping))
 	}
+	if lb := sp.LoadBalancer; lb != nil {
+		var hc *libnetwork.HealthCheck
+		if lb.HealthCheck != nil {
+			hc = &libnetwork.HealthCheck{
+				Interval: time.Duration(lb.HealthCheck.Interval) * time.Second,
+				Timeout:  time.Duration(lb.HealthCheck.Timeout) * time.Second,
+				Retries:  lb.HealthCheck.Retries,
+			}
+		}
+		setFctList = append(setFctList, libnetwork.CreateOptionLoadBalancer(lb.Scheduler, hc))
+	}
 
 	ep, err := n.CreateEndpoint(sp.Name, setFctList...)
 	if err != nil {
@@ -781,6 +926,13 @@ func procDeleteSandbox(c libnetwork.NetworkController, vars map[string]string, b
 	return nil, &successResponse
 }
 
+/******************
+ Drift resources
+*******************/
+func procGetDrift(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	return c.Drift(), &successResponse
+}
+
 /***********
   Utilities
 ************/
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"runtime"
@@ -252,6 +253,122 @@ func TestCreateDeleteNetwork(t *testing.T) {
 	}
 }
 
+func TestCreateInternalNetwork(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nc := networkCreate{Name: "internal", NetworkType: bridgeNetType, Internal: true}
+	body, err := json.Marshal(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+	_, errRsp := procCreateNetwork(c, vars, body)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	vars[urlNwName] = "internal"
+	inr, errRsp := procGetNetwork(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	if nr := i2n(inr); !nr.Internal {
+		t.Fatalf("Expected internal network resource, got: %v", nr)
+	}
+
+	_, errRsp = procDeleteNetwork(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+}
+
+func TestUpdateNetworkPolicy(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nc := networkCreate{Name: "policy", NetworkType: bridgeNetType}
+	body, err := json.Marshal(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+	_, errRsp := procCreateNetwork(c, vars, body)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	vars[urlNwName] = "policy"
+	_, errRsp = procUpdateNetworkPolicy(c, vars, []byte(`{"action":"allow"}`))
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected StatusBadRequest status code, got: %v", errRsp)
+	}
+
+	rules := []types.PolicyRule{{Action: "reject"}}
+	body, err = json.Marshal(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procUpdateNetworkPolicy(c, vars, body)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected StatusBadRequest status code, got: %v", errRsp)
+	}
+
+	// Policies are enforced through iptables, which is disabled in the test controller
+	rules = []types.PolicyRule{{Action: types.PolicyDeny, Source: types.EndpointSelector{Labels: []string{"tier=front"}}}}
+	body, err = json.Marshal(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procUpdateNetworkPolicy(c, vars, body)
+	if errRsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected StatusForbidden status code, got: %v", errRsp)
+	}
+
+	_, errRsp = procUpdateNetworkPolicy(c, vars, []byte(`[]`))
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	inr, errRsp := procGetNetwork(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	if nr := i2n(inr); len(nr.Policy) != 0 {
+		t.Fatalf("Unexpected network policy: %v", nr.Policy)
+	}
+
+	vars[urlNwName] = "unknown"
+	_, errRsp = procUpdateNetworkPolicy(c, vars, []byte(`[]`))
+	if errRsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected StatusNotFound status code, got: %v", errRsp)
+	}
+
+	vars[urlNwName] = "policy"
+	_, errRsp = procDeleteNetwork(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+}
+
 func TestGetNetworksAndEndpoints(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 
@@ -270,7 +387,7 @@ func TestGetNetworksAndEndpoints(t *testing.T) {
 		},
 	}
 
-	nc := networkCreate{Name: "sh", NetworkType: bridgeNetType, Options: ops}
+	nc := networkCreate{Name: "sh", NetworkType: bridgeNetType, Labels: map[string]string{"tenant": "blue"}, Options: ops}
 	body, err := json.Marshal(nc)
 	if err != nil {
 		t.Fatal(err)
@@ -474,6 +591,27 @@ func TestGetNetworksAndEndpoints(t *testing.T) {
 	if nid != netList[0].ID {
 		t.Fatalf("Did not find expected network %s: %v", nid, netList)
 	}
+	if netList[0].Labels["tenant"] != "blue" {
+		t.Fatalf("Did not find expected labels in network resource: %v", netList[0].Labels)
+	}
+
+	iList, errRsp = procGetNetworks(c, map[string]string{urlNwLbl: "tenant%3Dblue"}, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	netList = i2nL(iList)
+	if len(netList) != 1 || netList[0].ID != nid {
+		t.Fatalf("Did not find expected network %s by label: %v", nid, netList)
+	}
+
+	iList, errRsp = procGetNetworks(c, map[string]string{urlNwLbl: "tenant=red"}, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	netList = i2nL(iList)
+	if len(netList) != 0 {
+		t.Fatalf("Unexpected network resources returned by label query: %v", netList)
+	}
 
 	_, errRsp = procDeleteNetwork(c, vars, nil)
 	if errRsp == &successResponse {
@@ -824,9 +962,25 @@ func TestProcPublishUnpublishService(t *testing.T) {
 		t.Fatalf("Unexpected failure: %v", errRsp)
 	}
 
+	// The bridge network has no address pool to allocate the virtual ip from
+	b, err = json.Marshal(servicePublish{
+		Name:         "lb",
+		Network:      "network",
+		ExposedPorts: []types.TransportPort{{Proto: types.TCP, Port: uint16(80)}},
+		LoadBalancer: &loadBalancer{Scheduler: "rr", HealthCheck: &healthCheck{Interval: 2, Retries: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procPublishService(c, vars, b)
+	if errRsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected %d. Got: %v", http.StatusForbidden, errRsp)
+	}
+
 	sp := servicePublish{
 		Name:    "web",
 		Network: "network",
+		Aliases: []string{"www", "frontend"},
 		ExposedPorts: []types.TransportPort{
 			types.TransportPort{Proto: types.TCP, Port: uint16(6000)},
 			types.TransportPort{Proto: types.UDP, Port: uint16(500)},
@@ -1024,6 +1178,12 @@ func TestDetectGetNetworksInvalidQueryComposition(t *testing.T) {
 	if errRsp.StatusCode != http.StatusBadRequest {
 		t.Fatalf("Expected %d. Got: %v", http.StatusBadRequest, errRsp)
 	}
+
+	vars = map[string]string{urlNwName: "x", urlNwLbl: "y"}
+	_, errRsp = procGetNetworks(c, vars, nil)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %d. Got: %v", http.StatusBadRequest, errRsp)
+	}
 }
 
 func TestDetectGetEndpointsInvalidQueryComposition(t *testing.T) {
@@ -2253,6 +2413,137 @@ func TestEndToEnd(t *testing.T) {
 	}
 }
 
+// streamResponseWriter pipes the response body to a reader so that
+// streamed responses can be consumed while the handler is running
+type streamResponseWriter struct {
+	*io.PipeWriter
+	statusCode int
+	closeCh    chan bool
+	headerCh   chan struct{}
+}
+
+func (f *streamResponseWriter) Header() http.Header {
+	return make(map[string][]string, 0)
+}
+
+func (f *streamResponseWriter) WriteHeader(c int) {
+	f.statusCode = c
+	close(f.headerCh)
+}
+
+func (f *streamResponseWriter) CloseNotify() <-chan bool {
+	return f.closeCh
+}
+
+func TestEventsStream(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	handleRequest := NewHTTPHandler(c)
+
+	pr, pw := io.Pipe()
+	rsp := &streamResponseWriter{PipeWriter: pw, closeCh: make(chan bool, 1), headerCh: make(chan struct{})}
+	req, err := http.NewRequest("GET", "/v1.19/events?type="+string(libnetwork.EventNetworkCreate), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		handleRequest(rsp, req)
+		close(done)
+	}()
+	defer func() {
+		rsp.closeCh <- true
+		pr.Close()
+		<-done
+	}()
+
+	// Wait for the handler to be subscribed before generating events
+	<-rsp.headerCh
+
+	netOption := options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "evnet",
+		},
+	}
+	nw, err := c.NewNetwork(bridgeNetType, "evnet", libnetwork.NetworkOptionGeneric(netOption))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nw.CreateEndpoint("ep1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var ev libnetwork.Event
+	if err := json.NewDecoder(pr).Decode(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.statusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code. Expected (%d). Got (%d)", http.StatusOK, rsp.statusCode)
+	}
+	if ev.Type != libnetwork.EventNetworkCreate || ev.NetworkID != nw.ID() || ev.NetworkName != "evnet" {
+		t.Fatalf("Unexpected event: %v", ev)
+	}
+}
+
+func TestGetDrift(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	handleRequest := NewHTTPHandler(c)
+
+	rsp := newWriter()
+	req, err := http.NewRequest("GET", "/v1.19/drift", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleRequest(rsp, req)
+	if rsp.statusCode != http.StatusOK {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusOK, rsp.statusCode, rsp.body)
+	}
+
+	var report libnetwork.DriftReport
+	if err := json.Unmarshal(rsp.body, &report); err != nil {
+		t.Fatal(err)
+	}
+	// The drivers are reconciled when the controller starts
+	if report.Time.IsZero() {
+		t.Fatalf("Unexpected drift report before any reconciliation: %v", report)
+	}
+}
+
+func TestBuildEventFilter(t *testing.T) {
+	if f := buildEventFilter(url.Values{}); f != nil {
+		t.Fatalf("Expected nil filter for empty query")
+	}
+
+	f := buildEventFilter(url.Values{"type": {"endpoint-join", "endpoint-leave"}, "network": {"net1"}})
+	if !f(libnetwork.Event{Type: libnetwork.EventEndpointJoin, NetworkName: "net1"}) {
+		t.Fatalf("Expected event to match filter")
+	}
+	if f(libnetwork.Event{Type: libnetwork.EventEndpointCreate, NetworkName: "net1"}) {
+		t.Fatalf("Unexpected match on event type")
+	}
+	if f(libnetwork.Event{Type: libnetwork.EventEndpointLeave, NetworkName: "net2", NetworkID: "abc"}) {
+		t.Fatalf("Unexpected match on network")
+	}
+}
+
 func TestEndToEndErrorMessage(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 
@@ -11,14 +11,19 @@ type networkResource struct {
 	Name      string              `json:"name"`
 	ID        string              `json:"id"`
 	Type      string              `json:"type"`
+	Labels    map[string]string   `json:"labels"`
+	Internal  bool                `json:"internal"`
+	Policy    []types.PolicyRule  `json:"policy,omitempty"`
 	Endpoints []*endpointResource `json:"endpoints"`
 }
 
 // endpointResource is the body of the "get endpoint" http response message
 type endpointResource struct {
-	Name    string `json:"name"`
-	ID      string `json:"id"`
-	Network string `json:"network"`
+	Name      string            `json:"name"`
+	ID        string            `json:"id"`
+	Network   string            `json:"network"`
+	Labels    map[string]string `json:"labels"`
+	VirtualIP string            `json:"virtual_ip,omitempty"`
 }
 
 // sandboxResource is the body of "get service backend" response message
@@ -37,12 +42,16 @@ type sandboxResource struct {
 type networkCreate struct {
 	Name        string                 `json:"name"`
 	NetworkType string                 `json:"network_type"`
+	Labels      map[string]string      `json:"labels"`
+	Internal    bool                   `json:"internal"`
+	Policy      []types.PolicyRule     `json:"policy"`
 	Options     map[string]interface{} `json:"options"`
 }
 
 // endpointCreate represents the body of the "create endpoint" http request message
 type endpointCreate struct {
 	Name         string                `json:"name"`
+	Labels       map[string]string     `json:"labels"`
 	ExposedPorts []types.TransportPort `json:"exposed_ports"`
 	PortMapping  []types.PortBinding   `json:"port_mapping"`
 }
@@ -58,6 +67,7 @@ type sandboxCreate struct {
 	ExtraHosts        []extraHost `json:"extra_hosts"`
 	UseDefaultSandbox bool        `json:"use_default_sandbox"`
 	UseExternalKey    bool        `json:"use_external_key"`
+	UseEmbeddedDNS    bool        `json:"use_embedded_dns"`
 }
 
 // endpointJoin represents the expected body of the "join endpoint" or "leave endpoint" http request messages
@@ -69,8 +79,24 @@ type endpointJoin struct {
 type servicePublish struct {
 	Name         string                `json:"name"`
 	Network      string                `json:"network_name"`
+	Aliases      []string              `json:"aliases"`
 	ExposedPorts []types.TransportPort `json:"exposed_ports"`
 	PortMapping  []types.PortBinding   `json:"port_mapping"`
+	LoadBalancer *loadBalancer         `json:"load_balancer"`
+}
+
+// loadBalancer represents the virtual IP load balancing configuration of a published service
+type loadBalancer struct {
+	Scheduler   string       `json:"scheduler"`
+	HealthCheck *healthCheck `json:"health_check"`
+}
+
+// healthCheck represents the probing configuration of the backends of a load balanced service.
+// Interval and timeout are in seconds.
+type healthCheck struct {
+	Interval int `json:"interval"`
+	Timeout  int `json:"timeout"`
+	Retries  int `json:"retries"`
 }
 
 // extraHost represents the extra host object
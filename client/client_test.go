@@ -153,6 +153,21 @@ func TestClientNetworkCreateWithDriver(t *testing.T) {
 	}
 }
 
+func TestClientNetworkCreateWithLabels(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cli := NewNetworkCli(&out, &errOut, callbackFunc)
+
+	err := cli.Cmd("docker", "network", "create", "-l=tenant=blue", "--label=project", mockNwName)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = cli.Cmd("docker", "network", "create", "-l==blue", mockNwName)
+	if err == nil {
+		t.Fatalf("Passing a label with an empty key must fail")
+	}
+}
+
 func TestClientNetworkRm(t *testing.T) {
 	var out, errOut bytes.Buffer
 	cli := NewNetworkCli(&out, &errOut, callbackFunc)
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"text/tabwriter"
 
 	flag "github.com/docker/docker/pkg/mflag"
@@ -41,6 +42,9 @@ func (cli *NetworkCli) CmdNetwork(chain string, args ...string) error {
 func (cli *NetworkCli) CmdNetworkCreate(chain string, args ...string) error {
 	cmd := cli.Subcmd(chain, "create", "NETWORK-NAME", "Creates a new network with a name specified by the user", false)
 	flDriver := cmd.String([]string{"d", "-driver"}, "", "Driver to manage the Network")
+	flLabels := labelOpts{}
+	cmd.Var(&flLabels, []string{"l", "-label"}, "Set a label (key=value) on the Network")
+	flInternal := cmd.Bool([]string{"-internal"}, false, "Restrict external access to the Network")
 	cmd.Require(flag.Exact, 1)
 	err := cmd.ParseFlags(args, true)
 	if err != nil {
@@ -49,7 +53,10 @@ func (cli *NetworkCli) CmdNetworkCreate(chain string, args ...string) error {
 
 	// Construct network create request body
 	ops := make(map[string]interface{})
-	nc := networkCreate{Name: cmd.Arg(0), NetworkType: *flDriver, Options: ops}
+	nc := networkCreate{Name: cmd.Arg(0), NetworkType: *flDriver, Internal: *flInternal, Options: ops}
+	if len(flLabels) > 0 {
+		nc.Labels = flLabels
+	}
 	obj, _, err := readBody(cli.call("POST", "/networks", nc, nil))
 	if err != nil {
 		return err
@@ -160,6 +167,10 @@ func (cli *NetworkCli) CmdNetworkInfo(chain string, args ...string) error {
 	fmt.Fprintf(cli.out, "Network Id: %s\n", networkResource.ID)
 	fmt.Fprintf(cli.out, "Name: %s\n", networkResource.Name)
 	fmt.Fprintf(cli.out, "Type: %s\n", networkResource.Type)
+	fmt.Fprintf(cli.out, "Internal: %t\n", networkResource.Internal)
+	for k, v := range networkResource.Labels {
+		fmt.Fprintf(cli.out, "Label: %s=%s\n", k, v)
+	}
 	if networkResource.Services != nil {
 		for _, serviceResource := range networkResource.Services {
 			fmt.Fprintf(cli.out, "  Service Id: %s\n", serviceResource.ID)
@@ -219,6 +230,30 @@ func lookupNetworkID(cli *NetworkCli, nameID string) (string, error) {
 	return list[0].ID, nil
 }
 
+// labelOpts collects the key=value label pairs passed through repeated flags
+type labelOpts map[string]string
+
+func (l labelOpts) String() string {
+	var labels []string
+	for k, v := range l {
+		labels = append(labels, k+"="+v)
+	}
+	return strings.Join(labels, ",")
+}
+
+func (l labelOpts) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if kv[0] == "" {
+		return fmt.Errorf("invalid label: %s", value)
+	}
+	if len(kv) == 1 {
+		l[kv[0]] = ""
+		return nil
+	}
+	l[kv[0]] = kv[1]
+	return nil
+}
+
 func networkUsage(chain string) string {
 	help := "Commands:\n"
 
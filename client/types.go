@@ -11,6 +11,8 @@ type networkResource struct {
 	Name     string             `json:"name"`
 	ID       string             `json:"id"`
 	Type     string             `json:"type"`
+	Labels   map[string]string  `json:"labels"`
+	Internal bool               `json:"internal"`
 	Services []*serviceResource `json:"services"`
 }
 
@@ -36,6 +38,8 @@ type SandboxResource struct {
 type networkCreate struct {
 	Name        string                 `json:"name"`
 	NetworkType string                 `json:"network_type"`
+	Labels      map[string]string      `json:"labels"`
+	Internal    bool                   `json:"internal"`
 	Options     map[string]interface{} `json:"options"`
 }
 
@@ -6,10 +6,13 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/docker/pkg/term"
+	"github.com/docker/libnetwork"
 	"github.com/docker/libnetwork/client"
 )
 
@@ -31,6 +34,24 @@ var (
 		containerRmCommand,
 	}
 
+	eventsCommand = cli.Command{
+		Name:   "events",
+		Usage:  "Stream network, endpoint and sandbox events",
+		Action: runEvents,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "type, t",
+				Value: &cli.StringSlice{},
+				Usage: "Only show events of this type",
+			},
+			cli.StringSliceFlag{
+				Name:  "network, n",
+				Value: &cli.StringSlice{},
+				Usage: "Only show events for this network name or id",
+			},
+		},
+	}
+
 	dnetCommands = []cli.Command{
 		createDockerCommand("network"),
 		createDockerCommand("service"),
@@ -39,6 +60,7 @@ var (
 			Usage:       "Container management commands",
 			Subcommands: containerCommands,
 		},
+		eventsCommand,
 	}
 )
 
@@ -98,6 +120,48 @@ func runContainerRm(c *cli.Context) {
 	}
 }
 
+func runEvents(c *cli.Context) {
+	q := url.Values{}
+	for _, t := range c.StringSlice("type") {
+		q.Add("type", t)
+	}
+	for _, n := range c.StringSlice("network") {
+		q.Add("network", n)
+	}
+	path := "/events"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	stream, _, _, err := epConn.httpCall("GET", path, nil, nil)
+	if err != nil {
+		fmt.Printf("GET failed during events: %v\n", err)
+		os.Exit(1)
+	}
+	defer stream.Close()
+
+	dec := json.NewDecoder(stream)
+	for {
+		var ev libnetwork.Event
+		if err := dec.Decode(&ev); err != nil {
+			if err != io.EOF {
+				fmt.Printf("Failed to decode event: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		fmt.Printf("%s %s network=%s endpoint=%s sandbox=%s", ev.Time.Format(time.RFC3339Nano),
+			ev.Type, ev.NetworkName, ev.Endpoint, ev.SandboxID)
+		if ev.Address != "" {
+			fmt.Printf(" address=%s", ev.Address)
+		}
+		if ev.Error != "" {
+			fmt.Printf(" error=%q", ev.Error)
+		}
+		fmt.Printf("\n")
+	}
+}
+
 func runDockerCommand(c *cli.Context, cmd string) {
 	_, stdout, stderr := term.StdStreams()
 	oldcli := client.NewNetworkCli(stdout, stderr, epConn.httpCall)
@@ -234,6 +234,10 @@ func (d *dnetConnection) dnetDaemon(cfgFile string) error {
 	post.Methods("GET", "PUT", "POST", "DELETE").HandlerFunc(httpHandler)
 	post = r.PathPrefix("/sandboxes").Subrouter()
 	post.Methods("GET", "PUT", "POST", "DELETE").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/{.*}/events").Subrouter()
+	post.Methods("GET").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/events").Subrouter()
+	post.Methods("GET").HandlerFunc(httpHandler)
 
 	handleSignals(controller)
 	setupDumpStackTrap()
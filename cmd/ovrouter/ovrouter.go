@@ -70,6 +70,10 @@ func (ep *endpoint) AddressIPv6() *net.IPNet {
 	return nil
 }
 
+func (ep *endpoint) Addresses() []*net.IPNet {
+	return nil
+}
+
 func (ep *endpoint) InterfaceName() driverapi.InterfaceNameInfo {
 	return ep
 }
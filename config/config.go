@@ -2,6 +2,7 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	log "github.com/Sirupsen/logrus"
@@ -9,6 +10,7 @@ import (
 	"github.com/docker/libkv/store"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/portallocator"
 )
 
 // Config encapsulates configurations of various Libnetwork components
@@ -26,6 +28,16 @@ type DaemonCfg struct {
 	DefaultDriver  string
 	Labels         []string
 	DriverCfg      map[string]interface{}
+	// FirewallBackend selects the backend the drivers program their
+	// packet filtering rules with, iptables or nftables
+	FirewallBackend string
+	// ReconcileInterval is the period the state the drivers program in
+	// the host is reconciled at; a negative interval disables the
+	// periodic runs, leaving only the one at startup
+	ReconcileInterval time.Duration
+	// PortAllocator configures the dynamic ranges and the excluded ports
+	// of the host ports pools, per host address
+	PortAllocator portallocator.Config
 }
 
 // ClusterCfg represents cluster configuration
@@ -80,6 +92,59 @@ func OptionDefaultDriver(dd string) Option {
 	}
 }
 
+// OptionFirewallBackend function returns an option setter for the firewall backend
+func OptionFirewallBackend(backend string) Option {
+	return func(c *Config) {
+		log.Infof("Option FirewallBackend: %s", backend)
+		c.Daemon.FirewallBackend = strings.TrimSpace(backend)
+	}
+}
+
+// OptionReconcileInterval function returns an option setter for the period of the drivers reconciliation
+func OptionReconcileInterval(interval time.Duration) Option {
+	return func(c *Config) {
+		log.Infof("Option ReconcileInterval: %s", interval)
+		c.Daemon.ReconcileInterval = interval
+	}
+}
+
+// OptionDynamicPortRange function returns an option setter for the range the host
+// ports are dynamically allocated from, on the host address or on all of them when empty
+func OptionDynamicPortRange(hostIP string, begin, end int) Option {
+	return func(c *Config) {
+		log.Infof("Option DynamicPortRange: %s %d-%d", hostIP, begin, end)
+		updateHostPortConfig(c, hostIP, func(hc *portallocator.HostConfig) {
+			hc.DynamicRange = portallocator.PortRange{Begin: begin, End: end}
+		})
+	}
+}
+
+// OptionExcludedPorts function returns an option setter for the host ports which are
+// never allocated, on the host address or on all of them when empty
+func OptionExcludedPorts(hostIP string, ports ...portallocator.PortRange) Option {
+	return func(c *Config) {
+		log.Infof("Option ExcludedPorts: %s %v", hostIP, ports)
+		updateHostPortConfig(c, hostIP, func(hc *portallocator.HostConfig) {
+			hc.Excluded = append(hc.Excluded, ports...)
+		})
+	}
+}
+
+func updateHostPortConfig(c *Config, hostIP string, update func(*portallocator.HostConfig)) {
+	hostIP = strings.TrimSpace(hostIP)
+	if hostIP == "" {
+		update(&c.Daemon.PortAllocator.Default)
+		return
+	}
+
+	if c.Daemon.PortAllocator.Hosts == nil {
+		c.Daemon.PortAllocator.Hosts = make(map[string]portallocator.HostConfig)
+	}
+	hc := c.Daemon.PortAllocator.Hosts[hostIP]
+	update(&hc)
+	c.Daemon.PortAllocator.Hosts[hostIP] = hc
+}
+
 // OptionDriverConfig returns an option setter for driver configuration.
 func OptionDriverConfig(networkType string, config map[string]interface{}) Option {
 	return func(c *Config) {
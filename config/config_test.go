@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/portallocator"
 	_ "github.com/docker/libnetwork/testutils"
 )
 
@@ -42,6 +43,24 @@ func TestOptionsLabels(t *testing.T) {
 	}
 }
 
+func TestOptionsPortAllocator(t *testing.T) {
+	c := &Config{}
+	OptionDynamicPortRange("", 40000, 40999)(c)
+	OptionExcludedPorts("", portallocator.PortRange{Begin: 22, End: 22})(c)
+	OptionDynamicPortRange("10.0.0.1", 50000, 50999)(c)
+	OptionExcludedPorts("10.0.0.1", portallocator.PortRange{Begin: 8000, End: 8099})(c)
+	OptionExcludedPorts("10.0.0.1", portallocator.PortRange{Begin: 9000, End: 9000})(c)
+
+	pc := c.Daemon.PortAllocator
+	if pc.Default.DynamicRange != (portallocator.PortRange{Begin: 40000, End: 40999}) || len(pc.Default.Excluded) != 1 {
+		t.Fatalf("Unexpected default host ports configuration %v", pc.Default)
+	}
+	hc, ok := pc.Hosts["10.0.0.1"]
+	if !ok || hc.DynamicRange != (portallocator.PortRange{Begin: 50000, End: 50999}) || len(hc.Excluded) != 2 {
+		t.Fatalf("Unexpected host ports configuration %v", pc.Hosts)
+	}
+}
+
 func TestValidName(t *testing.T) {
 	if !IsValidName("test") {
 		t.Fatal("Name validation fails for a name that must be accepted")
@@ -0,0 +1,363 @@
+// Package conntrack lists, creates and deletes the entries of the connection tracking
+// table of the kernel through ctnetlink. The calls act on the network
+// namespace of the invoking thread.
+package conntrack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Netlink interface of the connection tracking, as defined in
+// linux/netfilter/nfnetlink.h and linux/netfilter/nfnetlink_conntrack.h
+const (
+	nfnlSubsysCtnetlink = 1
+
+	ipctnlMsgCtNew    = 0
+	ipctnlMsgCtGet    = 1
+	ipctnlMsgCtDelete = 2
+
+	ctaTupleOrig  = 1
+	ctaTupleReply = 2
+	ctaTimeout    = 7
+	ctaZone       = 18
+
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	ctaIPv4Src = 1
+	ctaIPv4Dst = 2
+	ctaIPv6Src = 3
+	ctaIPv6Dst = 4
+
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	nlaFNested = 1 << 15
+	nlaTypeMsk = 1<<14 - 1
+)
+
+// Tuple is one direction of a tracked connection.
+type Tuple struct {
+	Src     net.IP
+	Dst     net.IP
+	SrcPort uint16
+	DstPort uint16
+}
+
+// Flow is an entry of the connection tracking table. The reply tuple of the
+// connections which are translated differs from the inverse of the original
+// one: the reply of a destination nat flow comes from the translated address.
+type Flow struct {
+	Family   int
+	Protocol types.Protocol
+	Original Tuple
+	Reply    Tuple
+	Zone     uint16
+}
+
+func (t Tuple) String() string {
+	return fmt.Sprintf("%s:%d->%s:%d", t.Src, t.SrcPort, t.Dst, t.DstPort)
+}
+
+func (f Flow) String() string {
+	return fmt.Sprintf("%s %s reply %s", f.Protocol, f.Original, f.Reply)
+}
+
+// hasIP tells whether the address is one of the tuples of the flow.
+func (f Flow) hasIP(ip net.IP) bool {
+	return f.Original.Src.Equal(ip) || f.Original.Dst.Equal(ip) ||
+		f.Reply.Src.Equal(ip) || f.Reply.Dst.Equal(ip)
+}
+
+// Error is the error of a ctnetlink request
+type Error struct {
+	Op  string
+	Err error
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("failed to %s: %v", e.Op, e.Err)
+}
+
+// IsNotSupported tells whether the error is the one of a kernel without the
+// connection tracking netlink interface.
+func IsNotSupported(err error) bool {
+	if e, ok := err.(Error); ok {
+		err = e.Err
+	}
+	return err == syscall.EPROTONOSUPPORT || err == syscall.EOPNOTSUPP
+}
+
+// nfgenmsg is the header of the netfilter netlink messages.
+type nfgenmsg struct {
+	family uint8
+}
+
+func (m *nfgenmsg) Len() int {
+	return 4
+}
+
+func (m *nfgenmsg) Serialize() []byte {
+	return []byte{m.family, 0, 0, 0}
+}
+
+func newRequest(msgType, flags int, family int) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(nfnlSubsysCtnetlink<<8|msgType, flags)
+	req.AddData(&nfgenmsg{family: uint8(family)})
+	return req
+}
+
+// List returns the connection tracking entries of the address family,
+// syscall.AF_INET or syscall.AF_INET6.
+func List(family int) ([]Flow, error) {
+	req := newRequest(ipctnlMsgCtGet, syscall.NLM_F_DUMP, family)
+	msgs, err := req.Execute(syscall.NETLINK_NETFILTER, 0)
+	if err != nil {
+		return nil, Error{Op: "list the conntrack entries", Err: err}
+	}
+
+	var flows []Flow
+	for _, m := range msgs {
+		if len(m) < 4 {
+			continue
+		}
+		f, err := parseFlow(m[4:])
+		if err != nil {
+			return nil, err
+		}
+		f.Family = int(m[0])
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// Create adds a connection tracking entry for the flow, as the kernel does on
+// the first packet of a connection, which expires after the timeout.
+func Create(f Flow, timeout time.Duration) error {
+	req := newRequest(ipctnlMsgCtNew, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK, f.Family)
+	req.AddData(tupleAttr(ctaTupleOrig, f.Protocol, f.Original))
+	req.AddData(tupleAttr(ctaTupleReply, f.Protocol, f.Reply))
+	req.AddData(nl.NewRtAttr(ctaTimeout, be32(uint32(timeout/time.Second))))
+	if f.Zone != 0 {
+		req.AddData(nl.NewRtAttr(ctaZone, be16(f.Zone)))
+	}
+	if _, err := req.Execute(syscall.NETLINK_NETFILTER, 0); err != nil {
+		return Error{Op: "create conntrack entry " + f.String(), Err: err}
+	}
+	return nil
+}
+
+// Delete deletes the connection tracking entry of the flow. Deleting an
+// entry which no longer exists is not an error.
+func Delete(f Flow) error {
+	req := newRequest(ipctnlMsgCtDelete, syscall.NLM_F_ACK, f.Family)
+	req.AddData(tupleAttr(ctaTupleOrig, f.Protocol, f.Original))
+	if f.Zone != 0 {
+		req.AddData(nl.NewRtAttr(ctaZone, be16(f.Zone)))
+	}
+	if _, err := req.Execute(syscall.NETLINK_NETFILTER, 0); err != nil && err != syscall.ENOENT {
+		return Error{Op: "delete conntrack entry " + f.String(), Err: err}
+	}
+	return nil
+}
+
+// DeleteMatching deletes the connection tracking entries of both address
+// families the function selects, and returns how many were deleted.
+func DeleteMatching(match func(Flow) bool) (int, error) {
+	return deleteMatching([]int{syscall.AF_INET, syscall.AF_INET6}, match)
+}
+
+func deleteMatching(families []int, match func(Flow) bool) (int, error) {
+	deleted := 0
+	for _, family := range families {
+		flows, err := List(family)
+		if err != nil {
+			return deleted, err
+		}
+		for _, f := range flows {
+			if !match(f) {
+				continue
+			}
+			if err := Delete(f); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteForwardedTo deletes the entries of the flows of the protocol sent to
+// the host address and port whose replies come from the address and port,
+// that is the ones a destination nat forwarded from the former to the
+// latter, and returns how many were deleted. An unspecified host address
+// matches the flows sent to any address of the host.
+func DeleteForwardedTo(proto types.Protocol, hostIP net.IP, hostPort int, ip net.IP, port int) (int, error) {
+	anyHost := hostIP == nil || hostIP.IsUnspecified()
+	return DeleteMatching(func(f Flow) bool {
+		return f.Protocol == proto &&
+			(anyHost || f.Original.Dst.Equal(hostIP)) && int(f.Original.DstPort) == hostPort &&
+			f.Reply.Src.Equal(ip) && int(f.Reply.SrcPort) == port
+	})
+}
+
+// DeleteByIP deletes the entries of the flows from or to the addresses, on
+// either side of an address translation, and returns how many were deleted.
+// The table is listed once for each address family of the addresses.
+func DeleteByIP(ips ...net.IP) (int, error) {
+	var (
+		families []int
+		v4, v6   bool
+	)
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = true
+		} else if ip != nil {
+			v6 = true
+		}
+	}
+	if v4 {
+		families = append(families, syscall.AF_INET)
+	}
+	if v6 {
+		families = append(families, syscall.AF_INET6)
+	}
+
+	return deleteMatching(families, func(f Flow) bool {
+		for _, ip := range ips {
+			if ip != nil && f.hasIP(ip) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// FlushReleasedIPs deletes the entries of the flows of the addresses
+// released by an endpoint, for the flows of the former container not to
+// reach the next one an address is given to. The failures are logged, as
+// they do not prevent the release.
+func FlushReleasedIPs(ips ...net.IP) {
+	n, err := DeleteByIP(ips...)
+	if err != nil {
+		if !IsNotSupported(err) {
+			logrus.Warnf("Failed to flush the conntrack entries of %v: %v", ips, err)
+		}
+		return
+	}
+	if n > 0 {
+		logrus.Debugf("Flushed %d conntrack entries of %v", n, ips)
+	}
+}
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func tupleAttr(typ int, proto types.Protocol, t Tuple) *nl.RtAttr {
+	attr := nl.NewRtAttr(typ|nlaFNested, nil)
+	ip := nl.NewRtAttrChild(attr, ctaTupleIP|nlaFNested, nil)
+	if src := t.Src.To4(); src != nil {
+		nl.NewRtAttrChild(ip, ctaIPv4Src, src)
+		nl.NewRtAttrChild(ip, ctaIPv4Dst, t.Dst.To4())
+	} else {
+		nl.NewRtAttrChild(ip, ctaIPv6Src, t.Src.To16())
+		nl.NewRtAttrChild(ip, ctaIPv6Dst, t.Dst.To16())
+	}
+	p := nl.NewRtAttrChild(attr, ctaTupleProto|nlaFNested, nil)
+	nl.NewRtAttrChild(p, ctaProtoNum, []byte{uint8(proto)})
+	if proto == types.TCP || proto == types.UDP || proto == types.SCTP {
+		nl.NewRtAttrChild(p, ctaProtoSrcPort, be16(t.SrcPort))
+		nl.NewRtAttrChild(p, ctaProtoDstPort, be16(t.DstPort))
+	}
+	return attr
+}
+
+func parseAttrs(b []byte) (map[uint16][]byte, error) {
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse conntrack entry: %v", err)
+	}
+	m := make(map[uint16][]byte, len(attrs))
+	for _, a := range attrs {
+		m[a.Attr.Type&nlaTypeMsk] = a.Value
+	}
+	return m, nil
+}
+
+func parseFlow(b []byte) (Flow, error) {
+	var f Flow
+
+	attrs, err := parseAttrs(b)
+	if err != nil {
+		return f, err
+	}
+	if f.Protocol, f.Original, err = parseTuple(attrs[ctaTupleOrig]); err != nil {
+		return f, err
+	}
+	if _, f.Reply, err = parseTuple(attrs[ctaTupleReply]); err != nil {
+		return f, err
+	}
+	if z, ok := attrs[ctaZone]; ok && len(z) == 2 {
+		f.Zone = binary.BigEndian.Uint16(z)
+	}
+	return f, nil
+}
+
+func parseTuple(b []byte) (types.Protocol, Tuple, error) {
+	var (
+		t     Tuple
+		proto types.Protocol
+	)
+
+	attrs, err := parseAttrs(b)
+	if err != nil {
+		return proto, t, err
+	}
+
+	ip, err := parseAttrs(attrs[ctaTupleIP])
+	if err != nil {
+		return proto, t, err
+	}
+	for typ, v := range ip {
+		switch typ {
+		case ctaIPv4Src, ctaIPv6Src:
+			t.Src = net.IP(v)
+		case ctaIPv4Dst, ctaIPv6Dst:
+			t.Dst = net.IP(v)
+		}
+	}
+
+	p, err := parseAttrs(attrs[ctaTupleProto])
+	if err != nil {
+		return proto, t, err
+	}
+	if v, ok := p[ctaProtoNum]; ok && len(v) == 1 {
+		proto = types.Protocol(v[0])
+	}
+	if v, ok := p[ctaProtoSrcPort]; ok && len(v) == 2 {
+		t.SrcPort = binary.BigEndian.Uint16(v)
+	}
+	if v, ok := p[ctaProtoDstPort]; ok && len(v) == 2 {
+		t.DstPort = binary.BigEndian.Uint16(v)
+	}
+
+	return proto, t, nil
+}
@@ -0,0 +1,130 @@
+package conntrack
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+)
+
+func createFlow(t *testing.T, f Flow) {
+	if err := Create(f, 2*time.Minute); err != nil {
+		if IsNotSupported(err) {
+			t.Skipf("conntrack netlink interface is not supported: %v", err)
+		}
+		t.Fatal(err)
+	}
+}
+
+func udpFlow(client, host, container string, hostPort, containerPort uint16) Flow {
+	c := net.ParseIP(client)
+	return Flow{
+		Family:   syscall.AF_INET,
+		Protocol: types.UDP,
+		Original: Tuple{Src: c, Dst: net.ParseIP(host), SrcPort: 40000, DstPort: hostPort},
+		Reply:    Tuple{Src: net.ParseIP(container), Dst: c, SrcPort: containerPort, DstPort: 40000},
+	}
+}
+
+func listFlows(t *testing.T) []Flow {
+	flows, err := List(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flows
+}
+
+func TestDeleteForwardedTo(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	dns := udpFlow("10.0.0.1", "192.168.1.1", "172.17.0.2", 53, 53)
+	syslog := udpFlow("10.0.0.1", "192.168.1.1", "172.17.0.3", 514, 514)
+	createFlow(t, dns)
+	createFlow(t, syslog)
+
+	flows := listFlows(t)
+	if len(flows) != 2 {
+		t.Fatalf("Expected 2 conntrack entries, got %v", flows)
+	}
+	for _, f := range flows {
+		if f.Protocol != types.UDP || !f.Original.Dst.Equal(net.ParseIP("192.168.1.1")) || f.Original.SrcPort != 40000 {
+			t.Fatalf("Unexpected conntrack entry %s", f)
+		}
+	}
+
+	host := net.ParseIP("192.168.1.1")
+	n, err := DeleteForwardedTo(types.UDP, host, 53, net.ParseIP("172.17.0.2"), 53)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 deleted entry, got %d", n)
+	}
+	if flows = listFlows(t); len(flows) != 1 || !flows[0].Reply.Src.Equal(net.ParseIP("172.17.0.3")) {
+		t.Fatalf("Expected the syslog entry only, got %v", flows)
+	}
+
+	// Neither another protocol, another port nor another host address match
+	if n, err = DeleteForwardedTo(types.TCP, host, 514, net.ParseIP("172.17.0.3"), 514); err != nil || n != 0 {
+		t.Fatalf("Expected no deleted entry, got %d: %v", n, err)
+	}
+	if n, err = DeleteForwardedTo(types.UDP, host, 514, net.ParseIP("172.17.0.3"), 53); err != nil || n != 0 {
+		t.Fatalf("Expected no deleted entry, got %d: %v", n, err)
+	}
+	if n, err = DeleteForwardedTo(types.UDP, host, 5514, net.ParseIP("172.17.0.3"), 514); err != nil || n != 0 {
+		t.Fatalf("Expected no deleted entry, got %d: %v", n, err)
+	}
+	if n, err = DeleteForwardedTo(types.UDP, net.ParseIP("192.168.1.2"), 514, net.ParseIP("172.17.0.3"), 514); err != nil || n != 0 {
+		t.Fatalf("Expected no deleted entry, got %d: %v", n, err)
+	}
+
+	// The unspecified host address matches any of them
+	if n, err = DeleteForwardedTo(types.UDP, net.IPv4zero, 514, net.ParseIP("172.17.0.3"), 514); err != nil || n != 1 {
+		t.Fatalf("Expected 1 deleted entry, got %d: %v", n, err)
+	}
+
+	// Deleting a flow which is already gone succeeds
+	if err := Delete(dns); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteByIP(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	createFlow(t, udpFlow("10.0.0.1", "192.168.1.1", "172.17.0.2", 53, 53))
+	createFlow(t, udpFlow("172.17.0.2", "8.8.8.8", "8.8.8.8", 53, 53))
+	createFlow(t, udpFlow("10.0.0.1", "192.168.1.1", "172.17.0.3", 514, 514))
+
+	n, err := DeleteByIP(net.ParseIP("172.17.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 deleted entries, got %d", n)
+	}
+	if flows := listFlows(t); len(flows) != 1 || !flows[0].Reply.Src.Equal(net.ParseIP("172.17.0.3")) {
+		t.Fatalf("Expected the entry of the other address only, got %v", flows)
+	}
+
+	// The addresses of an endpoint are deleted together, the nil ones ignored
+	createFlow(t, udpFlow("172.17.0.4", "8.8.8.8", "8.8.8.8", 53, 53))
+	n, err = DeleteByIP(net.ParseIP("172.17.0.3"), nil, net.ParseIP("172.17.0.4"), net.ParseIP("fe90::2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 deleted entries, got %d", n)
+	}
+	if flows := listFlows(t); len(flows) != 0 {
+		t.Fatalf("Expected no entry left, got %v", flows)
+	}
+
+	// Nothing is listed without an address
+	if n, err = DeleteByIP(); err != nil || n != 0 {
+		t.Fatalf("Expected no deleted entry, got %d: %v", n, err)
+	}
+}
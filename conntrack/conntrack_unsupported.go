@@ -0,0 +1,9 @@
+// +build !linux
+
+package conntrack
+
+import "net"
+
+// FlushReleasedIPs does nothing, as there is no connection tracking to flush.
+func FlushReleasedIPs(ips ...net.IP) {
+}
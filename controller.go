@@ -60,6 +60,7 @@ import (
 	"github.com/docker/libnetwork/hostdiscovery"
 	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/portallocator"
 	"github.com/docker/libnetwork/types"
 )
 
@@ -88,6 +89,10 @@ type NetworkController interface {
 	// NetworkByID returns the Network which has the passed id. If not found, the error ErrNoSuchNetwork is returned.
 	NetworkByID(id string) (Network, error)
 
+	// NetworksByLabel returns the list of Network(s) whose labels match the passed selector.
+	// The selector is either a label key or a key=value pair.
+	NetworksByLabel(selector string) []Network
+
 	// NewSandbox cretes a new network sandbox for the passed container id
 	NewSandbox(containerID string, options ...SandboxOption) (Sandbox, error)
 
@@ -100,6 +105,13 @@ type NetworkController interface {
 	// SandboxByID returns the Sandbox which has the passed id. If not found, a types.NotFoundError is returned.
 	SandboxByID(id string) (Sandbox, error)
 
+	// Drift returns the drift the last reconciliation of the drivers state found and corrected
+	Drift() DriftReport
+
+	// Subscribe returns a channel on which the lifecycle events selected by the passed filter
+	// are delivered, and a function which cancels the subscription and closes the channel.
+	Subscribe(filter EventFilter) (<-chan Event, func())
+
 	// Stop network controller
 	Stop()
 }
@@ -142,7 +154,10 @@ type controller struct {
 	extKeyListener net.Listener
 	watchCh        chan *endpoint
 	unWatchCh      chan *endpoint
-	svcDb          map[string]svcMap
+	svcDb          map[string]*svcInfo
+	events         eventBroadcaster
+	drift          DriftReport
+	stopReconcile  chan struct{}
 	sync.Mutex
 }
 
@@ -167,13 +182,18 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 		sandboxes:   sandboxTable{},
 		drivers:     driverTable{},
 		ipamDrivers: ipamTable{},
-		svcDb:       make(map[string]svcMap),
+		svcDb:       make(map[string]*svcInfo),
 	}
 
 	if err := c.initStores(); err != nil {
 		return nil, err
 	}
 
+	if err := portallocator.Get().Configure(cfg.Daemon.PortAllocator); err != nil {
+		return nil, err
+	}
+	c.initPortAllocator()
+
 	if cfg != nil && cfg.Cluster.Watcher != nil {
 		if err := c.initDiscovery(cfg.Cluster.Watcher); err != nil {
 			// Failing to initalize discovery is a bad situation to be in.
@@ -191,6 +211,14 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 		return nil, err
 	}
 
+	if err := c.sandboxRestore(); err != nil {
+		log.Warnf("Failed to restore sandboxes: %v", err)
+	}
+
+	c.reconcilePortAllocations()
+
+	c.startReconciler()
+
 	if err := c.startExternalKeyListener(); err != nil {
 		return nil, err
 	}
@@ -290,6 +318,10 @@ func (c *controller) RegisterDriver(networkType string, driver driverapi.Driver,
 		c.pushNodeDiscovery(dData, hd.Fetch(), true)
 	}
 
+	if r, ok := driver.(driverapi.Restorer); ok {
+		c.restoreDriver(networkType, r)
+	}
+
 	return nil
 }
 
@@ -339,7 +371,12 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 
 	// Make sure we have a driver available for this network type
 	// before we allocate anything.
-	if _, err := network.driver(); err != nil {
+	d, err := network.driver()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePolicy(d, network.policy); err != nil {
 		return nil, err
 	}
 
@@ -365,6 +402,14 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 		err = c.addNetwork(network)
 	})
 	if err != nil {
+		c.publishEvent(driverErrorEvent(network, "", err))
+		return nil, err
+	}
+
+	if err = network.programPolicy(); err != nil {
+		if e := network.deleteNetwork(); e != nil {
+			log.Warnf("couldnt cleanup network %s on network policy failure (%v): %v", network.name, err, e)
+		}
 		return nil, err
 	}
 
@@ -376,6 +421,8 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 		return nil, err
 	}
 
+	c.publishEvent(networkEvent(EventNetworkCreate, network))
+
 	return network, nil
 }
 
@@ -452,6 +499,18 @@ func (c *controller) NetworkByID(id string) (Network, error) {
 	return n, nil
 }
 
+func (c *controller) NetworksByLabel(selector string) []Network {
+	var list []Network
+
+	for _, n := range c.Networks() {
+		if matchLabel(n.Labels(), selector) {
+			list = append(list, n)
+		}
+	}
+
+	return list
+}
+
 // NewSandbox creates a new sandbox for the passed container id
 func (c *controller) NewSandbox(containerID string, options ...SandboxOption) (Sandbox, error) {
 	var err error
@@ -487,6 +546,12 @@ func (c *controller) NewSandbox(containerID string, options ...SandboxOption) (S
 
 	sb.processOptions(options...)
 
+	defer func() {
+		if err != nil {
+			sb.removeResolutionFiles()
+		}
+	}()
+
 	if err = sb.setupResolutionFiles(); err != nil {
 		return nil, err
 	}
@@ -495,11 +560,32 @@ func (c *controller) NewSandbox(containerID string, options ...SandboxOption) (S
 		if sb.osSbox, err = osl.NewSandbox(sb.Key(), !sb.config.useDefaultSandBox); err != nil {
 			return nil, fmt.Errorf("failed to create new osl sandbox: %v", err)
 		}
+		// The osl sandbox created here is not shared with another sandbox yet
+		defer func() {
+			if err != nil {
+				if err := sb.osSbox.Destroy(); err != nil {
+					log.Warnf("Failed to destroy the osl sandbox of sandbox %s: %v", sb.id, err)
+				}
+			}
+		}()
 	}
 
 	c.Lock()
 	c.sandboxes[sb.id] = sb
 	c.Unlock()
+	defer func() {
+		if err != nil {
+			c.Lock()
+			delete(c.sandboxes, sb.id)
+			c.Unlock()
+		}
+	}()
+
+	if err = sb.storeUpdate(); err != nil {
+		return nil, fmt.Errorf("updating the store state of sandbox failed: %v", err)
+	}
+
+	c.publishEvent(sandboxEvent(EventSandboxCreate, sb))
 
 	return sb, nil
 }
@@ -559,6 +645,31 @@ func SandboxKeyWalker(out *Sandbox, key string) SandboxWalker {
 	}
 }
 
+// matchLabel returns whether the passed labels satisfy the selector, which
+// is either a label key or a key=value pair
+func matchLabel(labels map[string]string, selector string) bool {
+	kv := strings.SplitN(selector, "=", 2)
+	v, ok := labels[kv[0]]
+	if !ok {
+		return false
+	}
+	if len(kv) == 1 {
+		return true
+	}
+	return v == kv[1]
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	return cp
+}
+
 func (c *controller) loadDriver(networkType string) (*driverData, error) {
 	// Plugins pkg performs lazy loading of plugins that acts as remote drivers.
 	// As per the design, this Get call will result in remote driver discovery if there is a corresponding plugin available.
@@ -614,6 +725,8 @@ func (c *controller) getIpamDriver(name string) (ipamapi.Ipam, error) {
 }
 
 func (c *controller) Stop() {
+	c.stopReconciler()
+	c.closeSubscribers()
 	c.closeStores()
 	c.stopExternalKeyListener()
 	osl.GC()
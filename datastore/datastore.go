@@ -117,6 +117,8 @@ const (
 	NetworkKeyPrefix = "network"
 	// EndpointKeyPrefix is the prefix for endpoint key in the kv store
 	EndpointKeyPrefix = "endpoint"
+	// SandboxKeyPrefix is the prefix for sandbox key in the kv store
+	SandboxKeyPrefix = "sandbox"
 )
 
 var (
@@ -198,12 +200,15 @@ func newClient(scope string, kv string, addrs string, config *store.Config, cach
 	if config == nil {
 		config = &store.Config{}
 	}
-	store, err := libkv.NewStore(store.Backend(kv), []string{addrs}, config)
+	kvStore, err := libkv.NewStore(store.Backend(kv), []string{addrs}, config)
 	if err != nil {
 		return nil, err
 	}
+	if store.Backend(kv) == store.BOLTDB {
+		kvStore = newSequentialStore(kvStore)
+	}
 
-	ds := &datastore{scope: scope, store: store}
+	ds := &datastore{scope: scope, store: kvStore}
 	if cached {
 		ds.cache = newCache(ds)
 	}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"sync"
+
+	"github.com/docker/libkv/store"
+)
+
+// sequentialStore serializes the operations on a store whose returned values
+// are only valid until its next write, such as boltdb: a write growing the
+// database remaps it, and unmaps the values read before. The values are
+// copied before the next operation is let through.
+type sequentialStore struct {
+	store store.Store
+	sync.Mutex
+}
+
+func newSequentialStore(s store.Store) store.Store {
+	return &sequentialStore{store: s}
+}
+
+func copyPair(kvp *store.KVPair) *store.KVPair {
+	if kvp == nil {
+		return nil
+	}
+	value := make([]byte, len(kvp.Value))
+	copy(value, kvp.Value)
+	return &store.KVPair{Key: kvp.Key, Value: value, LastIndex: kvp.LastIndex}
+}
+
+func (s *sequentialStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.store.Put(key, value, options)
+}
+
+func (s *sequentialStore) Get(key string) (*store.KVPair, error) {
+	s.Lock()
+	defer s.Unlock()
+	kvp, err := s.store.Get(key)
+	return copyPair(kvp), err
+}
+
+func (s *sequentialStore) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.store.Delete(key)
+}
+
+func (s *sequentialStore) Exists(key string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.store.Exists(key)
+}
+
+func (s *sequentialStore) Watch(key string, stopCh <-chan struct{}) (<-chan *store.KVPair, error) {
+	return s.store.Watch(key, stopCh)
+}
+
+func (s *sequentialStore) WatchTree(directory string, stopCh <-chan struct{}) (<-chan []*store.KVPair, error) {
+	return s.store.WatchTree(directory, stopCh)
+}
+
+func (s *sequentialStore) NewLock(key string, options *store.LockOptions) (store.Locker, error) {
+	return s.store.NewLock(key, options)
+}
+
+func (s *sequentialStore) List(directory string) ([]*store.KVPair, error) {
+	s.Lock()
+	defer s.Unlock()
+	kvList, err := s.store.List(directory)
+	for i, kvp := range kvList {
+		kvList[i] = copyPair(kvp)
+	}
+	return kvList, err
+}
+
+func (s *sequentialStore) DeleteTree(directory string) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.store.DeleteTree(directory)
+}
+
+func (s *sequentialStore) AtomicPut(key string, value []byte, previous *store.KVPair, options *store.WriteOptions) (bool, *store.KVPair, error) {
+	s.Lock()
+	defer s.Unlock()
+	ok, kvp, err := s.store.AtomicPut(key, value, previous, options)
+	return ok, copyPair(kvp), err
+}
+
+func (s *sequentialStore) AtomicDelete(key string, previous *store.KVPair) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.store.AtomicDelete(key, previous)
+}
+
+func (s *sequentialStore) Close() {
+	s.Lock()
+	defer s.Unlock()
+	s.store.Close()
+}
@@ -0,0 +1,58 @@
+package datastore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+func TestSequentialStoreValues(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "datastore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	ds, err := NewDataStore(GlobalScope, &ScopeCfg{
+		Client: ScopeClientCfg{
+			Provider: "boltdb",
+			Address:  tmp.Name(),
+			Config: &store.Config{
+				Bucket:            "libnetwork",
+				ConnectionTimeout: 3 * time.Second,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	kv := ds.KVStore()
+	value := []byte("value")
+	if err := kv.Put("key", value, nil); err != nil {
+		t.Fatal(err)
+	}
+	kvp, err := kv.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvList, err := kv.List("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Grow the database for it to be remapped
+	if err := kv.Put("large", make([]byte, 1<<20), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(kvp.Value, value) || len(kvList) != 1 || !bytes.Equal(kvList[0].Value, value) {
+		t.Fatalf("Unexpected values %q and %v after a write", kvp.Value, kvList)
+	}
+}
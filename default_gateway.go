@@ -21,6 +21,9 @@ const (
    If a driver can't provide external connectivity it can choose to not set
    the GW IP for the endpoint.
 
+   Endpoints on internal networks never trigger the attachment to the
+   GW_bridge network, as they must not have external connectivity.
+
    endpoint on the GW_bridge network is managed dynamically by libnetwork.
    ie:
    - its created when an endpoint without GW joins the container
@@ -121,8 +124,12 @@ func (sb *sandbox) needDefaultGW() bool {
 		if ep.getNetwork().Type() == "null" || ep.getNetwork().Type() == "host" {
 			continue
 		}
+		// Internal networks are not meant to reach the outside world
+		if ep.getNetwork().Internal() {
+			continue
+		}
 		// TODO v6 needs to be handled.
-		if len(ep.Gateway()) > 0 {
+		if len(ep.Gateway()) > 0 || ep.hasConnectedDefaultRoute() {
 			return false
 		}
 		needGW = true
@@ -130,6 +137,23 @@ func (sb *sandbox) needDefaultGW() bool {
 	return needGW
 }
 
+// hasConnectedDefaultRoute returns whether the driver routes all the
+// traffic of the endpoint through its interface, with no gateway.
+func (ep *endpoint) hasConnectedDefaultRoute() bool {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.iface == nil {
+		return false
+	}
+	for _, r := range ep.iface.routes {
+		if ones, _ := r.Mask.Size(); ones == 0 && r.IP.To4() != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (sb *sandbox) getEndpointInGWNetwork() *endpoint {
 	for _, ep := range sb.getConnectedEndpoints() {
 		if ep.getNetwork().name == libnGWNetwork {
@@ -151,6 +175,9 @@ func (sb *sandbox) getEPwithoutGateway() *endpoint {
 		if ep.getNetwork().Type() == "null" || ep.getNetwork().Type() == "host" {
 			continue
 		}
+		if ep.getNetwork().Internal() {
+			continue
+		}
 		if len(ep.Gateway()) == 0 {
 			return ep
 		}
@@ -1,6 +1,10 @@
 package driverapi
 
-import "net"
+import (
+	"net"
+
+	"github.com/docker/libnetwork/types"
+)
 
 // NetworkPluginEndpointType represents the Endpoint Type used by Plugin system
 const NetworkPluginEndpointType = "NetworkDriver"
@@ -46,6 +50,70 @@ type Driver interface {
 	Type() string
 }
 
+// Restorer is an optional interface a driver can implement to be told about
+// the networks and endpoints which were created in a past life of libnetwork,
+// so that it can reconstruct its state when the controller reloads them from
+// the stores.
+type Restorer interface {
+	// RestoreNetwork invokes the driver method to restore a network passing
+	// the same network id, config and IPAM data it was created with.
+	RestoreNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []IPAMData) error
+
+	// RestoreEndpoint invokes the driver method to restore an endpoint
+	// passing the network id, endpoint id, the endpoint information as
+	// it was populated at creation time and the key of the sandbox the
+	// endpoint is joined to, if any.
+	RestoreEndpoint(nid, eid string, ifInfo InterfaceInfo, sboxKey string) error
+}
+
+// Reconciler is an optional interface a driver can implement to have the
+// state it programs in the host, such as the firewall rules, compared with
+// the live one at startup and periodically, so that the changes made behind
+// its back are undone.
+type Reconciler interface {
+	// Reconcile invokes the driver method to restore the missing state and
+	// remove the orphaned one, returning the drift it corrected.
+	Reconcile() ([]Drift, error)
+}
+
+// DriftKind tells whether a drifted state was missing or orphaned.
+type DriftKind string
+
+const (
+	// DriftMissing is a state the driver expects which was missing
+	DriftMissing DriftKind = "missing"
+	// DriftOrphan is a state the driver owns which it no longer expects
+	DriftOrphan DriftKind = "orphan"
+)
+
+// Drift is a difference Reconcile found between the expected and the live state.
+type Drift struct {
+	Kind DriftKind
+	// NetworkID is the network the state belongs to, empty when shared
+	NetworkID string
+	// Object describes the state, such as a firewall rule
+	Object string
+}
+
+// PolicyDriver is an optional interface a driver can implement to enforce
+// the policies of its networks.
+type PolicyDriver interface {
+	// ProgramPolicy invokes the driver method to replace the policy rules of
+	// the network passing the network id and the rules, in order of precedence.
+	// The traffic not matched by any rule is handled as it is without policy.
+	ProgramPolicy(nid string, rules []PolicyRule) error
+}
+
+// PolicyRule is a network policy rule resolved to the
+// ids of the endpoints it applies to.
+type PolicyRule struct {
+	Allow        bool
+	Sources      []string
+	Destinations []string
+	Proto        types.Protocol
+	Port         uint16
+}
+
 // InterfaceInfo provides a go interface for drivers to retrive
 // network information to interface resources.
 type InterfaceInfo interface {
@@ -66,6 +134,9 @@ type InterfaceInfo interface {
 
 	// AddressIPv6 returns the IPv6 address.
 	AddressIPv6() *net.IPNet
+
+	// Addresses returns the secondary IPv4 and IPv6 addresses.
+	Addresses() []*net.IPNet
 }
 
 // InterfaceNameInfo provides a go interface for the drivers to assign names
@@ -3,6 +3,7 @@ package libnetwork
 import (
 	"strings"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/ipamapi"
 	builtinIpam "github.com/docker/libnetwork/ipams/builtin"
@@ -52,6 +53,10 @@ func makeDriverConfig(c *controller, ntype string) map[string]interface{} {
 		return config
 	}
 
+	if c.cfg.Daemon.FirewallBackend != "" {
+		config[netlabel.FirewallBackend] = c.cfg.Daemon.FirewallBackend
+	}
+
 	for k, v := range c.cfg.Scopes {
 		if !v.IsValid() {
 			continue
@@ -62,9 +67,63 @@ func makeDriverConfig(c *controller, ntype string) map[string]interface{} {
 		config[netlabel.MakeKVProviderConfig(k)] = v.Client.Config
 	}
 
+	// The drivers share the datastore clients of the controller
+	for _, store := range c.getStores() {
+		config[netlabel.MakeKVClient(store.Scope())] = store
+	}
+
 	return config
 }
 
+// restoreDriver hands over to a driver implementing the driverapi.Restorer
+// interface the networks of its type and their endpoints found in the stores,
+// so that it can reconstruct the state it had in a past life of libnetwork.
+func (c *controller) restoreDriver(networkType string, r driverapi.Restorer) {
+	nl, err := c.getNetworksFromStore()
+	if err != nil {
+		log.Warnf("Could not retrieve networks from store to restore driver %s: %v", networkType, err)
+		return
+	}
+
+	sboxKeys := make(map[string]string)
+	sbsl, err := c.getSandboxStatesFromStore()
+	if err != nil {
+		log.Warnf("Could not retrieve sandboxes from store to restore driver %s: %v", networkType, err)
+	}
+	for _, sbs := range sbsl {
+		sboxKeys[sbs.ID] = sbs.OsKey
+	}
+
+	for _, n := range nl {
+		if n.Type() != networkType {
+			continue
+		}
+
+		// Once restored, the driver does not need
+		// to be told again about the network creation
+		var rerr error
+		n.drvOnce.Do(func() {
+			rerr = r.RestoreNetwork(n.ID(), n.generic, n.getIPv4Data(), n.getIPv6Data())
+		})
+		if rerr != nil {
+			log.Warnf("Driver %s failed to restore network %s (%s): %v", networkType, n.Name(), n.ID(), rerr)
+			continue
+		}
+
+		epl, err := n.getEndpointsFromStore()
+		if err != nil {
+			log.Warnf("Could not retrieve endpoints of network %s to restore driver %s: %v", n.Name(), networkType, err)
+			continue
+		}
+
+		for _, ep := range epl {
+			if err := r.RestoreEndpoint(n.ID(), ep.ID(), ep.Interface(), sboxKeys[ep.sandboxID]); err != nil {
+				log.Warnf("Driver %s failed to restore endpoint %s (%s): %v", networkType, ep.Name(), ep.ID(), err)
+			}
+		}
+	}
+}
+
 func initIpams(ic ipamapi.Callback, lDs, gDs interface{}) error {
 	for _, fn := range [](func(ipamapi.Callback, interface{}, interface{}) error){
 		builtinIpam.Init,
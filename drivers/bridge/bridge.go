@@ -16,12 +16,14 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/firewall"
 	"github.com/docker/libnetwork/ipallocator"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/portallocator"
 	"github.com/docker/libnetwork/portmapper"
 	"github.com/docker/libnetwork/types"
 	"github.com/vishvananda/netlink"
@@ -43,11 +45,16 @@ var (
 type configuration struct {
 	EnableIPForwarding  bool
 	EnableIPTables      bool
+	EnableIP6Tables     bool
 	EnableUserlandProxy bool
+	// UserlandProxyMode is how the userland proxies run when enabled:
+	// "process", the default, or "in-process"
+	UserlandProxyMode string
 }
 
 // networkConfiguration for network specific configuration
 type networkConfiguration struct {
+	ID                 string
 	BridgeName         string
 	AddressIPv4        *net.IPNet
 	FixedCIDR          *net.IPNet
@@ -60,6 +67,14 @@ type networkConfiguration struct {
 	DefaultGatewayIPv6 net.IP
 	DefaultBindingIP   net.IP
 	DefaultBridge      bool
+	Internal           bool
+	Policy             []driverapi.PolicyRule
+	// DynamicPortRange and ExcludedPorts configure the host ports pools
+	// of the default binding address of the network
+	DynamicPortRange portallocator.PortRange
+	ExcludedPorts    []portallocator.PortRange
+	dbIndex          uint64
+	dbExists         bool
 }
 
 // endpointConfiguration represents the user specified configuration for the sandbox endpoint
@@ -77,6 +92,7 @@ type containerConfiguration struct {
 
 type bridgeEndpoint struct {
 	id              string
+	nid             string
 	srcName         string
 	addr            *net.IPNet
 	addrv6          *net.IPNet
@@ -84,6 +100,8 @@ type bridgeEndpoint struct {
 	config          *endpointConfiguration // User specified parameters
 	containerConfig *containerConfiguration
 	portMapping     []types.PortBinding // Operation port bindings
+	dbIndex         uint64
+	dbExists        bool
 }
 
 type bridgeNetwork struct {
@@ -97,18 +115,30 @@ type bridgeNetwork struct {
 }
 
 type driver struct {
-	config      *configuration
-	network     *bridgeNetwork
-	natChain    *iptables.ChainInfo
-	filterChain *iptables.ChainInfo
-	networks    map[string]*bridgeNetwork
+	config        *configuration
+	network       *bridgeNetwork
+	firewall      firewall.Backend
+	firewallV6    firewall.Backend
+	natChain      firewall.Chain
+	filterChain   firewall.Chain
+	natChainV6    firewall.Chain
+	filterChainV6 firewall.Chain
+	networks      map[string]*bridgeNetwork
+	store         datastore.DataStore
+	// reconcileLock keeps the reconciliation from running while the
+	// operations programming the rules are in progress
+	reconcileLock sync.RWMutex
 	sync.Mutex
 }
 
 // New constructs a new bridge driver
 func newDriver() *driver {
 	ipAllocator = ipallocator.New()
-	return &driver{networks: map[string]*bridgeNetwork{}, config: &configuration{}}
+	d := &driver{networks: map[string]*bridgeNetwork{}, config: &configuration{}}
+	// The iptables backend is always available
+	d.firewall, _ = firewall.New(firewall.IptablesBackend, firewall.IPv4)
+	d.firewallV6, _ = firewall.New(firewall.IptablesBackend, firewall.IPv6)
+	return d
 }
 
 // Init registers a new instance of bridge driver
@@ -121,18 +151,33 @@ func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
 	if out, err := exec.Command("modprobe", "-va", "nf_nat").CombinedOutput(); err != nil {
 		logrus.Warnf("Running modprobe nf_nat failed with message: `%s`, error: %v", strings.TrimSpace(string(out)), err)
 	}
-	if err := iptables.FirewalldInit(); err != nil {
-		logrus.Debugf("Fail to initialize firewalld: %v, using raw iptables instead", err)
+
+	d := newDriver()
+	if name, ok := config[netlabel.FirewallBackend].(string); ok {
+		if err := d.setFirewallBackend(name); err != nil {
+			return err
+		}
 	}
-	if err := iptables.RemoveExistingChain(DockerChain, iptables.Nat); err != nil {
-		logrus.Warnf("Failed to remove existing iptables entries in %s : %v", DockerChain, err)
+
+	if d.firewall.Name() == firewall.IptablesBackend {
+		if err := iptables.FirewalldInit(); err != nil {
+			logrus.Debugf("Fail to initialize firewalld: %v, using raw iptables instead", err)
+		}
+	}
+	for _, fw := range []firewall.Backend{d.firewall, d.firewallV6} {
+		if err := fw.RemoveExistingChain(DockerChain, firewall.Nat); err != nil {
+			logrus.Warnf("Failed to remove existing %s %s entries in %s : %v", fw.Name(), fw.Family(), DockerChain, err)
+		}
 	}
 
-	d := newDriver()
 	if err := d.configure(config); err != nil {
 		return err
 	}
 
+	if err := d.initStore(config); err != nil {
+		return err
+	}
+
 	c := driverapi.Capability{
 		DataScope: datastore.LocalScope,
 	}
@@ -327,10 +372,59 @@ func (c *networkConfiguration) fromMap(data map[string]interface{}) error {
 			return types.BadRequestErrorf("invalid type for DefaultBindingIP value")
 		}
 	}
+
+	if i, ok := data["DynamicPortRange"]; ok && i != nil {
+		if s, ok := i.(string); ok {
+			if c.DynamicPortRange, err = portallocator.ParsePortRange(s); err != nil {
+				return types.BadRequestErrorf("failed to parse DynamicPortRange value: %s", err.Error())
+			}
+		} else {
+			return types.BadRequestErrorf("invalid type for DynamicPortRange value")
+		}
+	}
+
+	if i, ok := data["ExcludedPorts"]; ok && i != nil {
+		if s, ok := i.(string); ok {
+			if c.ExcludedPorts, err = portallocator.ParsePortRanges(s); err != nil {
+				return types.BadRequestErrorf("failed to parse ExcludedPorts value: %s", err.Error())
+			}
+		} else {
+			return types.BadRequestErrorf("invalid type for ExcludedPorts value")
+		}
+	}
 	return nil
 }
 
-func (n *bridgeNetwork) getDriverChains() (*iptables.ChainInfo, *iptables.ChainInfo, error) {
+// setFirewallBackend selects the backend the driver programs its rules with.
+func (d *driver) setFirewallBackend(name string) error {
+	fw, err := firewall.New(name, firewall.IPv4)
+	if err != nil {
+		return err
+	}
+	fwV6, err := firewall.New(name, firewall.IPv6)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	d.firewall, d.firewallV6 = fw, fwV6
+	d.Unlock()
+
+	return nil
+}
+
+// getFirewall returns the firewall backend of the address family.
+func (d *driver) getFirewall(family firewall.Family) firewall.Backend {
+	d.Lock()
+	defer d.Unlock()
+
+	if family == firewall.IPv6 {
+		return d.firewallV6
+	}
+	return d.firewall
+}
+
+func (n *bridgeNetwork) getDriverChains(family firewall.Family) (firewall.Chain, firewall.Chain, error) {
 	n.Lock()
 	defer n.Unlock()
 
@@ -338,6 +432,10 @@ func (n *bridgeNetwork) getDriverChains() (*iptables.ChainInfo, *iptables.ChainI
 		return nil, nil, types.BadRequestErrorf("no driver found")
 	}
 
+	if family == firewall.IPv6 {
+		return n.driver.natChainV6, n.driver.filterChainV6, nil
+	}
+
 	return n.driver.natChain, n.driver.filterChain, nil
 }
 
@@ -370,8 +468,15 @@ func (n *bridgeNetwork) isolateNetwork(others []*bridgeNetwork, enable bool) err
 	n.Lock()
 	thisV4 := n.bridge.bridgeIPv4
 	thisV6 := getV6Network(n.config, n.bridge)
+	d := n.driver
 	n.Unlock()
 
+	// The IPv6 subnets are isolated only when ip6tables is managed
+	d.Lock()
+	ip6tables := d.config.EnableIP6Tables
+	fw, fwV6 := d.firewall, d.firewallV6
+	d.Unlock()
+
 	// Install the rules to isolate this networks against each of the other networks
 	for _, o := range others {
 		o.Lock()
@@ -381,13 +486,13 @@ func (n *bridgeNetwork) isolateNetwork(others []*bridgeNetwork, enable bool) err
 
 		if !types.CompareIPNet(thisV4, otherV4) {
 			// It's ok to pass a.b.c.d/x, iptables will ignore the host subnet bits
-			if err := setINC(thisV4.String(), otherV4.String(), enable); err != nil {
+			if err := setINC(fw, thisV4.String(), otherV4.String(), enable); err != nil {
 				return err
 			}
 		}
 
-		if thisV6 != nil && otherV6 != nil && !types.CompareIPNet(thisV6, otherV6) {
-			if err := setINC(thisV6.String(), otherV6.String(), enable); err != nil {
+		if ip6tables && thisV6 != nil && otherV6 != nil && !types.CompareIPNet(thisV6, otherV6) {
+			if err := setINC(fwV6, thisV6.String(), otherV6.String(), enable); err != nil {
 				return err
 			}
 		}
@@ -431,6 +536,15 @@ func (c *networkConfiguration) conflictsWithNetworks(id string, others []*bridge
 	return nil
 }
 
+// Validate performs a static validation on the driver configuration parameters.
+func (c *configuration) Validate() error {
+	switch portmapper.ProxyMode(c.UserlandProxyMode) {
+	case "", portmapper.ProxyProcess, portmapper.ProxyInProcess:
+		return nil
+	}
+	return types.BadRequestErrorf("invalid userland proxy mode %q", c.UserlandProxyMode)
+}
+
 func (d *driver) configure(option map[string]interface{}) error {
 	var config *configuration
 	var err error
@@ -456,6 +570,10 @@ func (d *driver) configure(option map[string]interface{}) error {
 		return &ErrInvalidDriverConfig{}
 	}
 
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
 	if config.EnableIPForwarding {
 		err = setupIPForwarding()
 		if err != nil {
@@ -464,7 +582,17 @@ func (d *driver) configure(option map[string]interface{}) error {
 	}
 
 	if config.EnableIPTables {
-		d.natChain, d.filterChain, err = setupIPChains(config)
+		d.natChain, d.filterChain, err = setupIPChains(config, d.firewall)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.EnableIP6Tables {
+		if !config.EnableIPTables {
+			return types.BadRequestErrorf("ip6tables management requires iptables management to be enabled")
+		}
+		d.natChainV6, d.filterChainV6, err = setupIPChains(config, d.firewallV6)
 		if err != nil {
 			return err
 		}
@@ -532,6 +660,10 @@ func parseNetworkOptions(id string, option options.Generic) (*networkConfigurati
 		config.EnableIPv6 = option[netlabel.EnableIPv6].(bool)
 	}
 
+	if _, ok := option[netlabel.Internal]; ok {
+		config.Internal = option[netlabel.Internal].(bool)
+	}
+
 	// Finally validate the configuration
 	if err = config.Validate(); err != nil {
 		return nil, err
@@ -540,6 +672,8 @@ func parseNetworkOptions(id string, option options.Generic) (*networkConfigurati
 	if config.BridgeName == "" && config.DefaultBridge == false {
 		config.BridgeName = "br-" + id[:12]
 	}
+
+	config.ID = id
 	return config, nil
 }
 
@@ -574,6 +708,9 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 
 	defer osl.InitOSContext()()
 
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
 	// Sanity checks
 	d.Lock()
 	if _, ok := d.networks[id]; ok {
@@ -587,8 +724,7 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 	if err != nil {
 		return err
 	}
-	networkList := d.getNetworks()
-	for _, nw := range networkList {
+	for _, nw := range d.getNetworks() {
 		nw.Lock()
 		nwConfig := nw.config
 		nw.Unlock()
@@ -597,6 +733,33 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 		}
 	}
 
+	if err = d.createNetwork(config); err != nil {
+		return err
+	}
+
+	return d.storeUpdate(config)
+}
+
+// hasHostPortsConfig tells whether the network configures the host ports
+// pools of its default binding address.
+func (c *networkConfiguration) hasHostPortsConfig() bool {
+	return c.DynamicPortRange != (portallocator.PortRange{}) || len(c.ExcludedPorts) > 0
+}
+
+// bindingIP returns the host address the ports are mapped on by default.
+func (c *networkConfiguration) bindingIP() net.IP {
+	if c.DefaultBindingIP == nil {
+		return defaultBindingIP
+	}
+	return c.DefaultBindingIP
+}
+
+func (d *driver) createNetwork(config *networkConfiguration) error {
+	var err error
+
+	id := config.ID
+	networkList := d.getNetworks()
+
 	// Create and set network handler in driver
 	network := &bridgeNetwork{
 		id:         id,
@@ -608,6 +771,9 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 
 	d.Lock()
 	d.networks[id] = network
+	if d.config != nil && d.config.UserlandProxyMode != "" {
+		network.portMapper.SetProxyMode(portmapper.ProxyMode(d.config.UserlandProxyMode))
+	}
 	d.Unlock()
 
 	// On failure make sure to reset driver network handler to nil
@@ -619,6 +785,20 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 		}
 	}()
 
+	// The host ports pools of the default binding address are configured
+	// before any port gets mapped on the network
+	if config.hasHostPortsConfig() {
+		hc := portallocator.HostConfig{DynamicRange: config.DynamicPortRange, Excluded: config.ExcludedPorts}
+		if err = network.portMapper.Allocator.AddHostConfig(id, config.bindingIP(), hc); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				network.portMapper.Allocator.RemoveHostConfig(id, config.bindingIP())
+			}
+		}()
+	}
+
 	// Create or retrieve the bridge L3 interface
 	bridgeIface := newInterface(config)
 	network.bridge = bridgeIface
@@ -728,6 +908,9 @@ func (d *driver) DeleteNetwork(nid string) error {
 
 	defer osl.InitOSContext()()
 
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
 	// Get network handler and remove it from driver
 	d.Lock()
 	n, ok := d.networks[nid]
@@ -789,9 +972,24 @@ func (d *driver) DeleteNetwork(nid string) error {
 		return err
 	}
 
+	// Remove the policy chain and sets.
+	if len(config.Policy) > 0 {
+		if e := removePolicy(d.getFirewall(firewall.IPv4), n.id, config.BridgeName); e != nil {
+			logrus.Warnf("Failed to remove the policy of bridge network %s: %v", nid, e)
+		}
+	}
+
 	// Programming
 	err = netlink.LinkDel(n.bridge.Link)
 
+	if e := d.storeDelete(config); e != nil {
+		logrus.Warnf("Failed to remove bridge network %s from store: %v", nid, e)
+	}
+
+	if config.hasHostPortsConfig() {
+		n.portMapper.Allocator.RemoveHostConfig(nid, config.bindingIP())
+	}
+
 	// Release ip addresses (ignore errors)
 	if config.FixedCIDR == nil || config.FixedCIDR.Contains(config.DefaultGatewayIPv4) {
 		if e := ipAllocator.ReleaseIP(n.bridge.bridgeIPv4, n.bridge.gatewayIPv4); e != nil {
@@ -869,6 +1067,9 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 
 	defer osl.InitOSContext()()
 
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
 	if ifInfo == nil {
 		return errors.New("invalid interface info passed")
 	}
@@ -913,7 +1114,7 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 
 	// Create and add the endpoint
 	n.Lock()
-	endpoint := &bridgeEndpoint{id: eid, config: epConfig}
+	endpoint := &bridgeEndpoint{id: eid, nid: nid, config: epConfig}
 	n.endpoints[eid] = endpoint
 	n.Unlock()
 
@@ -1077,6 +1278,10 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 		}
 	}
 
+	if err = d.storeUpdate(endpoint); err != nil {
+		return fmt.Errorf("failed to save bridge endpoint %s to store: %v", eid, err)
+	}
+
 	return nil
 }
 
@@ -1085,6 +1290,9 @@ func (d *driver) DeleteEndpoint(nid, eid string) error {
 
 	defer osl.InitOSContext()()
 
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
 	// Get the network handler and make sure it exists
 	d.Lock()
 	n, ok := d.networks[nid]
@@ -1163,6 +1371,10 @@ func (d *driver) DeleteEndpoint(nid, eid string) error {
 		netlink.LinkDel(link)
 	}
 
+	if err := d.storeDelete(ep); err != nil {
+		logrus.Warnf("Failed to remove bridge endpoint %s from store: %v", ep.id, err)
+	}
+
 	return nil
 }
 
@@ -1219,13 +1431,40 @@ func (d *driver) EndpointOperInfo(nid, eid string) (map[string]interface{}, erro
 		m[netlabel.MacAddress] = ep.macAddress
 	}
 
+	if stats := n.portMapConnStats(ep); len(stats) != 0 {
+		m[netlabel.PortMapConnStats] = stats
+	}
+
 	return m, nil
 }
 
+// portMapConnStats returns the connection counters of the in-process
+// userland proxies of the port mappings of the endpoint, by host address.
+func (n *bridgeNetwork) portMapConnStats(ep *bridgeEndpoint) map[string]portmapper.ConnStats {
+	if n.portMapper == nil {
+		return nil
+	}
+
+	stats := make(map[string]portmapper.ConnStats)
+	for _, pb := range ep.portMapping {
+		host, err := pb.HostAddr()
+		if err != nil {
+			continue
+		}
+		if s, err := n.portMapper.ConnStats(host); err == nil {
+			stats[fmt.Sprintf("%s/%s", host, pb.Proto)] = s
+		}
+	}
+	return stats
+}
+
 // Join method is invoked when a Sandbox is attached to an endpoint.
 func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
 	defer osl.InitOSContext()()
 
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
 	network, err := d.getNetwork(nid)
 	if err != nil {
 		return err
@@ -1246,18 +1485,24 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 		return err
 	}
 
-	err = jinfo.SetGateway(network.bridge.gatewayIPv4)
-	if err != nil {
-		return err
-	}
+	// Containers on internal networks are not given a default gateway
+	if !network.config.Internal {
+		err = jinfo.SetGateway(network.bridge.gatewayIPv4)
+		if err != nil {
+			return err
+		}
 
-	err = jinfo.SetGatewayIPv6(network.bridge.gatewayIPv6)
-	if err != nil {
-		return err
+		err = jinfo.SetGatewayIPv6(network.bridge.gatewayIPv6)
+		if err != nil {
+			return err
+		}
 	}
 
 	if !network.config.EnableICC {
-		return d.link(network, endpoint, options, true)
+		if err = d.link(network, endpoint, options, true); err != nil {
+			return err
+		}
+		return d.storeUpdate(endpoint)
 	}
 
 	return nil
@@ -1267,6 +1512,9 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 func (d *driver) Leave(nid, eid string) error {
 	defer osl.InitOSContext()()
 
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
 	network, err := d.getNetwork(nid)
 	if err != nil {
 		return err
@@ -1282,7 +1530,12 @@ func (d *driver) Leave(nid, eid string) error {
 	}
 
 	if !network.config.EnableICC {
-		return d.link(network, endpoint, nil, false)
+		if err = d.link(network, endpoint, nil, false); err != nil {
+			return err
+		}
+		// The links are only programmed while the endpoint is joined
+		endpoint.containerConfig = nil
+		return d.storeUpdate(endpoint)
 	}
 
 	return nil
@@ -1307,6 +1560,10 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, options
 		return nil
 	}
 
+	d.Lock()
+	filterChain := d.filterChain
+	d.Unlock()
+
 	if endpoint.config != nil && endpoint.config.ExposedPorts != nil {
 		for _, p := range cc.ParentEndpoints {
 			var parentEndpoint *bridgeEndpoint
@@ -1321,7 +1578,7 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, options
 
 			l := newLink(parentEndpoint.addr.IP.String(),
 				endpoint.addr.IP.String(),
-				endpoint.config.ExposedPorts, network.config.BridgeName)
+				endpoint.config.ExposedPorts, network.config.BridgeName, filterChain)
 			if enable {
 				err = l.Enable()
 				if err != nil {
@@ -1354,7 +1611,7 @@ func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, options
 
 		l := newLink(endpoint.addr.IP.String(),
 			childEndpoint.addr.IP.String(),
-			childEndpoint.config.ExposedPorts, network.config.BridgeName)
+			childEndpoint.config.ExposedPorts, network.config.BridgeName, filterChain)
 		if enable {
 			err = l.Enable()
 			if err != nil {
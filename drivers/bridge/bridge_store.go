@@ -0,0 +1,516 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	bridgePrefix         = "bridge"
+	bridgeEndpointPrefix = "bridge-endpoint"
+)
+
+func (d *driver) initStore(option map[string]interface{}) error {
+	if data, ok := option[netlabel.LocalKVClient]; ok && data != nil {
+		store, ok := data.(datastore.DataStore)
+		if !ok {
+			return types.InternalErrorf("incorrect data in datastore configuration: %v", data)
+		}
+		d.store = store
+	}
+
+	if d.store == nil {
+		return nil
+	}
+
+	if err := d.populateNetworks(); err != nil {
+		return err
+	}
+
+	return d.populateEndpoints()
+}
+
+func (d *driver) populateNetworks() error {
+	defer osl.InitOSContext()()
+
+	kvol, err := d.store.List(datastore.Key(bridgePrefix), &networkConfiguration{})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return fmt.Errorf("failed to get bridge network configurations from store: %v", err)
+	}
+
+	for _, kvo := range kvol {
+		ncfg := kvo.(*networkConfiguration)
+		if err := d.createNetwork(ncfg); err != nil {
+			logrus.Warnf("Could not restore bridge network %s (%s): %v", ncfg.ID, ncfg.BridgeName, err)
+			continue
+		}
+		logrus.Debugf("Restored bridge network %s (%s)", ncfg.ID, ncfg.BridgeName)
+	}
+
+	return nil
+}
+
+func (d *driver) populateEndpoints() error {
+	defer osl.InitOSContext()()
+
+	kvol, err := d.store.List(datastore.Key(bridgeEndpointPrefix), &bridgeEndpoint{})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return fmt.Errorf("failed to get bridge endpoints from store: %v", err)
+	}
+
+	for _, kvo := range kvol {
+		ep := kvo.(*bridgeEndpoint)
+		n, err := d.getNetwork(ep.nid)
+		if err != nil {
+			logrus.Debugf("Network %s of bridge endpoint %s is gone, removing the endpoint from store", ep.nid, ep.id)
+			if err := d.storeDelete(ep); err != nil {
+				logrus.Debugf("Failed to remove stale bridge endpoint %s from store: %v", ep.id, err)
+			}
+			continue
+		}
+
+		if err := n.restoreEndpoint(ep); err != nil {
+			logrus.Warnf("Could not fully restore bridge endpoint %s: %v", ep.id, err)
+		}
+
+		n.Lock()
+		n.endpoints[ep.id] = ep
+		n.Unlock()
+
+		logrus.Debugf("Restored bridge endpoint %s in network %s", ep.id, ep.nid)
+	}
+
+	// The policy sets can be filled now that the endpoints are back
+	if d.config.EnableIPTables {
+		for _, n := range d.getNetworks() {
+			n.reapplyPolicy()
+		}
+	}
+
+	return nil
+}
+
+// restoreEndpoint reserves the addresses of an endpoint created in a previous
+// life of the driver and reprograms its port mappings and links
+func (n *bridgeNetwork) restoreEndpoint(ep *bridgeEndpoint) error {
+	n.Lock()
+	config := n.config
+	bridge := n.bridge
+	d := n.driver
+	n.Unlock()
+
+	if ep.addr != nil {
+		if _, err := ipAllocator.RequestIP(bridge.bridgeIPv4, ep.addr.IP); err != nil {
+			logrus.Debugf("Failed to reserve address %s of bridge endpoint %s: %v", ep.addr.IP, ep.id, err)
+		}
+	}
+
+	if config.EnableIPv6 && ep.addrv6 != nil {
+		network := bridge.bridgeIPv6
+		if config.FixedCIDRv6 != nil {
+			network = config.FixedCIDRv6
+		}
+		if _, err := ipAllocator.RequestIP(network, ep.addrv6.IP); err != nil {
+			logrus.Debugf("Failed to reserve address %s of bridge endpoint %s: %v", ep.addrv6.IP, ep.id, err)
+		}
+	}
+
+	if len(ep.portMapping) > 0 && ep.addr != nil {
+		// The host ports were elected in the previous life, map the same ones
+		bindings := make([]types.PortBinding, 0, len(ep.portMapping))
+		for _, b := range ep.portMapping {
+			b.HostPortEnd = b.HostPort
+			bindings = append(bindings, b)
+		}
+
+		var addrv6 net.IP
+		if ep.addrv6 != nil {
+			addrv6 = ep.addrv6.IP
+		}
+		pm, err := n.allocatePortsInternal(ep.id, bindings, ep.addr.IP, addrv6, defaultBindingIP, d.config.EnableUserlandProxy)
+		if err != nil {
+			return fmt.Errorf("failed to restore port mappings: %v", err)
+		}
+		ep.portMapping = pm
+	}
+
+	if !config.EnableICC && ep.containerConfig != nil {
+		cc := ep.containerConfig
+		ep.containerConfig = nil
+		if err := d.link(n, ep, map[string]interface{}{netlabel.GenericData: cc}, true); err != nil {
+			return fmt.Errorf("failed to restore links: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// RestoreNetwork is invoked by the controller for the bridge networks found in
+// its stores. The networks already reloaded from the driver store are left
+// untouched, the others are created again.
+func (d *driver) RestoreNetwork(nid string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	if _, err := d.getNetwork(nid); err == nil {
+		return nil
+	}
+
+	return d.CreateNetwork(nid, option, ipV4Data, ipV6Data)
+}
+
+// RestoreEndpoint is invoked by the controller for the endpoints of the bridge
+// networks found in its stores. The endpoints unknown to the driver store are
+// rebuilt from the interface information so that their addresses are reserved
+// and they can later be deleted.
+func (d *driver) RestoreEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, sboxKey string) error {
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep, _ := n.getEndpoint(eid); ep != nil {
+		return nil
+	}
+
+	if ifInfo == nil {
+		return types.BadRequestErrorf("no interface information for bridge endpoint %s", eid)
+	}
+
+	ep := &bridgeEndpoint{
+		id:         eid,
+		nid:        nid,
+		addr:       ifInfo.Address(),
+		addrv6:     ifInfo.AddressIPv6(),
+		macAddress: ifInfo.MacAddress(),
+		config:     &endpointConfiguration{},
+	}
+
+	if err := n.restoreEndpoint(ep); err != nil {
+		return err
+	}
+
+	n.Lock()
+	n.endpoints[eid] = ep
+	n.Unlock()
+
+	return d.storeUpdate(ep)
+}
+
+func (d *driver) storeUpdate(kvObject datastore.KVObject) error {
+	if d.store == nil {
+		logrus.Debugf("bridge store not initialized. kv object %s is not added to the store", datastore.Key(kvObject.Key()...))
+		return nil
+	}
+
+	if err := d.store.PutObjectAtomic(kvObject); err != nil {
+		return fmt.Errorf("failed to update bridge store for object type %T: %v", kvObject, err)
+	}
+
+	return nil
+}
+
+func (d *driver) storeDelete(kvObject datastore.KVObject) error {
+	if d.store == nil {
+		logrus.Debugf("bridge store not initialized. kv object %s is not deleted from store", datastore.Key(kvObject.Key()...))
+		return nil
+	}
+
+retry:
+	if err := d.store.DeleteObjectAtomic(kvObject); err != nil {
+		if err == datastore.ErrKeyModified {
+			if err := d.store.GetObject(datastore.Key(kvObject.Key()...), kvObject); err != nil {
+				return fmt.Errorf("could not update the kvobject to latest when trying to delete: %v", err)
+			}
+			goto retry
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ncfg *networkConfiguration) MarshalJSON() ([]byte, error) {
+	nMap := make(map[string]interface{})
+	nMap["ID"] = ncfg.ID
+	nMap["BridgeName"] = ncfg.BridgeName
+	nMap["EnableIPv6"] = ncfg.EnableIPv6
+	nMap["EnableIPMasquerade"] = ncfg.EnableIPMasquerade
+	nMap["EnableICC"] = ncfg.EnableICC
+	nMap["Mtu"] = ncfg.Mtu
+	nMap["DefaultBridge"] = ncfg.DefaultBridge
+	nMap["Internal"] = ncfg.Internal
+	nMap["DefaultBindingIP"] = ncfg.DefaultBindingIP.String()
+	nMap["DefaultGatewayIPv4"] = ncfg.DefaultGatewayIPv4.String()
+	nMap["DefaultGatewayIPv6"] = ncfg.DefaultGatewayIPv6.String()
+
+	if ncfg.AddressIPv4 != nil {
+		nMap["AddressIPv4"] = ncfg.AddressIPv4.String()
+	}
+
+	if ncfg.FixedCIDR != nil {
+		nMap["FixedCIDR"] = ncfg.FixedCIDR.String()
+	}
+
+	if ncfg.FixedCIDRv6 != nil {
+		nMap["FixedCIDRv6"] = ncfg.FixedCIDRv6.String()
+	}
+
+	if len(ncfg.Policy) > 0 {
+		nMap["Policy"] = ncfg.Policy
+	}
+
+	if ncfg.DynamicPortRange != (portallocator.PortRange{}) {
+		nMap["DynamicPortRange"] = ncfg.DynamicPortRange.String()
+	}
+
+	if len(ncfg.ExcludedPorts) > 0 {
+		ports := make([]string, 0, len(ncfg.ExcludedPorts))
+		for _, r := range ncfg.ExcludedPorts {
+			ports = append(ports, r.String())
+		}
+		nMap["ExcludedPorts"] = strings.Join(ports, ",")
+	}
+
+	return json.Marshal(nMap)
+}
+
+func (ncfg *networkConfiguration) UnmarshalJSON(b []byte) error {
+	var (
+		err  error
+		nMap map[string]interface{}
+	)
+
+	if err = json.Unmarshal(b, &nMap); err != nil {
+		return err
+	}
+
+	if v, ok := nMap["AddressIPv4"]; ok {
+		if ncfg.AddressIPv4, err = types.ParseCIDR(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network address IPv4 after json unmarshal: %s", v.(string))
+		}
+	}
+
+	if v, ok := nMap["FixedCIDR"]; ok {
+		if ncfg.FixedCIDR, err = types.ParseCIDR(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network FixedCIDR after json unmarshal: %s", v.(string))
+		}
+	}
+
+	if v, ok := nMap["FixedCIDRv6"]; ok {
+		if ncfg.FixedCIDRv6, err = types.ParseCIDR(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network FixedCIDRv6 after json unmarshal: %s", v.(string))
+		}
+	}
+
+	ncfg.DefaultBridge = nMap["DefaultBridge"].(bool)
+	if v, ok := nMap["Internal"]; ok {
+		ncfg.Internal = v.(bool)
+	}
+	ncfg.DefaultBindingIP = net.ParseIP(nMap["DefaultBindingIP"].(string))
+	ncfg.DefaultGatewayIPv4 = net.ParseIP(nMap["DefaultGatewayIPv4"].(string))
+	ncfg.DefaultGatewayIPv6 = net.ParseIP(nMap["DefaultGatewayIPv6"].(string))
+	ncfg.ID = nMap["ID"].(string)
+	ncfg.BridgeName = nMap["BridgeName"].(string)
+	ncfg.EnableIPv6 = nMap["EnableIPv6"].(bool)
+	ncfg.EnableIPMasquerade = nMap["EnableIPMasquerade"].(bool)
+	ncfg.EnableICC = nMap["EnableICC"].(bool)
+	ncfg.Mtu = int(nMap["Mtu"].(float64))
+
+	if v, ok := nMap["Policy"]; ok {
+		b, _ := json.Marshal(v)
+		if err = json.Unmarshal(b, &ncfg.Policy); err != nil {
+			return types.InternalErrorf("failed to decode bridge network policy after json unmarshal: %v", err)
+		}
+	}
+
+	if v, ok := nMap["DynamicPortRange"]; ok {
+		if ncfg.DynamicPortRange, err = portallocator.ParsePortRange(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network dynamic port range after json unmarshal: %s", v.(string))
+		}
+	}
+
+	if v, ok := nMap["ExcludedPorts"]; ok {
+		if ncfg.ExcludedPorts, err = portallocator.ParsePortRanges(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge network excluded ports after json unmarshal: %s", v.(string))
+		}
+	}
+
+	return nil
+}
+
+func (ncfg *networkConfiguration) Key() []string {
+	return []string{bridgePrefix, ncfg.ID}
+}
+
+func (ncfg *networkConfiguration) KeyPrefix() []string {
+	return []string{bridgePrefix}
+}
+
+func (ncfg *networkConfiguration) Value() []byte {
+	b, err := json.Marshal(ncfg)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (ncfg *networkConfiguration) SetValue(value []byte) error {
+	return json.Unmarshal(value, ncfg)
+}
+
+func (ncfg *networkConfiguration) Index() uint64 {
+	return ncfg.dbIndex
+}
+
+func (ncfg *networkConfiguration) SetIndex(index uint64) {
+	ncfg.dbIndex = index
+	ncfg.dbExists = true
+}
+
+func (ncfg *networkConfiguration) Exists() bool {
+	return ncfg.dbExists
+}
+
+func (ncfg *networkConfiguration) Skip() bool {
+	return false
+}
+
+func (ncfg *networkConfiguration) New() datastore.KVObject {
+	return &networkConfiguration{}
+}
+
+func (ncfg *networkConfiguration) CopyTo(o datastore.KVObject) error {
+	dstNcfg := o.(*networkConfiguration)
+	*dstNcfg = *ncfg
+	return nil
+}
+
+func (ncfg *networkConfiguration) DataScope() string {
+	return datastore.LocalScope
+}
+
+func (ep *bridgeEndpoint) MarshalJSON() ([]byte, error) {
+	epMap := make(map[string]interface{})
+	epMap["id"] = ep.id
+	epMap["nid"] = ep.nid
+	epMap["SrcName"] = ep.srcName
+	epMap["MacAddress"] = ep.macAddress.String()
+	if ep.addr != nil {
+		epMap["Addr"] = ep.addr.String()
+	}
+	if ep.addrv6 != nil {
+		epMap["Addrv6"] = ep.addrv6.String()
+	}
+	epMap["Config"] = ep.config
+	epMap["ContainerConfig"] = ep.containerConfig
+	epMap["PortMapping"] = ep.portMapping
+
+	return json.Marshal(epMap)
+}
+
+func (ep *bridgeEndpoint) UnmarshalJSON(b []byte) error {
+	var (
+		err   error
+		epMap map[string]interface{}
+	)
+
+	if err = json.Unmarshal(b, &epMap); err != nil {
+		return fmt.Errorf("failed to unmarshal to bridge endpoint: %v", err)
+	}
+
+	if v, ok := epMap["MacAddress"]; ok {
+		if ep.macAddress, err = net.ParseMAC(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge endpoint MAC address (%s) after json unmarshal: %v", v.(string), err)
+		}
+	}
+	if v, ok := epMap["Addr"]; ok {
+		if ep.addr, err = types.ParseCIDR(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge endpoint IPv4 address (%s) after json unmarshal: %v", v.(string), err)
+		}
+	}
+	if v, ok := epMap["Addrv6"]; ok {
+		if ep.addrv6, err = types.ParseCIDR(v.(string)); err != nil {
+			return types.InternalErrorf("failed to decode bridge endpoint IPv6 address (%s) after json unmarshal: %v", v.(string), err)
+		}
+	}
+	ep.id = epMap["id"].(string)
+	ep.nid = epMap["nid"].(string)
+	ep.srcName = epMap["SrcName"].(string)
+
+	d, _ := json.Marshal(epMap["Config"])
+	if err := json.Unmarshal(d, &ep.config); err != nil {
+		logrus.Warnf("Failed to decode endpoint config %v", err)
+	}
+	d, _ = json.Marshal(epMap["ContainerConfig"])
+	if err := json.Unmarshal(d, &ep.containerConfig); err != nil {
+		logrus.Warnf("Failed to decode endpoint container config %v", err)
+	}
+	d, _ = json.Marshal(epMap["PortMapping"])
+	if err := json.Unmarshal(d, &ep.portMapping); err != nil {
+		logrus.Warnf("Failed to decode endpoint port mapping %v", err)
+	}
+
+	return nil
+}
+
+func (ep *bridgeEndpoint) Key() []string {
+	return []string{bridgeEndpointPrefix, ep.id}
+}
+
+func (ep *bridgeEndpoint) KeyPrefix() []string {
+	return []string{bridgeEndpointPrefix}
+}
+
+func (ep *bridgeEndpoint) Value() []byte {
+	b, err := json.Marshal(ep)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (ep *bridgeEndpoint) SetValue(value []byte) error {
+	return json.Unmarshal(value, ep)
+}
+
+func (ep *bridgeEndpoint) Index() uint64 {
+	return ep.dbIndex
+}
+
+func (ep *bridgeEndpoint) SetIndex(index uint64) {
+	ep.dbIndex = index
+	ep.dbExists = true
+}
+
+func (ep *bridgeEndpoint) Exists() bool {
+	return ep.dbExists
+}
+
+func (ep *bridgeEndpoint) Skip() bool {
+	return false
+}
+
+func (ep *bridgeEndpoint) New() datastore.KVObject {
+	return &bridgeEndpoint{}
+}
+
+func (ep *bridgeEndpoint) CopyTo(o datastore.KVObject) error {
+	dstEp := o.(*bridgeEndpoint)
+	*dstEp = *ep
+	return nil
+}
+
+func (ep *bridgeEndpoint) DataScope() string {
+	return datastore.LocalScope
+}
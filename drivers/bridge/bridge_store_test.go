@@ -0,0 +1,174 @@
+package bridge
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/testutils"
+)
+
+func newTestStore(t *testing.T) (datastore.DataStore, func()) {
+	tmp, err := ioutil.TempFile("", "libnetwork-bridge-")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	tmp.Close()
+
+	ds, err := datastore.NewDataStore(datastore.LocalScope, &datastore.ScopeCfg{
+		Embedded: true,
+		Client: datastore.ScopeClientCfg{
+			Provider: "boltdb",
+			Address:  tmp.Name(),
+			Config: &store.Config{
+				Bucket:            "libnetwork",
+				ConnectionTimeout: 3 * time.Second,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error creating local store: %v", err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.Remove(tmp.Name())
+	}
+}
+
+func TestStoreRestore(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	option := map[string]interface{}{
+		netlabel.GenericData:   &configuration{EnableUserlandProxy: true},
+		netlabel.LocalKVClient: ds,
+	}
+
+	d := newDriver()
+	if err := d.configure(option); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+	if err := d.initStore(option); err != nil {
+		t.Fatalf("Failed to initialize driver store: %v", err)
+	}
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: "cu0", EnableICC: true},
+	}
+	if err := d.CreateNetwork("dummy", netOption, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	te := &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep1", te.Interface(), nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+
+	// Simulate a restart of the driver
+	d = newDriver()
+	if err := d.configure(option); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+	if err := d.initStore(option); err != nil {
+		t.Fatalf("Failed to initialize driver store: %v", err)
+	}
+
+	n, err := d.getNetwork("dummy")
+	if err != nil {
+		t.Fatalf("Bridge network was not restored: %v", err)
+	}
+	if n.config.BridgeName != "cu0" {
+		t.Fatalf("Unexpected bridge name for the restored network: %s", n.config.BridgeName)
+	}
+
+	ep, err := n.getEndpoint("ep1")
+	if err != nil || ep == nil {
+		t.Fatalf("Bridge endpoint was not restored: %v", err)
+	}
+	if ep.addr.String() != te.Interface().Address().String() {
+		t.Fatalf("Restored endpoint has address %s, expected %s", ep.addr, te.Interface().Address())
+	}
+	if ep.macAddress.String() != te.Interface().MacAddress().String() {
+		t.Fatalf("Restored endpoint has mac %s, expected %s", ep.macAddress, te.Interface().MacAddress())
+	}
+
+	// The restore calls from the controller must be no-ops
+	if err := d.RestoreNetwork("dummy", netOption, nil, nil); err != nil {
+		t.Fatalf("Failed to restore network: %v", err)
+	}
+	if err := d.RestoreEndpoint("dummy", "ep1", te.Interface(), ""); err != nil {
+		t.Fatalf("Failed to restore endpoint: %v", err)
+	}
+	if err := d.CreateNetwork("dummy", netOption, nil, nil); err == nil {
+		t.Fatalf("Expected failure on duplicate network creation")
+	}
+
+	if err := d.DeleteEndpoint("dummy", "ep1"); err != nil {
+		t.Fatalf("Failed to delete restored endpoint: %v", err)
+	}
+	if err := d.DeleteNetwork("dummy"); err != nil {
+		t.Fatalf("Failed to delete restored network: %v", err)
+	}
+
+	d = newDriver()
+	if err := d.initStore(option); err != nil {
+		t.Fatalf("Failed to initialize driver store: %v", err)
+	}
+	if _, err := d.getNetwork("dummy"); err == nil {
+		t.Fatalf("Deleted network was restored")
+	}
+}
+
+func TestRestoreWithoutStore(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := newDriver()
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: &configuration{EnableUserlandProxy: true}}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: "cu0", EnableICC: true},
+	}
+	if err := d.RestoreNetwork("dummy", netOption, nil, nil); err != nil {
+		t.Fatalf("Failed to restore network: %v", err)
+	}
+
+	n, err := d.getNetwork("dummy")
+	if err != nil {
+		t.Fatalf("Bridge network was not restored: %v", err)
+	}
+
+	te := &testEndpoint{iface: &testInterface{}}
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, n.bridge.bridgeIPv4.IP.To4())
+	ip[3] += 10
+	addr := &net.IPNet{IP: ip, Mask: n.bridge.bridgeIPv4.Mask}
+	te.iface.addr = addr
+	if err := d.RestoreEndpoint("dummy", "ep1", te.Interface(), ""); err != nil {
+		t.Fatalf("Failed to restore endpoint: %v", err)
+	}
+
+	ep, err := n.getEndpoint("ep1")
+	if err != nil || ep == nil {
+		t.Fatalf("Bridge endpoint was not restored: %v", err)
+	}
+	if !ep.addr.IP.Equal(addr.IP) {
+		t.Fatalf("Restored endpoint has address %s, expected %s", ep.addr, addr)
+	}
+
+	if err := d.DeleteEndpoint("dummy", "ep1"); err != nil {
+		t.Fatalf("Failed to delete restored endpoint: %v", err)
+	}
+	if err := d.DeleteNetwork("dummy"); err != nil {
+		t.Fatalf("Failed to delete restored network: %v", err)
+	}
+}
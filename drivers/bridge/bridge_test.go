@@ -243,6 +243,10 @@ func (i *testInterface) AddressIPv6() *net.IPNet {
 	return i.addrv6
 }
 
+func (i *testInterface) Addresses() []*net.IPNet {
+	return nil
+}
+
 func (i *testInterface) SetMacAddress(mac net.HardwareAddr) error {
 	if i.mac != nil {
 		return types.ForbiddenErrorf("endpoint interface MAC address present (%s). Cannot be modified with %s.", i.mac, mac)
@@ -5,6 +5,7 @@ import (
 	"net"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/firewall"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/types"
 )
@@ -14,18 +15,20 @@ type link struct {
 	childIP  string
 	ports    []types.TransportPort
 	bridge   string
+	chain    firewall.Chain
 }
 
 func (l *link) String() string {
 	return fmt.Sprintf("%s <-> %s [%v] on %s", l.parentIP, l.childIP, l.ports, l.bridge)
 }
 
-func newLink(parentIP, childIP string, ports []types.TransportPort, bridge string) *link {
+func newLink(parentIP, childIP string, ports []types.TransportPort, bridge string, chain firewall.Chain) *link {
 	return &link{
 		childIP:  childIP,
 		parentIP: parentIP,
 		ports:    ports,
 		bridge:   bridge,
+		chain:    chain,
 	}
 
 }
@@ -33,7 +36,7 @@ func newLink(parentIP, childIP string, ports []types.TransportPort, bridge strin
 func (l *link) Enable() error {
 	// -A == iptables append flag
 	linkFunction := func() error {
-		return linkContainers("-A", l.parentIP, l.childIP, l.ports, l.bridge, false)
+		return linkContainers("-A", l.parentIP, l.childIP, l.ports, l.bridge, l.chain, false)
 	}
 
 	iptables.OnReloaded(func() { linkFunction() })
@@ -42,7 +45,7 @@ func (l *link) Enable() error {
 
 func (l *link) Disable() {
 	// -D == iptables delete flag
-	err := linkContainers("-D", l.parentIP, l.childIP, l.ports, l.bridge, true)
+	err := linkContainers("-D", l.parentIP, l.childIP, l.ports, l.bridge, l.chain, true)
 	if err != nil {
 		log.Errorf("Error removing IPTables rules for a link %s due to %s", l.String(), err.Error())
 	}
@@ -51,20 +54,24 @@ func (l *link) Disable() {
 }
 
 func linkContainers(action, parentIP, childIP string, ports []types.TransportPort, bridge string,
-	ignoreErrors bool) error {
-	var nfAction iptables.Action
+	chain firewall.Chain, ignoreErrors bool) error {
+	var nfAction firewall.Action
 
 	switch action {
 	case "-A":
-		nfAction = iptables.Append
+		nfAction = firewall.Append
 	case "-I":
-		nfAction = iptables.Insert
+		nfAction = firewall.Insert
 	case "-D":
-		nfAction = iptables.Delete
+		nfAction = firewall.Delete
 	default:
 		return InvalidIPTablesCfgError(action)
 	}
 
+	if chain == nil {
+		return IPTableCfgError(bridge)
+	}
+
 	ip1 := net.ParseIP(parentIP)
 	if ip1 == nil {
 		return InvalidLinkIPAddrError(parentIP)
@@ -74,7 +81,6 @@ func linkContainers(action, parentIP, childIP string, ports []types.TransportPor
 		return InvalidLinkIPAddrError(childIP)
 	}
 
-	chain := iptables.ChainInfo{Name: DockerChain}
 	for _, port := range ports {
 		err := chain.Link(nfAction, ip1, ip2, int(port.Port), port.Proto.String(), bridge)
 		if !ignoreErrors && err != nil {
@@ -0,0 +1,259 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/firewall"
+	"github.com/docker/libnetwork/ipset"
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	// PolicyChainPrefix is the prefix of the iptables chains enforcing the network policies
+	PolicyChainPrefix = "DOCKER-POLICY-"
+	policySetPrefix   = "dpol-"
+	policyIDLen       = 12
+)
+
+// ProgramPolicy compiles the policy rules of the network into a dedicated
+// chain, jumped to by the traffic between the bridge ports. With the iptables
+// backend, the source and destination endpoints of each rule are matched
+// through ip sets holding their IPv4 addresses; the other backends get a rule
+// for each pair of addresses. The rules are stored so that they can be
+// applied again on restart and on firewalld reload.
+func (d *driver) ProgramPolicy(nid string, rules []driverapi.PolicyRule) error {
+	defer osl.InitOSContext()()
+
+	d.reconcileLock.RLock()
+	defer d.reconcileLock.RUnlock()
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	iptablesEnabled := d.config.EnableIPTables
+	d.Unlock()
+
+	if !iptablesEnabled {
+		if len(rules) > 0 {
+			return types.ForbiddenErrorf("network policies require iptables to be enabled")
+		}
+		return nil
+	}
+
+	if err := n.setupPolicy(rules); err != nil {
+		return err
+	}
+
+	n.Lock()
+	config := n.config
+	config.Policy = rules
+	n.Unlock()
+
+	return d.storeUpdate(config)
+}
+
+// reapplyPolicy programs again the stored policy rules of the network.
+func (n *bridgeNetwork) reapplyPolicy() {
+	n.Lock()
+	rules := n.config.Policy
+	n.Unlock()
+
+	if len(rules) == 0 {
+		return
+	}
+
+	if err := n.setupPolicy(rules); err != nil {
+		logrus.Warnf("Failed to reapply the policy of bridge network %s: %v", n.id, err)
+	}
+}
+
+// setupPolicy replaces the rules of the policy chain all together, so that
+// the chain never enforces part of the policy. The ip sets of the rules are
+// filled beforehand under a new generation of names, and the ones of the
+// previous generation are destroyed once no longer referenced.
+func (n *bridgeNetwork) setupPolicy(rules []driverapi.PolicyRule) error {
+	n.Lock()
+	nid := n.id
+	bridgeName := n.config.BridgeName
+	d := n.driver
+	addrs := make(map[string]net.IP, len(n.endpoints))
+	for eid, ep := range n.endpoints {
+		if ep.addr != nil {
+			addrs[eid] = ep.addr.IP
+		}
+	}
+	n.Unlock()
+
+	fw := d.getFirewall(firewall.IPv4)
+	if len(rules) == 0 {
+		return removePolicy(fw, nid, bridgeName)
+	}
+
+	chain := policyChainName(nid)
+	if _, err := fw.NewChain(chain, firewall.Filter, false); err != nil {
+		return fmt.Errorf("failed to create policy chain %s: %v", chain, err)
+	}
+
+	// The replies of the allowed connections must get through
+	// the deny rules and the disabled inter container communication
+	changes := []firewall.RuleChange{
+		{Table: firewall.Filter, Chain: chain, Action: firewall.Flush},
+		{Table: firewall.Filter, Chain: chain, Action: firewall.Append, Rule: firewall.Rule{CtState: "RELATED,ESTABLISHED", Target: firewall.Accept}},
+	}
+
+	var (
+		useSets = fw.Name() == firewall.IptablesBackend
+		sets    = make(map[string]bool)
+		gen     string
+	)
+	if useSets {
+		gen = nextPolicySetGeneration(nid)
+	}
+	for i, r := range rules {
+		match := firewall.Rule{Target: firewall.Drop}
+		if r.Allow {
+			match.Target = firewall.Accept
+		}
+		if r.Proto != 0 {
+			match.Proto = r.Proto.String()
+			match.DstPort = int(r.Port)
+		}
+
+		if !useSets {
+			for _, src := range policyAddrs(r.Sources, addrs) {
+				for _, dst := range policyAddrs(r.Destinations, addrs) {
+					m := match
+					m.Src, m.Dst = src.String(), dst.String()
+					changes = append(changes, firewall.RuleChange{Table: firewall.Filter, Chain: chain, Action: firewall.Append, Rule: m})
+				}
+			}
+			continue
+		}
+
+		match.SrcSet = policySetName(nid, gen, i, "s")
+		match.DstSet = policySetName(nid, gen, i, "d")
+		if err := fillPolicySet(match.SrcSet, r.Sources, addrs); err != nil {
+			return err
+		}
+		if err := fillPolicySet(match.DstSet, r.Destinations, addrs); err != nil {
+			return err
+		}
+		sets[match.SrcSet] = true
+		sets[match.DstSet] = true
+		changes = append(changes, firewall.RuleChange{Table: firewall.Filter, Chain: chain, Action: firewall.Append, Rule: match})
+	}
+
+	if change, ok := ruleChange(fw, policyJumpRule(nid, bridgeName), true); ok {
+		changes = append(changes, change)
+	}
+
+	if err := fw.Apply(changes); err != nil {
+		for name := range sets {
+			ipset.Destroy(name)
+		}
+		return fmt.Errorf("failed to program policy chain %s: %v", chain, err)
+	}
+
+	// The sets of the previous generation are no longer referenced
+	destroyPolicySets(nid, sets)
+
+	return nil
+}
+
+// removePolicy removes the policy chain of the network along with its ip sets.
+func removePolicy(fw firewall.Backend, nid, bridgeName string) error {
+	if err := programChainRule(fw, policyJumpRule(nid, bridgeName), "POLICY", false); err != nil {
+		return err
+	}
+	if err := fw.RemoveExistingChain(policyChainName(nid), firewall.Filter); err != nil {
+		return fmt.Errorf("failed to remove policy chain: %v", err)
+	}
+	destroyPolicySets(nid, nil)
+	return nil
+}
+
+func policyJumpRule(nid, bridgeName string) iptRule {
+	return iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: bridgeName, OutIface: bridgeName, Target: policyChainName(nid)}}
+}
+
+func fillPolicySet(name string, eids []string, addrs map[string]net.IP) error {
+	if err := ipset.Create(name, ipset.HashIP); err != nil {
+		return fmt.Errorf("failed to create policy set: %v", err)
+	}
+	if err := ipset.Flush(name); err != nil {
+		return fmt.Errorf("failed to flush policy set: %v", err)
+	}
+	for _, eid := range eids {
+		ip, ok := addrs[eid]
+		if !ok {
+			continue
+		}
+		if err := ipset.Add(name, ip); err != nil {
+			return fmt.Errorf("failed to add endpoint %s to policy set: %v", eid, err)
+		}
+	}
+	return nil
+}
+
+// policyAddrs returns the addresses of the endpoints which have one.
+func policyAddrs(eids []string, addrs map[string]net.IP) []net.IP {
+	var ips []net.IP
+	for _, eid := range eids {
+		if ip, ok := addrs[eid]; ok {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// nextPolicySetGeneration returns the generation of the names of the ip sets
+// the policy of the network is to be programmed with, the one its current
+// sets do not belong to.
+func nextPolicySetGeneration(nid string) string {
+	names, _ := ipset.List(policySetPrefix + shortPolicyID(nid) + "-a")
+	if len(names) > 0 {
+		return "b"
+	}
+	return "a"
+}
+
+// destroyPolicySets destroys the ip sets of the network which are not in use.
+func destroyPolicySets(nid string, inUse map[string]bool) {
+	names, err := ipset.List(policySetPrefix + shortPolicyID(nid) + "-")
+	if err != nil {
+		if err != ipset.ErrIpsetNotFound {
+			logrus.Warnf("Failed to list the policy sets of bridge network %s: %v", nid, err)
+		}
+		return
+	}
+	for _, name := range names {
+		if inUse[name] {
+			continue
+		}
+		if err := ipset.Destroy(name); err != nil {
+			logrus.Warnf("Failed to destroy policy set %s: %v", name, err)
+		}
+	}
+}
+
+func policyChainName(nid string) string {
+	return PolicyChainPrefix + shortPolicyID(nid)
+}
+
+func policySetName(nid, gen string, rule int, dir string) string {
+	return fmt.Sprintf("%s%s-%s%d%s", policySetPrefix, shortPolicyID(nid), gen, rule, dir)
+}
+
+func shortPolicyID(nid string) string {
+	if len(nid) > policyIDLen {
+		return nid[:policyIDLen]
+	}
+	return nid
+}
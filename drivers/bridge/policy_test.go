@@ -0,0 +1,230 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/firewall"
+	"github.com/docker/libnetwork/ipset"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+)
+
+func TestPolicyNames(t *testing.T) {
+	nid := "8a8d2c2b7c6e4f3f9b1c0d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a"
+
+	if c := policyChainName(nid); c != PolicyChainPrefix+nid[:policyIDLen] || len(c) > 28 {
+		t.Fatalf("Unexpected policy chain name %s", c)
+	}
+	if s := policySetName(nid, "b", 999, "d"); len(s) > ipset.MaxNameLen || !strings.HasPrefix(s, policySetPrefix+nid[:policyIDLen]+"-") {
+		t.Fatalf("Unexpected policy set name %s", s)
+	}
+}
+
+func TestPolicyMarshalling(t *testing.T) {
+	ncfg := &networkConfiguration{
+		ID:         "dummy",
+		BridgeName: "cu0",
+		Policy: []driverapi.PolicyRule{
+			{Allow: true, Sources: []string{"ep1"}, Destinations: []string{"ep2", "ep3"}, Proto: types.TCP, Port: 80},
+			{Sources: []string{"ep1"}, Destinations: []string{"ep3"}},
+		},
+	}
+
+	b, err := json.Marshal(ncfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nncfg := &networkConfiguration{}
+	if err := json.Unmarshal(b, nncfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nncfg.Policy) != 2 || !nncfg.Policy[0].Allow || nncfg.Policy[0].Port != 80 ||
+		nncfg.Policy[0].Proto != types.TCP || len(nncfg.Policy[0].Destinations) != 2 || nncfg.Policy[1].Allow {
+		t.Fatalf("Unexpected policy after json unmarshal: %v", nncfg.Policy)
+	}
+}
+
+func TestProgramPolicyWithoutIPTables(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := newDriver()
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: &configuration{}}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: "cu0", EnableICC: true},
+	}
+	if err := d.CreateNetwork("dummy", netOption, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	defer d.DeleteNetwork("dummy")
+
+	err := d.ProgramPolicy("dummy", []driverapi.PolicyRule{{Sources: []string{"ep1"}, Destinations: []string{"ep2"}}})
+	if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Expected forbidden error on policy without iptables, got %v", err)
+	}
+	if err := d.ProgramPolicy("dummy", nil); err != nil {
+		t.Fatalf("Unexpected failure on empty policy: %v", err)
+	}
+	if err := d.ProgramPolicy("unknown", nil); err == nil {
+		t.Fatalf("Expected failure on unknown network")
+	}
+}
+
+func TestProgramPolicy(t *testing.T) {
+	if _, err := exec.LookPath("ipset"); err != nil {
+		t.Skip("ipset is not available")
+	}
+	defer testutils.SetupTestOSContext(t)()
+
+	d := newDriver()
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: &configuration{EnableIPTables: true}}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: "cu0"},
+	}
+	if err := d.CreateNetwork("dummy", netOption, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	te1 := &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep1", te1.Interface(), nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+	te2 := &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep2", te2.Interface(), nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+
+	rules := []driverapi.PolicyRule{
+		{Allow: true, Sources: []string{"ep1"}, Destinations: []string{"ep2"}, Proto: types.TCP, Port: 80},
+		{Sources: []string{"ep1", "ep2"}, Destinations: []string{"ep1", "ep2"}},
+	}
+	if err := d.ProgramPolicy("dummy", rules); err != nil {
+		t.Fatalf("Failed to program policy: %v", err)
+	}
+
+	chain := policyChainName("dummy")
+	jump := policyJumpRule("dummy", "cu0")
+	if !d.firewall.Exists(jump.table, jump.chain, jump.rule) {
+		t.Fatalf("Policy chain %s is not jumped to", chain)
+	}
+	allow := firewall.Rule{Proto: "tcp", SrcSet: policySetName("dummy", "a", 0, "s"), DstSet: policySetName("dummy", "a", 0, "d"), DstPort: 80, Target: firewall.Accept}
+	if !d.firewall.Exists(firewall.Filter, chain, allow) {
+		t.Fatalf("Allow rule missing in policy chain %s", chain)
+	}
+	out, err := ipset.Raw("list", policySetName("dummy", "a", 1, "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []net.IP{te1.iface.addr.IP, te2.iface.addr.IP} {
+		if !strings.Contains(string(out), ip.String()) {
+			t.Fatalf("Endpoint address %s missing in policy set:\n%s", ip, out)
+		}
+	}
+
+	// Shrinking the policy replaces the sets with a new generation
+	if err := d.ProgramPolicy("dummy", rules[1:]); err != nil {
+		t.Fatalf("Failed to program policy: %v", err)
+	}
+	if sets, _ := ipset.List(policySetPrefix + "dummy-"); len(sets) != 2 || !strings.HasPrefix(sets[0], policySetPrefix+"dummy-b") {
+		t.Fatalf("Expected 2 policy sets of the next generation, got %v", sets)
+	}
+	if d.firewall.Exists(firewall.Filter, chain, allow) {
+		t.Fatalf("Allow rule still in policy chain %s", chain)
+	}
+
+	if err := d.ProgramPolicy("dummy", nil); err != nil {
+		t.Fatalf("Failed to remove policy: %v", err)
+	}
+	if d.firewall.Exists(jump.table, jump.chain, jump.rule) {
+		t.Fatalf("Policy chain %s is still jumped to", chain)
+	}
+	if sets, _ := ipset.List(policySetPrefix + "dummy-"); len(sets) != 0 {
+		t.Fatalf("Policy sets were not destroyed: %v", sets)
+	}
+}
+
+func TestProgramPolicyNftables(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := newDriver()
+	if err := d.setFirewallBackend(firewall.NftablesBackend); err != nil {
+		t.Skipf("nftables not supported: %v", err)
+	}
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: &configuration{EnableIPTables: true}}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: "cu0"},
+	}
+	if err := d.CreateNetwork("dummy", netOption, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	var eps []*testEndpoint
+	for _, eid := range []string{"ep1", "ep2", "ep3"} {
+		te := &testEndpoint{iface: &testInterface{}}
+		if err := d.CreateEndpoint("dummy", eid, te.Interface(), nil); err != nil {
+			t.Fatalf("Failed to create an endpoint: %v", err)
+		}
+		eps = append(eps, te)
+	}
+	ip := func(i int) string { return eps[i].iface.addr.IP.String() }
+
+	rules := []driverapi.PolicyRule{
+		{Allow: true, Sources: []string{"ep1"}, Destinations: []string{"ep2"}, Proto: types.TCP, Port: 80},
+		{Sources: []string{"ep1", "ep2"}, Destinations: []string{"ep3"}},
+	}
+	if err := d.ProgramPolicy("dummy", rules); err != nil {
+		t.Fatalf("Failed to program policy: %v", err)
+	}
+
+	chain := policyChainName("dummy")
+	jump := policyJumpRule("dummy", "cu0")
+	if !d.firewall.Exists(jump.table, jump.chain, jump.rule) {
+		t.Fatalf("Policy chain %s is not jumped to", chain)
+	}
+	allow := firewall.Rule{Proto: "tcp", Src: ip(0), Dst: ip(1), DstPort: 80, Target: firewall.Accept}
+	deny := []firewall.Rule{
+		{Src: ip(0), Dst: ip(2), Target: firewall.Drop},
+		{Src: ip(1), Dst: ip(2), Target: firewall.Drop},
+	}
+	for _, r := range append(deny, allow) {
+		if !d.firewall.Exists(firewall.Filter, chain, r) {
+			t.Fatalf("Rule %q missing in policy chain %s", r, chain)
+		}
+	}
+
+	// Updating the policy replaces the rules of the chain
+	if err := d.ProgramPolicy("dummy", rules[1:]); err != nil {
+		t.Fatalf("Failed to program policy: %v", err)
+	}
+	if d.firewall.Exists(firewall.Filter, chain, allow) {
+		t.Fatalf("Allow rule still in policy chain %s", chain)
+	}
+	for _, r := range deny {
+		if !d.firewall.Exists(firewall.Filter, chain, r) {
+			t.Fatalf("Rule %q missing in policy chain %s", r, chain)
+		}
+	}
+
+	if err := d.ProgramPolicy("dummy", nil); err != nil {
+		t.Fatalf("Failed to remove policy: %v", err)
+	}
+	if d.firewall.Exists(jump.table, jump.chain, jump.rule) {
+		t.Fatalf("Policy chain %s is still jumped to", chain)
+	}
+}
@@ -1,13 +1,20 @@
 package bridge
 
 import (
+	"encoding/json"
+	"net"
 	"os"
 	"testing"
 
 	"github.com/docker/docker/pkg/reexec"
+	"github.com/docker/libnetwork/firewall"
 	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/portmapper"
 	"github.com/docker/libnetwork/testutils"
 	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
 )
 
 func TestMain(m *testing.M) {
@@ -77,3 +84,241 @@ func TestPortMappingConfig(t *testing.T) {
 		t.Fatalf("Failed to release mapped ports: %v", err)
 	}
 }
+
+func TestPortMappingIPv6HostIP(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// The dummy proxies listen on the loopback addresses
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(lo); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &bridgeNetwork{portMapper: portmapper.New()}
+
+	containerIP := net.ParseIP("172.17.0.2")
+	containerIPv6 := net.ParseIP("2001:db8::2")
+	bindings := []types.PortBinding{
+		{Proto: types.TCP, Port: uint16(80), HostIP: net.ParseIP("::1"), HostPort: uint16(54080)},
+		{Proto: types.TCP, Port: uint16(80), HostIP: net.ParseIP("127.0.0.1"), HostPort: uint16(54080)},
+		{Proto: types.TCP, Port: uint16(81), HostPort: uint16(54081)},
+	}
+
+	pm, err := n.allocatePortsInternal("ep1", bindings, containerIP, containerIPv6, defaultBindingIP, false)
+	if err != nil {
+		t.Fatalf("Failed to allocate the port bindings: %v", err)
+	}
+	defer n.releasePortsInternal(pm)
+
+	if !pm[0].IP.Equal(containerIPv6) {
+		t.Fatalf("Expected the IPv6 host address to be forwarded to %s, got %s", containerIPv6, pm[0].IP)
+	}
+	if !pm[1].IP.Equal(containerIP) {
+		t.Fatalf("Expected the IPv4 host address to be forwarded to %s, got %s", containerIP, pm[1].IP)
+	}
+	if !pm[2].IP.Equal(containerIP) || !pm[2].HostIP.Equal(defaultBindingIP) {
+		t.Fatalf("Expected the default host address to be forwarded to %s, got %s on %s", containerIP, pm[2].IP, pm[2].HostIP)
+	}
+}
+
+func TestPortMappingNftables(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+	if err := d.setFirewallBackend(firewall.NftablesBackend); err != nil {
+		t.Skipf("nftables not supported: %v", err)
+	}
+
+	genericOption := map[string]interface{}{netlabel.GenericData: &configuration{EnableIPTables: true}}
+	if err := d.configure(genericOption); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netOptions := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: DefaultBridgeName, EnableICC: true, EnableIPMasquerade: true},
+	}
+	if err := d.CreateNetwork("dummy", netOptions, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	inRule := firewall.Rule{OutIface: DefaultBridgeName, CtState: "RELATED,ESTABLISHED", Target: firewall.Accept}
+	if !d.firewall.Exists(firewall.Filter, "FORWARD", inRule) {
+		t.Fatal("Bridge rules were not programmed through nftables")
+	}
+	if !d.firewall.Exists(firewall.Filter, "FORWARD", firewall.Rule{OutIface: DefaultBridgeName, Target: DockerChain}) {
+		t.Fatal("DOCKER filter chain was not hooked to the bridge")
+	}
+
+	epOptions := map[string]interface{}{
+		netlabel.PortMap: []types.PortBinding{{Proto: types.TCP, Port: uint16(80), HostPort: uint16(54080)}},
+	}
+	te := &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep1", te.Interface(), epOptions); err != nil {
+		t.Fatalf("Failed to create the endpoint: %v", err)
+	}
+
+	accept := firewall.Rule{
+		InIface:  "!" + DefaultBridgeName,
+		OutIface: DefaultBridgeName,
+		Proto:    "tcp",
+		Dst:      te.iface.addr.IP.String(),
+		DstPort:  80,
+		Target:   firewall.Accept,
+	}
+	if !d.firewall.Exists(firewall.Filter, DockerChain, accept) {
+		t.Fatal("Port mapping was not programmed through nftables")
+	}
+
+	if err := d.DeleteEndpoint("dummy", "ep1"); err != nil {
+		t.Fatalf("Failed to delete the endpoint: %v", err)
+	}
+	if d.firewall.Exists(firewall.Filter, DockerChain, accept) {
+		t.Fatal("Port mapping was not removed")
+	}
+}
+
+func TestPortMappingInProcessProxy(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+
+	config := options.Generic{"EnableUserlandProxy": true, "UserlandProxyMode": "docker-proxy"}
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: config}); err == nil {
+		t.Fatal("Expected failure with an invalid userland proxy mode")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type %T: %v", err, err)
+	}
+
+	config["UserlandProxyMode"] = string(portmapper.ProxyInProcess)
+	if err := d.configure(map[string]interface{}{netlabel.GenericData: config}); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+	if !d.config.EnableUserlandProxy || d.config.UserlandProxyMode != string(portmapper.ProxyInProcess) {
+		t.Fatalf("Unexpected userland proxy config: %+v", d.config)
+	}
+
+	netOptions := map[string]interface{}{netlabel.GenericData: &networkConfiguration{BridgeName: DefaultBridgeName}}
+	if err := d.CreateNetwork("dummy", netOptions, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	epOptions := map[string]interface{}{
+		netlabel.PortMap: []types.PortBinding{{Proto: types.TCP, Port: uint16(500)}},
+	}
+	te := &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep1", te.Interface(), epOptions); err != nil {
+		t.Fatalf("Failed to create the endpoint: %v", err)
+	}
+
+	network := d.networks["dummy"]
+	ep := network.endpoints["ep1"]
+	if len(ep.portMapping) != 1 {
+		t.Fatalf("Unexpected port mappings %v", ep.portMapping)
+	}
+
+	// Only the in-process proxies keep connection counters
+	host := &net.TCPAddr{IP: ep.portMapping[0].HostIP, Port: int(ep.portMapping[0].HostPort)}
+	if _, err := network.portMapper.ConnStats(host); err != nil {
+		t.Fatalf("Expected an in-process proxy for %s: %v", host, err)
+	}
+
+	info, err := d.EndpointOperInfo("dummy", "ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, ok := info[netlabel.PortMapConnStats].(map[string]portmapper.ConnStats)
+	if !ok {
+		t.Fatalf("Expected the connection counters in the endpoint info: %v", info)
+	}
+	if _, ok := stats[host.String()+"/tcp"]; !ok || len(stats) != 1 {
+		t.Fatalf("Unexpected connection counters %v", stats)
+	}
+
+	if err := network.releasePorts(ep); err != nil {
+		t.Fatalf("Failed to release mapped ports: %v", err)
+	}
+}
+
+func TestPortMappingExcludedPorts(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+
+	// The dummy proxies listen on the loopback address
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(lo); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.configure(nil); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netConfig := &networkConfiguration{BridgeName: "excl0"}
+	if err := netConfig.fromMap(map[string]interface{}{
+		"DefaultBindingIP": "127.0.0.1",
+		"DynamicPortRange": "47000-47099",
+		"ExcludedPorts":    "7000-7010, 7020",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if netConfig.DynamicPortRange != (portallocator.PortRange{Begin: 47000, End: 47099}) || len(netConfig.ExcludedPorts) != 2 {
+		t.Fatalf("Unexpected host ports configuration %v %v", netConfig.DynamicPortRange, netConfig.ExcludedPorts)
+	}
+
+	// The configuration survives the store
+	b, err := json.Marshal(netConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &networkConfiguration{}
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.DynamicPortRange != netConfig.DynamicPortRange || len(restored.ExcludedPorts) != 2 ||
+		restored.ExcludedPorts[1] != (portallocator.PortRange{Begin: 7020, End: 7020}) {
+		t.Fatalf("Unexpected host ports configuration after json unmarshal %v %v", restored.DynamicPortRange, restored.ExcludedPorts)
+	}
+
+	if err := d.CreateNetwork("dummy", map[string]interface{}{netlabel.GenericData: netConfig}, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	epOptions := map[string]interface{}{
+		netlabel.PortMap: []types.PortBinding{{Proto: types.TCP, Port: uint16(80), HostPort: uint16(7005)}},
+	}
+	te := &testEndpoint{iface: &testInterface{}}
+	err = d.CreateEndpoint("dummy", "ep1", te.Interface(), epOptions)
+	if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Expected a forbidden error mapping an excluded port, got %v", err)
+	}
+
+	epOptions[netlabel.PortMap] = []types.PortBinding{{Proto: types.TCP, Port: uint16(80)}}
+	te = &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep2", te.Interface(), epOptions); err != nil {
+		t.Fatalf("Failed to create the endpoint: %v", err)
+	}
+	network := d.networks["dummy"]
+	ep := network.endpoints["ep2"]
+	if len(ep.portMapping) != 1 || ep.portMapping[0].HostPort < 47000 || ep.portMapping[0].HostPort > 47099 {
+		t.Fatalf("Expected a host port of the dynamic range of the network, got %v", ep.portMapping)
+	}
+
+	// Deleting the network undoes its host ports configuration
+	if err := d.DeleteEndpoint("dummy", "ep2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteNetwork("dummy"); err != nil {
+		t.Fatal(err)
+	}
+	allocator := portallocator.Get()
+	if _, err := allocator.RequestPort(net.ParseIP("127.0.0.1"), "tcp", 7005); err != nil {
+		t.Fatalf("Expected the excluded ports of the deleted network to be allocatable: %v", err)
+	}
+	if err := allocator.ReleasePort(net.ParseIP("127.0.0.1"), "tcp", 7005); err != nil {
+		t.Fatal(err)
+	}
+}
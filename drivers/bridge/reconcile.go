@@ -0,0 +1,264 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/firewall"
+	"github.com/docker/libnetwork/osl"
+)
+
+// managedChains are the chains the driver programs its rules in. The rules
+// tagged by the firewall backend which the driver does not expect there are
+// removed by the reconciliation.
+var managedChains = []struct {
+	table firewall.Table
+	chain string
+}{
+	{firewall.Nat, DockerChain},
+	{firewall.Filter, DockerChain},
+	{firewall.Nat, "PREROUTING"},
+	{firewall.Nat, "OUTPUT"},
+	{firewall.Nat, "POSTROUTING"},
+	{firewall.Filter, "FORWARD"},
+}
+
+// expectedRule is a rule the driver expects in the tables.
+type expectedRule struct {
+	// nid is the network the rule belongs to, empty when shared
+	nid    string
+	change firewall.RuleChange
+	// restore programs the missing rule, when applying the change
+	// alone would not be enough
+	restore func() error
+}
+
+// Reconcile compares the rules the networks, the links and the port mappings
+// of the driver expect with the live tables of the firewall backends. The
+// missing rules are programmed again, and the rules tagged by the backends
+// which nothing expects, such as the ones left behind by a crash, are removed.
+func (d *driver) Reconcile() ([]driverapi.Drift, error) {
+	d.reconcileLock.Lock()
+	defer d.reconcileLock.Unlock()
+
+	defer osl.InitOSContext()()
+
+	d.Lock()
+	config := d.config
+	fw, fwV6 := d.firewall, d.firewallV6
+	d.Unlock()
+
+	if config == nil || !config.EnableIPTables {
+		return nil, nil
+	}
+
+	hairpinMode := !config.EnableUserlandProxy
+	networks := d.getNetworks()
+
+	drift, err := reconcileRules(fw, expectedRules(fw, networks, hairpinMode), hairpinMode)
+	if !config.EnableIP6Tables {
+		return drift, err
+	}
+
+	driftV6, errV6 := reconcileRules(fwV6, expectedRules(fwV6, networks, hairpinMode), hairpinMode)
+	if err == nil {
+		err = errV6
+	}
+
+	return append(drift, driftV6...), err
+}
+
+// expectedRules returns the rules of the address family of the backend
+// the networks expect.
+func expectedRules(fw firewall.Backend, networks []*bridgeNetwork, hairpinMode bool) []expectedRule {
+	var (
+		family  = fw.Family()
+		rules   []expectedRule
+		subnets []string
+	)
+
+	add := func(nid string, changes ...firewall.RuleChange) {
+		for _, c := range changes {
+			rules = append(rules, expectedRule{nid: nid, change: c})
+		}
+	}
+
+	for _, n := range networks {
+		n.Lock()
+		nid, config, bridge := n.id, n.config, n.bridge
+		endpoints := make(map[string]*bridgeEndpoint, len(n.endpoints))
+		for eid, ep := range n.endpoints {
+			endpoints[eid] = ep
+		}
+		var subnet *net.IPNet
+		if bridge != nil {
+			if family == firewall.IPv6 {
+				if config.EnableIPv6 {
+					subnet = getV6Network(config, bridge)
+				}
+			} else {
+				subnet = bridge.bridgeIPv4
+			}
+		}
+		n.Unlock()
+
+		if subnet == nil {
+			continue
+		}
+		bridgeName := config.BridgeName
+
+		// The subnets are isolated from each other as they are
+		// configured on the bridges
+		for _, otherSubnet := range subnets {
+			if otherSubnet != subnet.String() {
+				add(nid, incRules(subnet.String(), otherSubnet)...)
+			}
+		}
+		subnets = append(subnets, subnet.String())
+
+		masked := &net.IPNet{IP: subnet.IP.Mask(subnet.Mask), Mask: subnet.Mask}
+		add(nid, bridgeRules(bridgeName, masked, config.EnableICC, config.EnableIPMasquerade, config.Internal, hairpinMode)...)
+		add("", firewall.JumpRules(family, firewall.Nat, DockerChain, bridgeName, hairpinMode)...)
+		add(nid, firewall.JumpRules(family, firewall.Filter, DockerChain, bridgeName, hairpinMode)...)
+
+		// The policies are only programmed for IPv4, and
+		// their chain is created again along with the jump
+		if policy := config.Policy; len(policy) > 0 && family == firewall.IPv4 {
+			jump := policyJumpRule(nid, bridgeName)
+			add(nid, firewall.RuleChange{Table: jump.table, Chain: jump.chain, Action: firewall.Insert, Rule: jump.rule})
+			pn := n
+			rules[len(rules)-1].restore = func() error { return pn.setupPolicy(policy) }
+		}
+
+		for _, ep := range endpoints {
+			add(nid, portMappingRules(family, ep, bridgeName, hairpinMode)...)
+			if family == firewall.IPv4 && !config.EnableICC {
+				add(nid, endpointLinkRules(ep, endpoints, bridgeName)...)
+			}
+		}
+	}
+
+	return rules
+}
+
+// portMappingRules returns the rules forwarding the host ports to the
+// endpoint, which the port mapper programs in the chain of the family of
+// the container address.
+func portMappingRules(family firewall.Family, ep *bridgeEndpoint, bridgeName string, hairpinMode bool) []firewall.RuleChange {
+	var changes []firewall.RuleChange
+	for _, pb := range ep.portMapping {
+		if pb.IP == nil || (pb.IP.To4() == nil) != (family == firewall.IPv6) {
+			continue
+		}
+		if pb.HostIP != nil && !pb.HostIP.IsUnspecified() && (pb.HostIP.To4() == nil) != (pb.IP.To4() == nil) {
+			continue
+		}
+		changes = append(changes, firewall.ForwardRules(DockerChain, firewall.Append, hairpinMode,
+			pb.HostIP, int(pb.HostPort), pb.Proto.String(), pb.IP.String(), int(pb.Port), bridgeName)...)
+	}
+	return changes
+}
+
+// endpointLinkRules returns the rules of the links of the joined endpoint
+// with its parents and children.
+func endpointLinkRules(ep *bridgeEndpoint, endpoints map[string]*bridgeEndpoint, bridgeName string) []firewall.RuleChange {
+	cc := ep.containerConfig
+	if cc == nil || ep.addr == nil {
+		return nil
+	}
+
+	var changes []firewall.RuleChange
+	link := func(parent, child *bridgeEndpoint) {
+		for _, port := range child.config.ExposedPorts {
+			changes = append(changes, firewall.LinkRules(DockerChain, firewall.Append,
+				parent.addr.IP, child.addr.IP, int(port.Port), port.Proto.String(), bridgeName)...)
+		}
+	}
+
+	if ep.config != nil {
+		for _, p := range cc.ParentEndpoints {
+			if parent, ok := endpoints[p]; ok && parent.addr != nil {
+				link(parent, ep)
+			}
+		}
+	}
+	for _, c := range cc.ChildEndpoints {
+		if child, ok := endpoints[c]; ok && child.addr != nil && child.config != nil {
+			link(ep, child)
+		}
+	}
+
+	return changes
+}
+
+// reconcileRules programs the expected rules missing from the tables of the
+// backend, then prunes the managed chains from the tagged rules which are
+// not expected.
+func reconcileRules(fw firewall.Backend, expected []expectedRule, hairpinMode bool) ([]driverapi.Drift, error) {
+	var (
+		drift    []driverapi.Drift
+		firstErr error
+		seen     = make(map[string]bool, len(expected))
+		kept     = make(map[string][]firewall.Rule)
+	)
+
+	fail := func(err error) {
+		logrus.Warnf("Bridge driver %s %s reconciliation: %v", fw.Name(), fw.Family(), err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// The chains may have been deleted along with their rules
+	for _, table := range []firewall.Table{firewall.Nat, firewall.Filter} {
+		if _, err := fw.NewChain(DockerChain, table, hairpinMode); err != nil {
+			fail(fmt.Errorf("failed to create %s chain: %v", table, err))
+		}
+	}
+
+	for _, e := range expected {
+		c := e.change
+		key := string(c.Table) + "/" + c.Chain
+		kept[key] = append(kept[key], c.Rule)
+
+		if seen[key+" "+c.Rule.String()] {
+			continue
+		}
+		seen[key+" "+c.Rule.String()] = true
+
+		if fw.Exists(c.Table, c.Chain, c.Rule) {
+			continue
+		}
+		drift = append(drift, driverapi.Drift{Kind: driverapi.DriftMissing, NetworkID: e.nid, Object: driftObject(fw, c.Table, c.Chain, c.Rule.String())})
+
+		var err error
+		if e.restore != nil {
+			err = e.restore()
+		} else {
+			err = fw.Apply([]firewall.RuleChange{c})
+		}
+		if err != nil {
+			fail(fmt.Errorf("failed to restore rule %q in chain %s: %v", c.Rule, key, err))
+		}
+	}
+
+	for _, mc := range managedChains {
+		key := string(mc.table) + "/" + mc.chain
+		removed, err := fw.Prune(mc.table, mc.chain, kept[key])
+		for _, r := range removed {
+			drift = append(drift, driverapi.Drift{Kind: driverapi.DriftOrphan, Object: driftObject(fw, mc.table, mc.chain, r)})
+		}
+		if err != nil {
+			fail(fmt.Errorf("failed to prune chain %s: %v", key, err))
+		}
+	}
+
+	return drift, firstErr
+}
+
+// driftObject describes a drifted rule.
+func driftObject(fw firewall.Backend, table firewall.Table, chain, rule string) string {
+	return fmt.Sprintf("%s %s rule in %s/%s: %s", fw.Name(), fw.Family(), table, chain, rule)
+}
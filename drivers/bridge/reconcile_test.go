@@ -0,0 +1,81 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/firewall"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+)
+
+func TestReconcileNftables(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+	if err := d.setFirewallBackend(firewall.NftablesBackend); err != nil {
+		t.Skipf("nftables not supported: %v", err)
+	}
+
+	genericOption := map[string]interface{}{netlabel.GenericData: &configuration{EnableIPTables: true}}
+	if err := d.configure(genericOption); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netOptions := map[string]interface{}{
+		netlabel.GenericData: &networkConfiguration{BridgeName: DefaultBridgeName, EnableIPMasquerade: true},
+	}
+	if err := d.CreateNetwork("dummy", netOptions, nil, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	epOptions := map[string]interface{}{
+		netlabel.PortMap: []types.PortBinding{{Proto: types.UDP, Port: uint16(53), HostPort: uint16(54053)}},
+	}
+	te := &testEndpoint{iface: &testInterface{}}
+	if err := d.CreateEndpoint("dummy", "ep1", te.Interface(), epOptions); err != nil {
+		t.Fatalf("Failed to create the endpoint: %v", err)
+	}
+
+	// The programmed rules are all expected
+	if drift, err := d.Reconcile(); err != nil || len(drift) != 0 {
+		t.Fatalf("Unexpected drift of the programmed rules: %v %v", drift, err)
+	}
+
+	accept := firewall.Rule{
+		InIface:  "!" + DefaultBridgeName,
+		OutIface: DefaultBridgeName,
+		Proto:    "udp",
+		Dst:      te.iface.addr.IP.String(),
+		DstPort:  53,
+		Target:   firewall.Accept,
+	}
+	if err := d.firewall.ProgramRule(firewall.Filter, DockerChain, firewall.Delete, accept); err != nil {
+		t.Fatal(err)
+	}
+	orphan := firewall.Rule{OutIface: DefaultBridgeName, Proto: "tcp", DstPort: 8080, Target: firewall.Accept}
+	if err := d.firewall.ProgramRule(firewall.Filter, DockerChain, firewall.Append, orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	drift, err := d.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 2 || drift[0].Kind != driverapi.DriftMissing || drift[0].NetworkID != "dummy" || drift[1].Kind != driverapi.DriftOrphan {
+		t.Fatalf("Unexpected drift: %v", drift)
+	}
+	if !d.firewall.Exists(firewall.Filter, DockerChain, accept) {
+		t.Fatal("Missing port mapping rule was not restored")
+	}
+	if d.firewall.Exists(firewall.Filter, DockerChain, orphan) {
+		t.Fatal("Orphan rule was not removed")
+	}
+
+	if err := d.DeleteEndpoint("dummy", "ep1"); err != nil {
+		t.Fatalf("Failed to delete the endpoint: %v", err)
+	}
+	if drift, err := d.Reconcile(); err != nil || len(drift) != 0 {
+		t.Fatalf("Unexpected drift after the endpoint deletion: %v %v", drift, err)
+	}
+}
@@ -15,6 +15,7 @@ func (n *bridgeNetwork) setupFirewalld(config *networkConfiguration, i *bridgeIn
 
 	iptables.OnReloaded(func() { n.setupIPTables(config, i) })
 	iptables.OnReloaded(n.portMapper.ReMapAll)
+	iptables.OnReloaded(n.reapplyPolicy)
 
 	return nil
 }
@@ -5,7 +5,7 @@ import (
 	"net"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/firewall"
 	"github.com/docker/libnetwork/netutils"
 )
 
@@ -14,7 +14,7 @@ const (
 	DockerChain = "DOCKER"
 )
 
-func setupIPChains(config *configuration) (*iptables.ChainInfo, *iptables.ChainInfo, error) {
+func setupIPChains(config *configuration, fw firewall.Backend) (firewall.Chain, firewall.Chain, error) {
 	// Sanity check.
 	if config.EnableIPTables == false {
 		return nil, nil, fmt.Errorf("Cannot create new chains, EnableIPTable is disabled")
@@ -22,19 +22,19 @@ func setupIPChains(config *configuration) (*iptables.ChainInfo, *iptables.ChainI
 
 	hairpinMode := !config.EnableUserlandProxy
 
-	natChain, err := iptables.NewChain(DockerChain, iptables.Nat, hairpinMode)
+	natChain, err := fw.NewChain(DockerChain, firewall.Nat, hairpinMode)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to create NAT chain: %s", err.Error())
 	}
 	defer func() {
 		if err != nil {
-			if err := iptables.RemoveExistingChain(DockerChain, iptables.Nat); err != nil {
-				logrus.Warnf("Failed on removing iptables NAT chain on cleanup: %v", err)
+			if err := fw.RemoveExistingChain(DockerChain, firewall.Nat); err != nil {
+				logrus.Warnf("Failed on removing %s NAT chain on cleanup: %v", fw.Name(), err)
 			}
 		}
 	}()
 
-	filterChain, err := iptables.NewChain(DockerChain, iptables.Filter, hairpinMode)
+	filterChain, err := fw.NewChain(DockerChain, firewall.Filter, hairpinMode)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Failed to create FILTER chain: %s", err.Error())
 	}
@@ -53,9 +53,6 @@ func (n *bridgeNetwork) setupIPTables(config *networkConfiguration, i *bridgeInt
 		return fmt.Errorf("Cannot program chains, EnableIPTable is disabled")
 	}
 
-	// Pickup this configuraton option from driver
-	hairpinMode := !driverConfig.EnableUserlandProxy
-
 	addrv4, _, err := netutils.GetIfaceAddr(config.BridgeName)
 	if err != nil {
 		return fmt.Errorf("Failed to setup IP tables, cannot acquire Interface address: %s", err.Error())
@@ -65,187 +62,215 @@ func (n *bridgeNetwork) setupIPTables(config *networkConfiguration, i *bridgeInt
 		IP:   ipnet.IP.Mask(ipnet.Mask),
 		Mask: ipnet.Mask,
 	}
-	if err = setupIPTablesInternal(config.BridgeName, maskedAddrv4, config.EnableICC, config.EnableIPMasquerade, hairpinMode, true); err != nil {
+	if err := n.setupIPTablesVersion(d.getFirewall(firewall.IPv4), config, maskedAddrv4, driverConfig); err != nil {
+		return err
+	}
+
+	if !driverConfig.EnableIP6Tables || !config.EnableIPv6 {
+		return nil
+	}
+
+	// A bridge with a link-local address only has no IPv6 subnet to program
+	n.Lock()
+	addrv6 := getV6Network(config, i)
+	n.Unlock()
+	if addrv6 == nil {
+		return nil
+	}
+	maskedAddrv6 := &net.IPNet{
+		IP:   addrv6.IP.Mask(addrv6.Mask),
+		Mask: addrv6.Mask,
+	}
+	return n.setupIPTablesVersion(d.getFirewall(firewall.IPv6), config, maskedAddrv6, driverConfig)
+}
+
+// setupIPTablesVersion programs the rules of the bridge subnet through the
+// firewall backend of the address family and links the family DOCKER chains.
+func (n *bridgeNetwork) setupIPTablesVersion(fw firewall.Backend, config *networkConfiguration, addr *net.IPNet, driverConfig *configuration) error {
+	// Pickup this configuraton option from driver
+	hairpinMode := !driverConfig.EnableUserlandProxy
+
+	if err := setupIPTablesInternal(fw, config.BridgeName, addr, config.EnableICC, config.EnableIPMasquerade, config.Internal, hairpinMode, true); err != nil {
 		return fmt.Errorf("Failed to Setup IP tables: %s", err.Error())
 	}
 
-	natChain, filterChain, err := n.getDriverChains()
+	natChain, filterChain, err := n.getDriverChains(fw.Family())
 	if err != nil {
 		return fmt.Errorf("Failed to setup IP tables, cannot acquire chain info %s", err.Error())
 	}
 
-	err = iptables.ProgramChain(natChain, config.BridgeName, hairpinMode)
+	err = fw.ProgramChain(natChain, config.BridgeName, hairpinMode)
 	if err != nil {
 		return fmt.Errorf("Failed to program NAT chain: %s", err.Error())
 	}
 
-	err = iptables.ProgramChain(filterChain, config.BridgeName, hairpinMode)
+	err = fw.ProgramChain(filterChain, config.BridgeName, hairpinMode)
 	if err != nil {
 		return fmt.Errorf("Failed to program FILTER chain: %s", err.Error())
 	}
 
-	n.portMapper.SetIptablesChain(filterChain, n.getNetworkBridgeName())
+	n.portMapper.SetFirewallChain(filterChain, n.getNetworkBridgeName())
 
 	return nil
 }
 
 type iptRule struct {
-	table   iptables.Table
-	chain   string
-	preArgs []string
-	args    []string
+	table firewall.Table
+	chain string
+	rule  firewall.Rule
 }
 
-func setupIPTablesInternal(bridgeIface string, addr net.Addr, icc, ipmasq, hairpin, enable bool) error {
-
+// bridgeRules returns the changes programming the rules of the bridge, the
+// inter container communication ones included.
+func bridgeRules(bridgeIface string, addr net.Addr, icc, ipmasq, internal, hairpin bool) []firewall.RuleChange {
 	var (
-		address   = addr.String()
-		natRule   = iptRule{table: iptables.Nat, chain: "POSTROUTING", preArgs: []string{"-t", "nat"}, args: []string{"-s", address, "!", "-o", bridgeIface, "-j", "MASQUERADE"}}
-		hpNatRule = iptRule{table: iptables.Nat, chain: "POSTROUTING", preArgs: []string{"-t", "nat"}, args: []string{"-m", "addrtype", "--src-type", "LOCAL", "-o", bridgeIface, "-j", "MASQUERADE"}}
-		outRule   = iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-i", bridgeIface, "!", "-o", bridgeIface, "-j", "ACCEPT"}}
-		inRule    = iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-o", bridgeIface, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}}
+		address     = addr.String()
+		natRule     = iptRule{table: firewall.Nat, chain: "POSTROUTING", rule: firewall.Rule{Src: address, OutIface: "!" + bridgeIface, Target: firewall.Masquerade}}
+		hpNatRule   = iptRule{table: firewall.Nat, chain: "POSTROUTING", rule: firewall.Rule{SrcLocal: true, OutIface: bridgeIface, Target: firewall.Masquerade}}
+		outRule     = iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: bridgeIface, OutIface: "!" + bridgeIface, Target: firewall.Accept}}
+		inRule      = iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{OutIface: bridgeIface, CtState: "RELATED,ESTABLISHED", Target: firewall.Accept}}
+		outDropRule = iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: bridgeIface, Dst: "!" + address, Target: firewall.Drop}}
+		inDropRule  = iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{OutIface: bridgeIface, Src: "!" + address, Target: firewall.Drop}}
+		changes     []firewall.RuleChange
 	)
 
+	add := func(rule iptRule, action firewall.Action) {
+		changes = append(changes, firewall.RuleChange{Table: rule.table, Chain: rule.chain, Action: action, Rule: rule.rule})
+	}
+
+	// Internal networks have no external connectivity:
+	// drop any traffic from and to the outside world.
+	if internal {
+		add(outDropRule, firewall.Insert)
+		add(inDropRule, firewall.Insert)
+	}
+
 	// Set NAT.
-	if ipmasq {
-		if err := programChainRule(natRule, "NAT", enable); err != nil {
-			return err
-		}
+	if ipmasq && !internal {
+		add(natRule, firewall.Insert)
 	}
 
 	// In hairpin mode, masquerade traffic from localhost
 	if hairpin {
-		if err := programChainRule(hpNatRule, "MASQ LOCAL HOST", enable); err != nil {
-			return err
-		}
+		add(hpNatRule, firewall.Insert)
 	}
 
 	// Set Inter Container Communication.
-	if err := setIcc(bridgeIface, icc, enable); err != nil {
-		return err
+	current, _ := iccRules(bridgeIface, icc)
+	add(current.iptRule, current.action)
+
+	if !internal {
+		// Set Accept on all non-intercontainer outgoing packets.
+		add(outRule, firewall.Insert)
+		// Set Accept on incoming packets for existing connections.
+		add(inRule, firewall.Insert)
 	}
 
-	// Set Accept on all non-intercontainer outgoing packets.
-	if err := programChainRule(outRule, "ACCEPT NON_ICC OUTGOING", enable); err != nil {
-		return err
+	return changes
+}
+
+func setupIPTablesInternal(fw firewall.Backend, bridgeIface string, addr net.Addr, icc, ipmasq, internal, hairpin, enable bool) error {
+	var changes []firewall.RuleChange
+
+	// The ICC rule of the other setting is replaced
+	if _, other := iccRules(bridgeIface, icc); enable && fw.Exists(other.table, other.chain, other.rule) {
+		changes = append(changes, firewall.RuleChange{Table: other.table, Chain: other.chain, Action: firewall.Delete, Rule: other.rule})
 	}
 
-	// Set Accept on incoming packets for existing connections.
-	if err := programChainRule(inRule, "ACCEPT INCOMING", enable); err != nil {
-		return err
+	for _, c := range bridgeRules(bridgeIface, addr, icc, ipmasq, internal, hairpin) {
+		exists := fw.Exists(c.Table, c.Chain, c.Rule)
+		if enable && !exists {
+			changes = append(changes, c)
+		} else if !enable && exists {
+			c.Action = firewall.Delete
+			changes = append(changes, c)
+		}
+	}
+
+	// The rules of the bridge are programmed all together or not at all
+	if err := fw.Apply(changes); err != nil {
+		operation := "enable"
+		if !enable {
+			operation = "disable"
+		}
+		return fmt.Errorf("Unable to %s the rules of bridge %s: %s", operation, bridgeIface, err.Error())
 	}
 
 	return nil
 }
 
-func programChainRule(rule iptRule, ruleDescr string, insert bool) error {
-	var (
-		prefix    []string
-		operation string
-		condition bool
-		doesExist = iptables.Exists(rule.table, rule.chain, rule.args...)
-	)
+// ruleChange returns the change inserting the rule when it does not exist
+// or deleting it when it does, and whether a change is needed at all.
+func ruleChange(fw firewall.Backend, rule iptRule, insert bool) (firewall.RuleChange, bool) {
+	doesExist := fw.Exists(rule.table, rule.chain, rule.rule)
+	change := firewall.RuleChange{Table: rule.table, Chain: rule.chain, Rule: rule.rule}
 
 	if insert {
-		condition = !doesExist
-		prefix = []string{"-I", rule.chain}
-		operation = "enable"
-	} else {
-		condition = doesExist
-		prefix = []string{"-D", rule.chain}
-		operation = "disable"
-	}
-	if rule.preArgs != nil {
-		prefix = append(rule.preArgs, prefix...)
-	}
-
-	if condition {
-		if output, err := iptables.Raw(append(prefix, rule.args...)...); err != nil {
-			return fmt.Errorf("Unable to %s %s rule: %s", operation, ruleDescr, err.Error())
-		} else if len(output) != 0 {
-			return &iptables.ChainError{Chain: rule.chain, Output: output}
+		change.Action = firewall.Insert
+		return change, !doesExist
+	}
+	change.Action = firewall.Delete
+	return change, doesExist
+}
+
+func programChainRule(fw firewall.Backend, rule iptRule, ruleDescr string, insert bool) error {
+	change, ok := ruleChange(fw, rule, insert)
+	if !ok {
+		return nil
+	}
+
+	if err := fw.Apply([]firewall.RuleChange{change}); err != nil {
+		operation := "enable"
+		if !insert {
+			operation = "disable"
 		}
+		return fmt.Errorf("Unable to %s %s rule: %s", operation, ruleDescr, err.Error())
 	}
 
 	return nil
 }
 
-func setIcc(bridgeIface string, iccEnable, insert bool) error {
+// iccRule is a rule along with the action programming it.
+type iccRule struct {
+	iptRule
+	action firewall.Action
+}
+
+// iccRules returns the rule allowing or preventing the Inter Container
+// Communication on the bridge, and the rule of the other setting.
+func iccRules(bridgeIface string, iccEnable bool) (iccRule, iccRule) {
 	var (
-		table      = iptables.Filter
-		chain      = "FORWARD"
-		args       = []string{"-i", bridgeIface, "-o", bridgeIface, "-j"}
-		acceptArgs = append(args, "ACCEPT")
-		dropArgs   = append(args, "DROP")
+		acceptRule = iccRule{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: bridgeIface, OutIface: bridgeIface, Target: firewall.Accept}}, firewall.Insert}
+		dropRule   = iccRule{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: bridgeIface, OutIface: bridgeIface, Target: firewall.Drop}}, firewall.Append}
 	)
 
-	if insert {
-		if !iccEnable {
-			iptables.Raw(append([]string{"-D", chain}, acceptArgs...)...)
-
-			if !iptables.Exists(table, chain, dropArgs...) {
-				if output, err := iptables.Raw(append([]string{"-A", chain}, dropArgs...)...); err != nil {
-					return fmt.Errorf("Unable to prevent intercontainer communication: %s", err.Error())
-				} else if len(output) != 0 {
-					return fmt.Errorf("Error disabling intercontainer communication: %s", output)
-				}
-			}
-		} else {
-			iptables.Raw(append([]string{"-D", chain}, dropArgs...)...)
-
-			if !iptables.Exists(table, chain, acceptArgs...) {
-				if output, err := iptables.Raw(append([]string{"-I", chain}, acceptArgs...)...); err != nil {
-					return fmt.Errorf("Unable to allow intercontainer communication: %s", err.Error())
-				} else if len(output) != 0 {
-					return fmt.Errorf("Error enabling intercontainer communication: %s", output)
-				}
-			}
-		}
-	} else {
-		// Remove any ICC rule.
-		if !iccEnable {
-			if iptables.Exists(table, chain, dropArgs...) {
-				iptables.Raw(append([]string{"-D", chain}, dropArgs...)...)
-			}
-		} else {
-			if iptables.Exists(table, chain, acceptArgs...) {
-				iptables.Raw(append([]string{"-D", chain}, acceptArgs...)...)
-			}
-		}
+	if iccEnable {
+		return acceptRule, dropRule
 	}
+	return dropRule, acceptRule
+}
 
-	return nil
+// incRules returns the rules preventing the Inter Network Communication
+// between the two networks, in both directions.
+func incRules(network1, network2 string) []firewall.RuleChange {
+	return []firewall.RuleChange{
+		{Table: firewall.Filter, Chain: "FORWARD", Action: firewall.Insert, Rule: firewall.Rule{Src: network1, Dst: network2, Target: firewall.Drop}},
+		{Table: firewall.Filter, Chain: "FORWARD", Action: firewall.Insert, Rule: firewall.Rule{Src: network2, Dst: network1, Target: firewall.Drop}},
+	}
 }
 
 // Control Inter Network Communication. Install/remove only if it is not/is present.
-func setINC(network1, network2 string, enable bool) error {
-	var (
-		table = iptables.Filter
-		chain = "FORWARD"
-		args  = [2][]string{{"-s", network1, "-d", network2, "-j", "DROP"}, {"-s", network2, "-d", network1, "-j", "DROP"}}
-	)
-
-	if enable {
-		for i := 0; i < 2; i++ {
-			if iptables.Exists(table, chain, args[i]...) {
-				continue
-			}
-			if output, err := iptables.Raw(append([]string{"-I", chain}, args[i]...)...); err != nil {
-				return fmt.Errorf("unable to add inter-network communication rule: %s", err.Error())
-			} else if len(output) != 0 {
-				return fmt.Errorf("error adding inter-network communication rule: %s", string(output))
-			}
+func setINC(fw firewall.Backend, network1, network2 string, enable bool) error {
+	for _, c := range incRules(network1, network2) {
+		if fw.Exists(c.Table, c.Chain, c.Rule) == enable {
+			continue
 		}
-	} else {
-		for i := 0; i < 2; i++ {
-			if !iptables.Exists(table, chain, args[i]...) {
-				continue
-			}
-			if output, err := iptables.Raw(append([]string{"-D", chain}, args[i]...)...); err != nil {
-				return fmt.Errorf("unable to remove inter-network communication rule: %s", err.Error())
-			} else if len(output) != 0 {
-				return fmt.Errorf("error removing inter-network communication rule: %s", string(output))
+		if enable {
+			if err := fw.ProgramRule(c.Table, c.Chain, c.Action, c.Rule); err != nil {
+				return fmt.Errorf("unable to add inter-network communication rule: %s", err.Error())
 			}
+		} else if err := fw.ProgramRule(c.Table, c.Chain, firewall.Delete, c.Rule); err != nil {
+			return fmt.Errorf("unable to remove inter-network communication rule: %s", err.Error())
 		}
 	}
 
@@ -4,7 +4,7 @@ import (
 	"net"
 	"testing"
 
-	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/firewall"
 	"github.com/docker/libnetwork/portmapper"
 	"github.com/docker/libnetwork/testutils"
 )
@@ -23,17 +23,18 @@ func TestProgramIPTable(t *testing.T) {
 		rule  iptRule
 		descr string
 	}{
-		{iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-d", "127.1.2.3", "-i", "lo", "-o", "lo", "-j", "DROP"}}, "Test Loopback"},
-		{iptRule{table: iptables.Nat, chain: "POSTROUTING", preArgs: []string{"-t", "nat"}, args: []string{"-s", iptablesTestBridgeIP, "!", "-o", DefaultBridgeName, "-j", "MASQUERADE"}}, "NAT Test"},
-		{iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-i", DefaultBridgeName, "!", "-o", DefaultBridgeName, "-j", "ACCEPT"}}, "Test ACCEPT NON_ICC OUTGOING"},
-		{iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-o", DefaultBridgeName, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}}, "Test ACCEPT INCOMING"},
-		{iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-i", DefaultBridgeName, "-o", DefaultBridgeName, "-j", "ACCEPT"}}, "Test enable ICC"},
-		{iptRule{table: iptables.Filter, chain: "FORWARD", args: []string{"-i", DefaultBridgeName, "-o", DefaultBridgeName, "-j", "DROP"}}, "Test disable ICC"},
+		{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{Dst: "127.1.2.3", InIface: "lo", OutIface: "lo", Target: firewall.Drop}}, "Test Loopback"},
+		{iptRule{table: firewall.Nat, chain: "POSTROUTING", rule: firewall.Rule{Src: iptablesTestBridgeIP, OutIface: "!" + DefaultBridgeName, Target: firewall.Masquerade}}, "NAT Test"},
+		{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: DefaultBridgeName, OutIface: "!" + DefaultBridgeName, Target: firewall.Accept}}, "Test ACCEPT NON_ICC OUTGOING"},
+		{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{OutIface: DefaultBridgeName, CtState: "RELATED,ESTABLISHED", Target: firewall.Accept}}, "Test ACCEPT INCOMING"},
+		{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: DefaultBridgeName, OutIface: DefaultBridgeName, Target: firewall.Accept}}, "Test enable ICC"},
+		{iptRule{table: firewall.Filter, chain: "FORWARD", rule: firewall.Rule{InIface: DefaultBridgeName, OutIface: DefaultBridgeName, Target: firewall.Drop}}, "Test disable ICC"},
 	}
 
 	// Assert the chain rules' insertion and removal.
+	fw := newDriver().firewall
 	for _, c := range rules {
-		assertIPTableChainProgramming(c.rule, c.descr, t)
+		assertIPTableChainProgramming(fw, c.rule, c.descr, t)
 	}
 }
 
@@ -44,9 +45,8 @@ func TestSetupIPChains(t *testing.T) {
 	driverconfig := &configuration{
 		EnableIPTables: true,
 	}
-	d := &driver{
-		config: driverconfig,
-	}
+	d := newDriver()
+	d.config = driverconfig
 	assertChainConfig(d, t)
 
 	config := getBasicTestConfig()
@@ -63,6 +63,10 @@ func TestSetupIPChains(t *testing.T) {
 
 	config.EnableIPMasquerade = false
 	assertBridgeConfig(config, br, d, t)
+
+	config.EnableIPMasquerade = true
+	config.Internal = true
+	assertBridgeConfig(config, br, d, t)
 }
 
 func getBasicTestConfig() *networkConfiguration {
@@ -82,20 +86,20 @@ func createTestBridge(config *networkConfiguration, br *bridgeInterface, t *test
 }
 
 // Assert base function which pushes iptables chain rules on insertion and removal.
-func assertIPTableChainProgramming(rule iptRule, descr string, t *testing.T) {
+func assertIPTableChainProgramming(fw firewall.Backend, rule iptRule, descr string, t *testing.T) {
 	// Add
-	if err := programChainRule(rule, descr, true); err != nil {
+	if err := programChainRule(fw, rule, descr, true); err != nil {
 		t.Fatalf("Failed to program iptable rule %s: %s", descr, err.Error())
 	}
-	if iptables.Exists(rule.table, rule.chain, rule.args...) == false {
+	if fw.Exists(rule.table, rule.chain, rule.rule) == false {
 		t.Fatalf("Failed to effectively program iptable rule: %s", descr)
 	}
 
 	// Remove
-	if err := programChainRule(rule, descr, false); err != nil {
+	if err := programChainRule(fw, rule, descr, false); err != nil {
 		t.Fatalf("Failed to remove iptable rule %s: %s", descr, err.Error())
 	}
-	if iptables.Exists(rule.table, rule.chain, rule.args...) == true {
+	if fw.Exists(rule.table, rule.chain, rule.rule) == true {
 		t.Fatalf("Failed to effectively remove iptable rule: %s", descr)
 	}
 }
@@ -104,7 +108,7 @@ func assertIPTableChainProgramming(rule iptRule, descr string, t *testing.T) {
 func assertChainConfig(d *driver, t *testing.T) {
 	var err error
 
-	d.natChain, d.filterChain, err = setupIPChains(d.config)
+	d.natChain, d.filterChain, err = setupIPChains(d.config, d.firewall)
 	if err != nil {
 		t.Fatal(err)
 	}
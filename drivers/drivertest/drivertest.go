@@ -0,0 +1,178 @@
+// Package drivertest holds the fixtures shared by the tests of the drivers
+// which attach the containers to a parent interface, like macvlan and ipvlan.
+package drivertest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// Registrar is a driverapi.DriverCallback which records the driver
+// registered under the expected network type.
+type Registrar struct {
+	t           *testing.T
+	networkType string
+	Driver      driverapi.Driver
+}
+
+// NewRegistrar returns a registrar expecting a driver for networkType.
+func NewRegistrar(t *testing.T, networkType string) *Registrar {
+	return &Registrar{t: t, networkType: networkType}
+}
+
+// RegisterDriver records the driver, failing the test on an unexpected name.
+func (r *Registrar) RegisterDriver(name string, drv driverapi.Driver,
+	cap driverapi.Capability) error {
+	if name != r.networkType {
+		r.t.Fatalf("Expected driver register name to be %q. Instead got %q",
+			r.networkType, name)
+	}
+
+	r.Driver = drv
+	return nil
+}
+
+// Endpoint records what the driver programs through the interface and the
+// join info of an endpoint.
+type Endpoint struct {
+	Mac     net.HardwareAddr
+	Addr    *net.IPNet
+	AddrV6  *net.IPNet
+	SrcName string
+	DstName string
+	Gw      net.IP
+	Gw6     net.IP
+	Routes  []types.StaticRoute
+}
+
+// MacAddress returns the MAC address of the endpoint.
+func (te *Endpoint) MacAddress() net.HardwareAddr {
+	return te.Mac
+}
+
+// Address returns the IPv4 address of the endpoint.
+func (te *Endpoint) Address() *net.IPNet {
+	return te.Addr
+}
+
+// AddressIPv6 returns the IPv6 address of the endpoint.
+func (te *Endpoint) AddressIPv6() *net.IPNet {
+	return te.AddrV6
+}
+
+// Addresses returns the secondary addresses of the endpoint.
+func (te *Endpoint) Addresses() []*net.IPNet {
+	return nil
+}
+
+// SetMacAddress sets the MAC address, unless one is already present.
+func (te *Endpoint) SetMacAddress(mac net.HardwareAddr) error {
+	if te.Mac != nil {
+		return types.ForbiddenErrorf("endpoint interface MAC address present (%s). Cannot be modified with %s.", te.Mac, mac)
+	}
+	te.Mac = types.GetMacCopy(mac)
+	return nil
+}
+
+// SetIPAddress refuses the address, as it is assigned by IPAM.
+func (te *Endpoint) SetIPAddress(address *net.IPNet) error {
+	return types.ForbiddenErrorf("endpoint interface IP address is assigned by IPAM")
+}
+
+// SetNames records the names of the interface.
+func (te *Endpoint) SetNames(srcName string, dstName string) error {
+	te.SrcName = srcName
+	te.DstName = dstName
+	return nil
+}
+
+// InterfaceName returns the endpoint itself.
+func (te *Endpoint) InterfaceName() driverapi.InterfaceNameInfo {
+	return te
+}
+
+// SetGateway records the IPv4 gateway.
+func (te *Endpoint) SetGateway(gw net.IP) error {
+	te.Gw = gw
+	return nil
+}
+
+// SetGatewayIPv6 records the IPv6 gateway.
+func (te *Endpoint) SetGatewayIPv6(gw6 net.IP) error {
+	te.Gw6 = gw6
+	return nil
+}
+
+// AddStaticRoute records the route.
+func (te *Endpoint) AddStaticRoute(destination *net.IPNet, routeType int, nextHop net.IP) error {
+	te.Routes = append(te.Routes, types.StaticRoute{Destination: destination, RouteType: routeType, NextHop: nextHop})
+	return nil
+}
+
+// CreateDummyLink creates a dummy parent interface, skipping the test when
+// it cannot be created.
+func CreateDummyLink(t *testing.T, name string) {
+	dummy := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name}}
+	if err := netlink.LinkAdd(dummy); err != nil {
+		t.Skipf("Failed to create dummy link %s: %v", name, err)
+	}
+}
+
+// IPv4Data returns the pool 192.168.110.0/24, with the gateway .1 and the
+// auxiliary address .2.
+func IPv4Data(t *testing.T) []driverapi.IPAMData {
+	_, pool, err := net.ParseCIDR("192.168.110.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw, err := types.ParseCIDR("192.168.110.1/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aux, err := types.ParseCIDR("192.168.110.2/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []driverapi.IPAMData{{
+		Pool:         pool,
+		Gateway:      gw,
+		AuxAddresses: map[string]*net.IPNet{"host": aux},
+	}}
+}
+
+// CheckParseVlanParent runs the parser of the parent interfaces of the form
+// eth0.100 against the valid and the invalid parents.
+func CheckParseVlanParent(t *testing.T, parse func(string) (string, int, error)) {
+	for parent, exp := range map[string]struct {
+		master string
+		vlanID int
+		valid  bool
+	}{
+		"eth0":       {master: "eth0", valid: true},
+		"eth0.100":   {master: "eth0", vlanID: 100, valid: true},
+		"bond0.1.20": {master: "bond0.1", vlanID: 20, valid: true},
+		"eth0.":      {},
+		".100":       {},
+		"eth0.abc":   {},
+		"eth0.0":     {},
+		"eth0.4095":  {},
+	} {
+		master, vlanID, err := parse(parent)
+		if !exp.valid {
+			if _, ok := err.(types.BadRequestError); !ok {
+				t.Fatalf("Expected bad request error for parent %s, got %v", parent, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected failure for parent %s: %v", parent, err)
+		}
+		if master != exp.master || vlanID != exp.vlanID {
+			t.Fatalf("Unexpected result for parent %s: %s %d", parent, master, vlanID)
+		}
+	}
+}
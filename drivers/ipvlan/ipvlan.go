@@ -0,0 +1,58 @@
+// Package ipvlan implements a network driver attaching the containers to
+// the network of a host interface through ipvlan links, which share the
+// MAC address of the parent interface.
+package ipvlan
+
+import (
+	"sync"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/driverapi"
+)
+
+const (
+	networkType       = "ipvlan"
+	ipvlanPrefix      = "ipvl"
+	ipvlanLen         = 7
+	dummyPrefix       = "di-"
+	containerIfPrefix = "eth"
+	parentOpt         = "parent"      // parent interface, eth0 or eth0.100 for an 802.1q sub-interface
+	modeOpt           = "ipvlan_mode" // ipvlan mode, l2 when not specified
+	vlanOpt           = "vlan"        // vlan id of the 802.1q sub-interface of the parent
+	modeL2            = "l2"
+	modeL3            = "l3"
+	maxVlanID         = 4094
+	defaultIpvlanMode = modeL2
+)
+
+type driver struct {
+	networks networkTable
+	sync.Mutex
+}
+
+// Init registers a new instance of ipvlan driver
+func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
+	c := driverapi.Capability{
+		DataScope: datastore.LocalScope,
+	}
+
+	d := &driver{
+		networks: networkTable{},
+	}
+
+	return dc.RegisterDriver(networkType, d, c)
+}
+
+func (d *driver) Type() string {
+	return networkType
+}
+
+// DiscoverNew is a notification for a new discovery event, such as a new node joining a cluster
+func (d *driver) DiscoverNew(dType driverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
+
+// DiscoverDelete is a notification for a discovery delete event, such as a node leaving a cluster
+func (d *driver) DiscoverDelete(dType driverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package ipvlan
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/types"
+)
+
+type endpointTable map[string]*endpoint
+
+type endpoint struct {
+	id     string
+	addr   *net.IPNet
+	addrv6 *net.IPNet
+}
+
+func (n *network) endpoint(eid string) *endpoint {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.endpoints[eid]
+}
+
+func (n *network) addEndpoint(ep *endpoint) {
+	n.Lock()
+	n.endpoints[ep.id] = ep
+	n.Unlock()
+}
+
+func (n *network) deleteEndpoint(eid string) {
+	n.Lock()
+	delete(n.endpoints, eid)
+	n.Unlock()
+}
+
+func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, epOptions map[string]interface{}) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ifInfo == nil {
+		return types.BadRequestErrorf("no interface information for ipvlan endpoint %s", eid)
+	}
+
+	// All the ipvlan links share the parent MAC address
+	if ifInfo.MacAddress() != nil {
+		return types.ForbiddenErrorf("ipvlan endpoint %s cannot have its own MAC address", eid)
+	}
+
+	ep := &endpoint{
+		id:     eid,
+		addr:   ifInfo.Address(),
+		addrv6: ifInfo.AddressIPv6(),
+	}
+	if ep.addr == nil && ep.addrv6 == nil {
+		return fmt.Errorf("create endpoint was not passed interface IP address")
+	}
+
+	for _, addr := range []*net.IPNet{ep.addr, ep.addrv6} {
+		if addr != nil && n.config.isReserved(addr.IP) {
+			return types.ForbiddenErrorf("address %s is reserved on ipvlan network %s", addr.IP, nid)
+		}
+	}
+
+	n.addEndpoint(ep)
+
+	return nil
+}
+
+func (d *driver) DeleteEndpoint(nid, eid string) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep := n.endpoint(eid); ep == nil {
+		return fmt.Errorf("endpoint id %q not found", eid)
+	}
+
+	// Once the sandbox is gone the link is back in the host namespace
+	if err := deleteLink(ipvlanName(eid)); err != nil {
+		logrus.Warnf("Failed to delete ipvlan link of endpoint %s: %v", eid, err)
+	}
+
+	n.deleteEndpoint(eid)
+
+	return nil
+}
+
+func (d *driver) EndpointOperInfo(nid, eid string) (map[string]interface{}, error) {
+	return make(map[string]interface{}, 0), nil
+}
+
+// RestoreEndpoint is invoked by the controller for the endpoints of the
+// ipvlan networks found in its stores.
+func (d *driver) RestoreEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, sboxKey string) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep := n.endpoint(eid); ep != nil {
+		return nil
+	}
+
+	if ifInfo == nil {
+		return types.BadRequestErrorf("no interface information for ipvlan endpoint %s", eid)
+	}
+
+	n.addEndpoint(&endpoint{
+		id:     eid,
+		addr:   ifInfo.Address(),
+		addrv6: ifInfo.AddressIPv6(),
+	})
+
+	return nil
+}
+
+func validateID(nid, eid string) error {
+	if nid == "" {
+		return fmt.Errorf("invalid network id")
+	}
+
+	if eid == "" {
+		return fmt.Errorf("invalid endpoint id")
+	}
+
+	return nil
+}
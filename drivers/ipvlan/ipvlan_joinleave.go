@@ -0,0 +1,103 @@
+package ipvlan
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/types"
+)
+
+var (
+	defaultRoute     = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	defaultRouteIPv6 = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+)
+
+// Join method is invoked when a Sandbox is attached to an endpoint.
+func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep := n.endpoint(eid)
+	if ep == nil {
+		return fmt.Errorf("could not find endpoint with id %s", eid)
+	}
+
+	n.Lock()
+	config := n.config
+	n.Unlock()
+
+	name := ipvlanName(eid)
+	if err := createIpvlan(name, config.Parent, config.IpvlanMode); err != nil {
+		return err
+	}
+
+	if iNames := jinfo.InterfaceName(); iNames != nil {
+		if err := iNames.SetNames(name, containerIfPrefix); err != nil {
+			return err
+		}
+	}
+
+	// The networks confined to the host have no default route
+	if config.Internal {
+		return nil
+	}
+
+	// In l3 mode the parent routes the traffic of the ipvlan links,
+	// which have a connected default route rather than a gateway
+	if config.IpvlanMode == modeL3 {
+		if ep.addr != nil {
+			if err := jinfo.AddStaticRoute(defaultRoute, types.CONNECTED, nil); err != nil {
+				return err
+			}
+		}
+		if ep.addrv6 != nil {
+			if err := jinfo.AddStaticRoute(defaultRouteIPv6, types.CONNECTED, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// In l2 mode the default gateway is the router of the parent segment
+	if ep.addr != nil {
+		if gw := config.gateway(ep.addr.IP); gw != nil {
+			if err := jinfo.SetGateway(gw); err != nil {
+				return err
+			}
+		}
+	}
+	if ep.addrv6 != nil {
+		if gw := config.gateway(ep.addrv6.IP); gw != nil {
+			if err := jinfo.SetGatewayIPv6(gw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Leave method is invoked when a Sandbox detaches from an endpoint.
+func (d *driver) Leave(nid, eid string) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep := n.endpoint(eid); ep == nil {
+		return fmt.Errorf("could not find endpoint with id %s", eid)
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package ipvlan
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/types"
+)
+
+type networkTable map[string]*network
+
+// configuration is the ipvlan network configuration.
+type configuration struct {
+	Parent          string
+	IpvlanMode      string
+	Internal        bool
+	CreatedSubIface bool
+	DummyParent     bool
+	IPv4Data        []driverapi.IPAMData
+	IPv6Data        []driverapi.IPAMData
+}
+
+type network struct {
+	id        string
+	config    *configuration
+	endpoints endpointTable
+	sync.Mutex
+}
+
+func (d *driver) CreateNetwork(nid string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	if nid == "" {
+		return fmt.Errorf("invalid network id")
+	}
+
+	config, err := parseNetworkOptions(nid, option)
+	if err != nil {
+		return err
+	}
+	config.IPv4Data = ipV4Data
+	config.IPv6Data = ipV6Data
+
+	d.Lock()
+	if _, ok := d.networks[nid]; ok {
+		d.Unlock()
+		return types.ForbiddenErrorf("network %s exists", nid)
+	}
+	for _, n := range d.networks {
+		if n.config.Parent == config.Parent {
+			d.Unlock()
+			return types.ForbiddenErrorf("parent interface %s is in use by network %s", config.Parent, n.id)
+		}
+	}
+	d.Unlock()
+
+	if config.DummyParent {
+		err = createDummyParent(config.Parent)
+	} else {
+		config.CreatedSubIface, err = setupParent(config.Parent)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	d.networks[nid] = &network{
+		id:        nid,
+		config:    config,
+		endpoints: endpointTable{},
+	}
+	d.Unlock()
+
+	logrus.Debugf("Created ipvlan network %s on parent %s in %s mode", nid, config.Parent, config.IpvlanMode)
+
+	return nil
+}
+
+func (d *driver) DeleteNetwork(nid string) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	config := n.config
+	for eid := range n.endpoints {
+		if err := deleteLink(ipvlanName(eid)); err != nil {
+			logrus.Warnf("Failed to delete ipvlan link of endpoint %s: %v", eid, err)
+		}
+	}
+	n.Unlock()
+
+	// Only the links this driver created are deleted
+	if config.CreatedSubIface || config.DummyParent {
+		if err := deleteLink(config.Parent); err != nil {
+			logrus.Warnf("Failed to delete parent interface %s of ipvlan network %s: %v", config.Parent, nid, err)
+		}
+	}
+
+	d.Lock()
+	delete(d.networks, nid)
+	d.Unlock()
+
+	return nil
+}
+
+// RestoreNetwork is invoked by the controller for the ipvlan networks found
+// in its stores. A parent sub-interface which survived the restart is reused,
+// and it is left in place when the network is later deleted.
+func (d *driver) RestoreNetwork(nid string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	if _, err := d.getNetwork(nid); err == nil {
+		return nil
+	}
+
+	return d.CreateNetwork(nid, option, ipV4Data, ipV6Data)
+}
+
+func (d *driver) getNetwork(nid string) (*network, error) {
+	if nid == "" {
+		return nil, fmt.Errorf("invalid network id")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	n, ok := d.networks[nid]
+	if !ok {
+		return nil, types.NotFoundErrorf("network %s does not exist", nid)
+	}
+	return n, nil
+}
+
+// gateway returns the IPAM provided gateway of the subnet the address belongs to.
+func (config *configuration) gateway(ip net.IP) net.IP {
+	data := config.IPv4Data
+	if ip.To4() == nil {
+		data = config.IPv6Data
+	}
+	for _, d := range data {
+		if d.Pool != nil && d.Pool.Contains(ip) && d.Gateway != nil {
+			return d.Gateway.IP
+		}
+	}
+	return nil
+}
+
+// isReserved returns whether the address is the gateway or one of the
+// IPAM auxiliary addresses, which are in use by hosts outside of the
+// network on the parent interface segment.
+func (config *configuration) isReserved(ip net.IP) bool {
+	data := config.IPv4Data
+	if ip.To4() == nil {
+		data = config.IPv6Data
+	}
+	for _, d := range data {
+		if d.Gateway != nil && d.Gateway.IP.Equal(ip) {
+			return true
+		}
+		for _, aux := range d.AuxAddresses {
+			if aux != nil && aux.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseNetworkOptions(nid string, option map[string]interface{}) (*configuration, error) {
+	config := &configuration{IpvlanMode: defaultIpvlanMode}
+
+	if genData, ok := option[netlabel.GenericData]; ok && genData != nil {
+		if err := config.fromOptions(genData); err != nil {
+			return nil, err
+		}
+	}
+
+	if val, ok := option[netlabel.Internal]; ok {
+		if internal, ok := val.(bool); ok && internal {
+			config.Internal = true
+		}
+	}
+
+	if _, ok := ipvlanModes[config.IpvlanMode]; !ok {
+		return nil, types.BadRequestErrorf("unknown ipvlan mode %s, must be one of %s or %s",
+			config.IpvlanMode, modeL2, modeL3)
+	}
+
+	// Without a parent the network is confined to the host, through a dummy link
+	if config.Parent == "" {
+		id := nid
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		config.Parent = dummyPrefix + id
+		config.DummyParent = true
+		config.Internal = true
+	} else if _, _, err := parseVlanParent(config.Parent); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (config *configuration) fromOptions(data interface{}) error {
+	var opts map[string]interface{}
+
+	switch opt := data.(type) {
+	case map[string]string:
+		opts = make(map[string]interface{}, len(opt))
+		for k, v := range opt {
+			opts[k] = v
+		}
+	case map[string]interface{}:
+		opts = opt
+	case options.Generic:
+		opts = opt
+	default:
+		return types.BadRequestErrorf("do not recognize network configuration format: %T", opt)
+	}
+
+	if i, ok := opts[parentOpt]; ok && i != nil {
+		if config.Parent, ok = i.(string); !ok {
+			return types.BadRequestErrorf("invalid type for %s value", parentOpt)
+		}
+	}
+
+	if i, ok := opts[modeOpt]; ok && i != nil {
+		s, ok := i.(string)
+		if !ok {
+			return types.BadRequestErrorf("invalid type for %s value", modeOpt)
+		}
+		if s != "" {
+			config.IpvlanMode = s
+		}
+	}
+
+	// The vlan option is a shorthand for the parent sub-interface
+	if i, ok := opts[vlanOpt]; ok && i != nil {
+		s, ok := i.(string)
+		if !ok {
+			return types.BadRequestErrorf("invalid type for %s value", vlanOpt)
+		}
+		if s != "" {
+			if config.Parent == "" {
+				return types.BadRequestErrorf("%s option requires the %s option", vlanOpt, parentOpt)
+			}
+			if _, vlanID, err := parseVlanParent(config.Parent); err != nil || vlanID != 0 {
+				return types.BadRequestErrorf("%s option conflicts with parent sub-interface %s", vlanOpt, config.Parent)
+			}
+			config.Parent = config.Parent + "." + s
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package ipvlan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+var ipvlanModes = map[string]netlink.IPVlanMode{
+	modeL2: netlink.IPVLAN_MODE_L2,
+	modeL3: netlink.IPVLAN_MODE_L3,
+}
+
+// createIpvlan creates the ipvlan link of the endpoint on top of
+// the parent interface, replacing the one left over by a previous join.
+func createIpvlan(name, parent, mode string) error {
+	defer osl.InitOSContext()()
+
+	ipvMode, ok := ipvlanModes[mode]
+	if !ok {
+		return types.BadRequestErrorf("unknown ipvlan mode %s", mode)
+	}
+
+	parentLink, err := netlink.LinkByName(parent)
+	if err != nil {
+		return fmt.Errorf("could not find parent interface %s: %v", parent, err)
+	}
+
+	if link, err := netlink.LinkByName(name); err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			return fmt.Errorf("failed to delete stale ipvlan link %s: %v", name, err)
+		}
+	}
+
+	ipv := &netlink.IPVlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        name,
+			ParentIndex: parentLink.Attrs().Index,
+		},
+		Mode: ipvMode,
+	}
+	if err := netlink.LinkAdd(ipv); err != nil {
+		return fmt.Errorf("failed to create ipvlan link %s on parent %s: %v", name, parent, err)
+	}
+
+	return nil
+}
+
+// ipvlanName returns the name of the ipvlan link of the endpoint.
+func ipvlanName(eid string) string {
+	if len(eid) > ipvlanLen {
+		eid = eid[:ipvlanLen]
+	}
+	return ipvlanPrefix + eid
+}
+
+// deleteLink deletes the link, if it exists.
+func deleteLink(name string) error {
+	defer osl.InitOSContext()()
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil
+	}
+	return netlink.LinkDel(link)
+}
+
+// parseVlanParent splits a parent of the form eth0.100 into
+// the physical interface and the vlan id. The vlan id is 0
+// when the parent is not a sub-interface.
+func parseVlanParent(parent string) (string, int, error) {
+	i := strings.LastIndex(parent, ".")
+	if i < 0 {
+		return parent, 0, nil
+	}
+
+	master, vid := parent[:i], parent[i+1:]
+	vlanID, err := strconv.Atoi(vid)
+	if err != nil || master == "" {
+		return "", 0, types.BadRequestErrorf("invalid parent sub-interface %s, expected <interface>.<vlan id>", parent)
+	}
+	if vlanID < 1 || vlanID > maxVlanID {
+		return "", 0, types.BadRequestErrorf("invalid vlan id %d for parent %s, must be between 1 and %d", vlanID, parent, maxVlanID)
+	}
+
+	return master, vlanID, nil
+}
+
+// setupParent makes sure the parent interface exists and is up. A missing
+// 802.1q sub-interface is created, in which case true is returned so that
+// it can be deleted along with the network.
+func setupParent(parent string) (bool, error) {
+	defer osl.InitOSContext()()
+
+	if link, err := netlink.LinkByName(parent); err == nil {
+		return false, netlink.LinkSetUp(link)
+	}
+
+	master, vlanID, err := parseVlanParent(parent)
+	if err != nil {
+		return false, err
+	}
+	if vlanID == 0 {
+		return false, types.BadRequestErrorf("parent interface %s not found", parent)
+	}
+
+	masterLink, err := netlink.LinkByName(master)
+	if err != nil {
+		return false, types.BadRequestErrorf("parent interface %s of sub-interface %s not found", master, parent)
+	}
+	if err := netlink.LinkSetUp(masterLink); err != nil {
+		return false, fmt.Errorf("failed to set up parent interface %s: %v", master, err)
+	}
+
+	vlan := &netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        parent,
+			ParentIndex: masterLink.Attrs().Index,
+		},
+		VlanId: vlanID,
+	}
+	if err := netlink.LinkAdd(vlan); err != nil {
+		return false, fmt.Errorf("failed to create sub-interface %s: %v", parent, err)
+	}
+	if err := netlink.LinkSetUp(vlan); err != nil {
+		if e := netlink.LinkDel(vlan); e != nil {
+			logrus.Warnf("Failed to delete sub-interface %s: %v", parent, e)
+		}
+		return false, fmt.Errorf("failed to set up sub-interface %s: %v", parent, err)
+	}
+
+	logrus.Debugf("Created sub-interface %s with vlan id %d on %s", parent, vlanID, master)
+
+	return true, nil
+}
+
+// createDummyParent creates the dummy link used as parent by the
+// networks with no external connectivity.
+func createDummyParent(name string) error {
+	defer osl.InitOSContext()()
+
+	if _, err := netlink.LinkByName(name); err == nil {
+		return nil
+	}
+
+	dummy := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name}}
+	if err := netlink.LinkAdd(dummy); err != nil {
+		return fmt.Errorf("failed to create dummy parent %s: %v", name, err)
+	}
+	return netlink.LinkSetUp(dummy)
+}
@@ -0,0 +1,236 @@
+package ipvlan
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/drivers/drivertest"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+func setupDriver(t *testing.T) *driver {
+	r := drivertest.NewRegistrar(t, "ipvlan")
+	if err := Init(r, nil); err != nil {
+		t.Fatal(err)
+	}
+	d, ok := r.Driver.(*driver)
+	if !ok {
+		t.Fatalf("Expected driver type to be %T. Instead got %T", &driver{}, r.Driver)
+	}
+	return d
+}
+
+func TestParseVlanParent(t *testing.T) {
+	drivertest.CheckParseVlanParent(t, parseVlanParent)
+}
+
+func TestParseNetworkOptions(t *testing.T) {
+	nid := "dummynetwork00000"
+
+	config, err := parseNetworkOptions(nid, map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "eth0.10", modeOpt: modeL3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Parent != "eth0.10" || config.IpvlanMode != modeL3 || config.Internal || config.DummyParent {
+		t.Fatalf("Unexpected configuration: %+v", config)
+	}
+
+	config, err = parseNetworkOptions(nid, map[string]interface{}{
+		netlabel.GenericData: options.Generic{parentOpt: "eth0", vlanOpt: "20"},
+		netlabel.Internal:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Parent != "eth0.20" || config.IpvlanMode != defaultIpvlanMode || !config.Internal {
+		t.Fatalf("Unexpected configuration: %+v", config)
+	}
+
+	config, err = parseNetworkOptions(nid, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Parent != dummyPrefix+nid[:12] || !config.DummyParent || !config.Internal {
+		t.Fatalf("Unexpected configuration without parent: %+v", config)
+	}
+
+	for _, opt := range []interface{}{
+		map[string]string{modeOpt: "bridge"},
+		map[string]string{parentOpt: "eth0.5000"},
+		map[string]string{vlanOpt: "20"},
+		map[string]string{parentOpt: "eth0.10", vlanOpt: "20"},
+		map[string]string{parentOpt: "eth0", vlanOpt: "abc"},
+		map[string]interface{}{parentOpt: 10},
+		"eth0",
+	} {
+		if _, err := parseNetworkOptions(nid, map[string]interface{}{netlabel.GenericData: opt}); err == nil {
+			t.Fatalf("Expected failure on options %v", opt)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type on options %v: %T", opt, err)
+		}
+	}
+}
+
+func TestCreateNetwork(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := setupDriver(t)
+	drivertest.CreateDummyLink(t, "dummy0")
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy0", vlanOpt: "100"},
+	}
+	if err := d.CreateNetwork("net1", netOption, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create ipvlan network: %v", err)
+	}
+
+	link, err := netlink.LinkByName("dummy0.100")
+	if err != nil {
+		t.Fatalf("Sub-interface was not created: %v", err)
+	}
+	if vlan, ok := link.(*netlink.Vlan); !ok || vlan.VlanId != 100 {
+		t.Fatalf("Unexpected sub-interface: %#v", link)
+	}
+
+	if err := d.CreateNetwork("net2", netOption, drivertest.IPv4Data(t), nil); err == nil {
+		t.Fatalf("Expected failure on parent interface in use")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	netOption = map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy1"},
+	}
+	if err := d.CreateNetwork("net2", netOption, drivertest.IPv4Data(t), nil); err == nil {
+		t.Fatalf("Expected failure on missing parent interface")
+	}
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName("dummy0.100"); err == nil {
+		t.Fatalf("Sub-interface was not deleted along with the network")
+	}
+	if _, err := netlink.LinkByName("dummy0"); err != nil {
+		t.Fatalf("Parent interface was deleted along with the network")
+	}
+
+	if err := d.DeleteNetwork("net1"); err == nil {
+		t.Fatalf("Expected failure on deleted network")
+	}
+}
+
+func TestL2Endpoint(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := setupDriver(t)
+	drivertest.CreateDummyLink(t, "dummy0")
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy0"},
+	}
+	if err := d.CreateNetwork("net1", netOption, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create ipvlan network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	addr, _ := types.ParseCIDR("192.168.110.10/24")
+	if err := d.CreateEndpoint("net1", "ep1", &drivertest.Endpoint{Addr: addr, Mac: net.HardwareAddr{2, 0, 0, 0, 0, 1}}, nil); err == nil {
+		t.Fatalf("Expected failure on endpoint with MAC address")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	te := &drivertest.Endpoint{Addr: addr}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+	if te.Mac != nil {
+		t.Fatalf("Unexpected MAC address for ipvlan endpoint: %s", te.Mac)
+	}
+
+	if err := d.Join("net1", "ep1", "", te, nil); err != nil {
+		t.Fatalf("Failed to join endpoint: %v", err)
+	}
+	if te.SrcName != ipvlanName("ep1") || te.DstName != containerIfPrefix {
+		t.Fatalf("Unexpected interface names: %s %s", te.SrcName, te.DstName)
+	}
+	if !te.Gw.Equal(net.ParseIP("192.168.110.1")) || len(te.Routes) != 0 {
+		t.Fatalf("Unexpected gateway %v and routes %v", te.Gw, te.Routes)
+	}
+
+	link, err := netlink.LinkByName(te.SrcName)
+	if err != nil {
+		t.Fatalf("Ipvlan link was not created: %v", err)
+	}
+	if ipv, ok := link.(*netlink.IPVlan); !ok || ipv.Mode != netlink.IPVLAN_MODE_L2 {
+		t.Fatalf("Unexpected ipvlan link: %#v", link)
+	}
+	parent, err := netlink.LinkByName("dummy0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Attrs().HardwareAddr.String() != parent.Attrs().HardwareAddr.String() {
+		t.Fatalf("Ipvlan link does not share the parent MAC address")
+	}
+
+	if err := d.Leave("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(te.SrcName); err == nil {
+		t.Fatalf("Ipvlan link was not deleted along with the endpoint")
+	}
+}
+
+func TestL3Endpoint(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := setupDriver(t)
+	drivertest.CreateDummyLink(t, "dummy0")
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy0", modeOpt: modeL3},
+	}
+	if err := d.CreateNetwork("net1", netOption, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create ipvlan network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	addr, _ := types.ParseCIDR("192.168.110.10/24")
+	te := &drivertest.Endpoint{Addr: addr}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+
+	if err := d.Join("net1", "ep1", "", te, nil); err != nil {
+		t.Fatalf("Failed to join endpoint: %v", err)
+	}
+	if te.Gw != nil {
+		t.Fatalf("Unexpected gateway in l3 mode: %v", te.Gw)
+	}
+	if len(te.Routes) != 1 || te.Routes[0].RouteType != types.CONNECTED ||
+		te.Routes[0].Destination.String() != "0.0.0.0/0" {
+		t.Fatalf("Unexpected routes in l3 mode: %v", te.Routes)
+	}
+
+	link, err := netlink.LinkByName(te.SrcName)
+	if err != nil {
+		t.Fatalf("Ipvlan link was not created: %v", err)
+	}
+	if ipv, ok := link.(*netlink.IPVlan); !ok || ipv.Mode != netlink.IPVLAN_MODE_L3 {
+		t.Fatalf("Unexpected ipvlan link: %#v", link)
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+}
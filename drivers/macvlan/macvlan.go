@@ -0,0 +1,59 @@
+// Package macvlan implements a network driver attaching the containers
+// directly to the network of a host interface, each with its own MAC
+// address, through macvlan links.
+package macvlan
+
+import (
+	"sync"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/driverapi"
+)
+
+const (
+	networkType        = "macvlan"
+	macvlanPrefix      = "macv"
+	macvlanLen         = 7
+	dummyPrefix        = "dm-"
+	containerIfPrefix  = "eth"
+	parentOpt          = "parent"       // parent interface, eth0 or eth0.100 for an 802.1q sub-interface
+	modeOpt            = "macvlan_mode" // macvlan mode, bridge when not specified
+	modeBridge         = "bridge"
+	modePrivate        = "private"
+	modeVepa           = "vepa"
+	modePassthru       = "passthru"
+	maxVlanID          = 4094
+	defaultMacvlanMode = modeBridge
+)
+
+type driver struct {
+	networks networkTable
+	sync.Mutex
+}
+
+// Init registers a new instance of macvlan driver
+func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
+	c := driverapi.Capability{
+		DataScope: datastore.LocalScope,
+	}
+
+	d := &driver{
+		networks: networkTable{},
+	}
+
+	return dc.RegisterDriver(networkType, d, c)
+}
+
+func (d *driver) Type() string {
+	return networkType
+}
+
+// DiscoverNew is a notification for a new discovery event, such as a new node joining a cluster
+func (d *driver) DiscoverNew(dType driverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
+
+// DiscoverDelete is a notification for a discovery delete event, such as a node leaving a cluster
+func (d *driver) DiscoverDelete(dType driverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
@@ -0,0 +1,174 @@
+package macvlan
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+)
+
+type endpointTable map[string]*endpoint
+
+type endpoint struct {
+	id     string
+	mac    net.HardwareAddr
+	addr   *net.IPNet
+	addrv6 *net.IPNet
+}
+
+func (n *network) endpoint(eid string) *endpoint {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.endpoints[eid]
+}
+
+func (n *network) addEndpoint(ep *endpoint) {
+	n.Lock()
+	n.endpoints[ep.id] = ep
+	n.Unlock()
+}
+
+func (n *network) deleteEndpoint(eid string) {
+	n.Lock()
+	delete(n.endpoints, eid)
+	n.Unlock()
+}
+
+func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, epOptions map[string]interface{}) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ifInfo == nil {
+		return types.BadRequestErrorf("no interface information for macvlan endpoint %s", eid)
+	}
+
+	ep := &endpoint{
+		id:     eid,
+		addr:   ifInfo.Address(),
+		addrv6: ifInfo.AddressIPv6(),
+		mac:    ifInfo.MacAddress(),
+	}
+	if ep.addr == nil && ep.addrv6 == nil {
+		return fmt.Errorf("create endpoint was not passed interface IP address")
+	}
+
+	for _, addr := range []*net.IPNet{ep.addr, ep.addrv6} {
+		if addr != nil && n.config.isReserved(addr.IP) {
+			return types.ForbiddenErrorf("address %s is reserved on macvlan network %s", addr.IP, nid)
+		}
+	}
+
+	n.Lock()
+	if n.config.MacvlanMode == modePassthru && len(n.endpoints) > 0 {
+		n.Unlock()
+		return types.ForbiddenErrorf("only one endpoint is allowed on macvlan network %s in %s mode", nid, modePassthru)
+	}
+	n.Unlock()
+
+	// In passthru mode the endpoint takes over the parent MAC address
+	if ep.mac == nil && n.config.MacvlanMode != modePassthru {
+		if ep.addr != nil {
+			ep.mac = netutils.GenerateMACFromIP(ep.addr.IP)
+		} else {
+			ep.mac = netutils.GenerateRandomMAC()
+		}
+		if err := ifInfo.SetMacAddress(ep.mac); err != nil {
+			return err
+		}
+	}
+
+	n.addEndpoint(ep)
+
+	return nil
+}
+
+func (d *driver) DeleteEndpoint(nid, eid string) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep := n.endpoint(eid); ep == nil {
+		return fmt.Errorf("endpoint id %q not found", eid)
+	}
+
+	// Once the sandbox is gone the link is back in the host namespace
+	if err := deleteLink(macvlanName(eid)); err != nil {
+		logrus.Warnf("Failed to delete macvlan link of endpoint %s: %v", eid, err)
+	}
+
+	n.deleteEndpoint(eid)
+
+	return nil
+}
+
+func (d *driver) EndpointOperInfo(nid, eid string) (map[string]interface{}, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := n.endpoint(eid)
+	if ep == nil {
+		return nil, fmt.Errorf("endpoint id %q not found", eid)
+	}
+
+	m := make(map[string]interface{})
+	if ep.mac != nil {
+		m[netlabel.MacAddress] = ep.mac
+	}
+	return m, nil
+}
+
+// RestoreEndpoint is invoked by the controller for the endpoints of the
+// macvlan networks found in its stores.
+func (d *driver) RestoreEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, sboxKey string) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep := n.endpoint(eid); ep != nil {
+		return nil
+	}
+
+	if ifInfo == nil {
+		return types.BadRequestErrorf("no interface information for macvlan endpoint %s", eid)
+	}
+
+	n.addEndpoint(&endpoint{
+		id:     eid,
+		addr:   ifInfo.Address(),
+		addrv6: ifInfo.AddressIPv6(),
+		mac:    ifInfo.MacAddress(),
+	})
+
+	return nil
+}
+
+func validateID(nid, eid string) error {
+	if nid == "" {
+		return fmt.Errorf("invalid network id")
+	}
+
+	if eid == "" {
+		return fmt.Errorf("invalid endpoint id")
+	}
+
+	return nil
+}
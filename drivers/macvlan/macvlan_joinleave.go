@@ -0,0 +1,80 @@
+package macvlan
+
+import (
+	"fmt"
+
+	"github.com/docker/libnetwork/driverapi"
+)
+
+// Join method is invoked when a Sandbox is attached to an endpoint.
+func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep := n.endpoint(eid)
+	if ep == nil {
+		return fmt.Errorf("could not find endpoint with id %s", eid)
+	}
+
+	n.Lock()
+	config := n.config
+	n.Unlock()
+
+	name := macvlanName(eid)
+	if err := createMacvlan(name, config.Parent, config.MacvlanMode, ep.mac); err != nil {
+		return err
+	}
+
+	if iNames := jinfo.InterfaceName(); iNames != nil {
+		if err := iNames.SetNames(name, containerIfPrefix); err != nil {
+			return err
+		}
+	}
+
+	// The default gateway is the router of the parent segment,
+	// which the networks confined to the host do not have
+	if config.Internal {
+		return nil
+	}
+
+	if ep.addr != nil {
+		if gw := config.gateway(ep.addr.IP); gw != nil {
+			if err := jinfo.SetGateway(gw); err != nil {
+				return err
+			}
+		}
+	}
+	if ep.addrv6 != nil {
+		if gw := config.gateway(ep.addrv6.IP); gw != nil {
+			if err := jinfo.SetGatewayIPv6(gw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Leave method is invoked when a Sandbox detaches from an endpoint.
+func (d *driver) Leave(nid, eid string) error {
+	if err := validateID(nid, eid); err != nil {
+		return err
+	}
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	if ep := n.endpoint(eid); ep == nil {
+		return fmt.Errorf("could not find endpoint with id %s", eid)
+	}
+
+	return nil
+}
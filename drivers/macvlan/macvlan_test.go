@@ -0,0 +1,249 @@
+package macvlan
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/drivers/drivertest"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+func setupDriver(t *testing.T) *driver {
+	r := drivertest.NewRegistrar(t, "macvlan")
+	if err := Init(r, nil); err != nil {
+		t.Fatal(err)
+	}
+	d, ok := r.Driver.(*driver)
+	if !ok {
+		t.Fatalf("Expected driver type to be %T. Instead got %T", &driver{}, r.Driver)
+	}
+	return d
+}
+
+func TestParseVlanParent(t *testing.T) {
+	drivertest.CheckParseVlanParent(t, parseVlanParent)
+}
+
+func TestParseNetworkOptions(t *testing.T) {
+	nid := "dummynetwork00000"
+
+	config, err := parseNetworkOptions(nid, map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "eth0.10", modeOpt: modeVepa},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Parent != "eth0.10" || config.MacvlanMode != modeVepa || config.Internal || config.DummyParent {
+		t.Fatalf("Unexpected configuration: %+v", config)
+	}
+
+	config, err = parseNetworkOptions(nid, map[string]interface{}{
+		netlabel.GenericData: options.Generic{parentOpt: "eth0"},
+		netlabel.Internal:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Parent != "eth0" || config.MacvlanMode != defaultMacvlanMode || !config.Internal {
+		t.Fatalf("Unexpected configuration: %+v", config)
+	}
+
+	config, err = parseNetworkOptions(nid, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Parent != dummyPrefix+nid[:12] || !config.DummyParent || !config.Internal {
+		t.Fatalf("Unexpected configuration without parent: %+v", config)
+	}
+
+	for _, opt := range []interface{}{
+		map[string]string{modeOpt: "l2"},
+		map[string]string{parentOpt: "eth0.5000"},
+		map[string]interface{}{parentOpt: 10},
+		"eth0",
+	} {
+		if _, err := parseNetworkOptions(nid, map[string]interface{}{netlabel.GenericData: opt}); err == nil {
+			t.Fatalf("Expected failure on options %v", opt)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type on options %v: %T", opt, err)
+		}
+	}
+}
+
+func TestCreateNetwork(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := setupDriver(t)
+	drivertest.CreateDummyLink(t, "dummy0")
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy0.100"},
+	}
+	if err := d.CreateNetwork("net1", netOption, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create macvlan network: %v", err)
+	}
+
+	link, err := netlink.LinkByName("dummy0.100")
+	if err != nil {
+		t.Fatalf("Sub-interface was not created: %v", err)
+	}
+	if vlan, ok := link.(*netlink.Vlan); !ok || vlan.VlanId != 100 {
+		t.Fatalf("Unexpected sub-interface: %#v", link)
+	}
+
+	if err := d.CreateNetwork("net2", netOption, drivertest.IPv4Data(t), nil); err == nil {
+		t.Fatalf("Expected failure on parent interface in use")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	netOption = map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy1"},
+	}
+	if err := d.CreateNetwork("net2", netOption, drivertest.IPv4Data(t), nil); err == nil {
+		t.Fatalf("Expected failure on missing parent interface")
+	}
+
+	if err := d.CreateNetwork("net3", nil, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create macvlan network without parent: %v", err)
+	}
+	if _, err := netlink.LinkByName(dummyPrefix + "net3"); err != nil {
+		t.Fatalf("Dummy parent was not created: %v", err)
+	}
+
+	if err := d.DeleteNetwork("net1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName("dummy0.100"); err == nil {
+		t.Fatalf("Sub-interface was not deleted along with the network")
+	}
+	if _, err := netlink.LinkByName("dummy0"); err != nil {
+		t.Fatalf("Parent interface was deleted along with the network")
+	}
+
+	if err := d.DeleteNetwork("net3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(dummyPrefix + "net3"); err == nil {
+		t.Fatalf("Dummy parent was not deleted along with the network")
+	}
+
+	if err := d.DeleteNetwork("net1"); err == nil {
+		t.Fatalf("Expected failure on deleted network")
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := setupDriver(t)
+	drivertest.CreateDummyLink(t, "dummy0")
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy0", modeOpt: modePrivate},
+	}
+	if err := d.CreateNetwork("net1", netOption, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create macvlan network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	addr, _ := types.ParseCIDR("192.168.110.2/24")
+	if err := d.CreateEndpoint("net1", "ep1", &drivertest.Endpoint{Addr: addr}, nil); err == nil {
+		t.Fatalf("Expected failure on auxiliary address")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	addr, _ = types.ParseCIDR("192.168.110.10/24")
+	te := &drivertest.Endpoint{Addr: addr}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+	if te.Mac == nil {
+		t.Fatalf("MAC address was not generated for the endpoint")
+	}
+
+	if err := d.Join("net1", "ep1", "", te, nil); err != nil {
+		t.Fatalf("Failed to join endpoint: %v", err)
+	}
+	if te.SrcName != macvlanName("ep1") || te.DstName != containerIfPrefix {
+		t.Fatalf("Unexpected interface names: %s %s", te.SrcName, te.DstName)
+	}
+	if !te.Gw.Equal(net.ParseIP("192.168.110.1")) {
+		t.Fatalf("Unexpected gateway: %v", te.Gw)
+	}
+
+	link, err := netlink.LinkByName(te.SrcName)
+	if err != nil {
+		t.Fatalf("Macvlan link was not created: %v", err)
+	}
+	mv, ok := link.(*netlink.Macvlan)
+	if !ok || mv.Mode != netlink.MACVLAN_MODE_PRIVATE {
+		t.Fatalf("Unexpected macvlan link: %#v", link)
+	}
+	if mv.Attrs().HardwareAddr.String() != te.Mac.String() {
+		t.Fatalf("Unexpected MAC address %s, expected %s", mv.Attrs().HardwareAddr, te.Mac)
+	}
+
+	// A second join replaces the link left over by the previous one
+	if err := d.Join("net1", "ep1", "", te, nil); err != nil {
+		t.Fatalf("Failed to join endpoint again: %v", err)
+	}
+
+	if err := d.Leave("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(te.SrcName); err == nil {
+		t.Fatalf("Macvlan link was not deleted along with the endpoint")
+	}
+}
+
+func TestPassthruEndpoint(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	d := setupDriver(t)
+	drivertest.CreateDummyLink(t, "dummy0")
+
+	netOption := map[string]interface{}{
+		netlabel.GenericData: map[string]string{parentOpt: "dummy0", modeOpt: modePassthru},
+		netlabel.Internal:    true,
+	}
+	if err := d.CreateNetwork("net1", netOption, drivertest.IPv4Data(t), nil); err != nil {
+		t.Fatalf("Failed to create macvlan network: %v", err)
+	}
+	defer d.DeleteNetwork("net1")
+
+	addr, _ := types.ParseCIDR("192.168.110.10/24")
+	te := &drivertest.Endpoint{Addr: addr}
+	if err := d.CreateEndpoint("net1", "ep1", te, nil); err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+	if te.Mac != nil {
+		t.Fatalf("Unexpected MAC address for passthru endpoint: %s", te.Mac)
+	}
+
+	addr, _ = types.ParseCIDR("192.168.110.11/24")
+	if err := d.CreateEndpoint("net1", "ep2", &drivertest.Endpoint{Addr: addr}, nil); err == nil {
+		t.Fatalf("Expected failure on second passthru endpoint")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	if err := d.Join("net1", "ep1", "", te, nil); err != nil {
+		t.Fatalf("Failed to join endpoint: %v", err)
+	}
+	if te.Gw != nil {
+		t.Fatalf("Unexpected gateway on internal network: %v", te.Gw)
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,602 @@
+package overlay
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/osl"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+const (
+	secureOption = "encrypted"
+
+	// vxlanEncryptOverhead is the largest overhead of the ESP transport
+	// encapsulation of the vxlan packets: spi(4) + sequence number(4) +
+	// iv(16) + padding(15) + pad length and next header(2) + icv(16)
+	vxlanEncryptOverhead = 57
+
+	// encrReqid ties the xfrm policies of the vxlan traffic to the states
+	encrReqid = 0xD0C4E3
+
+	cryptAlgo  = "cbc(aes)"
+	cryptKeyLn = 16
+	authAlgo   = "hmac(sha256)"
+	authKeyLn  = 32
+	authTrunc  = 128
+)
+
+var (
+	// keyRotationInterval is the age of the primary key past which a node
+	// replaces it with a new one
+	keyRotationInterval = 12 * time.Hour
+	// keyPollInterval is how often the nodes check the key ring for a
+	// rotation
+	keyPollInterval = time.Minute
+	// keyringSize is the number of keys of the ring: the primary one the
+	// nodes encrypt with, and the previous ones they still decrypt with
+	// while the other nodes catch up with a rotation
+	keyringSize = 3
+)
+
+// encrKey is a key of the ring. The key material holds the encryption key
+// followed by the authentication key.
+type encrKey struct {
+	Tag     uint32
+	Key     []byte
+	Created time.Time
+}
+
+// keyring is the set of keys distributed to the nodes through the cluster
+// store, oldest first.
+type keyring struct {
+	keys     []*encrKey
+	dbIndex  uint64
+	dbExists bool
+}
+
+// encrNode is the encryption state programmed for a remote node.
+type encrNode struct {
+	// outKey is the key of the outbound state
+	outKey *encrKey
+	// inKeys are the keys of the inbound states, by tag
+	inKeys map[uint32]*encrKey
+}
+
+type encrMap struct {
+	nodes   map[string]*encrNode
+	keys    []*encrKey
+	started bool
+	stopCh  chan struct{}
+	sync.Mutex
+}
+
+func (k *keyring) primary() *encrKey {
+	if len(k.keys) == 0 {
+		return nil
+	}
+	return k.keys[len(k.keys)-1]
+}
+
+func (k *keyring) Key() []string {
+	return []string{"overlay", "keyring"}
+}
+
+func (k *keyring) KeyPrefix() []string {
+	return []string{"overlay"}
+}
+
+func (k *keyring) Value() []byte {
+	b, err := json.Marshal(map[string]interface{}{"keys": k.keys})
+	if err != nil {
+		return []byte{}
+	}
+	return b
+}
+
+func (k *keyring) SetValue(value []byte) error {
+	var ringMap struct {
+		Keys []*encrKey `json:"keys"`
+	}
+	if err := json.Unmarshal(value, &ringMap); err != nil {
+		return err
+	}
+	k.keys = ringMap.Keys
+	return nil
+}
+
+func (k *keyring) Index() uint64 {
+	return k.dbIndex
+}
+
+func (k *keyring) SetIndex(index uint64) {
+	k.dbIndex = index
+	k.dbExists = true
+}
+
+func (k *keyring) Exists() bool {
+	return k.dbExists
+}
+
+func (k *keyring) Skip() bool {
+	return false
+}
+
+func (k *keyring) DataScope() string {
+	return datastore.GlobalScope
+}
+
+func newEncrKey(tag uint32) (*encrKey, error) {
+	key := make([]byte, cryptKeyLn+authKeyLn)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %v", err)
+	}
+	return &encrKey{Tag: tag, Key: key, Created: time.Now().UTC()}, nil
+}
+
+// loadKeys returns the keys of the ring in the cluster store. The ring is
+// created when it is empty, and a new primary key is added to it when
+// rotate is set and the current one is past the rotation interval.
+func (d *driver) loadKeys(rotate bool) ([]*encrKey, error) {
+	if d.store == nil {
+		return nil, fmt.Errorf("no datastore configured. cannot distribute the encryption keys")
+	}
+
+	for {
+		k := &keyring{}
+		if err := d.store.GetObject(datastore.Key(k.Key()...), k); err != nil && err != datastore.ErrKeyNotFound {
+			return nil, fmt.Errorf("failed to get the encryption keys from the datastore: %v", err)
+		}
+
+		p := k.primary()
+		if p != nil && (!rotate || time.Since(p.Created) < keyRotationInterval) {
+			return k.keys, nil
+		}
+
+		var tag uint32 = 1
+		if p != nil {
+			tag = p.Tag + 1
+		}
+		key, err := newEncrKey(tag)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, key)
+		if len(k.keys) > keyringSize {
+			k.keys = k.keys[len(k.keys)-keyringSize:]
+		}
+
+		if err := d.store.PutObjectAtomic(k); err != nil {
+			if err == datastore.ErrKeyModified {
+				// Another node updated the ring first
+				continue
+			}
+			return nil, fmt.Errorf("failed to store the encryption keys: %v", err)
+		}
+		logrus.Debugf("Added encryption key %d to the overlay key ring", tag)
+		return k.keys, nil
+	}
+}
+
+// initEncryption loads the key ring and starts checking it for rotations,
+// the first time an encrypted network has a remote peer.
+func (d *driver) initEncryption() error {
+	d.encrMap.Lock()
+	defer d.encrMap.Unlock()
+
+	if d.encrMap.started {
+		return nil
+	}
+
+	keys, err := d.loadKeys(false)
+	if err != nil {
+		return err
+	}
+	d.encrMap.keys = keys
+	d.encrMap.started = true
+	d.encrMap.stopCh = make(chan struct{})
+
+	go d.keyLoop(d.encrMap.stopCh)
+	return nil
+}
+
+// stopEncryption stops checking the key ring, and deletes the xfrm policies
+// and states programmed for the remote nodes.
+func (d *driver) stopEncryption() {
+	d.encrMap.Lock()
+	defer d.encrMap.Unlock()
+
+	if d.encrMap.started {
+		close(d.encrMap.stopCh)
+		d.encrMap.started = false
+	}
+
+	lIP := net.ParseIP(d.bindAddress)
+	for node, en := range d.encrMap.nodes {
+		if err := removeNode(lIP, net.ParseIP(node), en); err != nil {
+			logrus.Warnf("Failed to remove the encryption of the traffic with node %s: %v", node, err)
+		}
+		delete(d.encrMap.nodes, node)
+	}
+}
+
+func (d *driver) keyLoop(stopCh chan struct{}) {
+	ticker := time.NewTicker(keyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.updateKeys(); err != nil {
+				logrus.Warnf("Failed to update the overlay encryption keys: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// updateKeys rotates the key ring when due, and reprograms the encryption of
+// the remote nodes when the ring changed.
+func (d *driver) updateKeys() error {
+	keys, err := d.loadKeys(true)
+	if err != nil {
+		return err
+	}
+
+	d.encrMap.Lock()
+	defer d.encrMap.Unlock()
+
+	if sameRing(d.encrMap.keys, keys) {
+		return nil
+	}
+	d.encrMap.keys = keys
+
+	lIP := net.ParseIP(d.bindAddress)
+	for node, en := range d.encrMap.nodes {
+		if err := programNode(lIP, net.ParseIP(node), keys, en); err != nil {
+			logrus.Warnf("Failed to update the encryption of the traffic with node %s: %v", node, err)
+		}
+	}
+	return nil
+}
+
+func sameRing(a, b []*encrKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Tag != b[i].Tag {
+			return false
+		}
+	}
+	return true
+}
+
+// outboundKey returns the key the traffic is encrypted with. The other nodes
+// may not decrypt with the primary key of the ring yet, so the traffic is
+// encrypted with the key preceding it, which they got a rotation ago. The
+// ring is ordered by tag, the nodes thus agree on the key whatever their
+// clocks.
+func outboundKey(keys []*encrKey) *encrKey {
+	if len(keys) < 2 {
+		return keys[0]
+	}
+	return keys[len(keys)-2]
+}
+
+// checkEncryption programs the encryption of the vxlan traffic with the
+// remote node when a peer of an encrypted network is added there, and
+// removes it once the node has no peer left in any encrypted network.
+func (d *driver) checkEncryption(nid string, rIP net.IP, add bool) error {
+	n := d.network(nid)
+	if n == nil || !n.isSecure() || rIP == nil {
+		return nil
+	}
+
+	lIP := net.ParseIP(d.bindAddress)
+	if lIP == nil {
+		return fmt.Errorf("no local address to encrypt the traffic of network %s with", nid)
+	}
+	if rIP.Equal(lIP) {
+		return nil
+	}
+
+	if !add {
+		return d.removeEncryption(lIP, rIP, "")
+	}
+
+	if err := d.initEncryption(); err != nil {
+		return err
+	}
+
+	d.encrMap.Lock()
+	defer d.encrMap.Unlock()
+	if _, ok := d.encrMap.nodes[rIP.String()]; ok {
+		return nil
+	}
+	en := &encrNode{inKeys: make(map[uint32]*encrKey)}
+	if err := programPolicies(lIP, rIP, true); err != nil {
+		return err
+	}
+	if err := programNode(lIP, rIP, d.encrMap.keys, en); err != nil {
+		removeNode(lIP, rIP, en)
+		return err
+	}
+	d.encrMap.nodes[rIP.String()] = en
+	return nil
+}
+
+// removeEncryption removes the encryption of the vxlan traffic with the
+// remote node, unless a peer of an encrypted network other than the one
+// being deleted is there.
+func (d *driver) removeEncryption(lIP, rIP net.IP, deletedNid string) error {
+	if d.hasSecurePeer(rIP, deletedNid) {
+		return nil
+	}
+
+	d.encrMap.Lock()
+	defer d.encrMap.Unlock()
+	en, ok := d.encrMap.nodes[rIP.String()]
+	if !ok {
+		return nil
+	}
+	delete(d.encrMap.nodes, rIP.String())
+	return removeNode(lIP, rIP, en)
+}
+
+// deleteEncryption removes the encryption of the vxlan traffic with the
+// remote nodes of the encrypted network being deleted, which no other
+// encrypted network has a peer on.
+func (d *driver) deleteEncryption(n *network) {
+	if !n.isSecure() {
+		return
+	}
+	lIP := net.ParseIP(d.bindAddress)
+	if lIP == nil {
+		return
+	}
+
+	vteps := map[string]net.IP{}
+	d.peerDbNetworkWalk(n.id, func(pKey *peerKey, pEntry *peerEntry) bool {
+		if !pEntry.isLocal && pEntry.vtep != nil && !pEntry.vtep.Equal(lIP) {
+			vteps[pEntry.vtep.String()] = pEntry.vtep
+		}
+		return false
+	})
+
+	for _, rIP := range vteps {
+		if err := d.removeEncryption(lIP, rIP, n.id); err != nil {
+			logrus.Warnf("could not remove the encryption of the traffic with %s: %v", rIP, err)
+		}
+	}
+}
+
+// hasSecurePeer tells whether a remote peer of an encrypted network is on
+// the node, ignoring the peers of the excluded network.
+func (d *driver) hasSecurePeer(vtep net.IP, excludedNid string) bool {
+	found := false
+	d.peerDbWalk(func(nid string, pKey *peerKey, pEntry *peerEntry) bool {
+		if nid == excludedNid || pEntry.isLocal || !pEntry.vtep.Equal(vtep) {
+			return false
+		}
+		if n := d.network(nid); n != nil && n.isSecure() {
+			found = true
+		}
+		return found
+	})
+	return found
+}
+
+// buildSPI returns the security parameter index of the traffic from src to
+// dst encrypted with the key, which both nodes compute alike.
+func buildSPI(src, dst net.IP, tag uint32) int {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, tag)
+	h := fnv.New32a()
+	h.Write(src.To16())
+	h.Write(b)
+	h.Write(dst.To16())
+	spi := binary.BigEndian.Uint32(h.Sum(nil))
+	// The indexes below 256 are reserved
+	if spi < 256 {
+		spi += 256
+	}
+	return int(spi)
+}
+
+func xfrmState(src, dst net.IP, key *encrKey) *netlink.XfrmState {
+	return &netlink.XfrmState{
+		Src:   src,
+		Dst:   dst,
+		Proto: netlink.XFRM_PROTO_ESP,
+		Mode:  netlink.XFRM_MODE_TRANSPORT,
+		Spi:   buildSPI(src, dst, key.Tag),
+		Reqid: encrReqid,
+		Crypt: &netlink.XfrmStateAlgo{Name: cryptAlgo, Key: key.Key[:cryptKeyLn]},
+		Auth:  &netlink.XfrmStateAlgo{Name: authAlgo, Key: key.Key[cryptKeyLn:], TruncateLen: authTrunc},
+	}
+}
+
+func addState(s *netlink.XfrmState) error {
+	// Replace the state a previous run of the daemon may have left
+	netlink.XfrmStateDel(s)
+	if err := netlink.XfrmStateAdd(s); err != nil {
+		return fmt.Errorf("failed to add xfrm state %s->%s spi 0x%x: %v", s.Src, s.Dst, s.Spi, err)
+	}
+	return nil
+}
+
+func delState(s *netlink.XfrmState) error {
+	if err := netlink.XfrmStateDel(s); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("failed to delete xfrm state %s->%s spi 0x%x: %v", s.Src, s.Dst, s.Spi, err)
+	}
+	return nil
+}
+
+// programNode brings the xfrm states of the traffic with the remote node in
+// line with the key ring: the inbound traffic is decrypted with any of the
+// keys, the outbound one is encrypted with the outbound key. A new key is
+// thus first added for the inbound traffic only. The outbound state of the
+// former key is deleted last, for the traffic to switch to the new one
+// without interruption.
+func programNode(lIP, rIP net.IP, keys []*encrKey, en *encrNode) error {
+	defer osl.InitOSContext()()
+
+	if len(keys) == 0 {
+		return fmt.Errorf("no encryption key")
+	}
+
+	ring := make(map[uint32]bool, len(keys))
+	for _, k := range keys {
+		ring[k.Tag] = true
+		if _, ok := en.inKeys[k.Tag]; ok {
+			continue
+		}
+		if err := addState(xfrmState(rIP, lIP, k)); err != nil {
+			return err
+		}
+		en.inKeys[k.Tag] = k
+	}
+
+	out := outboundKey(keys)
+	if en.outKey == nil || en.outKey.Tag != out.Tag {
+		if err := addState(xfrmState(lIP, rIP, out)); err != nil {
+			return err
+		}
+		if en.outKey != nil {
+			if err := delState(xfrmState(lIP, rIP, en.outKey)); err != nil {
+				logrus.Warn(err)
+			}
+		}
+		en.outKey = out
+	}
+
+	for tag, k := range en.inKeys {
+		if ring[tag] {
+			continue
+		}
+		if err := delState(xfrmState(rIP, lIP, k)); err != nil {
+			logrus.Warn(err)
+		}
+		delete(en.inKeys, tag)
+	}
+
+	return nil
+}
+
+// removeNode deletes the xfrm policies and states of the traffic with the
+// remote node.
+func removeNode(lIP, rIP net.IP, en *encrNode) error {
+	err := programPolicies(lIP, rIP, false)
+
+	defer osl.InitOSContext()()
+	if en.outKey != nil {
+		if e := delState(xfrmState(lIP, rIP, en.outKey)); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, k := range en.inKeys {
+		if e := delState(xfrmState(rIP, lIP, k)); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// vxlanSelector selects the vxlan packets from src to dst.
+func vxlanSelector(sel *nl.XfrmSelector, src, dst net.IP) {
+	bits := 8 * net.IPv6len
+	if dst.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	sel.Family = uint16(nl.GetIPFamily(dst))
+	sel.Saddr.FromIP(src)
+	sel.Daddr.FromIP(dst)
+	sel.PrefixlenS = uint8(bits)
+	sel.PrefixlenD = uint8(bits)
+	sel.Proto = syscall.IPPROTO_UDP
+	sel.Dport = nl.Swap16(vxlanPort)
+	sel.DportMask = 0xffff
+}
+
+// addPolicy requires the vxlan packets from src to dst to go through the
+// ESP states of the reqid, in the direction.
+func addPolicy(src, dst net.IP, dir netlink.Dir) error {
+	req := nl.NewNetlinkRequest(nl.XFRM_MSG_NEWPOLICY, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK)
+
+	msg := &nl.XfrmUserpolicyInfo{}
+	vxlanSelector(&msg.Sel, src, dst)
+	msg.Dir = uint8(dir)
+	msg.Lft.SoftByteLimit = nl.XFRM_INF
+	msg.Lft.HardByteLimit = nl.XFRM_INF
+	msg.Lft.SoftPacketLimit = nl.XFRM_INF
+	msg.Lft.HardPacketLimit = nl.XFRM_INF
+	req.AddData(msg)
+
+	tmplData := make([]byte, nl.SizeofXfrmUserTmpl)
+	tmpl := nl.DeserializeXfrmUserTmpl(tmplData)
+	tmpl.XfrmId.Daddr.FromIP(dst)
+	tmpl.XfrmId.Proto = uint8(netlink.XFRM_PROTO_ESP)
+	tmpl.Family = msg.Sel.Family
+	tmpl.Saddr.FromIP(src)
+	tmpl.Reqid = encrReqid
+	tmpl.Mode = uint8(netlink.XFRM_MODE_TRANSPORT)
+	tmpl.Aalgos = ^uint32(0)
+	tmpl.Ealgos = ^uint32(0)
+	tmpl.Calgos = ^uint32(0)
+	req.AddData(nl.NewRtAttr(nl.XFRMA_TMPL, tmplData))
+
+	if _, err := req.Execute(syscall.NETLINK_XFRM, 0); err != nil && err != syscall.EEXIST {
+		return fmt.Errorf("failed to add xfrm policy %s %s->%s: %v", dir, src, dst, err)
+	}
+	return nil
+}
+
+func delPolicy(src, dst net.IP, dir netlink.Dir) error {
+	req := nl.NewNetlinkRequest(nl.XFRM_MSG_DELPOLICY, syscall.NLM_F_ACK)
+
+	msg := &nl.XfrmUserpolicyId{}
+	vxlanSelector(&msg.Sel, src, dst)
+	msg.Dir = uint8(dir)
+	req.AddData(msg)
+
+	if _, err := req.Execute(syscall.NETLINK_XFRM, 0); err != nil && err != syscall.ENOENT {
+		return fmt.Errorf("failed to delete xfrm policy %s %s->%s: %v", dir, src, dst, err)
+	}
+	return nil
+}
+
+// programPolicies adds or deletes the xfrm policies which encrypt the vxlan
+// packets sent to the remote node, and drop the ones received from it in
+// clear text.
+func programPolicies(lIP, rIP net.IP, add bool) error {
+	defer osl.InitOSContext()()
+
+	if !add {
+		err := delPolicy(lIP, rIP, netlink.XFRM_DIR_OUT)
+		if e := delPolicy(rIP, lIP, netlink.XFRM_DIR_IN); e != nil && err == nil {
+			err = e
+		}
+		return err
+	}
+
+	if err := addPolicy(lIP, rIP, netlink.XFRM_DIR_OUT); err != nil {
+		return err
+	}
+	if err := addPolicy(rIP, lIP, netlink.XFRM_DIR_IN); err != nil {
+		delPolicy(lIP, rIP, netlink.XFRM_DIR_OUT)
+		return err
+	}
+	return nil
+}
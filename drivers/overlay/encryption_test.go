@@ -0,0 +1,348 @@
+package overlay
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+func newTestStore(t *testing.T) (datastore.DataStore, func()) {
+	tmp, err := ioutil.TempFile("", "overlay-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	ds, err := datastore.NewDataStore(datastore.GlobalScope, &datastore.ScopeCfg{
+		Client: datastore.ScopeClientCfg{
+			Provider: "boltdb",
+			Address:  tmp.Name(),
+			Config: &store.Config{
+				Bucket:            "libnetwork",
+				ConnectionTimeout: 3 * time.Second,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.Remove(tmp.Name())
+	}
+}
+
+func tags(keys []*encrKey) []uint32 {
+	var t []uint32
+	for _, k := range keys {
+		t = append(t, k.Tag)
+	}
+	return t
+}
+
+func TestKeyRotation(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	d1 := &driver{store: ds}
+	d2 := &driver{store: ds}
+
+	keys, err := d1.loadKeys(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Tag != 1 || len(keys[0].Key) != cryptKeyLn+authKeyLn {
+		t.Fatalf("Expected the key ring to be created with a key, got %v", tags(keys))
+	}
+
+	// The other nodes get the same key, which is not due for a rotation
+	other, err := d2.loadKeys(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRing(keys, other) || string(other[0].Key) != string(keys[0].Key) {
+		t.Fatalf("Expected the key ring %v, got %v", tags(keys), tags(other))
+	}
+
+	defer func(interval time.Duration) { keyRotationInterval = interval }(keyRotationInterval)
+	keyRotationInterval = 0
+
+	for i := 0; i < keyringSize; i++ {
+		if keys, err = d1.loadKeys(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys) != keyringSize || keys[0].Tag != 2 || keys[len(keys)-1].Tag != uint32(keyringSize+1) {
+		t.Fatalf("Expected the oldest key to leave the ring, got %v", tags(keys))
+	}
+
+	keyRotationInterval = time.Hour
+	if other, err = d2.loadKeys(true); err != nil {
+		t.Fatal(err)
+	}
+	if !sameRing(keys, other) {
+		t.Fatalf("Expected the rotated key ring %v, got %v", tags(keys), tags(other))
+	}
+}
+
+func TestOutboundKey(t *testing.T) {
+	now := time.Now().UTC()
+	keys := []*encrKey{
+		{Tag: 1, Created: now},
+		{Tag: 2, Created: now.Add(-time.Hour)},
+		{Tag: 3, Created: now.Add(time.Hour)},
+	}
+
+	// The primary key is not encrypted with until the next rotation,
+	// whatever the clock of the node which created it
+	if k := outboundKey(keys); k.Tag != 2 {
+		t.Fatalf("Expected key 2, got %d", k.Tag)
+	}
+	if k := outboundKey(keys[:2]); k.Tag != 1 {
+		t.Fatalf("Expected key 1, got %d", k.Tag)
+	}
+	if k := outboundKey(keys[2:]); k.Tag != 3 {
+		t.Fatalf("Expected the only key of the ring, got %d", k.Tag)
+	}
+}
+
+func TestSPI(t *testing.T) {
+	a, b := net.ParseIP("192.168.0.1"), net.ParseIP("192.168.0.2")
+	if buildSPI(a, b, 1) != buildSPI(a, b, 1) {
+		t.Fatal("Expected the nodes to compute the same spi")
+	}
+	if buildSPI(a, b, 1) == buildSPI(b, a, 1) || buildSPI(a, b, 1) == buildSPI(a, b, 2) {
+		t.Fatal("Expected distinct spis for the directions and the keys")
+	}
+}
+
+func TestParseSecureOption(t *testing.T) {
+	for val, expected := range map[interface{}]bool{
+		"":      true,
+		"true":  true,
+		"1":     true,
+		"false": false,
+		"0":     false,
+		true:    true,
+		false:   false,
+	} {
+		secure, err := parseSecureOption(val)
+		if err != nil {
+			t.Fatalf("Unexpected failure for %#v: %v", val, err)
+		}
+		if secure != expected {
+			t.Fatalf("Expected %t for %#v, got %t", expected, val, secure)
+		}
+	}
+
+	for _, val := range []interface{}{"yes", 1} {
+		if _, err := parseSecureOption(val); err == nil {
+			t.Fatalf("Expected failure for %#v", val)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type %T for %#v: %v", err, val, err)
+		}
+	}
+}
+
+func TestNetworkSecureValue(t *testing.T) {
+	subnetIP, _ := types.ParseCIDR("10.1.0.0/24")
+	gwIP, _ := types.ParseCIDR("10.1.0.1/24")
+	n := &network{id: "n1", secure: true, subnets: []*subnet{{subnetIP: subnetIP, gwIP: gwIP}}}
+
+	restored := &network{id: "n1"}
+	if err := restored.SetValue(n.Value()); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.isSecure() {
+		t.Fatal("Expected the network to remain encrypted")
+	}
+}
+
+func xfrmStates(t *testing.T) map[int]bool {
+	states, err := netlink.XfrmStateList(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spis := make(map[int]bool)
+	for _, s := range states {
+		spis[s.Spi] = true
+	}
+	return spis
+}
+
+func expectStates(t *testing.T, expected ...*netlink.XfrmState) {
+	spis := xfrmStates(t)
+	if len(spis) != len(expected) {
+		t.Fatalf("Expected %d xfrm states, got %v", len(expected), spis)
+	}
+	for _, s := range expected {
+		if !spis[s.Spi] {
+			t.Fatalf("Missing xfrm state %s->%s spi 0x%x in %v", s.Src, s.Dst, s.Spi, spis)
+		}
+	}
+}
+
+func TestProgramPolicies(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	lIP, rIP := net.ParseIP("192.168.0.1"), net.ParseIP("192.168.0.2")
+	if err := programPolicies(lIP, rIP, true); err != nil {
+		t.Skipf("xfrm is not supported: %v", err)
+	}
+	// Programming the policies again is harmless
+	if err := programPolicies(lIP, rIP, true); err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := netlink.XfrmPolicyList(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("Expected an inbound and an outbound policy, got %v", policies)
+	}
+	for _, p := range policies {
+		if len(p.Tmpls) != 1 || p.Tmpls[0].Proto != netlink.XFRM_PROTO_ESP || p.Tmpls[0].Reqid != encrReqid {
+			t.Fatalf("Unexpected policy %+v", p)
+		}
+		if p.Dir == netlink.XFRM_DIR_OUT && (!p.Src.IP.Equal(lIP) || !p.Dst.IP.Equal(rIP)) {
+			t.Fatalf("Unexpected outbound policy %+v", p)
+		}
+		if p.Dir == netlink.XFRM_DIR_IN && (!p.Src.IP.Equal(rIP) || !p.Dst.IP.Equal(lIP)) {
+			t.Fatalf("Unexpected inbound policy %+v", p)
+		}
+	}
+
+	if err := programPolicies(lIP, rIP, false); err != nil {
+		t.Fatal(err)
+	}
+	if policies, err = netlink.XfrmPolicyList(syscall.AF_INET); err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 0 {
+		t.Fatalf("Expected the policies to be deleted, got %v", policies)
+	}
+}
+
+func TestProgramNode(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	lIP, rIP := net.ParseIP("192.168.0.1"), net.ParseIP("192.168.0.2")
+
+	var keys []*encrKey
+	for tag := uint32(1); tag <= 3; tag++ {
+		k, err := newEncrKey(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+
+	probe := xfrmState(lIP, rIP, keys[0])
+	if err := netlink.XfrmStateAdd(probe); err != nil {
+		t.Skipf("ESP is not supported: %v", err)
+	}
+	netlink.XfrmStateDel(probe)
+
+	en := &encrNode{inKeys: make(map[uint32]*encrKey)}
+	if err := programNode(lIP, rIP, keys[:1], en); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, xfrmState(rIP, lIP, keys[0]), xfrmState(lIP, rIP, keys[0]))
+
+	// A rotation first decrypts with the new key only
+	if err := programNode(lIP, rIP, keys[:2], en); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, xfrmState(rIP, lIP, keys[0]), xfrmState(rIP, lIP, keys[1]), xfrmState(lIP, rIP, keys[0]))
+
+	// Then encrypts with it on the next rotation, by when the other nodes
+	// decrypt with it, while the oldest key leaves the ring
+	if err := programNode(lIP, rIP, keys[1:], en); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t, xfrmState(rIP, lIP, keys[1]), xfrmState(rIP, lIP, keys[2]), xfrmState(lIP, rIP, keys[1]))
+
+	if err := removeNode(lIP, rIP, en); err != nil {
+		t.Fatal(err)
+	}
+	expectStates(t)
+}
+
+func xfrmPolicies(t *testing.T) map[string]bool {
+	policies, err := netlink.XfrmPolicyList(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]bool)
+	for _, p := range policies {
+		if p.Dir == netlink.XFRM_DIR_OUT {
+			nodes[p.Dst.IP.String()] = true
+		}
+	}
+	return nodes
+}
+
+func TestDeleteNetworkEncryption(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	lIP := net.ParseIP("192.168.0.1")
+	vtepA, vtepB := net.ParseIP("192.168.0.2"), net.ParseIP("192.168.0.3")
+	if err := programPolicies(lIP, vtepA, true); err != nil {
+		t.Skipf("xfrm is not supported: %v", err)
+	}
+	if err := programPolicies(lIP, vtepB, true); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{
+		bindAddress: lIP.String(),
+		store:       ds,
+		networks:    networkTable{},
+		peerDb:      peerNetworkMap{mp: map[string]peerMap{}},
+		encrMap: &encrMap{nodes: map[string]*encrNode{
+			vtepA.String(): {inKeys: map[uint32]*encrKey{}},
+			vtepB.String(): {inKeys: map[uint32]*encrKey{}},
+		}},
+	}
+	d.addNetwork(&network{id: "n1", driver: d, secure: true})
+	d.addNetwork(&network{id: "n2", driver: d, secure: true})
+
+	mac, _ := net.ParseMAC("02:42:0a:00:00:02")
+	d.peerDbAdd("n1", "e1", net.ParseIP("10.0.0.2"), net.CIDRMask(24, 32), mac, vtepA, false)
+	d.peerDbAdd("n1", "e2", net.ParseIP("10.0.0.3"), net.CIDRMask(24, 32), mac, vtepB, false)
+	d.peerDbAdd("n2", "e3", net.ParseIP("10.0.1.3"), net.CIDRMask(24, 32), mac, vtepB, false)
+
+	// The node of the other encrypted network keeps its encryption
+	if err := d.DeleteNetwork("n1"); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := xfrmPolicies(t); len(nodes) != 1 || !nodes[vtepB.String()] {
+		t.Fatalf("Expected the policies of %s only, got %v", vtepB, nodes)
+	}
+	if _, ok := d.encrMap.nodes[vtepA.String()]; ok || len(d.encrMap.nodes) != 1 {
+		t.Fatalf("Expected the encryption state of %s only, got %v", vtepB, d.encrMap.nodes)
+	}
+
+	// Which is removed when the driver stops
+	d.stopEncryption()
+	if nodes := xfrmPolicies(t); len(nodes) != 0 {
+		t.Fatalf("Expected no policy left, got %v", nodes)
+	}
+	if len(d.encrMap.nodes) != 0 {
+		t.Fatalf("Expected no encryption state left, got %v", d.encrMap.nodes)
+	}
+}
@@ -50,12 +50,18 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 
 	// Set the container interface and its peer MTU to 1450 to allow
 	// for 50 bytes vxlan encap (inner eth header(14) + outer IP(20) +
-	// outer UDP(8) + vxlan header(8))
+	// outer UDP(8) + vxlan header(8)), less the ESP overhead of the
+	// encrypted networks
+	mtu := vxlanVethMTU
+	if n.isSecure() {
+		mtu -= vxlanEncryptOverhead
+	}
+
 	veth, err := netlink.LinkByName(name1)
 	if err != nil {
 		return fmt.Errorf("cound not find link by name %s: %v", name1, err)
 	}
-	err = netlink.LinkSetMTU(veth, vxlanVethMTU)
+	err = netlink.LinkSetMTU(veth, mtu)
 	if err != nil {
 		return err
 	}
@@ -69,7 +75,7 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 	if err != nil {
 		return fmt.Errorf("could not find link by name %s: %v", name2, err)
 	}
-	err = netlink.LinkSetMTU(veth, vxlanVethMTU)
+	err = netlink.LinkSetMTU(veth, mtu)
 	if err != nil {
 		return err
 	}
@@ -87,7 +93,7 @@ func (d *driver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo,
 
 	d.peerDbAdd(nid, eid, ep.addr.IP, ep.addr.Mask, ep.mac,
 		net.ParseIP(d.bindAddress), true)
-	d.pushLocalEndpointEvent("join", nid, eid)
+	d.peers.joinEndpoint(nid, eid)
 
 	return nil
 }
@@ -103,11 +109,7 @@ func (d *driver) Leave(nid, eid string) error {
 		return fmt.Errorf("could not find network with id %s", nid)
 	}
 
-	d.notifyCh <- ovNotify{
-		action: "leave",
-		nid:    nid,
-		eid:    eid,
-	}
+	d.peers.leaveEndpoint(nid, eid)
 
 	n.leaveSandbox()
 
@@ -0,0 +1,500 @@
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libkv/store"
+	"github.com/docker/libnetwork/datastore"
+)
+
+const peerPrefix = "peer"
+
+// peerPollInterval is how often the peers are listed from the stores which
+// cannot watch a tree of keys, such as boltdb
+var peerPollInterval = 5 * time.Second
+
+// peerRecord is a local endpoint published in the global datastore for the
+// other nodes. The records are keyed by network, then by the vtep of their
+// node, so the ones of a node which left the cluster can be dropped together.
+type peerRecord struct {
+	nid      string
+	eid      string
+	ip       net.IP
+	mask     net.IPMask
+	mac      net.HardwareAddr
+	vtep     net.IP
+	dbIndex  uint64
+	dbExists bool
+}
+
+// kvPeers distributes the peers through the global datastore: the nodes
+// write their local endpoints there, and watch the endpoints of the others.
+// A node publishes its endpoints again when their records are gone while it
+// is up, and the other nodes drop the records of a node leaving the cluster.
+type kvPeers struct {
+	d *driver
+	// peers are the remote peers programmed in the driver, by key
+	peers map[string]*peerRecord
+	// local are the local endpoints joined to their sandbox, by network
+	// and endpoint id
+	local   map[string]*peerRecord
+	started bool
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	sync.Mutex
+}
+
+func newKVPeers(d *driver) *kvPeers {
+	return &kvPeers{
+		d:     d,
+		peers: make(map[string]*peerRecord),
+		local: make(map[string]*peerRecord),
+	}
+}
+
+func localKey(nid, eid string) string {
+	return nid + "/" + eid
+}
+
+func (r *peerRecord) Key() []string {
+	return []string{"overlay", peerPrefix, r.nid, r.vtep.String(), r.eid}
+}
+
+func (r *peerRecord) KeyPrefix() []string {
+	return []string{"overlay", peerPrefix, r.nid, r.vtep.String()}
+}
+
+func (r *peerRecord) Value() []byte {
+	peerMap := make(map[string]interface{})
+
+	peerMap["nid"] = r.nid
+	peerMap["eid"] = r.eid
+	peerMap["ip"] = r.ip.String()
+	peerMap["mask"] = net.IP(r.mask).String()
+	peerMap["mac"] = r.mac.String()
+	peerMap["vtep"] = r.vtep.String()
+
+	b, err := json.Marshal(peerMap)
+	if err != nil {
+		return []byte{}
+	}
+
+	return b
+}
+
+func (r *peerRecord) SetValue(value []byte) error {
+	var peerMap struct {
+		Nid  string `json:"nid"`
+		Eid  string `json:"eid"`
+		IP   string `json:"ip"`
+		Mask string `json:"mask"`
+		Mac  string `json:"mac"`
+		Vtep string `json:"vtep"`
+	}
+
+	if err := json.Unmarshal(value, &peerMap); err != nil {
+		return err
+	}
+	if peerMap.Nid == "" || peerMap.Eid == "" {
+		return fmt.Errorf("missing network or endpoint id")
+	}
+
+	ip := net.ParseIP(peerMap.IP)
+	if ip == nil {
+		return fmt.Errorf("invalid peer address %q", peerMap.IP)
+	}
+	vtep := net.ParseIP(peerMap.Vtep)
+	if vtep == nil {
+		return fmt.Errorf("invalid vtep %q", peerMap.Vtep)
+	}
+	mask := net.ParseIP(peerMap.Mask)
+	if mask == nil {
+		return fmt.Errorf("invalid peer address mask %q", peerMap.Mask)
+	}
+	if ip4 := mask.To4(); ip4 != nil {
+		mask = ip4
+	}
+	mac, err := net.ParseMAC(peerMap.Mac)
+	if err != nil {
+		return err
+	}
+
+	r.nid = peerMap.Nid
+	r.eid = peerMap.Eid
+	r.ip = ip
+	r.mask = net.IPMask(mask)
+	r.mac = mac
+	r.vtep = vtep
+
+	return nil
+}
+
+func (r *peerRecord) Index() uint64 {
+	return r.dbIndex
+}
+
+func (r *peerRecord) SetIndex(index uint64) {
+	r.dbIndex = index
+	r.dbExists = true
+}
+
+func (r *peerRecord) Exists() bool {
+	return r.dbExists
+}
+
+func (r *peerRecord) Skip() bool {
+	return false
+}
+
+func (r *peerRecord) DataScope() string {
+	return datastore.GlobalScope
+}
+
+func (r *peerRecord) New() datastore.KVObject {
+	return &peerRecord{}
+}
+
+func (r *peerRecord) CopyTo(o datastore.KVObject) error {
+	dstR := o.(*peerRecord)
+	*dstR = *r
+	return nil
+}
+
+func (r *peerRecord) String() string {
+	return fmt.Sprintf("%s/%s %s %s on %s", r.nid, r.eid, r.ip, r.mac, r.vtep)
+}
+
+func (r *peerRecord) equal(o *peerRecord) bool {
+	return r.ip.Equal(o.ip) && r.vtep.Equal(o.vtep) &&
+		r.mac.String() == o.mac.String() && net.IP(r.mask).Equal(net.IP(o.mask))
+}
+
+func (p *kvPeers) nodeJoin(node string, self bool) {
+	if !self {
+		return
+	}
+
+	d := p.d
+	if err := d.configure(); err != nil {
+		logrus.Errorf("initializing the overlay peer distribution failed: %v", err)
+		return
+	}
+	if d.store == nil {
+		logrus.Errorf("no datastore configured. cannot distribute the overlay peers")
+		return
+	}
+
+	d.Lock()
+	d.bindAddress = node
+	d.Unlock()
+
+	// Withdraw the records a previous run of the node left, and publish the
+	// endpoints which joined before the address was known
+	p.withdrawStale(net.ParseIP(node))
+	p.publishLocal(nil)
+
+	p.Lock()
+	defer p.Unlock()
+	if p.started {
+		return
+	}
+	p.started = true
+	p.stopCh = make(chan struct{})
+	p.doneCh = make(chan struct{})
+	go p.watch(p.stopCh, p.doneCh)
+}
+
+// nodeLeave drops the records of a node which left the cluster, as it may
+// not have withdrawn them itself.
+func (p *kvPeers) nodeLeave(node string) {
+	d := p.d
+
+	d.Lock()
+	local := net.ParseIP(d.bindAddress)
+	d.Unlock()
+
+	vtep := net.ParseIP(node)
+	if vtep == nil || vtep.Equal(local) || d.store == nil {
+		return
+	}
+
+	records, err := p.listPeers(datastore.Key("overlay", peerPrefix))
+	if err != nil {
+		logrus.Errorf("failed to list the overlay peers of node %s: %v", node, err)
+		return
+	}
+
+	dropped := make(map[string]bool)
+	for _, r := range records {
+		if !r.vtep.Equal(vtep) || dropped[r.nid] {
+			continue
+		}
+		dropped[r.nid] = true
+		if err := d.store.DeleteTree(&peerRecord{nid: r.nid, vtep: vtep}); err != nil && err != datastore.ErrKeyNotFound {
+			logrus.Errorf("failed to drop the overlay peers of node %s on network %s: %v", node, r.nid, err)
+		}
+	}
+}
+
+func (p *kvPeers) joinEndpoint(nid, eid string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.local[localKey(nid, eid)] = &peerRecord{nid: nid, eid: eid}
+	p.publish(nid, eid)
+}
+
+// publish writes the record of the local endpoint, once the address of the
+// node is known. It is called with the lock held.
+func (p *kvPeers) publish(nid, eid string) {
+	d := p.d
+
+	d.Lock()
+	vtep := net.ParseIP(d.bindAddress)
+	d.Unlock()
+	if vtep == nil || d.store == nil {
+		return
+	}
+
+	n := d.network(nid)
+	if n == nil {
+		return
+	}
+	ep := n.endpoint(eid)
+	if ep == nil {
+		return
+	}
+
+	r := &peerRecord{
+		nid:  nid,
+		eid:  eid,
+		ip:   ep.addr.IP,
+		mask: ep.addr.Mask,
+		mac:  ep.mac,
+		vtep: vtep,
+	}
+	if err := d.store.PutObject(r); err != nil {
+		logrus.Errorf("failed to publish overlay peer %s: %v", r, err)
+	}
+}
+
+// publishLocal publishes the local endpoints whose record is not among the
+// published ones.
+func (p *kvPeers) publishLocal(published map[string]bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	for k, r := range p.local {
+		if !published[k] {
+			p.publish(r.nid, r.eid)
+		}
+	}
+}
+
+func (p *kvPeers) leaveEndpoint(nid, eid string) {
+	p.Lock()
+	defer p.Unlock()
+
+	delete(p.local, localKey(nid, eid))
+	p.withdraw(nid, eid)
+}
+
+// withdraw deletes the record of the local endpoint. It is called with the
+// lock held.
+func (p *kvPeers) withdraw(nid, eid string) {
+	d := p.d
+
+	d.Lock()
+	vtep := net.ParseIP(d.bindAddress)
+	d.Unlock()
+	if vtep == nil || d.store == nil {
+		return
+	}
+
+	r := &peerRecord{nid: nid, eid: eid, vtep: vtep}
+	if err := d.store.DeleteObject(r); err != nil && err != datastore.ErrKeyNotFound {
+		logrus.Errorf("failed to withdraw overlay peer %s/%s: %v", nid, eid, err)
+	}
+}
+
+// withdrawStale deletes the records of the node which are not the ones of
+// its local endpoints.
+func (p *kvPeers) withdrawStale(vtep net.IP) {
+	records, err := p.listPeers(datastore.Key("overlay", peerPrefix))
+	if err != nil {
+		logrus.Warnf("Failed to list the overlay peers of the local node: %v", err)
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	for _, r := range records {
+		if !r.vtep.Equal(vtep) {
+			continue
+		}
+		if _, ok := p.local[localKey(r.nid, r.eid)]; ok {
+			continue
+		}
+		if err := p.d.store.DeleteObject(r); err != nil && err != datastore.ErrKeyNotFound {
+			logrus.Warnf("Failed to withdraw stale overlay peer %s: %v", r, err)
+		}
+	}
+}
+
+func (p *kvPeers) resolvePeer(nid string, peerIP net.IP) (net.HardwareAddr, net.IPMask, net.IP, error) {
+	if p.d.store == nil {
+		return nil, nil, nil, fmt.Errorf("no datastore configured. cannot resolve peer %s", peerIP)
+	}
+
+	records, err := p.listPeers(datastore.Key("overlay", peerPrefix, nid))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("resolving peer from the datastore failed: %v", err)
+	}
+	for _, r := range records {
+		if r.ip.Equal(peerIP) {
+			return r.mac, r.mask, r.vtep, nil
+		}
+	}
+
+	return nil, nil, nil, fmt.Errorf("peer ip %q not found in the datastore", peerIP)
+}
+
+// listPeers returns the valid records under the key. The invalid ones, which
+// another node or version may have written, are skipped.
+func (p *kvPeers) listPeers(key string) ([]*peerRecord, error) {
+	pairs, err := p.d.store.KVStore().List(key)
+	if err != nil && err != store.ErrKeyNotFound {
+		return nil, err
+	}
+	return decodePeers(pairs), nil
+}
+
+func decodePeers(pairs []*store.KVPair) []*peerRecord {
+	records := make([]*peerRecord, 0, len(pairs))
+	for _, kvp := range pairs {
+		if len(kvp.Value) == 0 {
+			continue
+		}
+		r := &peerRecord{}
+		if err := r.SetValue(kvp.Value); err != nil {
+			logrus.Warnf("Ignoring invalid overlay peer %s: %v", kvp.Key, err)
+			continue
+		}
+		r.SetIndex(kvp.LastIndex)
+		records = append(records, r)
+	}
+	return records
+}
+
+// fini stops watching the peers and withdraws the local ones.
+func (p *kvPeers) fini() {
+	p.Lock()
+	if p.started {
+		close(p.stopCh)
+		p.started = false
+		p.Unlock()
+		<-p.doneCh
+	} else {
+		p.Unlock()
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	for _, r := range p.local {
+		p.withdraw(r.nid, r.eid)
+	}
+}
+
+// watch feeds the driver with the peers of the other nodes, on every change
+// of the tree of the peers, or periodically when the store cannot watch it.
+func (p *kvPeers) watch(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	prefix := datastore.Key("overlay", peerPrefix)
+	if pairsCh, err := p.d.store.KVStore().WatchTree(prefix, stopCh); err == nil {
+		for pairs := range pairsCh {
+			p.sync(decodePeers(pairs))
+		}
+		select {
+		case <-stopCh:
+			return
+		default:
+			logrus.Warnf("Watching the overlay peers stopped, listing them every %s", peerPollInterval)
+		}
+	} else {
+		logrus.Debugf("Listing the overlay peers every %s, as watching them failed: %v", peerPollInterval, err)
+	}
+
+	ticker := time.NewTicker(peerPollInterval)
+	defer ticker.Stop()
+	for {
+		records, err := p.listPeers(prefix)
+		if err != nil {
+			logrus.Warnf("Failed to list the overlay peers: %v", err)
+		} else {
+			p.sync(records)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// sync programs the driver with the peers of the other nodes which were
+// added or changed since the last call, and removes the ones which are gone.
+// The local endpoints whose record is gone, such as when another node took
+// this one for gone, are published again.
+func (p *kvPeers) sync(records []*peerRecord) {
+	d := p.d
+
+	d.Lock()
+	local := net.ParseIP(d.bindAddress)
+	d.Unlock()
+
+	published := make(map[string]bool)
+	current := make(map[string]*peerRecord, len(records))
+	for _, r := range records {
+		if r.vtep.Equal(local) {
+			published[localKey(r.nid, r.eid)] = true
+			continue
+		}
+		current[datastore.Key(r.Key()...)] = r
+	}
+
+	p.Lock()
+	known := p.peers
+	p.Unlock()
+
+	for k, old := range known {
+		if r, ok := current[k]; ok && r.equal(old) {
+			continue
+		}
+		if err := d.peerDelete(old.nid, old.eid, old.ip, old.mask, old.mac, old.vtep, true); err != nil {
+			logrus.Errorf("Peer delete failed in the driver: %v", err)
+		}
+	}
+
+	for k, r := range current {
+		if old, ok := known[k]; ok && old.equal(r) {
+			continue
+		}
+		if err := d.peerAdd(r.nid, r.eid, r.ip, r.mask, r.mac, r.vtep, true); err != nil {
+			logrus.Errorf("Peer add failed in the driver: %v", err)
+		}
+	}
+
+	p.Lock()
+	p.peers = current
+	p.Unlock()
+
+	p.publishLocal(published)
+}
@@ -0,0 +1,250 @@
+package overlay
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+)
+
+func newKVDriver(ds datastore.DataStore) *driver {
+	d := &driver{
+		networks: networkTable{},
+		peerDb: peerNetworkMap{
+			mp: map[string]peerMap{},
+		},
+		encrMap: &encrMap{
+			nodes: map[string]*encrNode{},
+		},
+		store: ds,
+	}
+	d.peers = newKVPeers(d)
+	return d
+}
+
+// waitForPeer waits for the distribution of the driver to program or remove
+// the remote peer, and returns its peer database entry.
+func waitForPeer(t *testing.T, d *driver, nid string, ip net.IP, present bool) (net.HardwareAddr, net.IP) {
+	p := d.peers.(*kvPeers)
+	for i := 0; i < 100; i++ {
+		found := false
+		p.Lock()
+		for _, r := range p.peers {
+			if r.nid == nid && r.ip.Equal(ip) {
+				found = true
+			}
+		}
+		p.Unlock()
+
+		if found == present {
+			mac, _, vtep, err := d.peerDbSearch(nid, ip)
+			if (err == nil) != present {
+				t.Fatalf("Expected the peer database to match the distribution for %s: %v", ip, err)
+			}
+			return mac, vtep
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for peer %s present=%t", ip, present)
+	return nil, nil
+}
+
+func TestKVPeerDistribution(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	defer func(interval time.Duration) { peerPollInterval = interval }(peerPollInterval)
+	peerPollInterval = 10 * time.Millisecond
+
+	d1 := newKVDriver(ds)
+	d2 := newKVDriver(ds)
+
+	addr, _ := types.ParseCIDR("10.1.0.2/24")
+	mac, _ := net.ParseMAC("02:42:0a:01:00:02")
+	n := &network{id: "n1", driver: d1, endpoints: endpointTable{}}
+	n.addEndpoint(&endpoint{id: "ep1", addr: addr, mac: mac})
+	d1.addNetwork(n)
+
+	// The endpoint joins before the discovery of the local node
+	d1.peerDbAdd("n1", "ep1", addr.IP, addr.Mask, mac, nil, true)
+	d1.peers.joinEndpoint("n1", "ep1")
+
+	d1.peers.nodeJoin("192.168.0.1", true)
+	d2.peers.nodeJoin("192.168.0.2", true)
+	defer d2.peers.fini()
+
+	pMac, vtep := waitForPeer(t, d2, "n1", addr.IP, true)
+	if pMac.String() != mac.String() || !vtep.Equal(net.ParseIP("192.168.0.1")) {
+		t.Fatalf("Unexpected peer %s on %s", pMac, vtep)
+	}
+
+	rMac, rMask, rVtep, err := d2.peers.resolvePeer("n1", addr.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rMac.String() != mac.String() || rMask.String() != addr.Mask.String() || !rVtep.Equal(vtep) {
+		t.Fatalf("Unexpected resolved peer %s %s on %s", rMac, rMask, rVtep)
+	}
+
+	// The local endpoints are not programmed as remote peers
+	if _, _, _, err := d1.peerDbSearch("n1", addr.IP); err != nil {
+		t.Fatal(err)
+	}
+	p1 := d1.peers.(*kvPeers)
+	p1.Lock()
+	remote := len(p1.peers)
+	p1.Unlock()
+	if remote != 0 {
+		t.Fatalf("Expected no remote peer on the local node, got %d", remote)
+	}
+
+	d1.peers.leaveEndpoint("n1", "ep1")
+	waitForPeer(t, d2, "n1", addr.IP, false)
+
+	if _, _, _, err := d2.peers.resolvePeer("n1", addr.IP); err == nil {
+		t.Fatal("Expected the withdrawn peer not to resolve")
+	}
+
+	// Stopping the distribution withdraws the local endpoints
+	d1.peers.joinEndpoint("n1", "ep1")
+	waitForPeer(t, d2, "n1", addr.IP, true)
+	d1.peers.fini()
+	waitForPeer(t, d2, "n1", addr.IP, false)
+}
+
+// publishedPeers returns the records the node published in the datastore
+// for the network.
+func publishedPeers(t *testing.T, ds datastore.DataStore, nid, vtep string) []*peerRecord {
+	r := &peerRecord{nid: nid, vtep: net.ParseIP(vtep)}
+	kvol, err := ds.List(datastore.Key(r.KeyPrefix()...), &peerRecord{})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	records := make([]*peerRecord, 0, len(kvol))
+	for _, kvo := range kvol {
+		records = append(records, kvo.(*peerRecord))
+	}
+	return records
+}
+
+func TestKVPeerNodeLeave(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	defer func(interval time.Duration) { peerPollInterval = interval }(peerPollInterval)
+	peerPollInterval = 10 * time.Millisecond
+
+	// A record left by a previous run of the node is withdrawn on its join
+	stale, _ := types.ParseCIDR("10.1.0.9/24")
+	staleMac, _ := net.ParseMAC("02:42:0a:01:00:09")
+	if err := ds.PutObject(&peerRecord{nid: "n1", eid: "stale", ip: stale.IP, mask: stale.Mask,
+		mac: staleMac, vtep: net.ParseIP("192.168.0.1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	d1 := newKVDriver(ds)
+	d2 := newKVDriver(ds)
+
+	addr, _ := types.ParseCIDR("10.1.0.2/24")
+	mac, _ := net.ParseMAC("02:42:0a:01:00:02")
+	n := &network{id: "n1", driver: d1, endpoints: endpointTable{}}
+	n.addEndpoint(&endpoint{id: "ep1", addr: addr, mac: mac})
+	d1.addNetwork(n)
+	d1.peerDbAdd("n1", "ep1", addr.IP, addr.Mask, mac, nil, true)
+	d1.peers.joinEndpoint("n1", "ep1")
+
+	d1.peers.nodeJoin("192.168.0.1", true)
+	d2.peers.nodeJoin("192.168.0.2", true)
+	defer d2.peers.fini()
+
+	records := publishedPeers(t, ds, "n1", "192.168.0.1")
+	if len(records) != 1 || records[0].eid != "ep1" {
+		t.Fatalf("Expected only the joined endpoint to be published, got %v", records)
+	}
+	waitForPeer(t, d2, "n1", addr.IP, true)
+
+	// A node still up publishes its endpoints again when taken for gone
+	d2.peers.nodeLeave("192.168.0.1")
+	for i := 0; len(publishedPeers(t, ds, "n1", "192.168.0.1")) == 0; i++ {
+		if i == 100 {
+			t.Fatal("Timed out waiting for the endpoint to be published again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The records of a node which stopped without withdrawing them are
+	// dropped when it leaves the cluster
+	p1 := d1.peers.(*kvPeers)
+	p1.Lock()
+	close(p1.stopCh)
+	p1.started = false
+	p1.Unlock()
+	<-p1.doneCh
+
+	d2.peers.nodeLeave("192.168.0.1")
+	if records := publishedPeers(t, ds, "n1", "192.168.0.1"); len(records) != 0 {
+		t.Fatalf("Expected the records of the departed node to be dropped, got %v", records)
+	}
+	waitForPeer(t, d2, "n1", addr.IP, false)
+
+	// The records of the local node are not dropped
+	d2.peers.nodeLeave("192.168.0.2")
+}
+
+func TestKVPeerInvalidRecord(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	for _, value := range []string{
+		`{"nid": 1}`,
+		`{"nid": "n1", "eid": "ep9", "ip": "10.1.0.9"}`,
+		`not json`,
+	} {
+		if err := (&peerRecord{}).SetValue([]byte(value)); err == nil {
+			t.Fatalf("Expected the invalid record %s to fail", value)
+		}
+	}
+
+	// An invalid record does not hide the valid ones of the network
+	if err := ds.KVStore().Put(datastore.Key("overlay", peerPrefix, "n1", "192.168.0.9", "ep9"),
+		[]byte(`{"nid": 1}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := types.ParseCIDR("10.1.0.2/24")
+	mac, _ := net.ParseMAC("02:42:0a:01:00:02")
+	if err := ds.PutObject(&peerRecord{nid: "n1", eid: "ep1", ip: addr.IP, mask: addr.Mask,
+		mac: mac, vtep: net.ParseIP("192.168.0.1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newKVDriver(ds)
+	rMac, _, rVtep, err := d.peers.resolvePeer("n1", addr.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rMac.String() != mac.String() || !rVtep.Equal(net.ParseIP("192.168.0.1")) {
+		t.Fatalf("Unexpected resolved peer %s on %s", rMac, rVtep)
+	}
+	if _, _, _, err := d.peers.resolvePeer("n2", addr.IP); err == nil {
+		t.Fatal("Expected the peer of another network not to resolve")
+	}
+}
+
+func TestPeerDistributionConfig(t *testing.T) {
+	dt := &driverTester{t: t}
+	config := map[string]interface{}{netlabel.OverlayPeerDistribution: kvDistribution}
+	if err := Init(dt, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dt.d.peers.(*kvPeers); !ok {
+		t.Fatalf("Expected the kv peer distribution, got %T", dt.d.peers)
+	}
+
+	config[netlabel.OverlayPeerDistribution] = "gossip"
+	if err := Init(&driverTester{t: t}, config); err == nil {
+		t.Fatal("Expected an unknown peer distribution to fail")
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/osl"
 	"github.com/docker/libnetwork/types"
 	"github.com/vishvananda/netlink"
@@ -41,9 +44,30 @@ type network struct {
 	initEpoch int
 	initErr   error
 	subnets   []*subnet
+	internal  bool
+	secure    bool
 	sync.Mutex
 }
 
+// parseSecureOption parses the value of the encrypted option as a bool, an
+// empty value meaning true as in "--opt encrypted".
+func parseSecureOption(val interface{}) (bool, error) {
+	switch v := val.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if v == "" {
+			return true, nil
+		}
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, types.BadRequestErrorf("invalid value %q for the %s option", v, secureOption)
+		}
+		return secure, nil
+	}
+	return false, types.BadRequestErrorf("invalid type %T for the %s option", val, secureOption)
+}
+
 func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
 	if id == "" {
 		return fmt.Errorf("invalid network id")
@@ -63,6 +87,34 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 		subnets:   []*subnet{},
 	}
 
+	if val, ok := option[netlabel.Internal]; ok {
+		if internal, ok := val.(bool); ok && internal {
+			n.internal = true
+		}
+	}
+
+	if genData, ok := option[netlabel.GenericData]; ok && genData != nil {
+		var (
+			val    interface{}
+			exists bool
+		)
+		switch opts := genData.(type) {
+		case map[string]string:
+			val, exists = opts[secureOption]
+		case options.Generic:
+			val, exists = opts[secureOption]
+		case map[string]interface{}:
+			val, exists = opts[secureOption]
+		}
+		if exists {
+			secure, err := parseSecureOption(val)
+			if err != nil {
+				return err
+			}
+			n.secure = secure
+		}
+	}
+
 	for _, ipd := range ipV4Data {
 		s := &subnet{
 			subnetIP: ipd.Pool,
@@ -108,6 +160,7 @@ func (d *driver) DeleteNetwork(nid string) error {
 	}
 
 	d.deleteNetwork(nid)
+	d.deleteEncryption(n)
 
 	return n.releaseVxlanID()
 }
@@ -196,9 +249,13 @@ func (n *network) initSubnetSandbox(s *subnet) error {
 	}
 	sbox := n.sandbox()
 
-	if err := sbox.AddInterface(brName, "br",
-		sbox.InterfaceOptions().Address(s.gwIP),
-		sbox.InterfaceOptions().Bridge(true)); err != nil {
+	brIfaceOptions := []osl.IfaceOption{sbox.InterfaceOptions().Bridge(true)}
+	// Internal networks have no gateway to route through
+	if !n.isInternal() {
+		brIfaceOptions = append(brIfaceOptions, sbox.InterfaceOptions().Address(s.gwIP))
+	}
+
+	if err := sbox.AddInterface(brName, "br", brIfaceOptions...); err != nil {
 		return fmt.Errorf("bridge creation in sandbox failed for subnet %q: %v", s.subnetIP.IP.String(), err)
 	}
 
@@ -274,7 +331,7 @@ func (n *network) watchMiss(nlSock *nl.NetlinkSocket) {
 				continue
 			}
 
-			mac, IPmask, vtep, err := n.driver.resolvePeer(n.id, neigh.IP)
+			mac, IPmask, vtep, err := n.driver.peers.resolvePeer(n.id, neigh.IP)
 			if err != nil {
 				logrus.Errorf("could not resolve peer %q: %v", neigh.IP, err)
 				continue
@@ -338,6 +395,20 @@ func (n *network) sandbox() osl.Sandbox {
 	return n.sbox
 }
 
+func (n *network) isInternal() bool {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.internal
+}
+
+func (n *network) isSecure() bool {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.secure
+}
+
 func (n *network) setSandbox(sbox osl.Sandbox) {
 	n.Lock()
 	n.sbox = sbox
@@ -377,6 +448,8 @@ func (n *network) Value() []byte {
 	overlayNetmap["subnetIP"] = s.subnetIP.String()
 	overlayNetmap["gwIP"] = s.gwIP.String()
 	overlayNetmap["vni"] = s.vni
+	overlayNetmap["internal"] = n.internal
+	overlayNetmap["secure"] = n.secure
 
 	b, err := json.Marshal(overlayNetmap)
 	if err != nil {
@@ -417,6 +490,12 @@ func (n *network) SetValue(value []byte) error {
 	subnetIPstr := overlayNetmap["subnetIP"].(string)
 	gwIPstr := overlayNetmap["gwIP"].(string)
 	vni := uint32(overlayNetmap["vni"].(float64))
+	if v, ok := overlayNetmap["internal"]; ok {
+		n.internal = v.(bool)
+	}
+	if v, ok := overlayNetmap["secure"]; ok {
+		n.secure = v.(bool)
+	}
 
 	subnetIP, _ := types.ParseCIDR(subnetIPstr)
 	gwIP, _ := types.ParseCIDR(gwIPstr)
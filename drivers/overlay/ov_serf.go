@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -16,6 +17,13 @@ type ovNotify struct {
 	nid    string
 }
 
+// serfPeers distributes the peers with the serf gossip of the nodes. The
+// nodes join the cluster through the neighbor discovered first, and resolve
+// the missed peers with serf queries.
+type serfPeers struct {
+	d *driver
+}
+
 type logWriter struct{}
 
 func (l *logWriter) Write(p []byte) (int, error) {
@@ -35,6 +43,77 @@ func (l *logWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+func (s *serfPeers) nodeJoin(node string, self bool) {
+	d := s.d
+
+	if self && !d.isSerfAlive() {
+		d.Lock()
+		d.bindAddress = node
+		d.Unlock()
+		err := d.serfInit()
+		if err != nil {
+			logrus.Errorf("initializing serf instance failed: %v", err)
+			return
+		}
+	}
+
+	d.Lock()
+	if !self {
+		d.neighIP = node
+	}
+	neighIP := d.neighIP
+	d.Unlock()
+
+	if d.serfInstance != nil && neighIP != "" {
+		var err error
+		d.joinOnce.Do(func() {
+			err = d.serfJoin(neighIP)
+			if err == nil {
+				d.pushLocalDb()
+			}
+		})
+		if err != nil {
+			logrus.Errorf("joining serf neighbor %s failed: %v", node, err)
+			d.Lock()
+			d.joinOnce = sync.Once{}
+			d.Unlock()
+			return
+		}
+	}
+}
+
+// nodeLeave is a no-op: serf detects the failed nodes itself.
+func (s *serfPeers) nodeLeave(node string) {
+}
+
+func (s *serfPeers) joinEndpoint(nid, eid string) {
+	s.d.pushLocalEndpointEvent("join", nid, eid)
+}
+
+func (s *serfPeers) leaveEndpoint(nid, eid string) {
+	s.d.notifyCh <- ovNotify{
+		action: "leave",
+		nid:    nid,
+		eid:    eid,
+	}
+}
+
+func (s *serfPeers) resolvePeer(nid string, peerIP net.IP) (net.HardwareAddr, net.IPMask, net.IP, error) {
+	return s.d.resolvePeer(nid, peerIP)
+}
+
+func (s *serfPeers) fini() {
+	d := s.d
+
+	if d.exitCh != nil {
+		waitCh := make(chan struct{})
+
+		d.exitCh <- waitCh
+
+		<-waitCh
+	}
+}
+
 func (d *driver) serfInit() error {
 	var err error
 
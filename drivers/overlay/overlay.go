@@ -2,9 +2,9 @@ package overlay
 
 import (
 	"fmt"
+	"net"
 	"sync"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/docker/libkv/store"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
@@ -21,8 +21,31 @@ const (
 	vxlanIDEnd   = 1000
 	vxlanPort    = 4789
 	vxlanVethMTU = 1450
+
+	serfDistribution = "serf"
+	kvDistribution   = "kv"
 )
 
+// peerDistributor publishes the local endpoints of the overlay networks to
+// the other nodes, and programs the driver with the remote ones through
+// peerAdd and peerDelete.
+type peerDistributor interface {
+	// nodeJoin is called on the discovery of a node, the local one when
+	// self is set
+	nodeJoin(node string, self bool)
+	// nodeLeave is called when a remote node leaves the cluster
+	nodeLeave(node string)
+	// joinEndpoint publishes a local endpoint joining its sandbox
+	joinEndpoint(nid, eid string)
+	// leaveEndpoint withdraws a local endpoint leaving its sandbox
+	leaveEndpoint(nid, eid string)
+	// resolvePeer returns the mac address, the address mask and the vtep of
+	// the remote peer of the address, on a miss of the network sandbox
+	resolvePeer(nid string, peerIP net.IP) (net.HardwareAddr, net.IPMask, net.IP, error)
+	// fini stops the distribution
+	fini()
+}
+
 type driver struct {
 	eventCh      chan serf.Event
 	notifyCh     chan ovNotify
@@ -36,6 +59,8 @@ type driver struct {
 	store        datastore.DataStore
 	ipAllocator  *idm.Idm
 	vxlanIdm     *idm.Idm
+	encrMap      *encrMap
+	peers        peerDistributor
 	once         sync.Once
 	joinOnce     sync.Once
 	sync.Mutex
@@ -52,9 +77,25 @@ func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
 		peerDb: peerNetworkMap{
 			mp: map[string]peerMap{},
 		},
+		encrMap: &encrMap{
+			nodes: map[string]*encrNode{},
+		},
 		config: config,
 	}
 
+	distribution := serfDistribution
+	if v, ok := config[netlabel.OverlayPeerDistribution]; ok {
+		distribution, _ = v.(string)
+	}
+	switch distribution {
+	case serfDistribution:
+		d.peers = &serfPeers{d: d}
+	case kvDistribution:
+		d.peers = newKVPeers(d)
+	default:
+		return fmt.Errorf("unknown overlay peer distribution %q", distribution)
+	}
+
 	return dc.RegisterDriver(networkType, d, c)
 }
 
@@ -62,13 +103,8 @@ func Init(dc driverapi.DriverCallback, config map[string]interface{}) error {
 func Fini(drv driverapi.Driver) {
 	d := drv.(*driver)
 
-	if d.exitCh != nil {
-		waitCh := make(chan struct{})
-
-		d.exitCh <- waitCh
-
-		<-waitCh
-	}
+	d.stopEncryption()
+	d.peers.fini()
 }
 
 func (d *driver) configure() error {
@@ -121,40 +157,7 @@ func (d *driver) Type() string {
 }
 
 func (d *driver) nodeJoin(node string, self bool) {
-	if self && !d.isSerfAlive() {
-		d.Lock()
-		d.bindAddress = node
-		d.Unlock()
-		err := d.serfInit()
-		if err != nil {
-			logrus.Errorf("initializing serf instance failed: %v", err)
-			return
-		}
-	}
-
-	d.Lock()
-	if !self {
-		d.neighIP = node
-	}
-	neighIP := d.neighIP
-	d.Unlock()
-
-	if d.serfInstance != nil && neighIP != "" {
-		var err error
-		d.joinOnce.Do(func() {
-			err = d.serfJoin(neighIP)
-			if err == nil {
-				d.pushLocalDb()
-			}
-		})
-		if err != nil {
-			logrus.Errorf("joining serf neighbor %s failed: %v", node, err)
-			d.Lock()
-			d.joinOnce = sync.Once{}
-			d.Unlock()
-			return
-		}
-	}
+	d.peers.nodeJoin(node, self)
 }
 
 func (d *driver) pushLocalEndpointEvent(action, nid, eid string) {
@@ -182,5 +185,14 @@ func (d *driver) DiscoverNew(dType driverapi.DiscoveryType, data interface{}) er
 
 // DiscoverDelete is a notification for a discovery delete event, such as a node leaving a cluster
 func (d *driver) DiscoverDelete(dType driverapi.DiscoveryType, data interface{}) error {
+	if dType == driverapi.NodeDiscovery {
+		nodeData, ok := data.(driverapi.NodeDiscoveryData)
+		if !ok || nodeData.Address == "" {
+			return fmt.Errorf("invalid discovery data")
+		}
+		if !nodeData.Self {
+			d.peers.nodeLeave(nodeData.Address)
+		}
+	}
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"net"
 	"sync"
 	"syscall"
+
+	"github.com/Sirupsen/logrus"
 )
 
 type peerKey struct {
@@ -271,6 +273,11 @@ func (d *driver) peerAdd(nid, eid string, peerIP net.IP, peerIPMask net.IPMask,
 		return fmt.Errorf("subnet sandbox join failed for %q: %v", s.subnetIP.String(), err)
 	}
 
+	// Encrypt the traffic with the peer node before it can flow
+	if err := d.checkEncryption(nid, vtep, true); err != nil {
+		return fmt.Errorf("could not program the encryption of the traffic with %s: %v", vtep, err)
+	}
+
 	// Add neighbor entry for the peer IP
 	if err := sbox.AddNeighbor(peerIP, peerMac, sbox.NeighborOptions().LinkName(s.vxlanName)); err != nil {
 		return fmt.Errorf("could not add neigbor entry into the sandbox: %v", err)
@@ -296,6 +303,10 @@ func (d *driver) peerDelete(nid, eid string, peerIP net.IP, peerIPMask net.IPMas
 		d.peerDbDelete(nid, eid, peerIP, peerIPMask, peerMac, vtep)
 	}
 
+	if err := d.checkEncryption(nid, vtep, false); err != nil {
+		logrus.Warnf("could not remove the encryption of the traffic with %s: %v", vtep, err)
+	}
+
 	n := d.network(nid)
 	if n == nil {
 		return nil
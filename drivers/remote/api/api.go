@@ -24,6 +24,9 @@ func (r *Response) GetError() string {
 type GetCapabilityResponse struct {
 	Response
 	Scope string
+	// Restore is set by the plugins which implement the optional
+	// RestoreNetwork and RestoreEndpoint methods
+	Restore bool
 }
 
 // CreateNetworkRequest requests a new network.
@@ -44,6 +47,24 @@ type CreateNetworkResponse struct {
 	Response
 }
 
+// RestoreNetworkRequest requests the restore of a network which was created
+// in a past life of libnetwork.
+type RestoreNetworkRequest struct {
+	// The ID of the network, as passed at creation time.
+	NetworkID string
+
+	// A free form map->object interface for communication of options.
+	Options map[string]interface{}
+
+	// IPAMData contains the address pool information for this network
+	IPv4Data, IPv6Data []driverapi.IPAMData
+}
+
+// RestoreNetworkResponse is the response to the RestoreNetworkRequest.
+type RestoreNetworkResponse struct {
+	Response
+}
+
 // DeleteNetworkRequest is the request to delete an existing network.
 type DeleteNetworkRequest struct {
 	// The ID of the network to delete.
@@ -70,6 +91,7 @@ type EndpointInterface struct {
 	Address     string
 	AddressIPv6 string
 	MacAddress  string
+	Addresses   []string
 }
 
 // CreateEndpointResponse is the response to the CreateEndpoint action.
@@ -78,6 +100,21 @@ type CreateEndpointResponse struct {
 	Interface *EndpointInterface
 }
 
+// RestoreEndpointRequest requests the restore of an endpoint which was created
+// in a past life of libnetwork.
+type RestoreEndpointRequest struct {
+	NetworkID  string
+	EndpointID string
+	Interface  *EndpointInterface
+	// The key of the sandbox the endpoint is joined to, if any.
+	SandboxKey string
+}
+
+// RestoreEndpointResponse is the response to the RestoreEndpointRequest.
+type RestoreEndpointResponse struct {
+	Response
+}
+
 // Interface is the representation of a linux interface.
 type Interface struct {
 	Address     *net.IPNet
@@ -15,6 +15,7 @@ import (
 type driver struct {
 	endpoint    *plugins.Client
 	networkType string
+	restore     bool
 }
 
 type maybeError interface {
@@ -60,6 +61,8 @@ func (d *driver) getCapabilities() (*driverapi.Capability, error) {
 		return nil, fmt.Errorf("invalid capability: expecting 'local' or 'global', got %s", capResp.Scope)
 	}
 
+	d.restore = capResp.Restore
+
 	return c, nil
 }
 
@@ -92,6 +95,21 @@ func (d *driver) CreateNetwork(id string, options map[string]interface{}, ipV4Da
 	return d.call("CreateNetwork", create, &api.CreateNetworkResponse{})
 }
 
+// RestoreNetwork is invoked for the networks created in a past life of
+// libnetwork. It is only forwarded to the plugins advertising the capability.
+func (d *driver) RestoreNetwork(id string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	if !d.restore {
+		return nil
+	}
+	restore := &api.RestoreNetworkRequest{
+		NetworkID: id,
+		Options:   options,
+		IPv4Data:  ipV4Data,
+		IPv6Data:  ipV6Data,
+	}
+	return d.call("RestoreNetwork", restore, &api.RestoreNetworkResponse{})
+}
+
 func (d *driver) DeleteNetwork(nid string) error {
 	delete := &api.DeleteNetworkRequest{NetworkID: nid}
 	return d.call("DeleteNetwork", delete, &api.DeleteNetworkResponse{})
@@ -102,21 +120,10 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 		return fmt.Errorf("must not be called with nil InterfaceInfo")
 	}
 
-	reqIface := &api.EndpointInterface{}
-	if ifInfo.Address() != nil {
-		reqIface.Address = ifInfo.Address().String()
-	}
-	if ifInfo.AddressIPv6() != nil {
-		reqIface.AddressIPv6 = ifInfo.AddressIPv6().String()
-	}
-	if ifInfo.MacAddress() != nil {
-		reqIface.MacAddress = ifInfo.MacAddress().String()
-	}
-
 	create := &api.CreateEndpointRequest{
 		NetworkID:  nid,
 		EndpointID: eid,
-		Interface:  reqIface,
+		Interface:  makeEndpointInterface(ifInfo),
 		Options:    epOptions,
 	}
 	var res api.CreateEndpointResponse
@@ -152,6 +159,40 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 	return nil
 }
 
+// RestoreEndpoint is invoked for the endpoints created in a past life of
+// libnetwork. It is only forwarded to the plugins advertising the capability.
+func (d *driver) RestoreEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, sboxKey string) error {
+	if !d.restore {
+		return nil
+	}
+	restore := &api.RestoreEndpointRequest{
+		NetworkID:  nid,
+		EndpointID: eid,
+		SandboxKey: sboxKey,
+	}
+	if ifInfo != nil {
+		restore.Interface = makeEndpointInterface(ifInfo)
+	}
+	return d.call("RestoreEndpoint", restore, &api.RestoreEndpointResponse{})
+}
+
+func makeEndpointInterface(ifInfo driverapi.InterfaceInfo) *api.EndpointInterface {
+	reqIface := &api.EndpointInterface{}
+	if ifInfo.Address() != nil {
+		reqIface.Address = ifInfo.Address().String()
+	}
+	if ifInfo.AddressIPv6() != nil {
+		reqIface.AddressIPv6 = ifInfo.AddressIPv6().String()
+	}
+	if ifInfo.MacAddress() != nil {
+		reqIface.MacAddress = ifInfo.MacAddress().String()
+	}
+	for _, addr := range ifInfo.Addresses() {
+		reqIface.Addresses = append(reqIface.Addresses, addr.String())
+	}
+	return reqIface
+}
+
 func errorWithRollback(msg string, err error) error {
 	rollback := "rolled back"
 	if err != nil {
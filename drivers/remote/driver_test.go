@@ -69,6 +69,7 @@ type testEndpoint struct {
 	dst            string
 	address        string
 	addressIPv6    string
+	addresses      []string
 	macAddress     string
 	gateway        string
 	gatewayIPv6    string
@@ -99,6 +100,15 @@ func (test *testEndpoint) AddressIPv6() *net.IPNet {
 	return nw
 }
 
+func (test *testEndpoint) Addresses() []*net.IPNet {
+	var addrs []*net.IPNet
+	for _, a := range test.addresses {
+		nw, _ := types.ParseCIDR(a)
+		addrs = append(addrs, nw)
+	}
+	return addrs
+}
+
 func (test *testEndpoint) MacAddress() net.HardwareAddr {
 	if test.macAddress == "" {
 		return nil
@@ -505,6 +515,10 @@ func (r *rollbackEndpoint) AddressIPv6() *net.IPNet {
 	return nil
 }
 
+func (r *rollbackEndpoint) Addresses() []*net.IPNet {
+	return nil
+}
+
 func (r *rollbackEndpoint) SetMacAddress(mac net.HardwareAddr) error {
 	return fmt.Errorf("invalid mac")
 }
@@ -551,3 +565,91 @@ func TestRollback(t *testing.T) {
 		t.Fatalf("Expected to have had DeleteEndpoint called")
 	}
 }
+
+func TestRestore(t *testing.T) {
+	var plugin = "test-net-driver-restore"
+
+	mux := http.NewServeMux()
+	defer setupPlugin(t, plugin, mux)()
+
+	var restored []string
+	handle(t, mux, "GetCapabilities", func(msg map[string]interface{}) interface{} {
+		return map[string]interface{}{
+			"Scope":   "local",
+			"Restore": true,
+		}
+	})
+	handle(t, mux, "RestoreNetwork", func(msg map[string]interface{}) interface{} {
+		restored = append(restored, msg["NetworkID"].(string))
+		return map[string]interface{}{}
+	})
+	handle(t, mux, "RestoreEndpoint", func(msg map[string]interface{}) interface{} {
+		if msg["SandboxKey"].(string) != "/var/run/docker/netns/dummy" {
+			t.Fatalf("Unexpected sandbox key in restore request: %v", msg["SandboxKey"])
+		}
+		iface := msg["Interface"].(map[string]interface{})
+		if iface["Address"].(string) != "192.168.5.7/16" {
+			t.Fatalf("Unexpected address in restore request: %v", iface["Address"])
+		}
+		restored = append(restored, msg["EndpointID"].(string))
+		return map[string]interface{}{}
+	})
+
+	p, err := plugins.Get(plugin, driverapi.NetworkPluginEndpointType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDriver(plugin, p.Client)
+	if _, err := d.(*driver).getCapabilities(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, ok := d.(driverapi.Restorer)
+	if !ok {
+		t.Fatal("Remote driver does not implement the restorer interface")
+	}
+
+	if err := r.RestoreNetwork("dummy", map[string]interface{}{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	ep := &testEndpoint{t: t, address: "192.168.5.7/16"}
+	if err := r.RestoreEndpoint("dummy", "dummy-ep", ep, "/var/run/docker/netns/dummy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(restored) != 2 || restored[0] != "dummy" || restored[1] != "dummy-ep" {
+		t.Fatalf("Unexpected restore calls to the plugin: %v", restored)
+	}
+}
+
+func TestRestoreNotSupported(t *testing.T) {
+	var plugin = "test-net-driver-no-restore"
+
+	mux := http.NewServeMux()
+	defer setupPlugin(t, plugin, mux)()
+
+	handle(t, mux, "GetCapabilities", func(msg map[string]interface{}) interface{} {
+		return map[string]interface{}{
+			"Scope": "local",
+		}
+	})
+	handle(t, mux, "RestoreNetwork", func(msg map[string]interface{}) interface{} {
+		t.Fatal("Restore must not be invoked on a plugin not advertising it")
+		return nil
+	})
+
+	p, err := plugins.Get(plugin, driverapi.NetworkPluginEndpointType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDriver(plugin, p.Client)
+	if _, err := d.(*driver).getCapabilities(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.(driverapi.Restorer).RestoreNetwork("dummy", map[string]interface{}{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/conntrack"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/netlabel"
@@ -27,6 +28,9 @@ type Endpoint interface {
 	// Network returns the name of the network to which this endpoint is attached.
 	Network() string
 
+	// Labels returns the user labels associated with this endpoint.
+	Labels() map[string]string
+
 	// Join joins the sandbox to the endpoint and populates into the sandbox
 	// the network resources allocated for the endpoint.
 	Join(sandbox Sandbox, options ...EndpointOption) error
@@ -58,6 +62,12 @@ type endpoint struct {
 	sandboxID     string
 	exposedPorts  []types.TransportPort
 	generic       map[string]interface{}
+	labels        map[string]string
+	aliases       []string
+	joinAliases   []string
+	lb            *lbConfig
+	virtualIP     net.IP
+	vipPoolID     string
 	joinLeaveDone chan struct{}
 	dbIndex       uint64
 	dbExists      bool
@@ -76,6 +86,20 @@ func (ep *endpoint) MarshalJSON() ([]byte, error) {
 	if ep.generic != nil {
 		epMap["generic"] = ep.generic
 	}
+	if ep.labels != nil {
+		epMap["labels"] = ep.labels
+	}
+	if len(ep.aliases) > 0 {
+		epMap["aliases"] = ep.aliases
+	}
+	if len(ep.joinAliases) > 0 {
+		epMap["join_aliases"] = ep.joinAliases
+	}
+	if ep.lb != nil {
+		epMap["load_balancer"] = ep.lb
+		epMap["virtual_ip"] = ep.virtualIP.String()
+		epMap["vip_pool"] = ep.vipPoolID
+	}
 	epMap["sandbox"] = ep.sandboxID
 	return json.Marshal(epMap)
 }
@@ -105,6 +129,32 @@ func (ep *endpoint) UnmarshalJSON(b []byte) (err error) {
 	if v, ok := epMap["generic"]; ok {
 		ep.generic = v.(map[string]interface{})
 	}
+
+	if v, ok := epMap["labels"]; ok {
+		ep.labels = make(map[string]string)
+		for k, l := range v.(map[string]interface{}) {
+			ep.labels[k] = l.(string)
+		}
+	}
+
+	if v, ok := epMap["aliases"]; ok {
+		for _, a := range v.([]interface{}) {
+			ep.aliases = append(ep.aliases, a.(string))
+		}
+	}
+
+	if v, ok := epMap["join_aliases"]; ok {
+		for _, a := range v.([]interface{}) {
+			ep.joinAliases = append(ep.joinAliases, a.(string))
+		}
+	}
+
+	if v, ok := epMap["load_balancer"]; ok {
+		lb, _ := json.Marshal(v)
+		json.Unmarshal(lb, &ep.lb)
+		ep.virtualIP = net.ParseIP(epMap["virtual_ip"].(string))
+		ep.vipPoolID = epMap["vip_pool"].(string)
+	}
 	return nil
 }
 
@@ -136,6 +186,23 @@ func (ep *endpoint) CopyTo(o datastore.KVObject) error {
 		dstEp.generic[k] = v
 	}
 
+	dstEp.labels = copyLabels(ep.labels)
+	dstEp.aliases = make([]string, len(ep.aliases))
+	copy(dstEp.aliases, ep.aliases)
+	dstEp.joinAliases = make([]string, len(ep.joinAliases))
+	copy(dstEp.joinAliases, ep.joinAliases)
+
+	if ep.lb != nil {
+		lb := *ep.lb
+		if ep.lb.HealthCheck != nil {
+			hc := *ep.lb.HealthCheck
+			lb.HealthCheck = &hc
+		}
+		dstEp.lb = &lb
+	}
+	dstEp.virtualIP = types.GetIPCopy(ep.virtualIP)
+	dstEp.vipPoolID = ep.vipPoolID
+
 	return nil
 }
 
@@ -161,6 +228,13 @@ func (ep *endpoint) Network() string {
 	return ep.network.name
 }
 
+func (ep *endpoint) Labels() map[string]string {
+	ep.Lock()
+	defer ep.Unlock()
+
+	return copyLabels(ep.labels)
+}
+
 // endpoint Key structure : endpoint/network-id/endpoint-id
 func (ep *endpoint) Key() []string {
 	if ep.network == nil {
@@ -221,7 +295,7 @@ func (ep *endpoint) Exists() bool {
 }
 
 func (ep *endpoint) Skip() bool {
-	return ep.getNetwork().Skip() || ep.DataScope() == datastore.LocalScope
+	return ep.getNetwork().Skip()
 }
 
 func (ep *endpoint) processOptions(options ...EndpointOption) {
@@ -235,6 +309,42 @@ func (ep *endpoint) processOptions(options ...EndpointOption) {
 	}
 }
 
+func (ep *endpoint) getExposedPorts() []types.TransportPort {
+	ep.Lock()
+	defer ep.Unlock()
+
+	ports := make([]types.TransportPort, len(ep.exposedPorts))
+	copy(ports, ep.exposedPorts)
+	return ports
+}
+
+func (ep *endpoint) getAliases() []string {
+	ep.Lock()
+	defer ep.Unlock()
+
+	aliases := make([]string, len(ep.aliases))
+	copy(aliases, ep.aliases)
+	return appendNames(aliases, ep.joinAliases)
+}
+
+// appendNames appends the passed names to the list skipping the ones
+// already present.
+func appendNames(list []string, names []string) []string {
+	for _, name := range names {
+		found := false
+		for _, a := range list {
+			if a == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
 func (ep *endpoint) getNetwork() *network {
 	ep.Lock()
 	defer ep.Unlock()
@@ -294,6 +404,7 @@ func (ep *endpoint) sbJoin(sbox Sandbox, options ...EndpointOption) error {
 	ep.network = network
 	ep.sandboxID = sbox.ID()
 	ep.joinInfo = &endpointJoinInfo{}
+	ep.joinAliases = nil
 	epid := ep.id
 	ep.Unlock()
 	defer func() {
@@ -317,6 +428,7 @@ func (ep *endpoint) sbJoin(sbox Sandbox, options ...EndpointOption) error {
 
 	err = driver.Join(nid, epid, sbox.Key(), ep, sbox.Labels())
 	if err != nil {
+		network.getController().publishEvent(driverErrorEvent(network, epid, err))
 		return err
 	}
 	defer func() {
@@ -367,6 +479,17 @@ func (ep *endpoint) sbJoin(sbox Sandbox, options ...EndpointOption) error {
 		return err
 	}
 
+	sb.addLBServices(network)
+
+	if err := sb.storeUpdate(); err != nil {
+		log.Warnf("Failed to update store for sandbox %s: %v", sb.ID(), err)
+	}
+
+	ev := endpointEvent(EventEndpointJoin, network, ep)
+	ev.SandboxID = sb.ID()
+	ev.ContainerID = sb.ContainerID()
+	network.getController().publishEvent(ev)
+
 	if sb.needDefaultGW() {
 		return sb.setupDefaultGW(ep)
 	}
@@ -425,14 +548,21 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 
 	ep.processOptions(options...)
 
+	// The service records of the endpoint are
+	// removed along with its join aliases
+	svcEp := &endpoint{network: n}
+	ep.CopyTo(svcEp)
+
 	ep.Lock()
 	ep.sandboxID = ""
+	ep.joinAliases = nil
 	ep.network = n
 	ep.Unlock()
 
 	if err := n.getController().updateToStore(ep); err != nil {
 		ep.Lock()
 		ep.sandboxID = sid
+		ep.joinAliases = svcEp.joinAliases
 		ep.Unlock()
 		return err
 	}
@@ -443,6 +573,7 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 	}
 
 	if err := d.Leave(n.id, ep.id); err != nil {
+		n.getController().publishEvent(driverErrorEvent(n, ep.id, err))
 		return err
 	}
 
@@ -450,8 +581,19 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 		return err
 	}
 
+	sb.rmLBServices(n)
+
+	if err := sb.storeUpdate(); err != nil {
+		log.Warnf("Failed to update store for sandbox %s: %v", sb.ID(), err)
+	}
+
 	// unwatch for service records
-	n.getController().unWatchSvcRecord(ep)
+	n.getController().unWatchSvcRecord(svcEp)
+
+	ev := endpointEvent(EventEndpointLeave, n, ep)
+	ev.SandboxID = sb.ID()
+	ev.ContainerID = sb.ContainerID()
+	n.getController().publishEvent(ev)
 
 	if sb.needDefaultGW() {
 		ep := sb.getEPwithoutGateway()
@@ -511,8 +653,15 @@ func (ep *endpoint) Delete() error {
 		return err
 	}
 
+	n.removeLBService(ep)
 	ep.releaseAddress()
 
+	if err := n.programPolicy(); err != nil {
+		log.Warnf("Failed to update the policy of network %s on delete of endpoint %s: %v", n.Name(), name, err)
+	}
+
+	n.getController().publishEvent(endpointEvent(EventEndpointDelete, n, ep))
+
 	return nil
 }
 
@@ -533,6 +682,7 @@ func (ep *endpoint) deleteEndpoint() error {
 			return err
 		}
 		log.Warnf("driver error deleting endpoint %s : %v", name, err)
+		n.getController().publishEvent(driverErrorEvent(n, epid, err))
 	}
 
 	return nil
@@ -596,6 +746,47 @@ func CreateOptionPortMapping(portBindings []types.PortBinding) EndpointOption {
 	}
 }
 
+// CreateOptionSecondaryAddresses function returns an option setter for the
+// secondary addresses to be assigned to the endpoint interface in addition to
+// its primary address. An unspecified address (0.0.0.0 or ::) requests any
+// available address of that family from the network address pools. The
+// addresses are allocated through the network IPAM, so the bridge, host and
+// null networks, which do not use it yet, refuse them.
+func CreateOptionSecondaryAddresses(addrs []net.IP) EndpointOption {
+	return func(ep *endpoint) {
+		for _, ip := range addrs {
+			ep.iface.reqAddrs = append(ep.iface.reqAddrs, types.GetIPCopy(ip))
+		}
+	}
+}
+
+// CreateOptionLabels function returns an option setter for the user labels
+// to be associated with the endpoint, to be passed to network.CreateEndpoint() method.
+func CreateOptionLabels(labels map[string]string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.labels = copyLabels(labels)
+	}
+}
+
+// CreateOptionAlias function returns an option setter for the additional
+// names the endpoint is reachable with by the other containers on the
+// network, to be passed to network.CreateEndpoint() method.
+func CreateOptionAlias(names ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.aliases = appendNames(ep.aliases, names)
+	}
+}
+
+// JoinOptionAlias function returns an option setter for the additional
+// names the endpoint is reachable with by the other containers on the
+// network, to be passed to the endpoint.Join() method. They are dropped
+// when the endpoint leaves the sandbox.
+func JoinOptionAlias(names ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.joinAliases = appendNames(ep.joinAliases, names)
+	}
+}
+
 // JoinOptionPriority function returns an option setter for priority option to
 // be passed to the endpoint.Join() method.
 func JoinOptionPriority(ep Endpoint, prio int) EndpointOption {
@@ -624,12 +815,22 @@ func (ep *endpoint) assignAddress() error {
 	)
 	n := ep.getNetwork()
 	if n.Type() == "host" || n.Type() == "null" || n.Type() == "bridge" {
+		if len(ep.iface.reqAddrs) > 0 {
+			return types.ForbiddenErrorf("secondary addresses are not supported on %s network %s", n.Type(), n.Name())
+		}
+		if ep.lb != nil {
+			return types.ForbiddenErrorf("load balancing is not supported on %s network %s", n.Type(), n.Name())
+		}
 		return nil
 	}
+	if ep.lb != nil && len(ep.exposedPorts) == 0 {
+		return types.BadRequestErrorf("load balanced service %s does not expose any port", ep.Name())
+	}
 	ipam, err = n.getController().getIpamDriver(n.ipamType)
 	if err != nil {
 		return err
 	}
+	var found bool
 	for _, d := range n.getIPInfo() {
 		var addr *net.IPNet
 		addr, _, err = ipam.RequestAddress(d.PoolID, nil, nil)
@@ -638,26 +839,145 @@ func (ep *endpoint) assignAddress() error {
 			ep.iface.addr = addr
 			ep.iface.poolID = d.PoolID
 			ep.Unlock()
-			return nil
+			found = true
+			break
 		}
 		if err != ipamapi.ErrNoAvailableIPs {
 			return err
 		}
 	}
-	return fmt.Errorf("no available ip addresses on this network address pools: %s (%s)", n.Name(), n.ID())
+	if !found {
+		return fmt.Errorf("no available ip addresses on this network address pools: %s (%s)", n.Name(), n.ID())
+	}
+
+	if err = ep.assignSecondaryAddresses(ipam); err != nil {
+		ep.releaseAddress()
+		return err
+	}
+
+	if err = ep.assignVirtualIP(ipam); err != nil {
+		ep.releaseAddress()
+		return err
+	}
+	return nil
+}
+
+// assignVirtualIP allocates the virtual IP of a load balanced service
+// from the first IPv4 pool of the network with a free address.
+func (ep *endpoint) assignVirtualIP(ipam ipamapi.Ipam) error {
+	if ep.lb == nil {
+		return nil
+	}
+	n := ep.getNetwork()
+	for _, d := range n.getIPInfo() {
+		addr, _, err := ipam.RequestAddress(d.PoolID, nil, nil)
+		if err == nil {
+			ep.Lock()
+			ep.virtualIP = addr.IP
+			ep.vipPoolID = d.PoolID
+			ep.Unlock()
+			return nil
+		}
+		if err != ipamapi.ErrNoAvailableIPs {
+			return fmt.Errorf("failed to allocate virtual ip: %v", err)
+		}
+	}
+	return fmt.Errorf("no available virtual ip on this network address pools: %s (%s)", n.Name(), n.ID())
+}
+
+// assignSecondaryAddresses allocates the secondary addresses requested via
+// CreateOptionSecondaryAddresses. An unspecified address is served by the first
+// pool of the matching family with a free address, a specific address by the
+// pool containing it.
+func (ep *endpoint) assignSecondaryAddresses(ipam ipamapi.Ipam) error {
+	n := ep.getNetwork()
+	for _, req := range ep.iface.reqAddrs {
+		infos := n.getIPInfo()
+		if req.To4() == nil {
+			infos = n.getIPInfoV6()
+		}
+		var (
+			addr   *net.IPNet
+			poolID string
+			err    = ipamapi.ErrNoAvailableIPs
+		)
+		for _, d := range infos {
+			var ip net.IP
+			if !req.IsUnspecified() {
+				if !d.Pool.Contains(req) {
+					continue
+				}
+				ip = req
+			}
+			addr, _, err = ipam.RequestAddress(d.PoolID, ip, nil)
+			if err == nil {
+				poolID = d.PoolID
+				break
+			}
+			if err != ipamapi.ErrNoAvailableIPs {
+				return fmt.Errorf("failed to allocate secondary address %s: %v", req, err)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("no available secondary address %s on this network address pools: %s (%s)", req, n.Name(), n.ID())
+		}
+		ep.Lock()
+		ep.iface.addrs = append(ep.iface.addrs, &ifaceAddress{addr: addr, poolID: poolID})
+		ep.Unlock()
+	}
+	return nil
 }
 
 func (ep *endpoint) releaseAddress() {
 	n := ep.getNetwork()
-	if n.Type() == "host" || n.Type() == "null" || n.Type() == "bridge" {
+	if n.Type() == "host" || n.Type() == "null" {
+		return
+	}
+
+	// The flows of the released addresses must not reach the next endpoint
+	// they are given to
+	var released []net.IP
+	defer func() {
+		conntrack.FlushReleasedIPs(released...)
+	}()
+
+	if n.Type() == "bridge" {
+		// The bridge driver released its addresses on the endpoint delete
+		if ep.iface.addr != nil {
+			released = append(released, ep.iface.addr.IP)
+		}
+		if ep.iface.addrv6 != nil {
+			released = append(released, ep.iface.addrv6.IP)
+		}
 		return
 	}
+
 	ipam, err := n.getController().getIpamDriver(n.ipamType)
 	if err != nil {
 		log.Warnf("Failed to retrieve ipam driver to release interface address on delete of endpoint %s (%s): %v", ep.Name(), ep.ID(), err)
 		return
 	}
-	if err := ipam.ReleaseAddress(ep.iface.poolID, ep.iface.addr.IP); err != nil {
-		log.Warnf("Failed to release ip address %s on delete of endpoint %s (%s): %v", ep.iface.addr.IP, ep.Name(), ep.ID(), err)
+	if ep.iface.addr != nil {
+		if err := ipam.ReleaseAddress(ep.iface.poolID, ep.iface.addr.IP); err != nil {
+			log.Warnf("Failed to release ip address %s on delete of endpoint %s (%s): %v", ep.iface.addr.IP, ep.Name(), ep.ID(), err)
+		}
+		released = append(released, ep.iface.addr.IP)
+	}
+	ep.Lock()
+	addrs := ep.iface.addrs
+	ep.iface.addrs = nil
+	ep.Unlock()
+	for _, ia := range addrs {
+		if err := ipam.ReleaseAddress(ia.poolID, ia.addr.IP); err != nil {
+			log.Warnf("Failed to release secondary ip address %s on delete of endpoint %s (%s): %v", ia.addr.IP, ep.Name(), ep.ID(), err)
+		}
+		released = append(released, ia.addr.IP)
+	}
+	if ep.virtualIP != nil {
+		if err := ipam.ReleaseAddress(ep.vipPoolID, ep.virtualIP); err != nil {
+			log.Warnf("Failed to release virtual ip %s on delete of endpoint %s (%s): %v", ep.virtualIP, ep.Name(), ep.ID(), err)
+		}
+		released = append(released, ep.virtualIP)
+		ep.virtualIP = nil
 	}
 }
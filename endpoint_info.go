@@ -27,6 +27,10 @@ type EndpointInfo interface {
 
 	// Sandbox returns the attached sandbox if there, nil otherwise.
 	Sandbox() Sandbox
+
+	// VirtualIP returns the virtual IP of the load balanced service
+	// published by the endpoint, nil otherwise.
+	VirtualIP() net.IP
 }
 
 // InterfaceInfo provides an interface to retrieve interface addresses bound to the endpoint.
@@ -39,12 +43,25 @@ type InterfaceInfo interface {
 
 	// AddressIPv6 returns the IPv6 address assigned to the endpoint.
 	AddressIPv6() *net.IPNet
+
+	// Addresses returns the secondary IPv4 and IPv6 addresses assigned
+	// to the endpoint.
+	Addresses() []*net.IPNet
+}
+
+// ifaceAddress is a secondary address of the endpoint interface
+// along with the ipam pool it was allocated from.
+type ifaceAddress struct {
+	addr   *net.IPNet
+	poolID string
 }
 
 type endpointInterface struct {
 	mac       net.HardwareAddr
 	addr      *net.IPNet
 	addrv6    *net.IPNet
+	addrs     []*ifaceAddress
+	reqAddrs  []net.IP
 	srcName   string
 	dstPrefix string
 	routes    []*net.IPNet
@@ -62,6 +79,13 @@ func (epi *endpointInterface) MarshalJSON() ([]byte, error) {
 	if epi.addrv6 != nil {
 		epMap["addrv6"] = epi.addrv6.String()
 	}
+	if len(epi.addrs) > 0 {
+		var addrs []map[string]string
+		for _, ia := range epi.addrs {
+			addrs = append(addrs, map[string]string{"addr": ia.addr.String(), "poolID": ia.poolID})
+		}
+		epMap["addrs"] = addrs
+	}
 	epMap["srcName"] = epi.srcName
 	epMap["dstPrefix"] = epi.dstPrefix
 	var routes []string
@@ -97,6 +121,17 @@ func (epi *endpointInterface) UnmarshalJSON(b []byte) error {
 		}
 	}
 
+	if v, ok := epMap["addrs"]; ok {
+		for _, a := range v.([]interface{}) {
+			am := a.(map[string]interface{})
+			addr, err := types.ParseCIDR(am["addr"].(string))
+			if err != nil {
+				return types.InternalErrorf("failed to decode endpoint interface secondary address after json unmarshal: %v", err)
+			}
+			epi.addrs = append(epi.addrs, &ifaceAddress{addr: addr, poolID: am["poolID"].(string)})
+		}
+	}
+
 	epi.srcName = epMap["srcName"].(string)
 	epi.dstPrefix = epMap["dstPrefix"].(string)
 
@@ -120,6 +155,9 @@ func (epi *endpointInterface) CopyTo(dstEpi *endpointInterface) error {
 	dstEpi.mac = types.GetMacCopy(epi.mac)
 	dstEpi.addr = types.GetIPNetCopy(epi.addr)
 	dstEpi.addrv6 = types.GetIPNetCopy(epi.addrv6)
+	for _, ia := range epi.addrs {
+		dstEpi.addrs = append(dstEpi.addrs, &ifaceAddress{addr: types.GetIPNetCopy(ia.addr), poolID: ia.poolID})
+	}
 	dstEpi.srcName = epi.srcName
 	dstEpi.dstPrefix = epi.dstPrefix
 	dstEpi.poolID = epi.poolID
@@ -235,6 +273,14 @@ func (epi *endpointInterface) AddressIPv6() *net.IPNet {
 	return types.GetIPNetCopy(epi.addrv6)
 }
 
+func (epi *endpointInterface) Addresses() []*net.IPNet {
+	addrs := make([]*net.IPNet, 0, len(epi.addrs))
+	for _, ia := range epi.addrs {
+		addrs = append(addrs, types.GetIPNetCopy(ia.addr))
+	}
+	return addrs
+}
+
 func (epi *endpointInterface) SetNames(srcName string, dstPrefix string) error {
 	epi.srcName = srcName
 	epi.dstPrefix = dstPrefix
@@ -276,6 +322,13 @@ func (ep *endpoint) Sandbox() Sandbox {
 	return cnt
 }
 
+func (ep *endpoint) VirtualIP() net.IP {
+	ep.Lock()
+	defer ep.Unlock()
+
+	return types.GetIPCopy(ep.virtualIP)
+}
+
 func (ep *endpoint) Gateway() net.IP {
 	ep.Lock()
 	defer ep.Unlock()
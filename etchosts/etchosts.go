@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strings"
 )
 
 // Record Structure for a single host record
@@ -93,7 +94,9 @@ func Add(path string, recs []Record) error {
 	return ioutil.WriteFile(path, content.Bytes(), 0644)
 }
 
-// Delete deletes an arbitrary number of Records already existing in /etc/hosts file
+// Delete deletes an arbitrary number of Records already existing in /etc/hosts file.
+// When the IP of a Record is set, only the entry for that IP is deleted, as the
+// same hostname may be resolving to several IPs.
 func Delete(path string, recs []Record) error {
 	if len(recs) == 0 {
 		return nil
@@ -104,10 +107,15 @@ func Delete(path string, recs []Record) error {
 		return err
 	}
 
-	regexpStr := fmt.Sprintf("\\S*\\t%s\\n", regexp.QuoteMeta(recs[0].Hosts))
-	for _, r := range recs[1:] {
-		regexpStr = regexpStr + "|" + fmt.Sprintf("\\S*\\t%s\\n", regexp.QuoteMeta(r.Hosts))
+	var exprs []string
+	for _, r := range recs {
+		ip := "\\S*"
+		if r.IP != "" {
+			ip = regexp.QuoteMeta(r.IP)
+		}
+		exprs = append(exprs, fmt.Sprintf("(?m:^%s\\t%s\\n)", ip, regexp.QuoteMeta(r.Hosts)))
 	}
+	regexpStr := strings.Join(exprs, "|")
 
 	var re = regexp.MustCompile(regexpStr)
 	return ioutil.WriteFile(path, re.ReplaceAll(old, []byte("")), 0644)
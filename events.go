@@ -0,0 +1,159 @@
+package libnetwork
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EventType identifies the lifecycle change an Event reports
+type EventType string
+
+const (
+	// EventNetworkCreate is emitted when a network is created
+	EventNetworkCreate EventType = "network-create"
+	// EventNetworkDelete is emitted when a network is deleted
+	EventNetworkDelete EventType = "network-delete"
+	// EventEndpointCreate is emitted when an endpoint is created
+	EventEndpointCreate EventType = "endpoint-create"
+	// EventEndpointDelete is emitted when an endpoint is deleted
+	EventEndpointDelete EventType = "endpoint-delete"
+	// EventEndpointJoin is emitted when a sandbox joins an endpoint
+	EventEndpointJoin EventType = "endpoint-join"
+	// EventEndpointLeave is emitted when a sandbox leaves an endpoint
+	EventEndpointLeave EventType = "endpoint-leave"
+	// EventAddressAllocated is emitted when an address is assigned to an endpoint
+	EventAddressAllocated EventType = "address-allocated"
+	// EventSandboxCreate is emitted when a sandbox is created
+	EventSandboxCreate EventType = "sandbox-create"
+	// EventSandboxDelete is emitted when a sandbox is deleted
+	EventSandboxDelete EventType = "sandbox-delete"
+	// EventDriverError is emitted when a driver fails an operation
+	EventDriverError EventType = "driver-error"
+	// EventStateDrift is emitted when a driver corrects a drift of its state in the host
+	EventStateDrift EventType = "state-drift"
+)
+
+// eventQueueLen is the number of events buffered for each subscriber.
+// Events are dropped for a subscriber which is not keeping up.
+const eventQueueLen = 256
+
+// Event describes a lifecycle change of a network, endpoint or sandbox
+type Event struct {
+	Type        EventType `json:"type"`
+	Time        time.Time `json:"time"`
+	NetworkID   string    `json:"network_id,omitempty"`
+	NetworkName string    `json:"network_name,omitempty"`
+	EndpointID  string    `json:"endpoint_id,omitempty"`
+	Endpoint    string    `json:"endpoint,omitempty"`
+	SandboxID   string    `json:"sandbox_id,omitempty"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Driver      string    `json:"driver,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+}
+
+// EventFilter is a client provided function which selects the events to be
+// delivered to a subscriber. A nil filter selects all the events.
+type EventFilter func(ev Event) bool
+
+// EventTypeFilter returns an EventFilter which selects the events of the passed types
+func EventTypeFilter(types ...EventType) EventFilter {
+	return func(ev Event) bool {
+		for _, t := range types {
+			if ev.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type eventSubscriber struct {
+	ch     chan Event
+	filter EventFilter
+}
+
+type eventBroadcaster struct {
+	subs map[*eventSubscriber]struct{}
+	sync.Mutex
+}
+
+func (c *controller) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	s := &eventSubscriber{ch: make(chan Event, eventQueueLen), filter: filter}
+
+	c.events.Lock()
+	if c.events.subs == nil {
+		c.events.subs = make(map[*eventSubscriber]struct{})
+	}
+	c.events.subs[s] = struct{}{}
+	c.events.Unlock()
+
+	cancel := func() {
+		c.events.Lock()
+		defer c.events.Unlock()
+		// The subscription may have already been closed by the controller stop
+		if _, ok := c.events.subs[s]; ok {
+			delete(c.events.subs, s)
+			close(s.ch)
+		}
+	}
+
+	return s.ch, cancel
+}
+
+func (c *controller) publishEvent(ev Event) {
+	ev.Time = time.Now()
+
+	c.events.Lock()
+	defer c.events.Unlock()
+
+	for s := range c.events.subs {
+		if s.filter != nil && !s.filter(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			log.Debugf("dropping %s event for slow subscriber", ev.Type)
+		}
+	}
+}
+
+func (c *controller) closeSubscribers() {
+	c.events.Lock()
+	defer c.events.Unlock()
+
+	for s := range c.events.subs {
+		delete(c.events.subs, s)
+		close(s.ch)
+	}
+}
+
+func networkEvent(t EventType, n *network) Event {
+	return Event{Type: t, NetworkID: n.ID(), NetworkName: n.Name()}
+}
+
+func endpointEvent(t EventType, n *network, ep *endpoint) Event {
+	ev := networkEvent(t, n)
+	ev.EndpointID = ep.ID()
+	ev.Endpoint = ep.Name()
+	return ev
+}
+
+func sandboxEvent(t EventType, sb *sandbox) Event {
+	return Event{Type: t, SandboxID: sb.ID(), ContainerID: sb.ContainerID()}
+}
+
+func driverErrorEvent(n *network, epid string, err error) Event {
+	ev := networkEvent(EventDriverError, n)
+	ev.EndpointID = epid
+	ev.Error = err.Error()
+	return ev
+}
+
+func driftEvent(d Drift) Event {
+	return Event{Type: EventStateDrift, NetworkID: d.NetworkID, Driver: d.Driver, Detail: string(d.Kind) + " " + d.Object}
+}
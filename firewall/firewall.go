@@ -0,0 +1,235 @@
+// Package firewall abstracts the programming of the packet filtering rules
+// the drivers rely on, so that they can be installed either by the iptables
+// tools or directly through the nftables netlink interface of the kernel.
+package firewall
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	// IptablesBackend programs the rules through the iptables and ip6tables tools.
+	IptablesBackend = "iptables"
+	// NftablesBackend programs the rules through the nftables netlink interface.
+	NftablesBackend = "nftables"
+)
+
+// Action signifies the operation applied to a rule.
+type Action string
+
+// Table refers to Nat or Filter.
+type Table string
+
+// Family is the IP address family of the rules of a backend.
+type Family string
+
+const (
+	// Append appends the rule at the end of the chain.
+	Append Action = "-A"
+	// Delete deletes the rule from the chain.
+	Delete Action = "-D"
+	// Insert inserts the rule at the top of the chain.
+	Insert Action = "-I"
+	// Flush deletes all the rules of the chain, regardless of the rule.
+	Flush Action = "-F"
+	// Nat table is used for nat translation rules.
+	Nat Table = "nat"
+	// Filter table is used for filter rules.
+	Filter Table = "filter"
+	// IPv4 is the family of the IPv4 rules.
+	IPv4 Family = "ipv4"
+	// IPv6 is the family of the IPv6 rules.
+	IPv6 Family = "ipv6"
+)
+
+const (
+	// Accept is the target accepting the packet.
+	Accept = "ACCEPT"
+	// Drop is the target dropping the packet.
+	Drop = "DROP"
+	// Masquerade is the target translating the source address to the one of the output interface.
+	Masquerade = "MASQUERADE"
+	// DNAT is the target translating the destination to the rule ToDest address and port.
+	DNAT = "DNAT"
+)
+
+// Backend programs the chains and the rules of an address family.
+type Backend interface {
+	// Name returns the name the backend is selected with.
+	Name() string
+	// Family returns the address family of the rules of the backend.
+	Family() Family
+	// NewChain creates the chain in the table, if it does not exist yet.
+	NewChain(name string, table Table, hairpinMode bool) (Chain, error)
+	// ProgramChain hooks the chain to the built-in chains: the nat chain
+	// gets the traffic to the local addresses and the filter chain gets
+	// the traffic forwarded to the bridge.
+	ProgramChain(c Chain, bridgeName string, hairpinMode bool) error
+	// RemoveExistingChain removes the chain and the rules jumping to it.
+	RemoveExistingChain(name string, table Table) error
+	// ProgramRule applies the action to the rule in the chain of the table.
+	ProgramRule(table Table, chain string, action Action, rule Rule) error
+	// Exists returns whether the rule is in the chain of the table.
+	Exists(table Table, chain string, rule Rule) bool
+	// Apply applies the changes all together: should one of them fail,
+	// none is left in place.
+	Apply(changes []RuleChange) error
+	// Prune deletes the rules of the chain the backend tagged as its own
+	// which are not among the expected ones, and returns them in their
+	// listed form.
+	Prune(table Table, chain string, expected []Rule) ([]string, error)
+}
+
+// RuleChange is an action applied to a rule of a chain.
+type RuleChange struct {
+	Table  Table
+	Chain  string
+	Action Action
+	Rule   Rule
+}
+
+// Chain is a chain created by a Backend.
+type Chain interface {
+	// Name returns the name of the chain.
+	Name() string
+	// Table returns the table of the chain.
+	Table() Table
+	// Family returns the address family of the chain.
+	Family() Family
+	// Forward programs the translation of the host address and port to the
+	// destination ones, the filter rule accepting the translated traffic
+	// and the masquerading of the hairpin traffic of the destination.
+	Forward(action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error
+	// Link programs the rules accepting the traffic between two addresses
+	// on the port, in both directions.
+	Link(action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error
+	// Prerouting applies the action to the rule in the nat PREROUTING chain.
+	Prerouting(action Action, rule Rule) error
+	// Output applies the action to the rule in the OUTPUT chain of the chain table.
+	Output(action Action, rule Rule) error
+	// Remove removes the chain and the rules jumping to it.
+	Remove() error
+}
+
+// Rule describes a rule in terms common to all the backends. A rule matches
+// the packets satisfying all of its non-empty fields. The interface and the
+// address matches are negated when prefixed with "!".
+type Rule struct {
+	// SrcLocal and DstLocal match the packets from or to a local address
+	SrcLocal bool
+	DstLocal bool
+	InIface  string
+	OutIface string
+	Proto    string
+	// Src and Dst are addresses or subnets in CIDR notation
+	Src     string
+	Dst     string
+	SrcPort int
+	DstPort int
+	// CtState is a comma separated list of conntrack states, among
+	// NEW, ESTABLISHED, RELATED, INVALID and UNTRACKED
+	CtState string
+	// SrcSet and DstSet are the names of the ip sets the addresses
+	// belong to, which only the iptables backend matches
+	SrcSet string
+	DstSet string
+	// Target is one of Accept, Drop, Masquerade or DNAT, or else the
+	// name of the chain to jump to
+	Target string
+	// ToDest is the address and port in the host:port form the DNAT
+	// target translates the destination to
+	ToDest string
+}
+
+// args returns the rule in the iptables command line form. This form
+// also identifies the rules programmed by the other backends.
+func (r Rule) args() []string {
+	var args []string
+	if r.SrcLocal {
+		args = append(args, "-m", "addrtype", "--src-type", "LOCAL")
+	}
+	if r.DstLocal {
+		args = append(args, "-m", "addrtype", "--dst-type", "LOCAL")
+	}
+	args = appendMatch(args, "-i", r.InIface)
+	args = appendMatch(args, "-o", r.OutIface)
+	if r.Proto != "" {
+		args = append(args, "-p", r.Proto)
+	}
+	args = appendMatch(args, "-s", r.Src)
+	args = appendMatch(args, "-d", r.Dst)
+	if r.SrcSet != "" {
+		args = append(args, "-m", "set", "--match-set", r.SrcSet, "src")
+	}
+	if r.DstSet != "" {
+		args = append(args, "-m", "set", "--match-set", r.DstSet, "dst")
+	}
+	if r.SrcPort != 0 {
+		args = append(args, "--sport", strconv.Itoa(r.SrcPort))
+	}
+	if r.DstPort != 0 {
+		args = append(args, "--dport", strconv.Itoa(r.DstPort))
+	}
+	if r.CtState != "" {
+		args = append(args, "-m", "conntrack", "--ctstate", r.CtState)
+	}
+	if r.Target != "" {
+		args = append(args, "-j", r.Target)
+	}
+	if r.ToDest != "" {
+		args = append(args, "--to-destination", r.ToDest)
+	}
+	return args
+}
+
+// String returns the rule in the iptables command line form.
+func (r Rule) String() string {
+	return strings.Join(r.args(), " ")
+}
+
+func appendMatch(args []string, option, value string) []string {
+	if value == "" {
+		return args
+	}
+	if negated, v := parseNegation(value); negated {
+		return append(args, "!", option, v)
+	}
+	return append(args, option, value)
+}
+
+// parseNegation splits the "!" prefix from the value of a match.
+func parseNegation(value string) (bool, string) {
+	if strings.HasPrefix(value, "!") {
+		return true, strings.TrimSpace(value[1:])
+	}
+	return false, value
+}
+
+// New returns the backend of the address family selected by name. The
+// iptables backend is the default one.
+func New(name string, family Family) (Backend, error) {
+	if family != IPv4 && family != IPv6 {
+		return nil, types.BadRequestErrorf("unknown firewall address family %s", family)
+	}
+
+	switch name {
+	case "", IptablesBackend:
+		return newIptablesBackend(family), nil
+	case NftablesBackend:
+		return newNftablesBackend(family)
+	}
+
+	return nil, types.BadRequestErrorf("unknown firewall backend %s, must be one of %s or %s", name, IptablesBackend, NftablesBackend)
+}
+
+// loopback returns the loopback subnet of the address family.
+func loopback(family Family) string {
+	if family == IPv6 {
+		return "::1/128"
+	}
+	return "127.0.0.0/8"
+}
@@ -0,0 +1,155 @@
+package firewall
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestRuleString(t *testing.T) {
+	r := Rule{
+		DstLocal: true,
+		InIface:  "!docker0",
+		Proto:    "tcp",
+		Dst:      "172.17.0.2",
+		DstPort:  80,
+		CtState:  "RELATED,ESTABLISHED",
+		Target:   Accept,
+	}
+	expected := "-m addrtype --dst-type LOCAL ! -i docker0 -p tcp -d 172.17.0.2 --dport 80 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT"
+	if r.String() != expected {
+		t.Fatalf("Unexpected rule form.\nExpected: %s\nGot: %s", expected, r.String())
+	}
+}
+
+func TestRuleSets(t *testing.T) {
+	r := Rule{Proto: "tcp", SrcSet: "dpol-n1-a0s", DstSet: "dpol-n1-a0d", DstPort: 80, Target: Accept}
+	expected := "-p tcp -m set --match-set dpol-n1-a0s src -m set --match-set dpol-n1-a0d dst --dport 80 -j ACCEPT"
+	if r.String() != expected {
+		t.Fatalf("Unexpected rule form.\nExpected: %s\nGot: %s", expected, r.String())
+	}
+
+	b := &nftablesBackend{family: IPv4}
+	if _, err := b.compile(Filter, r); err == nil {
+		t.Fatal("Expected the ip set matches to fail on nftables")
+	}
+}
+
+func TestForwardRules(t *testing.T) {
+	dnat, accept, masq := forwardRules(false, net.IPv4zero, 1234, "udp", "172.17.0.2", 53, "docker0")
+
+	if expected := "! -i docker0 -p udp -d 0/0 --dport 1234 -j DNAT --to-destination 172.17.0.2:53"; dnat.String() != expected {
+		t.Fatalf("Unexpected DNAT rule.\nExpected: %s\nGot: %s", expected, dnat.String())
+	}
+	if expected := "! -i docker0 -o docker0 -p udp -d 172.17.0.2 --dport 53 -j ACCEPT"; accept.String() != expected {
+		t.Fatalf("Unexpected filter rule.\nExpected: %s\nGot: %s", expected, accept.String())
+	}
+	if expected := "-p udp -s 172.17.0.2 -d 172.17.0.2 --dport 53 -j MASQUERADE"; masq.String() != expected {
+		t.Fatalf("Unexpected masquerade rule.\nExpected: %s\nGot: %s", expected, masq.String())
+	}
+
+	dnat, _, _ = forwardRules(true, net.ParseIP("2001:db8::1"), 1234, "tcp", "fd00::2", 80, "docker0")
+	if expected := "-p tcp -d 2001:db8::1 --dport 1234 -j DNAT --to-destination [fd00::2]:80"; dnat.String() != expected {
+		t.Fatalf("Unexpected hairpin DNAT rule.\nExpected: %s\nGot: %s", expected, dnat.String())
+	}
+}
+
+func TestTaggedArgs(t *testing.T) {
+	r := Rule{Proto: "tcp", Dst: "0/0", DstPort: 80, Target: DNAT, ToDest: "172.17.0.2:8080"}
+	args := strings.Join(taggedArgs(r), " ")
+	expected := "-p tcp -d 0/0 --dport 80 -m comment --comment " + ownerTag + ruleID(r) + " -j DNAT --to-destination 172.17.0.2:8080"
+	if args != expected {
+		t.Fatalf("Unexpected tagged rule.\nExpected: %s\nGot: %s", expected, args)
+	}
+
+	listed := strings.Fields("-A DOCKER " + args)
+	if commentOf(listed) != ownerTag+ruleID(r) {
+		t.Fatalf("Unexpected comment %q of listed rule %v", commentOf(listed), listed)
+	}
+	if ruleID(r) == ruleID(Rule{Proto: "udp", Dst: "0/0", DstPort: 80, Target: DNAT, ToDest: "172.17.0.2:8080"}) {
+		t.Fatal("Different rules share their identifier")
+	}
+}
+
+func TestUntaggedRuleNum(t *testing.T) {
+	masq := Rule{Src: "172.17.0.0/16", OutIface: "!docker0", Target: Masquerade}
+	dnat := Rule{InIface: "!docker0", Proto: "tcp", Dst: "0/0", DstPort: 8080, Target: DNAT, ToDest: "172.17.0.2:80"}
+	accept := Rule{InIface: "!docker0", OutIface: "docker0", Proto: "tcp", Dst: "172.17.0.2", DstPort: 80, Target: Accept}
+	output := []byte(strings.Join([]string{
+		"-N DOCKER",
+		"-A DOCKER -d 172.17.0.3/32 ! -i docker0 -o docker0 -p tcp -m tcp --dport 80 -j ACCEPT",
+		"-A DOCKER -d 172.17.0.2/32 ! -i docker0 -o docker0 -p tcp -m tcp --dport 80 -m comment --comment " + ownerTag + ruleID(accept) + " -j ACCEPT",
+		"-A DOCKER -d 172.17.0.2/32 ! -i docker0 -o docker0 -p tcp -m tcp --dport 80 -j ACCEPT",
+		"-A DOCKER ! -i docker0 -p tcp -m tcp --dport 8080 -j DNAT --to-destination 172.17.0.2:80",
+		"-A POSTROUTING -s 172.17.0.0/16 ! -o docker0 -j MASQUERADE",
+	}, "\n"))
+
+	for _, tc := range []struct {
+		chain string
+		rule  Rule
+		num   int
+	}{
+		{"DOCKER", accept, 3},
+		{"DOCKER", dnat, 4},
+		{"POSTROUTING", masq, 1},
+		{"DOCKER", masq, 0},
+	} {
+		if num := untaggedRuleNum(output, tc.chain, tc.rule); num != tc.num {
+			t.Fatalf("Expected rule %s to be number %d of chain %s, got %d", tc.rule, tc.num, tc.chain, num)
+		}
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	b, err := New("", IPv6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != IptablesBackend || b.Family() != IPv6 {
+		t.Fatalf("Unexpected default backend %s/%s", b.Name(), b.Family())
+	}
+
+	if _, err := New("pf", IPv4); err == nil {
+		t.Fatal("Expected failure on unknown backend")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type %T: %v", err, err)
+	}
+
+	if _, err := New(IptablesBackend, Family("ipx")); err == nil {
+		t.Fatal("Expected failure on unknown family")
+	}
+}
+
+func TestRuleTag(t *testing.T) {
+	short := Rule{OutIface: "docker0", Target: "DOCKER"}
+	if ruleTag(short) != short.String() {
+		t.Fatalf("Unexpected tag %q of rule %q", ruleTag(short), short)
+	}
+
+	long := Rule{
+		InIface:  "!" + "br-0123456789ab",
+		OutIface: "br-0123456789ab",
+		Proto:    "tcp",
+		Src:      "2001:db8:1234:5678:9abc:def0:1234:5678",
+		Dst:      "2001:db8:1234:5678:9abc:def0:1234:5679",
+		DstPort:  8080,
+		Target:   Accept,
+	}
+	tag := ruleTag(long)
+	if len(tag) > nftMaxTagLen {
+		t.Fatalf("Tag %q exceeds %d characters", tag, nftMaxTagLen)
+	}
+	long.DstPort = 8081
+	if ruleTag(long) == tag {
+		t.Fatalf("Rules differing past the tag length share the tag %q", tag)
+	}
+
+	if parseRuleUserdata(ruleUserdata(tag)) != tag {
+		t.Fatalf("Failed to decode the tag %q from the user data", tag)
+	}
+	if !jumpsTo("-m addrtype --dst-type LOCAL -j DOCKER", "DOCKER") || jumpsTo("-j DOCKER-ISOLATION", "DOCKER") {
+		t.Fatal("Unexpected jump detection")
+	}
+}
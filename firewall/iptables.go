@@ -0,0 +1,342 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/iptables"
+)
+
+// iptablesBackend programs the rules through the iptables package. The
+// address families share their names with the iptables IPV values. Every
+// rule carries a comment tagging it as programmed by the backend; the
+// untagged rules older versions programmed are tagged as they are found.
+type iptablesBackend struct {
+	family  Family
+	iptable *iptables.IPTable
+}
+
+// iptablesChain is the Chain of the iptables backend.
+type iptablesChain struct {
+	backend *iptablesBackend
+	info    *iptables.ChainInfo
+}
+
+func newIptablesBackend(family Family) *iptablesBackend {
+	return &iptablesBackend{
+		family:  family,
+		iptable: iptables.GetIptable(iptables.IPV(family)),
+	}
+}
+
+// NewIptablesChain returns the Chain handling the iptables chain.
+func NewIptablesChain(c *iptables.ChainInfo) Chain {
+	family := IPv4
+	if c.IPTable.Version == iptables.IP6Tables {
+		family = IPv6
+	}
+	return &iptablesChain{backend: newIptablesBackend(family), info: c}
+}
+
+func (b *iptablesBackend) Name() string {
+	return IptablesBackend
+}
+
+func (b *iptablesBackend) Family() Family {
+	return b.family
+}
+
+func (b *iptablesBackend) NewChain(name string, table Table, hairpinMode bool) (Chain, error) {
+	c, err := b.iptable.NewChain(name, iptables.Table(table), hairpinMode)
+	if err != nil {
+		return nil, err
+	}
+	return &iptablesChain{backend: b, info: c}, nil
+}
+
+func (b *iptablesBackend) ProgramChain(c Chain, bridgeName string, hairpinMode bool) error {
+	if _, ok := c.(*iptablesChain); !ok {
+		return fmt.Errorf("chain %s was not created by the %s backend", c.Name(), IptablesBackend)
+	}
+	return programJumps(b, c, bridgeName, hairpinMode)
+}
+
+func (b *iptablesBackend) RemoveExistingChain(name string, table Table) error {
+	c := &iptablesChain{
+		backend: b,
+		info:    &iptables.ChainInfo{Name: name, Table: iptables.Table(table), IPTable: *b.iptable},
+	}
+	return c.Remove()
+}
+
+func (b *iptablesBackend) ProgramRule(table Table, chain string, action Action, rule Rule) error {
+	forms := [][]string{taggedArgs(rule)}
+	if action == Delete {
+		forms = b.programmedForms(table, chain, rule)
+	}
+	for _, form := range forms {
+		if err := b.raw(table, chain, append([]string{string(action), chain}, form...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *iptablesBackend) Apply(changes []RuleChange) error {
+	tx := b.iptable.Begin()
+	for _, c := range changes {
+		switch c.Action {
+		case Flush:
+			tx.Add(iptables.Table(c.Table), iptables.Flush, c.Chain)
+		case Delete:
+			for _, form := range b.programmedForms(c.Table, c.Chain, c.Rule) {
+				tx.Add(iptables.Table(c.Table), iptables.Delete, c.Chain, form...)
+			}
+		default:
+			tx.Add(iptables.Table(c.Table), iptables.Action(c.Action), c.Chain, taggedArgs(c.Rule)...)
+		}
+	}
+	return tx.Commit()
+}
+
+// Exists returns whether the rule is in the chain, tagged or untagged. An
+// untagged rule is replaced in place by the tagged one, or deleted when the
+// tagged one is there too.
+func (b *iptablesBackend) Exists(table Table, chain string, rule Rule) bool {
+	tagged := b.iptable.Exists(iptables.Table(table), chain, taggedArgs(rule)...)
+	if !b.iptable.Exists(iptables.Table(table), chain, rule.args()...) {
+		return tagged
+	}
+	if err := b.tagRule(table, chain, rule, tagged); err != nil {
+		logrus.Warnf("Failed to tag the %s rule %s in chain %s/%s: %v", b.family, rule, table, chain, err)
+	}
+	return true
+}
+
+// programmedForms returns the forms the rule is in the chain, tagged and
+// untagged, or the tagged one when it is not in the chain.
+func (b *iptablesBackend) programmedForms(table Table, chain string, rule Rule) [][]string {
+	var forms [][]string
+	for _, form := range [][]string{taggedArgs(rule), rule.args()} {
+		if b.iptable.Exists(iptables.Table(table), chain, form...) {
+			forms = append(forms, form)
+		}
+	}
+	if len(forms) == 0 {
+		forms = append(forms, taggedArgs(rule))
+	}
+	return forms
+}
+
+// tagRule replaces the untagged rule by the tagged one at its position in
+// the chain, or deletes it when the tagged one is in the chain already.
+func (b *iptablesBackend) tagRule(table Table, chain string, rule Rule, tagged bool) error {
+	if tagged {
+		return b.raw(table, chain, append([]string{string(Delete), chain}, rule.args()...)...)
+	}
+
+	output, err := b.iptable.Raw("-t", string(table), "-S", chain)
+	if err != nil {
+		return err
+	}
+	num := untaggedRuleNum(output, chain, rule)
+	if num == 0 {
+		return fmt.Errorf("rule not found in the listing of the chain")
+	}
+	return b.raw(table, chain, append([]string{"-R", chain, strconv.Itoa(num)}, taggedArgs(rule)...)...)
+}
+
+// raw runs the iptables command on the table.
+func (b *iptablesBackend) raw(table Table, chain string, args ...string) error {
+	if output, err := b.iptable.Raw(append([]string{"-t", string(table)}, args...)...); err != nil {
+		return err
+	} else if len(output) != 0 {
+		return &iptables.ChainError{Chain: chain, Output: output}
+	}
+	return nil
+}
+
+// Prune lists the chain and deletes the rules with an unexpected tag one
+// by one, in their listed form.
+func (b *iptablesBackend) Prune(table Table, chain string, expected []Rule) ([]string, error) {
+	keep := make(map[string]bool, len(expected))
+	for _, r := range expected {
+		keep[ownerTag+ruleID(r)] = true
+	}
+
+	output, err := b.iptable.Raw("-t", string(table), "-S", chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != string(Append) || fields[1] != chain {
+			continue
+		}
+		tag := commentOf(fields)
+		if !strings.HasPrefix(tag, ownerTag) || keep[tag] {
+			continue
+		}
+		args := append([]string{"-t", string(table), string(Delete)}, fields[1:]...)
+		if output, err := b.iptable.Raw(args...); err != nil {
+			return removed, err
+		} else if len(output) != 0 {
+			return removed, &iptables.ChainError{Chain: chain, Output: output}
+		}
+		removed = append(removed, strings.Join(fields[2:], " "))
+	}
+
+	return removed, nil
+}
+
+// taggedArgs returns the rule in the iptables command line form, with the
+// comment tagging it before the target.
+func taggedArgs(r Rule) []string {
+	matches := r
+	matches.Target, matches.ToDest = "", ""
+	target := Rule{Target: r.Target, ToDest: r.ToDest}
+	args := append(matches.args(), "-m", "comment", "--comment", ownerTag+ruleID(r))
+	return append(args, target.args()...)
+}
+
+// untaggedRuleNum returns the number of the first untagged rule of the
+// chain listed by iptables -S which is the rule, or 0 when none is.
+func untaggedRuleNum(output []byte, chain string, rule Rule) int {
+	expected := listedFields(rule)
+	num := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != string(Append) || fields[1] != chain {
+			continue
+		}
+		num++
+		if commentOf(fields) != "" {
+			continue
+		}
+		if sameFields(expected, withoutProtoMatch(fields[2:], rule.Proto)) {
+			return num
+		}
+	}
+	return 0
+}
+
+// listedFields returns the rule in the form iptables lists it, but for the
+// order of its fields: the addresses have a mask and the ones matching any
+// address are left out.
+func listedFields(rule Rule) []string {
+	args := rule.args()
+	fields := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if (args[i] == "-s" || args[i] == "-d") && i+1 < len(args) {
+			addr := args[i+1]
+			if addr == "0/0" || addr == "0.0.0.0/0" || addr == "::/0" {
+				i++
+				continue
+			}
+			if !strings.Contains(addr, "/") {
+				if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+					addr += "/128"
+				} else {
+					addr += "/32"
+				}
+			}
+			fields = append(fields, args[i], addr)
+			i++
+			continue
+		}
+		fields = append(fields, args[i])
+	}
+	return fields
+}
+
+// withoutProtoMatch drops the match of the protocol iptables lists along
+// with the ports.
+func withoutProtoMatch(fields []string, proto string) []string {
+	var out []string
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "-m" && i+1 < len(fields) && proto != "" && fields[i+1] == proto {
+			i++
+			continue
+		}
+		out = append(out, fields[i])
+	}
+	return out
+}
+
+// sameFields returns whether the two rules have the same fields, whatever
+// their order.
+func sameFields(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// commentOf returns the comment of a rule listed by iptables -S.
+func commentOf(fields []string) string {
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == "--comment" {
+			return strings.Trim(fields[i+1], `"`)
+		}
+	}
+	return ""
+}
+
+func (c *iptablesChain) Name() string {
+	return c.info.Name
+}
+
+func (c *iptablesChain) Table() Table {
+	return Table(c.info.Table)
+}
+
+func (c *iptablesChain) Family() Family {
+	if c.info.IPTable.Version == iptables.IP6Tables {
+		return IPv6
+	}
+	return IPv4
+}
+
+func (c *iptablesChain) Forward(action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error {
+	return c.backend.Apply(ForwardRules(c.info.Name, action, c.info.HairpinMode, ip, port, proto, destAddr, destPort, bridgeName))
+}
+
+func (c *iptablesChain) Link(action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
+	return c.backend.Apply(LinkRules(c.info.Name, action, ip1, ip2, port, proto, bridgeName))
+}
+
+func (c *iptablesChain) Prerouting(action Action, rule Rule) error {
+	return c.backend.ProgramRule(Nat, "PREROUTING", action, rule)
+}
+
+func (c *iptablesChain) Output(action Action, rule Rule) error {
+	return c.backend.ProgramRule(c.Table(), "OUTPUT", action, rule)
+}
+
+// Remove deletes the tagged jumps to the chain before removing it with
+// the untagged jumps older versions programmed.
+func (c *iptablesChain) Remove() error {
+	// Ignore errors - This could mean the chains were never set up
+	for _, hairpinMode := range []bool{true, false} {
+		for _, j := range JumpRules(c.Family(), c.Table(), c.Name(), "", hairpinMode) {
+			if j.Table == Nat && c.backend.Exists(j.Table, j.Chain, j.Rule) {
+				c.backend.ProgramRule(j.Table, j.Chain, Delete, j.Rule)
+			}
+		}
+	}
+	return c.info.Remove()
+}
@@ -0,0 +1,430 @@
+package firewall
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+const (
+	// nftTableName is the table holding the chains of the nftables backend
+	nftTableName = "docker"
+	// nftMaxTagLen is the length the comment identifying a rule is cut to
+	nftMaxTagLen = 127
+	nfprotoIPv4  = 2
+	nfprotoIPv6  = 10
+)
+
+// nftBaseChains are the chains of the table hooked to netfilter, which stand
+// for the iptables built-in chains of the same name.
+var nftBaseChains = []struct {
+	table    Table
+	name     string
+	hook     uint32
+	priority int32
+}{
+	{Nat, "PREROUTING", nfInetPreRouting, -100},
+	{Nat, "OUTPUT", nfInetLocalOut, -100},
+	{Nat, "POSTROUTING", nfInetPostRouting, 100},
+	{Filter, "FORWARD", nfInetForward, 0},
+}
+
+// nftablesBackend programs the rules in the docker table of the ip or ip6
+// nftables family. The chains are named after the table they would belong
+// to in iptables, and every rule is tagged with a comment holding its
+// iptables form, which identifies it for the lookups and the deletions.
+type nftablesBackend struct {
+	family Family
+	sync.Mutex
+}
+
+// nftablesChain is the Chain of the nftables backend.
+type nftablesChain struct {
+	backend     *nftablesBackend
+	name        string
+	table       Table
+	hairpinMode bool
+}
+
+// nftRule is a rule found in a chain.
+type nftRule struct {
+	handle uint64
+	tag    string
+}
+
+func newNftablesBackend(family Family) (*nftablesBackend, error) {
+	b := &nftablesBackend{family: family}
+	if err := nftBatch(b.nfproto(), b.tableMessages()); err != nil {
+		return nil, fmt.Errorf("failed to set up the nftables %s table: %v", nftTableName, err)
+	}
+	return b, nil
+}
+
+func (b *nftablesBackend) Name() string {
+	return NftablesBackend
+}
+
+func (b *nftablesBackend) Family() Family {
+	return b.family
+}
+
+func (b *nftablesBackend) nfproto() uint8 {
+	if b.family == IPv6 {
+		return nfprotoIPv6
+	}
+	return nfprotoIPv4
+}
+
+func nftChainName(table Table, name string) string {
+	return string(table) + "-" + name
+}
+
+// tableMessages returns the requests creating the table and its base chains,
+// which are no-ops for the existing ones.
+func (b *nftablesBackend) tableMessages() []nftMessage {
+	msgs := []nftMessage{{
+		typ:   nftMsgNewTable,
+		flags: syscall.NLM_F_CREATE,
+		attrs: []nfattr{attrString(nftaTableName, nftTableName), attrU32(nftaTableFlags, 0)},
+		desc:  "add table " + nftTableName,
+	}}
+	for _, bc := range nftBaseChains {
+		name := nftChainName(bc.table, bc.name)
+		msgs = append(msgs, nftMessage{
+			typ:   nftMsgNewChain,
+			flags: syscall.NLM_F_CREATE,
+			attrs: []nfattr{
+				attrString(nftaChainTable, nftTableName),
+				attrString(nftaChainName, name),
+				attrNested(nftaChainHook,
+					attrU32(nftaHookHooknum, bc.hook),
+					attrU32(nftaHookPriority, uint32(bc.priority))),
+				attrString(nftaChainType, string(bc.table)),
+			},
+			desc: "add chain " + name,
+		})
+	}
+	return msgs
+}
+
+func (b *nftablesBackend) NewChain(name string, table Table, hairpinMode bool) (Chain, error) {
+	if table != Nat && table != Filter {
+		return nil, fmt.Errorf("unsupported table %s for nftables chain %s", table, name)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	msgs := append(b.tableMessages(), nftMessage{
+		typ:   nftMsgNewChain,
+		flags: syscall.NLM_F_CREATE,
+		attrs: []nfattr{
+			attrString(nftaChainTable, nftTableName),
+			attrString(nftaChainName, nftChainName(table, name)),
+		},
+		desc: "add chain " + nftChainName(table, name),
+	})
+	if err := nftBatch(b.nfproto(), msgs); err != nil {
+		return nil, err
+	}
+
+	return &nftablesChain{backend: b, name: name, table: table, hairpinMode: hairpinMode}, nil
+}
+
+func (b *nftablesBackend) ProgramChain(c Chain, bridgeName string, hairpinMode bool) error {
+	return programJumps(b, c, bridgeName, hairpinMode)
+}
+
+func (b *nftablesBackend) RemoveExistingChain(name string, table Table) error {
+	c := &nftablesChain{backend: b, name: name, table: table}
+	return c.Remove()
+}
+
+func (b *nftablesBackend) ProgramRule(table Table, chain string, action Action, rule Rule) error {
+	return b.Apply([]RuleChange{{Table: table, Chain: chain, Action: action, Rule: rule}})
+}
+
+func (b *nftablesBackend) Exists(table Table, chain string, rule Rule) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	handle, err := b.findRule(table, chain, rule)
+	return err == nil && handle != 0
+}
+
+// Apply programs the changes in a single batch, which the kernel applies
+// atomically.
+func (b *nftablesBackend) Apply(changes []RuleChange) error {
+	b.Lock()
+	defer b.Unlock()
+
+	var msgs []nftMessage
+	for _, c := range changes {
+		chain := nftChainName(c.Table, c.Chain)
+		switch c.Action {
+		case Append, Insert:
+			exprs, err := b.compile(c.Table, c.Rule)
+			if err != nil {
+				return err
+			}
+			var flags uint16 = syscall.NLM_F_CREATE
+			if c.Action == Append {
+				flags |= syscall.NLM_F_APPEND
+			}
+			msgs = append(msgs, nftMessage{
+				typ:   nftMsgNewRule,
+				flags: flags,
+				attrs: []nfattr{
+					attrString(nftaRuleTable, nftTableName),
+					attrString(nftaRuleChain, chain),
+					attrNested(nftaRuleExpressions, exprs...),
+					{typ: nftaRuleUserdata, data: ruleUserdata(ruleTag(c.Rule))},
+				},
+				desc: fmt.Sprintf("add rule %q to chain %s", c.Rule, chain),
+			})
+		case Delete:
+			handle, err := b.findRule(c.Table, c.Chain, c.Rule)
+			if err != nil {
+				return err
+			}
+			if handle == 0 {
+				return fmt.Errorf("rule %q not found in nftables chain %s", c.Rule, chain)
+			}
+			msgs = append(msgs, deleteRuleMessage(chain, handle))
+		case Flush:
+			msgs = append(msgs, nftMessage{
+				typ: nftMsgDelRule,
+				attrs: []nfattr{
+					attrString(nftaRuleTable, nftTableName),
+					attrString(nftaRuleChain, chain),
+				},
+				desc: "flush chain " + chain,
+			})
+		default:
+			return fmt.Errorf("unsupported action %s on nftables chain %s", c.Action, chain)
+		}
+	}
+
+	return nftBatch(b.nfproto(), msgs)
+}
+
+// Prune deletes the tagged rules of the chain which are not expected, in a
+// single batch.
+func (b *nftablesBackend) Prune(table Table, chain string, expected []Rule) ([]string, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	keep := make(map[string]bool, len(expected))
+	for _, r := range expected {
+		keep[ruleTag(r)] = true
+	}
+
+	name := nftChainName(table, chain)
+	rules, err := b.listRules(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		msgs    []nftMessage
+		removed []string
+	)
+	for _, r := range rules {
+		if r.tag == "" || keep[r.tag] {
+			continue
+		}
+		msgs = append(msgs, deleteRuleMessage(name, r.handle))
+		removed = append(removed, r.tag)
+	}
+	if err := nftBatch(b.nfproto(), msgs); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+func deleteRuleMessage(chain string, handle uint64) nftMessage {
+	return nftMessage{
+		typ: nftMsgDelRule,
+		attrs: []nfattr{
+			attrString(nftaRuleTable, nftTableName),
+			attrString(nftaRuleChain, chain),
+			attrU64(nftaRuleHandle, handle),
+		},
+		desc: fmt.Sprintf("delete rule %d from chain %s", handle, chain),
+	}
+}
+
+// findRule returns the handle of the rule in the chain, zero if not found.
+func (b *nftablesBackend) findRule(table Table, chain string, rule Rule) (uint64, error) {
+	rules, err := b.listRules(nftChainName(table, chain))
+	if err != nil {
+		return 0, err
+	}
+	tag := ruleTag(rule)
+	for _, r := range rules {
+		if r.tag == tag {
+			return r.handle, nil
+		}
+	}
+	return 0, nil
+}
+
+// listRules returns the rules of the chain.
+func (b *nftablesBackend) listRules(chain string) ([]nftRule, error) {
+	objs, err := nftDump(b.nfproto(), nftMessage{
+		typ: nftMsgGetRule,
+		attrs: []nfattr{
+			attrString(nftaRuleTable, nftTableName),
+			attrString(nftaRuleChain, chain),
+		},
+		desc: "list rules of chain " + chain,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []nftRule
+	for _, attrs := range objs {
+		var r nftRule
+		matches := true
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case nftaRuleTable:
+				matches = matches && nlString(a.Value) == nftTableName
+			case nftaRuleChain:
+				matches = matches && nlString(a.Value) == chain
+			case nftaRuleHandle:
+				if len(a.Value) == 8 {
+					r.handle = binary.BigEndian.Uint64(a.Value)
+				}
+			case nftaRuleUserdata:
+				r.tag = parseRuleUserdata(a.Value)
+			}
+		}
+		if matches {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func nlString(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+// ruleTag returns the comment identifying the rule. The rules too long for
+// a comment are cut and suffixed with their hash.
+func ruleTag(r Rule) string {
+	s := r.String()
+	if len(s) <= nftMaxTagLen {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	h := hex.EncodeToString(sum[:8])
+	return s[:nftMaxTagLen-len(h)-1] + " " + h
+}
+
+// ruleUserdata encodes the comment the way the nft tool does, so that it
+// shows in its listings.
+func ruleUserdata(comment string) []byte {
+	value := nl.ZeroTerminated(comment)
+	return append([]byte{nftUdataComment, byte(len(value))}, value...)
+}
+
+func parseRuleUserdata(b []byte) string {
+	for len(b) >= 2 {
+		typ, l := b[0], int(b[1])
+		if len(b) < 2+l {
+			break
+		}
+		if typ == nftUdataComment {
+			return nlString(b[2 : 2+l])
+		}
+		b = b[2+l:]
+	}
+	return ""
+}
+
+// jumpsTo returns whether the tag is the one of a rule jumping to the chain.
+func jumpsTo(tag, chain string) bool {
+	fields := strings.Fields(tag)
+	n := len(fields)
+	return n >= 2 && fields[n-2] == "-j" && fields[n-1] == chain
+}
+
+func (c *nftablesChain) Name() string {
+	return c.name
+}
+
+func (c *nftablesChain) Table() Table {
+	return c.table
+}
+
+func (c *nftablesChain) Family() Family {
+	return c.backend.family
+}
+
+func (c *nftablesChain) Forward(action Action, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) error {
+	return c.backend.Apply(ForwardRules(c.name, action, c.hairpinMode, ip, port, proto, destAddr, destPort, bridgeName))
+}
+
+func (c *nftablesChain) Link(action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
+	return c.backend.Apply(LinkRules(c.name, action, ip1, ip2, port, proto, bridgeName))
+}
+
+func (c *nftablesChain) Prerouting(action Action, rule Rule) error {
+	return c.backend.ProgramRule(Nat, "PREROUTING", action, rule)
+}
+
+func (c *nftablesChain) Output(action Action, rule Rule) error {
+	return c.backend.ProgramRule(c.table, "OUTPUT", action, rule)
+}
+
+func (c *nftablesChain) Remove() error {
+	b := c.backend
+	b.Lock()
+	defer b.Unlock()
+
+	// Ignore errors - This could mean the chains were never set up
+	var jumps []nftMessage
+	for _, bc := range nftBaseChains {
+		if bc.table != c.table {
+			continue
+		}
+		base := nftChainName(bc.table, bc.name)
+		rules, err := b.listRules(base)
+		if err != nil {
+			continue
+		}
+		for _, r := range rules {
+			if jumpsTo(r.tag, c.name) {
+				jumps = append(jumps, deleteRuleMessage(base, r.handle))
+			}
+		}
+	}
+	nftBatch(b.nfproto(), jumps)
+
+	chain := nftChainName(c.table, c.name)
+	nftBatch(b.nfproto(), []nftMessage{
+		{
+			typ:   nftMsgDelRule,
+			attrs: []nfattr{attrString(nftaRuleTable, nftTableName), attrString(nftaRuleChain, chain)},
+			desc:  "flush chain " + chain,
+		},
+		{
+			typ:   nftMsgDelChain,
+			attrs: []nfattr{attrString(nftaChainTable, nftTableName), attrString(nftaChainName, chain)},
+			desc:  "delete chain " + chain,
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// ctStates are the conntrack state bits of the nftables ct expression
+var ctStates = map[string]uint32{
+	"INVALID":     1,
+	"ESTABLISHED": 2,
+	"RELATED":     4,
+	"NEW":         8,
+	"UNTRACKED":   64,
+}
+
+// protocols are the transport protocols the rules can match
+var protocols = map[string]byte{
+	"icmp":   1,
+	"tcp":    6,
+	"udp":    17,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
+func expr(name string, attrs ...nfattr) nfattr {
+	elem := []nfattr{attrString(nftaExprName, name)}
+	if len(attrs) > 0 {
+		elem = append(elem, attrNested(nftaExprData, attrs...))
+	}
+	return attrNested(nftaListElem, elem...)
+}
+
+func nativeU32(v uint32) []byte {
+	b := make([]byte, 4)
+	nl.NativeEndian().PutUint32(b, v)
+	return b
+}
+
+func exprCmp(op uint32, data []byte) nfattr {
+	return expr("cmp",
+		attrU32(nftaCmpSreg, nftReg1),
+		attrU32(nftaCmpOp, op),
+		attrNested(nftaCmpData, nfattr{typ: nftaDataValue, data: data}))
+}
+
+func exprMeta(key uint32) nfattr {
+	return expr("meta", attrU32(nftaMetaDreg, nftReg1), attrU32(nftaMetaKey, key))
+}
+
+func exprPayload(base, offset, length uint32) nfattr {
+	return expr("payload",
+		attrU32(nftaPayloadDreg, nftReg1),
+		attrU32(nftaPayloadBase, base),
+		attrU32(nftaPayloadOffset, offset),
+		attrU32(nftaPayloadLen, length))
+}
+
+func exprBitwise(mask []byte) nfattr {
+	return expr("bitwise",
+		attrU32(nftaBitwiseSreg, nftReg1),
+		attrU32(nftaBitwiseDreg, nftReg1),
+		attrU32(nftaBitwiseLen, uint32(len(mask))),
+		attrNested(nftaBitwiseMask, nfattr{typ: nftaDataValue, data: mask}),
+		attrNested(nftaBitwiseXor, nfattr{typ: nftaDataValue, data: make([]byte, len(mask))}))
+}
+
+func exprImmediate(reg uint32, data []byte) nfattr {
+	return expr("immediate",
+		attrU32(nftaImmediateDreg, reg),
+		attrNested(nftaImmediateData, nfattr{typ: nftaDataValue, data: data}))
+}
+
+func exprVerdict(code int32, chain string) nfattr {
+	verdict := []nfattr{attrU32(nftaVerdictCode, uint32(code))}
+	if chain != "" {
+		verdict = append(verdict, attrString(nftaVerdictChain, chain))
+	}
+	return expr("immediate",
+		attrU32(nftaImmediateDreg, nftRegVerdict),
+		attrNested(nftaImmediateData, attrNested(nftaDataVerdict, verdict...)))
+}
+
+// compile returns the expressions of the rule of the table.
+func (b *nftablesBackend) compile(table Table, r Rule) ([]nfattr, error) {
+	var exprs []nfattr
+
+	if r.SrcLocal {
+		exprs = append(exprs, b.matchLocal(nftFibFlagSaddr)...)
+	}
+	if r.DstLocal {
+		exprs = append(exprs, b.matchLocal(nftFibFlagDaddr)...)
+	}
+	exprs = append(exprs, matchIface(nftMetaIifname, r.InIface)...)
+	exprs = append(exprs, matchIface(nftMetaOifname, r.OutIface)...)
+
+	if r.Proto != "" {
+		p, ok := protocols[strings.ToLower(r.Proto)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported protocol %s in rule %q", r.Proto, r)
+		}
+		exprs = append(exprs, exprMeta(nftMetaL4proto), exprCmp(nftCmpEq, []byte{p}))
+	}
+
+	for _, m := range []struct {
+		value  string
+		src    bool
+		option string
+	}{{r.Src, true, "-s"}, {r.Dst, false, "-d"}} {
+		e, err := b.matchAddr(m.value, m.src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match in rule %q: %v", m.option, r, err)
+		}
+		exprs = append(exprs, e...)
+	}
+
+	if r.SrcSet != "" || r.DstSet != "" {
+		return nil, fmt.Errorf("ip set matches are not supported by nftables in rule %q", r)
+	}
+
+	if (r.SrcPort != 0 || r.DstPort != 0) && r.Proto == "" {
+		return nil, fmt.Errorf("port match without protocol in rule %q", r)
+	}
+	if r.SrcPort != 0 {
+		exprs = append(exprs, exprPayload(nftPayloadTransportHeader, 0, 2), exprCmp(nftCmpEq, portBytes(r.SrcPort)))
+	}
+	if r.DstPort != 0 {
+		exprs = append(exprs, exprPayload(nftPayloadTransportHeader, 2, 2), exprCmp(nftCmpEq, portBytes(r.DstPort)))
+	}
+
+	if r.CtState != "" {
+		var mask uint32
+		for _, s := range strings.Split(r.CtState, ",") {
+			bit, ok := ctStates[strings.ToUpper(strings.TrimSpace(s))]
+			if !ok {
+				return nil, fmt.Errorf("unknown conntrack state %s in rule %q", s, r)
+			}
+			mask |= bit
+		}
+		exprs = append(exprs,
+			expr("ct", attrU32(nftaCtDreg, nftReg1), attrU32(nftaCtKey, nftCtState)),
+			exprBitwise(nativeU32(mask)),
+			exprCmp(nftCmpNeq, make([]byte, 4)))
+	}
+
+	switch r.Target {
+	case "":
+	case Accept:
+		exprs = append(exprs, exprVerdict(nfAccept, ""))
+	case Drop:
+		exprs = append(exprs, exprVerdict(nfDrop, ""))
+	case Masquerade:
+		exprs = append(exprs, expr("masq"))
+	case DNAT:
+		e, err := b.dnat(r.ToDest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNAT destination in rule %q: %v", r, err)
+		}
+		exprs = append(exprs, e...)
+	default:
+		exprs = append(exprs, exprVerdict(nftJump, nftChainName(table, r.Target)))
+	}
+
+	return exprs, nil
+}
+
+// matchLocal matches the packets whose source or destination address,
+// depending on the fib flag, is a local one.
+func (b *nftablesBackend) matchLocal(flag uint32) []nfattr {
+	return []nfattr{
+		expr("fib",
+			attrU32(nftaFibDreg, nftReg1),
+			attrU32(nftaFibResult, nftFibResultAddrtype),
+			attrU32(nftaFibFlags, flag)),
+		exprCmp(nftCmpEq, nativeU32(rtnLocal)),
+	}
+}
+
+func matchIface(key uint32, value string) []nfattr {
+	if value == "" {
+		return nil
+	}
+	negated, name := parseNegation(value)
+	data := make([]byte, ifNameSiz)
+	copy(data, name)
+	op := uint32(nftCmpEq)
+	if negated {
+		op = nftCmpNeq
+	}
+	return []nfattr{exprMeta(key), exprCmp(op, data)}
+}
+
+func (b *nftablesBackend) matchAddr(value string, src bool) ([]nfattr, error) {
+	if value == "" {
+		return nil, nil
+	}
+	negated, v := parseNegation(value)
+	if v == "0/0" {
+		return nil, nil
+	}
+
+	var (
+		ip   net.IP
+		mask net.IPMask
+	)
+	if strings.Contains(v, "/") {
+		addr, subnet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		ip, mask = addr.Mask(subnet.Mask), subnet.Mask
+	} else if ip = net.ParseIP(v); ip == nil {
+		return nil, fmt.Errorf("invalid address %s", v)
+	}
+
+	data, err := b.addrBytes(ip)
+	if err != nil {
+		return nil, err
+	}
+	if mask != nil && len(mask) != len(data) {
+		mask = mask[len(mask)-len(data):]
+	}
+
+	offset := uint32(16)
+	if src {
+		offset = 12
+	}
+	if b.family == IPv6 {
+		offset = 24
+		if src {
+			offset = 8
+		}
+	}
+
+	exprs := []nfattr{exprPayload(nftPayloadNetworkHeader, offset, uint32(len(data)))}
+	if ones, bits := mask.Size(); mask != nil && ones != bits {
+		exprs = append(exprs, exprBitwise(mask))
+	}
+	op := uint32(nftCmpEq)
+	if negated {
+		op = nftCmpNeq
+	}
+	return append(exprs, exprCmp(op, data)), nil
+}
+
+// addrBytes returns the address in the length of the backend family.
+func (b *nftablesBackend) addrBytes(ip net.IP) ([]byte, error) {
+	if b.family == IPv4 {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	} else if ip.To4() == nil {
+		return ip.To16(), nil
+	}
+	return nil, fmt.Errorf("address %s is not in the %s family", ip, b.family)
+}
+
+// dnat returns the expressions translating the destination to the
+// host:port address.
+func (b *nftablesBackend) dnat(toDest string) ([]nfattr, error) {
+	host, p, err := net.SplitHostPort(toDest)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %s", host)
+	}
+	data, err := b.addrBytes(ip)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s", p)
+	}
+
+	return []nfattr{
+		exprImmediate(nftReg1, data),
+		exprImmediate(nftReg2, portBytes(int(port))),
+		expr("nat",
+			attrU32(nftaNatType, nftNatDnat),
+			attrU32(nftaNatFamily, uint32(b.nfproto())),
+			attrU32(nftaNatRegAddrMin, nftReg1),
+			attrU32(nftaNatRegProtoMn, nftReg2)),
+	}, nil
+}
+
+func portBytes(port int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(port))
+	return b
+}
@@ -0,0 +1,340 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Netlink interface of nf_tables, as defined in linux/netfilter/nfnetlink.h
+// and linux/netfilter/nf_tables.h
+const (
+	nfnlSubsysNftables = 10
+	nfnlMsgBatchBegin  = 0x10
+	nfnlMsgBatchEnd    = 0x11
+
+	nftMsgNewTable = 0
+	nftMsgNewChain = 3
+	nftMsgDelChain = 5
+	nftMsgNewRule  = 6
+	nftMsgGetRule  = 7
+	nftMsgDelRule  = 8
+
+	nftaTableName    = 1
+	nftaTableFlags   = 2
+	nftaChainTable   = 1
+	nftaChainName    = 3
+	nftaChainHook    = 4
+	nftaChainType    = 7
+	nftaHookHooknum  = 1
+	nftaHookPriority = 2
+
+	nftaRuleTable       = 1
+	nftaRuleChain       = 2
+	nftaRuleHandle      = 3
+	nftaRuleExpressions = 4
+	nftaRuleUserdata    = 7
+
+	nftaListElem     = 1
+	nftaExprName     = 1
+	nftaExprData     = 2
+	nftaDataValue    = 1
+	nftaDataVerdict  = 2
+	nftaVerdictCode  = 1
+	nftaVerdictChain = 2
+
+	nftaImmediateDreg = 1
+	nftaImmediateData = 2
+	nftaCmpSreg       = 1
+	nftaCmpOp         = 2
+	nftaCmpData       = 3
+	nftaPayloadDreg   = 1
+	nftaPayloadBase   = 2
+	nftaPayloadOffset = 3
+	nftaPayloadLen    = 4
+	nftaBitwiseSreg   = 1
+	nftaBitwiseDreg   = 2
+	nftaBitwiseLen    = 3
+	nftaBitwiseMask   = 4
+	nftaBitwiseXor    = 5
+	nftaMetaDreg      = 1
+	nftaMetaKey       = 2
+	nftaCtDreg        = 1
+	nftaCtKey         = 2
+	nftaFibDreg       = 1
+	nftaFibResult     = 2
+	nftaFibFlags      = 3
+	nftaNatType       = 1
+	nftaNatFamily     = 2
+	nftaNatRegAddrMin = 3
+	nftaNatRegProtoMn = 5
+
+	nftRegVerdict = 0
+	nftReg1       = 1
+	nftReg2       = 2
+
+	nftCmpEq  = 0
+	nftCmpNeq = 1
+
+	nftPayloadNetworkHeader   = 1
+	nftPayloadTransportHeader = 2
+
+	nftMetaIifname = 6
+	nftMetaOifname = 7
+	nftMetaL4proto = 16
+
+	nftCtState = 0
+
+	nftFibResultAddrtype = 3
+	nftFibFlagSaddr      = 1 << 0
+	nftFibFlagDaddr      = 1 << 1
+
+	nftNatDnat = 1
+
+	nfDrop    = 0
+	nfAccept  = 1
+	nftJump   = -3
+	rtnLocal  = 2
+	ifNameSiz = 16
+
+	nfInetPreRouting  = 0
+	nfInetForward     = 2
+	nfInetLocalOut    = 3
+	nfInetPostRouting = 4
+
+	nlaFNested = 1 << 15
+	nlaTypeMsk = 1<<14 - 1
+
+	// nftUdataComment is the type of the libnftnl comment in the rule user data
+	nftUdataComment = 0
+)
+
+var nftSeq uint32
+
+// nfattr is a netfilter netlink attribute, either holding data or nesting
+// the children attributes.
+type nfattr struct {
+	typ      int
+	data     []byte
+	children []nfattr
+}
+
+// nftMessage is an nf_tables request.
+type nftMessage struct {
+	typ   uint16
+	flags uint16
+	attrs []nfattr
+	// desc describes the request in the errors
+	desc string
+}
+
+func attrString(typ int, s string) nfattr {
+	return nfattr{typ: typ, data: nl.ZeroTerminated(s)}
+}
+
+func attrU32(typ int, v uint32) nfattr {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return nfattr{typ: typ, data: b}
+}
+
+func attrU64(typ int, v uint64) nfattr {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return nfattr{typ: typ, data: b}
+}
+
+func attrNested(typ int, children ...nfattr) nfattr {
+	return nfattr{typ: typ, children: append([]nfattr{}, children...)}
+}
+
+func (a nfattr) addTo(parent *nl.RtAttr) {
+	if a.children == nil {
+		nl.NewRtAttrChild(parent, a.typ, a.data)
+		return
+	}
+	child := nl.NewRtAttrChild(parent, a.typ|nlaFNested, nil)
+	for _, c := range a.children {
+		c.addTo(child)
+	}
+}
+
+func (a nfattr) serialize() []byte {
+	if a.children == nil {
+		return nl.NewRtAttr(a.typ, a.data).Serialize()
+	}
+	attr := nl.NewRtAttr(a.typ|nlaFNested, nil)
+	for _, c := range a.children {
+		c.addTo(attr)
+	}
+	return attr.Serialize()
+}
+
+// serializeNfMessage returns the netlink message with the nfgenmsg header.
+func serializeNfMessage(msgType, flags uint16, seq uint32, family uint8, resID uint16, attrs []nfattr) []byte {
+	payload := []byte{family, 0, 0, 0}
+	binary.BigEndian.PutUint16(payload[2:], resID)
+	for _, a := range attrs {
+		payload = append(payload, a.serialize()...)
+	}
+
+	b := make([]byte, syscall.SizeofNlMsghdr, syscall.SizeofNlMsghdr+len(payload))
+	native := nl.NativeEndian()
+	native.PutUint32(b[0:4], uint32(syscall.SizeofNlMsghdr+len(payload)))
+	native.PutUint16(b[4:6], msgType)
+	native.PutUint16(b[6:8], flags)
+	native.PutUint32(b[8:12], seq)
+	return append(b, payload...)
+}
+
+func nftSocket() (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	// Do not wait forever on a kernel which does not answer all the requests
+	tv := syscall.Timeval{Sec: 10}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func nftReceive(fd int) ([]syscall.NetlinkMessage, error) {
+	rb := make([]byte, 1<<16)
+	n, _, err := syscall.Recvfrom(fd, rb, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < syscall.NLMSG_HDRLEN {
+		return nil, fmt.Errorf("short netlink response")
+	}
+	return syscall.ParseNetlinkMessage(rb[:n])
+}
+
+func netlinkError(m syscall.NetlinkMessage) error {
+	if len(m.Data) < 4 {
+		return fmt.Errorf("short netlink error message")
+	}
+	if errno := int32(nl.NativeEndian().Uint32(m.Data[0:4])); errno != 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
+// nftBatch sends the requests to the kernel in a batch, which is applied
+// atomically: either all the requests succeed or none is applied.
+func nftBatch(family uint8, msgs []nftMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	fd, err := nftSocket()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	begin := atomic.AddUint32(&nftSeq, uint32(len(msgs)+2)) - uint32(len(msgs)+1)
+	buf := serializeNfMessage(nfnlMsgBatchBegin, syscall.NLM_F_REQUEST, begin, syscall.AF_UNSPEC, nfnlSubsysNftables, nil)
+	pending := make(map[uint32]string, len(msgs))
+	for i, m := range msgs {
+		seq := begin + uint32(i) + 1
+		flags := syscall.NLM_F_REQUEST | syscall.NLM_F_ACK | m.flags
+		buf = append(buf, serializeNfMessage(nfnlSubsysNftables<<8|m.typ, flags, seq, family, 0, m.attrs)...)
+		pending[seq] = m.desc
+	}
+	buf = append(buf, serializeNfMessage(nfnlMsgBatchEnd, syscall.NLM_F_REQUEST, begin+uint32(len(msgs))+1, syscall.AF_UNSPEC, nfnlSubsysNftables, nil)...)
+
+	if err := syscall.Sendto(fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	var batchErr error
+	for len(pending) > 0 {
+		resp, err := nftReceive(fd)
+		if err != nil {
+			if batchErr != nil {
+				return batchErr
+			}
+			return fmt.Errorf("failed to receive the nftables response: %v", err)
+		}
+		for _, m := range resp {
+			if m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			err := netlinkError(m)
+			if m.Header.Seq == begin {
+				// The whole batch was refused
+				return fmt.Errorf("nftables batch failed: %v", err)
+			}
+			desc, ok := pending[m.Header.Seq]
+			if !ok {
+				continue
+			}
+			delete(pending, m.Header.Seq)
+			if err != nil && batchErr == nil {
+				batchErr = fmt.Errorf("nftables failed to %s: %v", desc, err)
+			}
+		}
+	}
+
+	return batchErr
+}
+
+// nftDump returns the attributes of the objects dumped by the request.
+func nftDump(family uint8, msg nftMessage) ([][]syscall.NetlinkRouteAttr, error) {
+	fd, err := nftSocket()
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	seq := atomic.AddUint32(&nftSeq, 1)
+	flags := uint16(syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP)
+	buf := serializeNfMessage(nfnlSubsysNftables<<8|msg.typ, flags, seq, family, 0, msg.attrs)
+	if err := syscall.Sendto(fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var objs [][]syscall.NetlinkRouteAttr
+	for {
+		resp, err := nftReceive(fd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive the nftables response: %v", err)
+		}
+		for _, m := range resp {
+			if m.Header.Seq != seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return objs, nil
+			case syscall.NLMSG_ERROR:
+				if err := netlinkError(m); err != nil {
+					return nil, fmt.Errorf("nftables failed to %s: %v", msg.desc, err)
+				}
+				return objs, nil
+			}
+			if len(m.Data) < 4 {
+				continue
+			}
+			attrs, err := nl.ParseRouteAttr(m.Data[4:])
+			if err != nil {
+				return nil, err
+			}
+			for i := range attrs {
+				attrs[i].Attr.Type &= nlaTypeMsk
+			}
+			objs = append(objs, attrs)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package firewall
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/testutils"
+)
+
+func newTestNftables(t *testing.T, family Family) *nftablesBackend {
+	b, err := newNftablesBackend(family)
+	if err != nil {
+		t.Skipf("nftables not supported: %v", err)
+	}
+	return b
+}
+
+func TestNftablesChain(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	b := newTestNftables(t, IPv4)
+
+	natChain, err := b.NewChain("DOCKER", Nat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterChain, err := b.NewChain("DOCKER", Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ProgramChain(natChain, "docker0", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ProgramChain(filterChain, "docker0", false); err != nil {
+		t.Fatal(err)
+	}
+	// Programming the chains twice does not duplicate the jumps
+	if err := b.ProgramChain(natChain, "docker0", false); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := b.listRules(nftChainName(Nat, "OUTPUT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].tag != "-m addrtype --dst-type LOCAL ! -d 127.0.0.0/8 -j DOCKER" {
+		t.Fatalf("Unexpected OUTPUT rules %v", rules)
+	}
+	if !b.Exists(Filter, "FORWARD", Rule{OutIface: "docker0", Target: "DOCKER"}) {
+		t.Fatal("Filter chain was not hooked to FORWARD")
+	}
+
+	ip := net.ParseIP("192.168.1.1")
+	if err := natChain.Forward(Append, ip, 1234, "tcp", "172.17.0.2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	dnat, accept, masq := forwardRules(false, ip, 1234, "tcp", "172.17.0.2", 80, "docker0")
+	if !b.Exists(Nat, "DOCKER", dnat) || !b.Exists(Filter, "DOCKER", accept) || !b.Exists(Nat, "POSTROUTING", masq) {
+		t.Fatal("Forward rules were not programmed")
+	}
+	if err := natChain.Forward(Delete, ip, 1234, "tcp", "172.17.0.2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	if b.Exists(Nat, "DOCKER", dnat) || b.Exists(Filter, "DOCKER", accept) || b.Exists(Nat, "POSTROUTING", masq) {
+		t.Fatal("Forward rules were not deleted")
+	}
+	if err := natChain.Forward(Delete, ip, 1234, "tcp", "172.17.0.2", 80, "docker0"); err == nil {
+		t.Fatal("Expected failure on deleting missing rules")
+	}
+
+	ip1, ip2 := net.ParseIP("172.17.0.2"), net.ParseIP("172.17.0.3")
+	if err := filterChain.Link(Append, ip1, ip2, 5432, "udp", "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	out, in := linkRules(ip1, ip2, 5432, "udp", "docker0")
+	if !b.Exists(Filter, "DOCKER", out) || !b.Exists(Filter, "DOCKER", in) {
+		t.Fatal("Link rules were not programmed")
+	}
+
+	masqSubnet := Rule{Src: "172.17.0.0/16", OutIface: "!docker0", Target: Masquerade}
+	if err := b.ProgramRule(Nat, "POSTROUTING", Append, masqSubnet); err != nil {
+		t.Fatal(err)
+	}
+	est := Rule{OutIface: "docker0", CtState: "RELATED,ESTABLISHED", Target: Accept}
+	if err := b.ProgramRule(Filter, "FORWARD", Insert, est); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := natChain.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if err := filterChain.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Exists(Filter, "FORWARD", Rule{OutIface: "docker0", Target: "DOCKER"}) {
+		t.Fatal("Jump to removed filter chain was not deleted")
+	}
+	if rules, err := b.listRules(nftChainName(Nat, "OUTPUT")); err != nil || len(rules) != 0 {
+		t.Fatalf("Jump to removed nat chain was not deleted: %v %v", rules, err)
+	}
+	if !b.Exists(Filter, "FORWARD", est) {
+		t.Fatal("Unrelated rule was removed along with the chain")
+	}
+}
+
+func TestNftablesIPv6(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	b := newTestNftables(t, IPv6)
+
+	c, err := b.NewChain("DOCKER", Nat, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ProgramChain(c, "docker0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The forwarding fails without the filter chain, and the failing
+	// batch does not leave the nat rules behind
+	if err := c.Forward(Append, net.IPv6unspecified, 8080, "tcp", "fd00::2", 80, "docker0"); err == nil {
+		t.Fatal("Expected failure on missing filter chain")
+	}
+	dnat, _, masq := forwardRules(true, net.IPv6unspecified, 8080, "tcp", "fd00::2", 80, "docker0")
+	if b.Exists(Nat, "DOCKER", dnat) || b.Exists(Nat, "POSTROUTING", masq) {
+		t.Fatal("Failed forwarding left nat rules behind")
+	}
+
+	if _, err := b.NewChain("DOCKER", Filter, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Forward(Append, net.IPv6unspecified, 8080, "tcp", "fd00::2", 80, "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Exists(Nat, "DOCKER", dnat) || !b.Exists(Nat, "POSTROUTING", masq) {
+		t.Fatal("Forward rules were not programmed")
+	}
+
+	// Addresses of the other family are refused
+	if err := b.ProgramRule(Nat, "DOCKER", Append, Rule{Dst: "10.0.0.1", Target: Accept}); err == nil {
+		t.Fatal("Expected failure on IPv4 address in IPv6 rule")
+	}
+}
+
+func TestNftablesPrune(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	b := newTestNftables(t, IPv4)
+
+	filterChain, err := b.NewChain("DOCKER", Filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip1, ip2 := net.ParseIP("172.17.0.2"), net.ParseIP("172.17.0.3")
+	if err := filterChain.Link(Append, ip1, ip2, 80, "tcp", "docker0"); err != nil {
+		t.Fatal(err)
+	}
+	out, in := linkRules(ip1, ip2, 80, "tcp", "docker0")
+
+	removed, err := b.Prune(Filter, "DOCKER", []Rule{out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != in.String() {
+		t.Fatalf("Unexpected pruned rules %v", removed)
+	}
+	if !b.Exists(Filter, "DOCKER", out) || b.Exists(Filter, "DOCKER", in) {
+		t.Fatal("Prune did not keep only the expected rule")
+	}
+
+	if removed, err := b.Prune(Filter, "DOCKER", []Rule{out}); err != nil || len(removed) != 0 {
+		t.Fatalf("Unexpected second prune: %v %v", removed, err)
+	}
+
+	// A flush replaces the rules of the chain in the same batch
+	if err := b.Apply([]RuleChange{
+		{Table: Filter, Chain: "DOCKER", Action: Flush},
+		{Table: Filter, Chain: "DOCKER", Action: Append, Rule: in},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b.Exists(Filter, "DOCKER", out) || !b.Exists(Filter, "DOCKER", in) {
+		t.Fatal("Flush did not replace the rules of the chain")
+	}
+}
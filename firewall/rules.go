@@ -0,0 +1,146 @@
+package firewall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ownerTag prefixes the comment the backends tag their iptables rules with,
+// which tells them apart from the rules of the other tools.
+const ownerTag = "libnetwork:"
+
+// ruleID returns the identifier of the rule, a hash of its iptables form.
+func ruleID(r Rule) string {
+	sum := sha256.Sum256([]byte(r.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// JumpRules returns the changes hooking the chain of the table to the
+// built-in chains: the nat chain gets the traffic to the local addresses
+// and the filter chain gets the traffic forwarded to the bridge.
+func JumpRules(family Family, table Table, chain, bridgeName string, hairpinMode bool) []RuleChange {
+	switch table {
+	case Nat:
+		output := Rule{DstLocal: true, Target: chain}
+		if !hairpinMode {
+			output.Dst = "!" + loopback(family)
+		}
+		return []RuleChange{
+			{Table: Nat, Chain: "PREROUTING", Action: Append, Rule: Rule{DstLocal: true, Target: chain}},
+			{Table: Nat, Chain: "OUTPUT", Action: Append, Rule: output},
+		}
+	case Filter:
+		return []RuleChange{
+			{Table: Filter, Chain: "FORWARD", Action: Insert, Rule: Rule{OutIface: bridgeName, Target: chain}},
+		}
+	}
+	return nil
+}
+
+// ForwardRules returns the changes Chain.Forward applies to the chain and
+// to the nat POSTROUTING chain.
+func ForwardRules(chain string, action Action, hairpinMode bool, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) []RuleChange {
+	dnat, accept, masquerade := forwardRules(hairpinMode, ip, port, proto, destAddr, destPort, bridgeName)
+	return []RuleChange{
+		{Table: Nat, Chain: chain, Action: action, Rule: dnat},
+		{Table: Filter, Chain: chain, Action: action, Rule: accept},
+		{Table: Nat, Chain: "POSTROUTING", Action: action, Rule: masquerade},
+	}
+}
+
+// LinkRules returns the changes Chain.Link applies to the filter chain.
+func LinkRules(chain string, action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) []RuleChange {
+	out, in := linkRules(ip1, ip2, port, proto, bridgeName)
+	return []RuleChange{
+		{Table: Filter, Chain: chain, Action: action, Rule: out},
+		{Table: Filter, Chain: chain, Action: action, Rule: in},
+	}
+}
+
+// programJumps adds the missing jumps to the chain all together.
+func programJumps(b Backend, c Chain, bridgeName string, hairpinMode bool) error {
+	if c == nil || c.Name() == "" {
+		return fmt.Errorf("could not program chain, missing chain name")
+	}
+	if c.Table() == Filter && bridgeName == "" {
+		return fmt.Errorf("could not program chain %s/%s, missing bridge name", c.Table(), c.Name())
+	}
+
+	var changes []RuleChange
+	for _, j := range JumpRules(b.Family(), c.Table(), c.Name(), bridgeName, hairpinMode) {
+		if !b.Exists(j.Table, j.Chain, j.Rule) {
+			changes = append(changes, j)
+		}
+	}
+	if err := b.Apply(changes); err != nil {
+		return fmt.Errorf("failed to inject %s in the %s built-in chains: %v", c.Name(), c.Table(), err)
+	}
+	return nil
+}
+
+// forwardRules returns the rules Chain.Forward programs in the tables: the
+// translation in the nat chain, the acceptance in the filter chain, and the
+// masquerading in the nat POSTROUTING chain of the traffic the destination
+// sends to itself through the host port.
+func forwardRules(hairpinMode bool, ip net.IP, port int, proto, destAddr string, destPort int, bridgeName string) (dnat, accept, masquerade Rule) {
+	daddr := ip.String()
+	if ip.IsUnspecified() {
+		// "0/0" is interpreted as "any value" by both iptables
+		// and ip6tables, and is not matched by nftables
+		daddr = "0/0"
+	}
+
+	dnat = Rule{
+		Proto:   proto,
+		Dst:     daddr,
+		DstPort: port,
+		Target:  DNAT,
+		ToDest:  net.JoinHostPort(destAddr, strconv.Itoa(destPort)),
+	}
+	if !hairpinMode {
+		dnat.InIface = "!" + bridgeName
+	}
+
+	accept = Rule{
+		InIface:  "!" + bridgeName,
+		OutIface: bridgeName,
+		Proto:    proto,
+		Dst:      destAddr,
+		DstPort:  destPort,
+		Target:   Accept,
+	}
+
+	masquerade = Rule{
+		Proto:   proto,
+		Src:     destAddr,
+		Dst:     destAddr,
+		DstPort: destPort,
+		Target:  Masquerade,
+	}
+
+	return dnat, accept, masquerade
+}
+
+// linkRules returns the rules Chain.Link programs in the filter chain.
+func linkRules(ip1, ip2 net.IP, port int, proto string, bridgeName string) (Rule, Rule) {
+	return Rule{
+		InIface:  bridgeName,
+		OutIface: bridgeName,
+		Proto:    proto,
+		Src:      ip1.String(),
+		Dst:      ip2.String(),
+		DstPort:  port,
+		Target:   Accept,
+	}, Rule{
+		InIface:  bridgeName,
+		OutIface: bridgeName,
+		Proto:    proto,
+		Src:      ip2.String(),
+		Dst:      ip1.String(),
+		SrcPort:  port,
+		Target:   Accept,
+	}
+}
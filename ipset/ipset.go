@@ -0,0 +1,104 @@
+// Package ipset manages the kernel ip sets through the ipset tool, so
+// that iptables rules can match against a changing group of addresses.
+package ipset
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// HashIP is the set type storing IP addresses.
+	HashIP = "hash:ip"
+	// HashNet is the set type storing IP networks.
+	HashNet = "hash:net"
+	// MaxNameLen is the maximum length of a set name.
+	MaxNameLen = 31
+)
+
+var (
+	ipsetPath string
+	// ErrIpsetNotFound is returned when the ipset tool is not available.
+	ErrIpsetNotFound = errors.New("ipset not found")
+)
+
+func initCheck() error {
+	if ipsetPath == "" {
+		path, err := exec.LookPath("ipset")
+		if err != nil {
+			return ErrIpsetNotFound
+		}
+		ipsetPath = path
+	}
+	return nil
+}
+
+// Create creates the set of the passed type, unless it already exists.
+func Create(name, setType string) error {
+	if len(name) > MaxNameLen {
+		return fmt.Errorf("ipset name %s is longer than %d characters", name, MaxNameLen)
+	}
+	_, err := Raw("create", name, setType, "-exist")
+	return err
+}
+
+// Add adds the address to the set, unless it is already a member.
+func Add(name string, ip net.IP) error {
+	_, err := Raw("add", name, ip.String(), "-exist")
+	return err
+}
+
+// Del removes the address from the set, if it is a member.
+func Del(name string, ip net.IP) error {
+	_, err := Raw("del", name, ip.String(), "-exist")
+	return err
+}
+
+// Flush removes all the members of the set.
+func Flush(name string) error {
+	_, err := Raw("flush", name)
+	return err
+}
+
+// Destroy removes the set. It fails while the set is referenced
+// by an iptables rule.
+func Destroy(name string) error {
+	_, err := Raw("destroy", name)
+	return err
+}
+
+// List returns the names of the existing sets starting with the passed prefix.
+func List(prefix string) ([]string, error) {
+	out, err := Raw("list", "-n")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range strings.Fields(string(out)) {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Raw calls 'ipset' with the specified arguments.
+func Raw(args ...string) ([]byte, error) {
+	if err := initCheck(); err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("%s, %v", ipsetPath, args)
+
+	output, err := exec.Command(ipsetPath, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ipset failed: ipset %v: %s (%s)", strings.Join(args, " "), output, err)
+	}
+	return output, nil
+}
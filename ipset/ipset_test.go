@@ -0,0 +1,62 @@
+package ipset
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/testutils"
+)
+
+func TestCreateLongName(t *testing.T) {
+	if err := Create(strings.Repeat("a", MaxNameLen+1), HashIP); err == nil {
+		t.Fatalf("Expected failure on set name longer than %d characters", MaxNameLen)
+	}
+}
+
+func TestSet(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	if err := initCheck(); err != nil {
+		t.Skip(err.Error())
+	}
+
+	name := "test-set"
+	ip := net.ParseIP("10.0.0.2")
+
+	if err := Create(name, HashIP); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(name, HashIP); err != nil {
+		t.Fatalf("Unexpected failure on existing set: %v", err)
+	}
+	if err := Add(name, ip); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Raw("list", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), ip.String()) {
+		t.Fatalf("Address %s missing in set:\n%s", ip, out)
+	}
+
+	names, err := List("test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != name {
+		t.Fatalf("Unexpected sets: %v", names)
+	}
+
+	if err := Del(name, ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := Flush(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := Destroy(name); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -25,6 +25,8 @@ const (
 	Delete Action = "-D"
 	// Insert inserts the rule at the top of the chain.
 	Insert Action = "-I"
+	// Flush deletes all the rules of the chain.
+	Flush Action = "-F"
 	// Nat table is used for nat translation rules.
 	Nat Table = "nat"
 	// Filter table is used for filter rules.
@@ -34,19 +36,31 @@ const (
 )
 
 var (
-	iptablesPath  string
-	supportsXlock = false
+	iptablesPath   string
+	ip6tablesPath  string
+	supportsXlock  = false
+	supportsXlock6 = false
 	// used to lock iptables commands if xtables lock is not supported
 	bestEffortLock sync.Mutex
 	// ErrIptablesNotFound is returned when the rule is not found.
 	ErrIptablesNotFound = errors.New("Iptables not found")
+	// ErrIp6tablesNotFound is returned when the ip6tables binary is not found.
+	ErrIp6tablesNotFound = errors.New("Ip6tables not found")
 )
 
+// IPTable is the iptables command of an IP address family:
+// iptables for Iptables and ip6tables for IP6Tables.
+type IPTable struct {
+	Version IPV
+}
+
 // ChainInfo defines the iptables chain.
 type ChainInfo struct {
 	Name        string
 	Table       Table
 	HairpinMode bool
+	// IPTable is the address family of the chain, IPv4 when not set
+	IPTable IPTable
 }
 
 // ChainError is returned to represent errors during ip table operation.
@@ -59,6 +73,37 @@ func (e ChainError) Error() string {
 	return fmt.Sprintf("Error iptables %s: %s", e.Chain, string(e.Output))
 }
 
+// GetIptable returns the iptables command of the address family.
+func GetIptable(version IPV) *IPTable {
+	return &IPTable{Version: version}
+}
+
+func (iptable *IPTable) isIPv6() bool {
+	return iptable.Version == IP6Tables
+}
+
+func (iptable *IPTable) version() IPV {
+	if iptable.isIPv6() {
+		return IP6Tables
+	}
+	return Iptables
+}
+
+func (iptable *IPTable) command() string {
+	if iptable.isIPv6() {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+// loopback returns the loopback subnet of the address family.
+func (iptable *IPTable) loopback() string {
+	if iptable.isIPv6() {
+		return "::1/128"
+	}
+	return "127.0.0.0/8"
+}
+
 func initCheck() error {
 
 	if iptablesPath == "" {
@@ -72,20 +117,39 @@ func initCheck() error {
 	return nil
 }
 
-// NewChain adds a new chain to ip table.
+func initCheck6() error {
+
+	if ip6tablesPath == "" {
+		path, err := exec.LookPath("ip6tables")
+		if err != nil {
+			return ErrIp6tablesNotFound
+		}
+		ip6tablesPath = path
+		supportsXlock6 = exec.Command(ip6tablesPath, "--wait", "-L", "-n").Run() == nil
+	}
+	return nil
+}
+
+// NewChain adds a new chain to the IPv4 ip table.
 func NewChain(name string, table Table, hairpinMode bool) (*ChainInfo, error) {
+	return GetIptable(Iptables).NewChain(name, table, hairpinMode)
+}
+
+// NewChain adds a new chain to ip table.
+func (iptable *IPTable) NewChain(name string, table Table, hairpinMode bool) (*ChainInfo, error) {
 	c := &ChainInfo{
 		Name:        name,
 		Table:       table,
 		HairpinMode: hairpinMode,
+		IPTable:     IPTable{Version: iptable.version()},
 	}
 	if string(c.Table) == "" {
 		c.Table = Filter
 	}
 
 	// Add chain if it doesn't exist
-	if _, err := Raw("-t", string(c.Table), "-n", "-L", c.Name); err != nil {
-		if output, err := Raw("-t", string(c.Table), "-N", c.Name); err != nil {
+	if _, err := iptable.Raw("-t", string(c.Table), "-n", "-L", c.Name); err != nil {
+		if output, err := iptable.Raw("-t", string(c.Table), "-N", c.Name); err != nil {
 			return nil, err
 		} else if len(output) != 0 {
 			return nil, fmt.Errorf("Could not create %s/%s chain: %s", c.Table, c.Name, output)
@@ -94,34 +158,40 @@ func NewChain(name string, table Table, hairpinMode bool) (*ChainInfo, error) {
 	return c, nil
 }
 
-// ProgramChain is used to add rules to a chain
+// ProgramChain is used to add rules to an IPv4 chain
 func ProgramChain(c *ChainInfo, bridgeName string, hairpinMode bool) error {
+	return GetIptable(Iptables).ProgramChain(c, bridgeName, hairpinMode)
+}
+
+// ProgramChain is used to add rules to a chain
+func (iptable *IPTable) ProgramChain(c *ChainInfo, bridgeName string, hairpinMode bool) error {
 	if c.Name == "" {
 		return fmt.Errorf("Could not program chain, missing chain name.")
 	}
 
+	// The jumps to the chain are added at once
+	tx := iptable.Begin()
 	switch c.Table {
 	case Nat:
 		preroute := []string{
 			"-m", "addrtype",
 			"--dst-type", "LOCAL",
 			"-j", c.Name}
-		if !Exists(Nat, "PREROUTING", preroute...) {
-			if err := c.Prerouting(Append, preroute...); err != nil {
-				return fmt.Errorf("Failed to inject docker in PREROUTING chain: %s", err)
-			}
+		if !iptable.Exists(Nat, "PREROUTING", preroute...) {
+			tx.Append(Nat, "PREROUTING", preroute...)
 		}
 		output := []string{
 			"-m", "addrtype",
 			"--dst-type", "LOCAL",
 			"-j", c.Name}
 		if !hairpinMode {
-			output = append(output, "!", "--dst", "127.0.0.0/8")
+			output = append(output, "!", "--dst", iptable.loopback())
 		}
-		if !Exists(Nat, "OUTPUT", output...) {
-			if err := c.Output(Append, output...); err != nil {
-				return fmt.Errorf("Failed to inject docker in OUTPUT chain: %s", err)
-			}
+		if !iptable.Exists(Nat, "OUTPUT", output...) {
+			tx.Append(Nat, "OUTPUT", output...)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("Failed to inject docker in PREROUTING and OUTPUT chains: %s", err)
 		}
 	case Filter:
 		if bridgeName == "" {
@@ -131,23 +201,27 @@ func ProgramChain(c *ChainInfo, bridgeName string, hairpinMode bool) error {
 		link := []string{
 			"-o", bridgeName,
 			"-j", c.Name}
-		if !Exists(Filter, "FORWARD", link...) {
-			insert := append([]string{string(Insert), "FORWARD"}, link...)
-			if output, err := Raw(insert...); err != nil {
-				return err
-			} else if len(output) != 0 {
-				return fmt.Errorf("Could not create linking rule to %s/%s: %s", c.Table, c.Name, output)
-			}
+		if !iptable.Exists(Filter, "FORWARD", link...) {
+			tx.Insert(Filter, "FORWARD", link...)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("Could not create linking rule to %s/%s: %s", c.Table, c.Name, err)
 		}
 	}
 	return nil
 }
 
-// RemoveExistingChain removes existing chain from the table.
+// RemoveExistingChain removes existing chain from the IPv4 table.
 func RemoveExistingChain(name string, table Table) error {
+	return GetIptable(Iptables).RemoveExistingChain(name, table)
+}
+
+// RemoveExistingChain removes existing chain from the table.
+func (iptable *IPTable) RemoveExistingChain(name string, table Table) error {
 	c := &ChainInfo{
-		Name:  name,
-		Table: table,
+		Name:    name,
+		Table:   table,
+		IPTable: IPTable{Version: iptable.version()},
 	}
 	if string(c.Table) == "" {
 		c.Table = Filter
@@ -164,51 +238,39 @@ func (c *ChainInfo) Forward(action Action, ip net.IP, port int, proto, destAddr
 		// value" by both iptables and ip6tables.
 		daddr = "0/0"
 	}
-	args := []string{"-t", string(Nat), string(action), c.Name,
+	dnat := []string{
 		"-p", proto,
 		"-d", daddr,
 		"--dport", strconv.Itoa(port),
 		"-j", "DNAT",
 		"--to-destination", net.JoinHostPort(destAddr, strconv.Itoa(destPort))}
 	if !c.HairpinMode {
-		args = append(args, "!", "-i", bridgeName)
-	}
-	if output, err := Raw(args...); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return ChainError{Chain: "FORWARD", Output: output}
-	}
-
-	if output, err := Raw("-t", string(Filter), string(action), c.Name,
-		"!", "-i", bridgeName,
-		"-o", bridgeName,
-		"-p", proto,
-		"-d", destAddr,
-		"--dport", strconv.Itoa(destPort),
-		"-j", "ACCEPT"); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return ChainError{Chain: "FORWARD", Output: output}
-	}
-
-	if output, err := Raw("-t", string(Nat), string(action), "POSTROUTING",
-		"-p", proto,
-		"-s", destAddr,
-		"-d", destAddr,
-		"--dport", strconv.Itoa(destPort),
-		"-j", "MASQUERADE"); err != nil {
-		return err
-	} else if len(output) != 0 {
-		return ChainError{Chain: "FORWARD", Output: output}
+		dnat = append(dnat, "!", "-i", bridgeName)
 	}
 
-	return nil
+	// The rules are programmed all together or not at all
+	return c.IPTable.Begin().
+		Add(Nat, action, c.Name, dnat...).
+		Add(Filter, action, c.Name,
+			"!", "-i", bridgeName,
+			"-o", bridgeName,
+			"-p", proto,
+			"-d", destAddr,
+			"--dport", strconv.Itoa(destPort),
+			"-j", "ACCEPT").
+		Add(Nat, action, "POSTROUTING",
+			"-p", proto,
+			"-s", destAddr,
+			"-d", destAddr,
+			"--dport", strconv.Itoa(destPort),
+			"-j", "MASQUERADE").
+		Commit()
 }
 
 // Link adds reciprocal ACCEPT rule for two supplied IP addresses.
 // Traffic is allowed from ip1 to ip2 and vice-versa
 func (c *ChainInfo) Link(action Action, ip1, ip2 net.IP, port int, proto string, bridgeName string) error {
-	if output, err := Raw("-t", string(Filter), string(action), c.Name,
+	if output, err := c.IPTable.Raw("-t", string(Filter), string(action), c.Name,
 		"-i", bridgeName, "-o", bridgeName,
 		"-p", proto,
 		"-s", ip1.String(),
@@ -219,7 +281,7 @@ func (c *ChainInfo) Link(action Action, ip1, ip2 net.IP, port int, proto string,
 	} else if len(output) != 0 {
 		return fmt.Errorf("Error iptables forward: %s", output)
 	}
-	if output, err := Raw("-t", string(Filter), string(action), c.Name,
+	if output, err := c.IPTable.Raw("-t", string(Filter), string(action), c.Name,
 		"-i", bridgeName, "-o", bridgeName,
 		"-p", proto,
 		"-s", ip2.String(),
@@ -239,7 +301,7 @@ func (c *ChainInfo) Prerouting(action Action, args ...string) error {
 	if len(args) > 0 {
 		a = append(a, args...)
 	}
-	if output, err := Raw(a...); err != nil {
+	if output, err := c.IPTable.Raw(a...); err != nil {
 		return err
 	} else if len(output) != 0 {
 		return ChainError{Chain: "PREROUTING", Output: output}
@@ -253,7 +315,7 @@ func (c *ChainInfo) Output(action Action, args ...string) error {
 	if len(args) > 0 {
 		a = append(a, args...)
 	}
-	if output, err := Raw(a...); err != nil {
+	if output, err := c.IPTable.Raw(a...); err != nil {
 		return err
 	} else if len(output) != 0 {
 		return ChainError{Chain: "OUTPUT", Output: output}
@@ -266,19 +328,24 @@ func (c *ChainInfo) Remove() error {
 	// Ignore errors - This could mean the chains were never set up
 	if c.Table == Nat {
 		c.Prerouting(Delete, "-m", "addrtype", "--dst-type", "LOCAL", "-j", c.Name)
-		c.Output(Delete, "-m", "addrtype", "--dst-type", "LOCAL", "!", "--dst", "127.0.0.0/8", "-j", c.Name)
+		c.Output(Delete, "-m", "addrtype", "--dst-type", "LOCAL", "!", "--dst", c.IPTable.loopback(), "-j", c.Name)
 		c.Output(Delete, "-m", "addrtype", "--dst-type", "LOCAL", "-j", c.Name) // Created in versions <= 0.1.6
 
 		c.Prerouting(Delete)
 		c.Output(Delete)
 	}
-	Raw("-t", string(c.Table), "-F", c.Name)
-	Raw("-t", string(c.Table), "-X", c.Name)
+	c.IPTable.Raw("-t", string(c.Table), "-F", c.Name)
+	c.IPTable.Raw("-t", string(c.Table), "-X", c.Name)
 	return nil
 }
 
-// Exists checks if a rule exists
+// Exists checks if a rule exists in the IPv4 table
 func Exists(table Table, chain string, rule ...string) bool {
+	return GetIptable(Iptables).Exists(table, chain, rule...)
+}
+
+// Exists checks if a rule exists
+func (iptable *IPTable) Exists(table Table, chain string, rule ...string) bool {
 	if string(table) == "" {
 		table = Filter
 	}
@@ -288,7 +355,7 @@ func Exists(table Table, chain string, rule ...string) bool {
 
 	// try -C
 	// if exit status is 0 then return true, the rule exists
-	if _, err := Raw(append([]string{
+	if _, err := iptable.Raw(append([]string{
 		"-t", string(table), "-C", chain}, rule...)...); err == nil {
 		return true
 	}
@@ -296,36 +363,57 @@ func Exists(table Table, chain string, rule ...string) bool {
 	// parse "iptables -S" for the rule (this checks rules in a specific chain
 	// in a specific table)
 	ruleString := strings.Join(rule, " ")
-	existingRules, _ := exec.Command(iptablesPath, "-t", string(table), "-S", chain).Output()
+	existingRules, _ := exec.Command(iptable.path(), "-t", string(table), "-S", chain).Output()
 
 	return strings.Contains(string(existingRules), ruleString)
 }
 
 // Raw calls 'iptables' system command, passing supplied arguments.
 func Raw(args ...string) ([]byte, error) {
+	return GetIptable(Iptables).Raw(args...)
+}
+
+func (iptable *IPTable) path() string {
+	if iptable.isIPv6() {
+		return ip6tablesPath
+	}
+	return iptablesPath
+}
+
+// Raw calls the 'iptables' or 'ip6tables' system command of the
+// address family, passing supplied arguments.
+func (iptable *IPTable) Raw(args ...string) ([]byte, error) {
 	if firewalldRunning {
-		output, err := Passthrough(Iptables, args...)
+		output, err := Passthrough(iptable.version(), args...)
 		if err == nil || !strings.Contains(err.Error(), "was not provided by any .service files") {
 			return output, err
 		}
 
 	}
 
-	if err := initCheck(); err != nil {
+	xlock := supportsXlock
+	if iptable.isIPv6() {
+		if err := initCheck6(); err != nil {
+			return nil, err
+		}
+		xlock = supportsXlock6
+	} else if err := initCheck(); err != nil {
 		return nil, err
 	}
-	if supportsXlock {
+	if xlock {
 		args = append([]string{"--wait"}, args...)
 	} else {
 		bestEffortLock.Lock()
 		defer bestEffortLock.Unlock()
 	}
 
-	logrus.Debugf("%s, %v", iptablesPath, args)
+	path, command := iptable.path(), iptable.command()
+
+	logrus.Debugf("%s, %v", path, args)
 
-	output, err := exec.Command(iptablesPath, args...).CombinedOutput()
+	output, err := exec.Command(path, args...).CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("iptables failed: iptables %v: %s (%s)", strings.Join(args, " "), output, err)
+		return nil, fmt.Errorf("%s failed: %s %v: %s (%s)", command, command, strings.Join(args, " "), output, err)
 	}
 
 	// ignore iptables' message about xtables lock
@@ -234,3 +234,16 @@ func TestCleanup(t *testing.T) {
 		t.Fatalf("Removing chain failed. %s found in iptables-save", chainName)
 	}
 }
+
+func TestIPTableVersion(t *testing.T) {
+	iptable := GetIptable(IP6Tables)
+	if iptable.command() != "ip6tables" || iptable.loopback() != "::1/128" {
+		t.Fatalf("Unexpected IPv6 table command %s and loopback %s", iptable.command(), iptable.loopback())
+	}
+
+	// The chains created before the address family was introduced are IPv4
+	c := &ChainInfo{Name: chainName}
+	if c.IPTable.version() != Iptables || c.IPTable.command() != "iptables" {
+		t.Fatalf("Unexpected default table version %s", c.IPTable.version())
+	}
+}
@@ -0,0 +1,228 @@
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	iptablesRestorePath  string
+	ip6tablesRestorePath string
+)
+
+// Transaction accumulates the rule changes of an address family, which
+// Commit applies at once through iptables-restore.
+type Transaction struct {
+	iptable *IPTable
+	changes []ruleChange
+}
+
+// ruleChange is an action applied to a rule of a chain.
+type ruleChange struct {
+	table  Table
+	action Action
+	chain  string
+	args   []string
+}
+
+// Begin starts a transaction on the IPv4 table.
+func Begin() *Transaction {
+	return GetIptable(Iptables).Begin()
+}
+
+// Begin starts a transaction on the table of the address family.
+func (iptable *IPTable) Begin() *Transaction {
+	return &Transaction{iptable: &IPTable{Version: iptable.version()}}
+}
+
+// Append adds the appending of the rule to the chain to the transaction.
+func (t *Transaction) Append(table Table, chain string, args ...string) *Transaction {
+	return t.Add(table, Append, chain, args...)
+}
+
+// Insert adds the insertion of the rule at the top of the chain to the transaction.
+func (t *Transaction) Insert(table Table, chain string, args ...string) *Transaction {
+	return t.Add(table, Insert, chain, args...)
+}
+
+// Delete adds the deletion of the rule from the chain to the transaction.
+func (t *Transaction) Delete(table Table, chain string, args ...string) *Transaction {
+	return t.Add(table, Delete, chain, args...)
+}
+
+// Add adds the action on the rule of the chain to the transaction.
+func (t *Transaction) Add(table Table, action Action, chain string, args ...string) *Transaction {
+	if string(table) == "" {
+		table = Filter
+	}
+	t.changes = append(t.changes, ruleChange{
+		table:  table,
+		action: action,
+		chain:  chain,
+		args:   append([]string{}, args...),
+	})
+	return t
+}
+
+// Len returns the number of changes in the transaction.
+func (t *Transaction) Len() int {
+	return len(t.changes)
+}
+
+// Commit applies the changes with iptables-restore, without flushing the
+// tables. Each table is updated atomically; should a table fail, the changes
+// already committed to the other tables are reverted, so that none of the
+// changes is left in place. When iptables-restore is not available or
+// firewalld manages the tables, the changes are applied one by one and
+// reverted the same way on failure.
+func (t *Transaction) Commit() error {
+	changes := t.changes
+	t.changes = nil
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if firewalldRunning || t.iptable.initRestore() != nil {
+		return t.iptable.applyEach(changes)
+	}
+
+	var done []ruleChange
+	for _, table := range tablesOf(changes) {
+		tableChanges := changesOf(changes, table)
+		if err := t.iptable.restore(renderRestore(table, tableChanges)); err != nil {
+			t.iptable.revert(done)
+			return err
+		}
+		done = append(done, tableChanges...)
+	}
+
+	return nil
+}
+
+// applyEach applies the changes one by one, reverting the applied ones
+// on failure.
+func (iptable *IPTable) applyEach(changes []ruleChange) error {
+	for i, c := range changes {
+		a := append([]string{"-t", string(c.table), string(c.action), c.chain}, c.args...)
+		output, err := iptable.Raw(a...)
+		if err == nil && len(output) != 0 {
+			err = ChainError{Chain: c.chain, Output: output}
+		}
+		if err != nil {
+			iptable.revert(changes[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// revert undoes the applied changes, in the reverse order. The deleted
+// rules are appended back to their chain, the flushed ones are lost.
+func (iptable *IPTable) revert(applied []ruleChange) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		c := applied[i]
+		if c.action == Flush {
+			logrus.Warnf("Cannot revert the flush of chain %s/%s", c.table, c.chain)
+			continue
+		}
+		undo := Delete
+		if c.action == Delete {
+			undo = Append
+		}
+		a := append([]string{"-t", string(c.table), string(undo), c.chain}, c.args...)
+		if output, err := iptable.Raw(a...); err != nil || len(output) != 0 {
+			logrus.Warnf("Failed to revert %s rule %s in chain %s/%s: %v %s",
+				iptable.command(), strings.Join(c.args, " "), c.table, c.chain, err, output)
+		}
+	}
+}
+
+// tablesOf returns the tables the changes apply to, in order of appearance.
+func tablesOf(changes []ruleChange) []Table {
+	var tables []Table
+	seen := make(map[Table]bool)
+	for _, c := range changes {
+		if !seen[c.table] {
+			seen[c.table] = true
+			tables = append(tables, c.table)
+		}
+	}
+	return tables
+}
+
+func changesOf(changes []ruleChange, table Table) []ruleChange {
+	var tc []ruleChange
+	for _, c := range changes {
+		if c.table == table {
+			tc = append(tc, c)
+		}
+	}
+	return tc
+}
+
+// renderRestore returns the changes of the table in the iptables-restore format.
+func renderRestore(table Table, changes []ruleChange) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%s\n", table)
+	for _, c := range changes {
+		b.WriteString(string(c.action) + " " + c.chain)
+		for _, a := range c.args {
+			b.WriteString(" " + quoteRestoreArg(a))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("COMMIT\n")
+	return b.String()
+}
+
+// quoteRestoreArg quotes the arguments iptables-restore would otherwise split.
+func quoteRestoreArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'") {
+		return arg
+	}
+	return `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+}
+
+func (iptable *IPTable) restoreCommand() string {
+	return iptable.command() + "-restore"
+}
+
+func (iptable *IPTable) initRestore() error {
+	p := &iptablesRestorePath
+	if iptable.isIPv6() {
+		p = &ip6tablesRestorePath
+	}
+	if *p == "" {
+		path, err := exec.LookPath(iptable.restoreCommand())
+		if err != nil {
+			return fmt.Errorf("%s not found", iptable.restoreCommand())
+		}
+		*p = path
+	}
+	return nil
+}
+
+// restore applies the rules with iptables-restore, keeping the existing ones.
+func (iptable *IPTable) restore(rules string) error {
+	path := iptablesRestorePath
+	if iptable.isIPv6() {
+		path = ip6tablesRestorePath
+	}
+
+	// iptables-restore does not take the xtables lock
+	bestEffortLock.Lock()
+	defer bestEffortLock.Unlock()
+
+	logrus.Debugf("%s --noflush\n%s", path, rules)
+
+	cmd := exec.Command(path, "--noflush")
+	cmd.Stdin = strings.NewReader(rules)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s (%s)", iptable.restoreCommand(), bytes.TrimSpace(output), err)
+	}
+	return nil
+}
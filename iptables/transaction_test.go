@@ -0,0 +1,92 @@
+package iptables
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderRestore(t *testing.T) {
+	tx := Begin().
+		Append(Nat, "DOCKER", "-p", "tcp", "-d", "0/0", "--dport", "80", "-j", "DNAT", "--to-destination", "172.17.0.2:80").
+		Delete(Filter, "DOCKER", "-o", "docker0", "-j", "ACCEPT").
+		Insert(Nat, "POSTROUTING", "-m", "comment", "--comment", "a \"quoted\" comment", "-j", "MASQUERADE").
+		Add(Filter, Flush, "DOCKER-POLICY-n1")
+
+	if tx.Len() != 4 {
+		t.Fatalf("Expected 4 changes, got %d", tx.Len())
+	}
+	tables := tablesOf(tx.changes)
+	if len(tables) != 2 || tables[0] != Nat || tables[1] != Filter {
+		t.Fatalf("Unexpected tables %v", tables)
+	}
+
+	expected := "*nat\n" +
+		"-A DOCKER -p tcp -d 0/0 --dport 80 -j DNAT --to-destination 172.17.0.2:80\n" +
+		"-I POSTROUTING -m comment --comment \"a \\\"quoted\\\" comment\" -j MASQUERADE\n" +
+		"COMMIT\n"
+	if out := renderRestore(Nat, changesOf(tx.changes, Nat)); out != expected {
+		t.Fatalf("Unexpected nat rules.\nExpected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	expected = "*filter\n" +
+		"-D DOCKER -o docker0 -j ACCEPT\n" +
+		"-F DOCKER-POLICY-n1\n" +
+		"COMMIT\n"
+	if out := renderRestore(Filter, changesOf(tx.changes, Filter)); out != expected {
+		t.Fatalf("Unexpected filter rules.\nExpected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+// TestCommitRollback commits through stubs of the iptables commands, the
+// restore of the filter table failing.
+func TestCommitRollback(t *testing.T) {
+	if firewalldRunning {
+		t.Skip("firewalld manages the tables")
+	}
+
+	dir, err := ioutil.TempDir("", "iptables-stub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "log")
+	stubs := map[string]string{
+		"iptables":         "#!/bin/sh\necho \"$@\" >> " + log + "\n",
+		"iptables-restore": "#!/bin/sh\nin=$(cat)\necho \"$in\" >> " + log + "\ncase \"$in\" in *filter*) echo stub failure; exit 1;; esac\n",
+	}
+	for name, script := range stubs {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(path, restorePath string, xlock bool) {
+		iptablesPath, iptablesRestorePath, supportsXlock = path, restorePath, xlock
+	}(iptablesPath, iptablesRestorePath, supportsXlock)
+	iptablesPath = filepath.Join(dir, "iptables")
+	iptablesRestorePath = filepath.Join(dir, "iptables-restore")
+	supportsXlock = false
+
+	err = Begin().
+		Append(Nat, "DOCKER", "-j", "DNAT", "--to-destination", "172.17.0.2:80").
+		Append(Filter, "DOCKER", "-j", "ACCEPT").
+		Commit()
+	if err == nil || !strings.Contains(err.Error(), "stub failure") {
+		t.Fatalf("Expected the restore failure, got %v", err)
+	}
+
+	out, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "-t nat -D DOCKER -j DNAT --to-destination 172.17.0.2:80") {
+		t.Fatalf("The committed nat rule was not reverted:\n%s", out)
+	}
+	if strings.Contains(string(out), "-t filter") {
+		t.Fatalf("Unexpected revert of the failed filter table:\n%s", out)
+	}
+}
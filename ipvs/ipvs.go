@@ -0,0 +1,188 @@
+// Package ipvs programs the IP Virtual Server tables of the kernel through
+// the ipvsadm tool. The calls act on the network namespace of the invoking
+// thread, so they can be run inside a sandbox via its InvokeFunc.
+package ipvs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	// RoundRobin distributes the connections equally across the destinations.
+	RoundRobin = "rr"
+	// WeightedRoundRobin distributes the connections according to the destination weights.
+	WeightedRoundRobin = "wrr"
+	// LeastConnection sends the connections to the destination with the fewest active ones.
+	LeastConnection = "lc"
+	// WeightedLeastConnection is the least connection scheduler accounting for the weights.
+	WeightedLeastConnection = "wlc"
+	// SourceHashing picks the destination by hashing the client address.
+	SourceHashing = "sh"
+	// DestinationHashing picks the destination by hashing the virtual address.
+	DestinationHashing = "dh"
+)
+
+var (
+	ipvsadmPath string
+	// ErrIpvsadmNotFound is returned when the ipvsadm tool is not available.
+	ErrIpvsadmNotFound = errors.New("ipvsadm not found")
+)
+
+// Service defines an IPVS virtual server.
+type Service struct {
+	Address   net.IP
+	Protocol  types.Protocol
+	Port      uint16
+	SchedName string
+}
+
+// Destination defines a real server of an IPVS virtual server.
+type Destination struct {
+	Address net.IP
+	Port    uint16
+	Weight  int
+}
+
+// Error is returned to represent errors during ipvs table operations.
+type Error struct {
+	Service string
+	Output  []byte
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("Error ipvs %s: %s", e.Service, strings.TrimSpace(string(e.Output)))
+}
+
+func initCheck() error {
+	if ipvsadmPath == "" {
+		path, err := exec.LookPath("ipvsadm")
+		if err != nil {
+			return ErrIpvsadmNotFound
+		}
+		ipvsadmPath = path
+	}
+	return nil
+}
+
+// Supported returns whether virtual servers can be programmed on this host.
+func Supported() bool {
+	if err := initCheck(); err != nil {
+		return false
+	}
+	_, err := Raw("-L", "-n")
+	return err == nil
+}
+
+func (s *Service) String() string {
+	return net.JoinHostPort(s.Address.String(), strconv.Itoa(int(s.Port)))
+}
+
+func (s *Service) args() ([]string, error) {
+	switch s.Protocol {
+	case types.TCP:
+		return []string{"-t", s.String()}, nil
+	case types.UDP:
+		return []string{"-u", s.String()}, nil
+	}
+	return nil, types.BadRequestErrorf("protocol %s is not supported by ipvs", s.Protocol)
+}
+
+func (d *Destination) args() []string {
+	return []string{"-r", net.JoinHostPort(d.Address.String(), strconv.Itoa(int(d.Port))), "-m", "-w", strconv.Itoa(d.Weight)}
+}
+
+// NewService adds the virtual server to the ipvs table.
+func NewService(s *Service) error {
+	args, err := s.args()
+	if err != nil {
+		return err
+	}
+	sched := s.SchedName
+	if sched == "" {
+		sched = RoundRobin
+	}
+	return s.run(append(append([]string{"-A"}, args...), "-s", sched)...)
+}
+
+// DelService removes the virtual server and its destinations from the ipvs table.
+func DelService(s *Service) error {
+	args, err := s.args()
+	if err != nil {
+		return err
+	}
+	return s.run(append([]string{"-D"}, args...)...)
+}
+
+// NewDestination adds the real server to the virtual server using masquerading.
+func NewDestination(s *Service, d *Destination) error {
+	return s.destination("-a", d)
+}
+
+// UpdateDestination updates the weight of the real server of the virtual server.
+func UpdateDestination(s *Service, d *Destination) error {
+	return s.destination("-e", d)
+}
+
+// DelDestination removes the real server from the virtual server.
+func DelDestination(s *Service, d *Destination) error {
+	args, err := s.args()
+	if err != nil {
+		return err
+	}
+	return s.run(append(append([]string{"-d"}, args...), d.args()[:2]...)...)
+}
+
+func (s *Service) destination(action string, d *Destination) error {
+	args, err := s.args()
+	if err != nil {
+		return err
+	}
+	return s.run(append(append([]string{action}, args...), d.args()...)...)
+}
+
+func (s *Service) run(args ...string) error {
+	if output, err := Raw(args...); err != nil {
+		if len(output) == 0 {
+			return err
+		}
+		return Error{Service: s.String(), Output: output}
+	}
+	return nil
+}
+
+// Raw calls 'ipvsadm' with the specified arguments. On failure the
+// output of the tool is returned along with the error.
+func Raw(args ...string) ([]byte, error) {
+	if err := initCheck(); err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("%s, %v", ipvsadmPath, args)
+
+	output, err := exec.Command(ipvsadmPath, args...).CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("ipvsadm failed: ipvsadm %v: %s (%s)", strings.Join(args, " "), output, err)
+	}
+	return output, nil
+}
+
+// IsExist returns whether the error reports an already programmed
+// virtual or real server.
+func IsExist(err error) bool {
+	e, ok := err.(Error)
+	return ok && strings.Contains(string(e.Output), "already exists")
+}
+
+// IsNotExist returns whether the error reports a missing virtual or real server.
+func IsNotExist(err error) bool {
+	e, ok := err.(Error)
+	return ok && (strings.Contains(string(e.Output), "No such") || strings.Contains(string(e.Output), "does not exist"))
+}
@@ -0,0 +1,95 @@
+package ipvs
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+)
+
+func TestServiceArgs(t *testing.T) {
+	s := &Service{Address: net.ParseIP("10.0.0.2"), Protocol: types.TCP, Port: 80}
+	args, err := s.args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "-t 10.0.0.2:80" {
+		t.Fatalf("Unexpected tcp service arguments: %v", args)
+	}
+
+	s.Protocol = types.UDP
+	if args, err = s.args(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "-u 10.0.0.2:80" {
+		t.Fatalf("Unexpected udp service arguments: %v", args)
+	}
+
+	s.Protocol = types.ICMP
+	if _, err = s.args(); err == nil {
+		t.Fatalf("Expected failure on icmp service")
+	}
+
+	d := &Destination{Address: net.ParseIP("10.0.0.3"), Port: 8080, Weight: 2}
+	if strings.Join(d.args(), " ") != "-r 10.0.0.3:8080 -m -w 2" {
+		t.Fatalf("Unexpected destination arguments: %v", d.args())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if !IsExist(Error{Output: []byte("Service already exists\n")}) {
+		t.Fatalf("Expected existing service error")
+	}
+	if !IsNotExist(Error{Output: []byte("No such destination\n")}) {
+		t.Fatalf("Expected missing destination error")
+	}
+	if IsExist(ErrIpvsadmNotFound) || IsNotExist(ErrIpvsadmNotFound) {
+		t.Fatalf("Unexpected match on %v", ErrIpvsadmNotFound)
+	}
+}
+
+func TestProgramService(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	if !Supported() {
+		t.Skip("ipvs is not supported on this host")
+	}
+
+	s := &Service{Address: net.ParseIP("10.0.0.2"), Protocol: types.TCP, Port: 80, SchedName: WeightedRoundRobin}
+	d := &Destination{Address: net.ParseIP("10.0.0.3"), Port: 80, Weight: 1}
+
+	if err := NewService(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewService(s); !IsExist(err) {
+		t.Fatalf("Expected existing service error, got %v", err)
+	}
+	if err := NewDestination(s, d); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Weight = 0
+	if err := UpdateDestination(s, d); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Raw("-L", "-n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "10.0.0.3:80") {
+		t.Fatalf("Destination not programmed:\n%s", out)
+	}
+
+	if err := DelDestination(s, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := DelDestination(s, d); !IsNotExist(err) {
+		t.Fatalf("Expected missing destination error, got %v", err)
+	}
+	if err := DelService(s); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,520 @@
+package libnetwork
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/etchosts"
+	"github.com/docker/libnetwork/ipvs"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// HealthCheck configures the probing of the backends of a load balanced
+// service. A backend failing Retries consecutive TCP connections to the
+// first TCP port exposed by the service gets no new connections until it
+// accepts them again.
+type HealthCheck struct {
+	Interval time.Duration `json:"interval"`
+	Timeout  time.Duration `json:"timeout"`
+	Retries  int           `json:"retries"`
+}
+
+// lbConfig is the load balancing configuration of a service endpoint.
+type lbConfig struct {
+	Scheduler   string       `json:"scheduler"`
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+}
+
+// lbService is a service of a network reachable via a virtual IP, which
+// balances the connections across the endpoints sharing the service name.
+// It is programmed as IPVS virtual servers in every local sandbox
+// connected to the network.
+type lbService struct {
+	name   string
+	epID   string
+	vip    net.IP
+	ports  []types.TransportPort
+	config lbConfig
+	health map[string]*backendHealth
+	stopCh chan struct{}
+	sync.Mutex
+}
+
+// backendHealth is the outcome of the last probes of a backend.
+type backendHealth struct {
+	failures int
+	down     bool
+}
+
+// CreateOptionLoadBalancer function returns an option setter for the virtual
+// IP load balancing of the service, to be passed to network.CreateEndpoint()
+// method. A virtual IP is allocated from the network address pools, and the
+// connections to it on the exposed ports are distributed with the passed
+// ipvs scheduler across the endpoints providing the service name. The health
+// check is optional, unset fields take the default values.
+func CreateOptionLoadBalancer(scheduler string, health *HealthCheck) EndpointOption {
+	return func(ep *endpoint) {
+		if scheduler == "" {
+			scheduler = ipvs.RoundRobin
+		}
+		ep.lb = &lbConfig{Scheduler: scheduler}
+		if health == nil {
+			return
+		}
+		hc := *health
+		if hc.Interval <= 0 {
+			hc.Interval = defaultHealthInterval
+		}
+		if hc.Timeout <= 0 {
+			hc.Timeout = defaultHealthTimeout
+		}
+		if hc.Retries <= 0 {
+			hc.Retries = defaultHealthRetries
+		}
+		ep.lb.HealthCheck = &hc
+	}
+}
+
+func newLBService(ep *endpoint) *lbService {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.lb == nil || ep.virtualIP == nil {
+		return nil
+	}
+
+	lb := &lbService{
+		name:   ep.name,
+		epID:   ep.id,
+		vip:    types.GetIPCopy(ep.virtualIP),
+		ports:  make([]types.TransportPort, len(ep.exposedPorts)),
+		config: *ep.lb,
+		health: make(map[string]*backendHealth),
+	}
+	copy(lb.ports, ep.exposedPorts)
+	return lb
+}
+
+// lbServiceFor returns the load balanced service the passed host name
+// refers to, if any.
+func (si *svcInfo) lbServiceFor(name, netName string) *lbService {
+	for _, lb := range si.lbServices {
+		if name == lb.name || name == lb.name+"."+netName {
+			return lb
+		}
+	}
+	return nil
+}
+
+func (lb *lbService) hostNames(netName string) []string {
+	return []string{lb.name, lb.name + "." + netName}
+}
+
+func (lb *lbService) records(netName string) []etchosts.Record {
+	var recs []etchosts.Record
+	for _, h := range lb.hostNames(netName) {
+		recs = append(recs, etchosts.Record{Hosts: h, IP: lb.vip.String()})
+	}
+	return recs
+}
+
+// backendRecords returns the host records of the passed service
+// backends, which the virtual IP record takes the place of.
+func (lb *lbService) backendRecords(netName string, backends []net.IP) []etchosts.Record {
+	var recs []etchosts.Record
+	for _, h := range lb.hostNames(netName) {
+		for _, ip := range backends {
+			recs = append(recs, etchosts.Record{Hosts: h, IP: ip.String()})
+		}
+	}
+	return recs
+}
+
+// addLBService registers the load balanced service published by the passed
+// endpoint, if any, and programs it in the local sandboxes connected to the
+// network. It is a no-op when the service is already registered.
+func (n *network) addLBService(ep *endpoint) {
+	lb := newLBService(ep)
+	if lb == nil {
+		return
+	}
+
+	c := n.getController()
+	n.Lock()
+	si, ok := c.svcDb[n.id]
+	if !ok {
+		si = newSvcInfo()
+		c.svcDb[n.id] = si
+	}
+	if _, ok := si.lbServices[lb.name]; ok {
+		n.Unlock()
+		return
+	}
+	si.lbServices[lb.name] = lb
+	backends := copyIPs(si.svcMap[lb.name])
+	netName := n.name
+	n.Unlock()
+
+	log.Debugf("Load balancing service %s of network %s on %s", lb.name, netName, lb.vip)
+
+	if lb.config.HealthCheck != nil {
+		lb.stopCh = make(chan struct{})
+		go lb.healthLoop(n)
+	}
+
+	for _, sb := range n.lbSandboxes() {
+		sb.deleteHostsEntries(lb.backendRecords(netName, backends))
+		sb.addHostsEntries(lb.records(netName))
+		sb.addLBService(lb, backends)
+	}
+}
+
+// removeLBService unregisters the load balanced service published by the
+// passed endpoint and removes it from the local sandboxes.
+func (n *network) removeLBService(ep *endpoint) {
+	name := ep.Name()
+
+	n.Lock()
+	si, ok := n.ctrlr.svcDb[n.id]
+	if !ok {
+		n.Unlock()
+		return
+	}
+	lb, ok := si.lbServices[name]
+	if !ok || lb.epID != ep.ID() {
+		n.Unlock()
+		return
+	}
+	delete(si.lbServices, name)
+	backends := copyIPs(si.svcMap[lb.name])
+	netName := n.name
+	n.Unlock()
+
+	if lb.stopCh != nil {
+		close(lb.stopCh)
+	}
+
+	for _, sb := range n.lbSandboxes() {
+		sb.rmLBService(lb)
+		sb.deleteHostsEntries(lb.records(netName))
+		sb.addHostsEntries(lb.backendRecords(netName, backends))
+	}
+}
+
+// updateLBBackend adds or removes the passed endpoint as a backend of the
+// load balanced services it provides by name or alias.
+func (n *network) updateLBBackend(ep *endpoint, isAdd bool) {
+	iface := ep.Iface()
+	if iface == nil || iface.Address() == nil {
+		return
+	}
+	ip := iface.Address().IP
+
+	var lbs []*lbService
+	n.Lock()
+	if si, ok := n.ctrlr.svcDb[n.id]; ok {
+		for _, name := range append([]string{ep.Name()}, ep.getAliases()...) {
+			if lb, ok := si.lbServices[name]; ok {
+				lbs = append(lbs, lb)
+			}
+		}
+	}
+	n.Unlock()
+
+	if len(lbs) == 0 {
+		return
+	}
+
+	sbs := n.lbSandboxes()
+	for _, lb := range lbs {
+		if !isAdd {
+			lb.Lock()
+			delete(lb.health, ip.String())
+			lb.Unlock()
+		}
+		for _, sb := range sbs {
+			if isAdd {
+				sb.addLBBackend(lb, ip)
+			} else {
+				sb.rmLBBackend(lb, ip)
+			}
+		}
+	}
+}
+
+// lbBackends returns the addresses of the endpoints providing the service.
+func (n *network) lbBackends(lb *lbService) []net.IP {
+	n.Lock()
+	defer n.Unlock()
+
+	si, ok := n.ctrlr.svcDb[n.id]
+	if !ok {
+		return nil
+	}
+	return copyIPs(si.svcMap[lb.name])
+}
+
+// lbSandboxes returns the local sandboxes connected to the network, in which
+// the load balanced services of the network are programmed.
+func (n *network) lbSandboxes() []*sandbox {
+	c := n.getController()
+	nid := n.ID()
+
+	c.Lock()
+	sbs := make([]*sandbox, 0, len(c.sandboxes))
+	for _, sb := range c.sandboxes {
+		sbs = append(sbs, sb)
+	}
+	c.Unlock()
+
+	var list []*sandbox
+	for _, sb := range sbs {
+		for _, ep := range sb.getConnectedEndpoints() {
+			if ep.getNetwork().ID() == nid {
+				list = append(list, sb)
+				break
+			}
+		}
+	}
+	return list
+}
+
+// addLBServices programs in the sandbox the load balanced services of
+// the network it got connected to.
+func (sb *sandbox) addLBServices(n *network) {
+	type lbBackends struct {
+		lb       *lbService
+		backends []net.IP
+	}
+
+	var lbl []lbBackends
+	n.Lock()
+	if si, ok := n.ctrlr.svcDb[n.id]; ok {
+		for _, lb := range si.lbServices {
+			lbl = append(lbl, lbBackends{lb: lb, backends: copyIPs(si.svcMap[lb.name])})
+		}
+	}
+	n.Unlock()
+
+	for _, l := range lbl {
+		sb.addLBService(l.lb, l.backends)
+	}
+}
+
+// rmLBServices removes from the sandbox the load balanced services of
+// the network it is no longer connected to.
+func (sb *sandbox) rmLBServices(n *network) {
+	for _, ep := range sb.getConnectedEndpoints() {
+		if ep.getNetwork().ID() == n.ID() {
+			return
+		}
+	}
+
+	var lbl []*lbService
+	n.Lock()
+	if si, ok := n.ctrlr.svcDb[n.id]; ok {
+		for _, lb := range si.lbServices {
+			lbl = append(lbl, lb)
+		}
+	}
+	n.Unlock()
+
+	for _, lb := range lbl {
+		sb.rmLBService(lb)
+	}
+}
+
+func (sb *sandbox) addLBService(lb *lbService, backends []net.IP) {
+	sb.programLB(lb, "add virtual server", func(s *ipvs.Service) error {
+		if err := ipvs.NewService(s); err != nil && !ipvs.IsExist(err) {
+			return err
+		}
+		for _, ip := range backends {
+			d := &ipvs.Destination{Address: ip, Port: s.Port, Weight: lb.weight(ip)}
+			if err := ipvs.NewDestination(s, d); err != nil && !ipvs.IsExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (sb *sandbox) rmLBService(lb *lbService) {
+	sb.programLB(lb, "remove virtual server", func(s *ipvs.Service) error {
+		if err := ipvs.DelService(s); err != nil && !ipvs.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (sb *sandbox) addLBBackend(lb *lbService, ip net.IP) {
+	sb.programLB(lb, "add real server "+ip.String(), func(s *ipvs.Service) error {
+		d := &ipvs.Destination{Address: ip, Port: s.Port, Weight: lb.weight(ip)}
+		if err := ipvs.NewDestination(s, d); err != nil && !ipvs.IsExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (sb *sandbox) rmLBBackend(lb *lbService, ip net.IP) {
+	sb.programLB(lb, "remove real server "+ip.String(), func(s *ipvs.Service) error {
+		d := &ipvs.Destination{Address: ip, Port: s.Port}
+		if err := ipvs.DelDestination(s, d); err != nil && !ipvs.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (sb *sandbox) setLBBackendWeight(lb *lbService, ip net.IP, weight int) {
+	sb.programLB(lb, "update real server "+ip.String(), func(s *ipvs.Service) error {
+		return ipvs.UpdateDestination(s, &ipvs.Destination{Address: ip, Port: s.Port, Weight: weight})
+	})
+}
+
+// programLB invokes the passed function in the sandbox network namespace
+// for each virtual server of the service, one per exposed port.
+func (sb *sandbox) programLB(lb *lbService, op string, f func(s *ipvs.Service) error) {
+	for _, p := range lb.ports {
+		s := &ipvs.Service{
+			Address:   lb.vip,
+			Protocol:  p.Proto,
+			Port:      p.Port,
+			SchedName: lb.config.Scheduler,
+		}
+		var err error
+		if e := sb.execFunc(func() { err = f(s) }); e != nil {
+			err = e
+		}
+		if err != nil {
+			log.Warnf("Failed to %s for service %s (%s/%s) in sandbox %s: %v", op, lb.name, s, p.Proto, sb.ID(), err)
+		}
+	}
+}
+
+// weight returns the ipvs weight of the backend, zero while it
+// fails its health checks.
+func (lb *lbService) weight(ip net.IP) int {
+	lb.Lock()
+	defer lb.Unlock()
+
+	if h, ok := lb.health[ip.String()]; ok && h.down {
+		return 0
+	}
+	return 1
+}
+
+// report records the outcome of a probe of the backend and returns
+// whether it changed the backend state, along with the new state.
+func (lb *lbService) report(ip net.IP, ok bool) (bool, bool) {
+	lb.Lock()
+	defer lb.Unlock()
+
+	h, found := lb.health[ip.String()]
+	if !found {
+		h = &backendHealth{}
+		lb.health[ip.String()] = h
+	}
+
+	if ok {
+		h.failures = 0
+		if h.down {
+			h.down = false
+			return true, true
+		}
+		return false, true
+	}
+
+	h.failures++
+	if !h.down && h.failures >= lb.config.HealthCheck.Retries {
+		h.down = true
+		return true, false
+	}
+	return false, !h.down
+}
+
+// healthLoop periodically probes the service backends until
+// the service is unregistered.
+func (lb *lbService) healthLoop(n *network) {
+	var port uint16
+	for _, p := range lb.ports {
+		if p.Proto == types.TCP {
+			port = p.Port
+			break
+		}
+	}
+	if port == 0 {
+		log.Warnf("Health check of service %s requires an exposed TCP port", lb.name)
+		return
+	}
+
+	ticker := time.NewTicker(lb.config.HealthCheck.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lb.stopCh:
+			return
+		case <-ticker.C:
+			lb.probe(n, port)
+		}
+	}
+}
+
+// probe connects to each backend from a sandbox connected to the network
+// and updates the weight of the backends whose state changed.
+func (lb *lbService) probe(n *network, port uint16) {
+	sbs := n.lbSandboxes()
+	if len(sbs) == 0 {
+		return
+	}
+
+	for _, ip := range n.lbBackends(lb) {
+		var err error
+		addr := net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+		execErr := sbs[0].execFunc(func() {
+			var conn net.Conn
+			if conn, err = net.DialTimeout("tcp", addr, lb.config.HealthCheck.Timeout); err == nil {
+				conn.Close()
+			}
+		})
+		if execErr != nil {
+			log.Debugf("Could not probe backend %s of service %s: %v", addr, lb.name, execErr)
+			continue
+		}
+
+		changed, healthy := lb.report(ip, err == nil)
+		if !changed {
+			continue
+		}
+
+		weight := 0
+		if healthy {
+			weight = 1
+			log.Infof("Backend %s of service %s is healthy", addr, lb.name)
+		} else {
+			log.Warnf("Backend %s of service %s is unhealthy: %v", addr, lb.name, err)
+		}
+		for _, sb := range sbs {
+			sb.setLBBackendWeight(lb, ip, weight)
+		}
+	}
+}
+
+func copyIPs(ips []net.IP) []net.IP {
+	cp := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		cp = append(cp, types.GetIPCopy(ip))
+	}
+	return cp
+}
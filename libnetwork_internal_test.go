@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/docker/libnetwork/config"
+	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/types"
 )
 
@@ -40,7 +46,18 @@ func TestNetworkMarshalling(t *testing.T) {
 		networkType: "bridge",
 		endpointCnt: 27,
 		enableIPv6:  true,
+		internal:    true,
 		persist:     true,
+		policy: []types.PolicyRule{{
+			Action: types.PolicyAllow,
+			Source: types.EndpointSelector{Labels: []string{"tier=front"}},
+			Proto:  types.TCP,
+			Port:   80,
+		}},
+		labels: map[string]string{
+			"tenant":  "blue",
+			"project": "viola",
+		},
 		ipamV4Config: []*IpamConf{
 			&IpamConf{
 				PreferredPool: "10.2.0.0/16",
@@ -142,9 +159,10 @@ func TestNetworkMarshalling(t *testing.T) {
 
 	if n.name != nn.name || n.id != nn.id || n.networkType != nn.networkType || n.ipamType != nn.ipamType ||
 		n.addrSpace != nn.addrSpace || n.endpointCnt != nn.endpointCnt || n.enableIPv6 != nn.enableIPv6 ||
-		n.persist != nn.persist || !compareIpamConfList(n.ipamV4Config, nn.ipamV4Config) ||
+		n.internal != nn.internal || n.persist != nn.persist || !compareStringMaps(n.labels, nn.labels) || !compareIpamConfList(n.ipamV4Config, nn.ipamV4Config) ||
 		!compareIpamInfoList(n.ipamV4Info, nn.ipamV4Info) || !compareIpamConfList(n.ipamV6Config, nn.ipamV6Config) ||
-		!compareIpamInfoList(n.ipamV6Info, nn.ipamV6Info) {
+		!compareIpamInfoList(n.ipamV6Info, nn.ipamV6Info) || len(nn.policy) != 1 || nn.policy[0].Port != 80 ||
+		nn.policy[0].Source.Labels[0] != "tier=front" {
 		t.Fatalf("JSON marsh/unmarsh failed."+
 			"\nOriginal:\n%#v\nDecoded:\n%#v"+
 			"\nOriginal ipamV4Conf: %#v\n\nDecoded ipamV4Conf: %#v"+
@@ -187,13 +205,25 @@ func TestEndpointMarshalling(t *testing.T) {
 		name:      "Bau",
 		id:        "efghijklmno",
 		sandboxID: "ambarabaciccicocco",
+		labels:    map[string]string{"role": "db"},
+		aliases:   []string{"db", "primary-db"},
+		lb: &lbConfig{
+			Scheduler:   "wrr",
+			HealthCheck: &HealthCheck{Interval: time.Second, Timeout: time.Second, Retries: 2},
+		},
+		virtualIP: net.IP{10, 0, 1, 2},
+		vipPoolID: "poolpool",
 		iface: &endpointInterface{
 			mac: []byte{11, 12, 13, 14, 15, 16},
 			addr: &net.IPNet{
 				IP:   net.IP{10, 0, 1, 23},
 				Mask: net.IPMask{255, 255, 255, 0},
 			},
-			addrv6:    nw6,
+			addrv6: nw6,
+			addrs: []*ifaceAddress{
+				{addr: &net.IPNet{IP: net.IP{10, 0, 1, 24}, Mask: net.IPMask{255, 255, 255, 0}}, poolID: "poolpool"},
+				{addr: &net.IPNet{IP: net.ParseIP("2001:3002:4003::123"), Mask: nw6.Mask}, poolID: "poolpool6"},
+			},
 			srcName:   "veth12ab1314",
 			dstPrefix: "eth",
 			poolID:    "poolpool",
@@ -211,11 +241,498 @@ func TestEndpointMarshalling(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if e.name != ee.name || e.id != ee.id || e.sandboxID != ee.sandboxID || !compareEndpointInterface(e.iface, ee.iface) {
+	if e.name != ee.name || e.id != ee.id || e.sandboxID != ee.sandboxID ||
+		!compareStringMaps(e.labels, ee.labels) || !sameAliases(e.aliases, ee.aliases) ||
+		!e.virtualIP.Equal(ee.virtualIP) || e.vipPoolID != ee.vipPoolID ||
+		ee.lb == nil || e.lb.Scheduler != ee.lb.Scheduler || ee.lb.HealthCheck == nil ||
+		*e.lb.HealthCheck != *ee.lb.HealthCheck ||
+		!compareEndpointInterface(e.iface, ee.iface) {
 		t.Fatalf("JSON marsh/unmarsh failed.\nOriginal:\n%#v\nDecoded:\n%#v\nOriginal iface: %#v\nDecodediface:\n%#v", e, ee, e.iface, ee.iface)
 	}
 }
 
+type fakeDriver struct{}
+
+func (f *fakeDriver) CreateNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	return nil
+}
+
+func (f *fakeDriver) DeleteNetwork(nid string) error {
+	return nil
+}
+
+func (f *fakeDriver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, options map[string]interface{}) error {
+	return nil
+}
+
+func (f *fakeDriver) DeleteEndpoint(nid, eid string) error {
+	return nil
+}
+
+func (f *fakeDriver) EndpointOperInfo(nid, eid string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (f *fakeDriver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	return nil
+}
+
+func (f *fakeDriver) Leave(nid, eid string) error {
+	return nil
+}
+
+func (f *fakeDriver) DiscoverNew(dType driverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
+
+func (f *fakeDriver) DiscoverDelete(dType driverapi.DiscoveryType, data interface{}) error {
+	return nil
+}
+
+func (f *fakeDriver) Type() string {
+	return "fakedriver"
+}
+
+func TestSecondaryAddresses(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	if err := c.(*controller).RegisterDriver("fakedriver", &fakeDriver{}, driverapi.Capability{DataScope: datastore.LocalScope}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.NewNetwork("fakedriver", "testnet",
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{{PreferredPool: "192.168.100.0/24"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ep, err := n.CreateEndpoint("ep1", CreateOptionSecondaryAddresses([]net.IP{
+		net.ParseIP("192.168.100.50"), net.IPv4zero}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := ep.Info().Iface().Addresses()
+	if len(addrs) != 2 {
+		t.Fatalf("Expected 2 secondary addresses, got %v", addrs)
+	}
+	if !addrs[0].IP.Equal(net.ParseIP("192.168.100.50")) {
+		t.Fatalf("Unexpected requested secondary address: %s", addrs[0])
+	}
+	if addrs[1].IP.To4() == nil || addrs[1].IP.Equal(ep.Info().Iface().Address().IP) {
+		t.Fatalf("Unexpected secondary IPv4 address: %s", addrs[1])
+	}
+
+	// The requested address is in use, the allocation must fail
+	if _, err := n.CreateEndpoint("ep2", CreateOptionSecondaryAddresses([]net.IP{net.ParseIP("192.168.100.50")})); err == nil {
+		t.Fatalf("Expected failure on duplicate secondary address")
+	}
+
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once released the address can be allocated again
+	ep, err = n.CreateEndpoint("ep2", CreateOptionSecondaryAddresses([]net.IP{net.ParseIP("192.168.100.50")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bridge networks do not allocate their addresses through IPAM
+	bn, err := c.NewNetwork("bridge", "testbr", NetworkOptionGeneric(map[string]interface{}{
+		netlabel.GenericData: options.Generic{"BridgeName": "testbr"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bn.Delete()
+
+	if _, err := bn.CreateEndpoint("ep1", CreateOptionSecondaryAddresses([]net.IP{net.IPv4zero})); err == nil {
+		t.Fatalf("Expected failure on secondary addresses on bridge network")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+}
+
+func TestLoadBalancedService(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	if err := c.(*controller).RegisterDriver("fakedriver", &fakeDriver{}, driverapi.Capability{DataScope: datastore.LocalScope}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.NewNetwork("fakedriver", "testnet",
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{{PreferredPool: "192.168.100.0/24"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if _, err := n.CreateEndpoint("web", CreateOptionLoadBalancer("", nil)); err == nil {
+		t.Fatalf("Expected failure on load balanced service without exposed ports")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	ports := []types.TransportPort{{Proto: types.TCP, Port: 80}}
+	ep, err := n.CreateEndpoint("web", CreateOptionExposedPorts(ports),
+		CreateOptionLoadBalancer("wlc", &HealthCheck{Retries: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vip := ep.Info().VirtualIP()
+	if vip == nil || vip.Equal(ep.Info().Iface().Address().IP) {
+		t.Fatalf("Unexpected virtual ip %v for service address %s", vip, ep.Info().Iface().Address())
+	}
+	if !n.(*network).getIPInfo()[0].Pool.Contains(vip) {
+		t.Fatalf("Virtual ip %s was not allocated from the network pool", vip)
+	}
+
+	lep := ep.(*endpoint)
+	if lep.lb.Scheduler != "wlc" || lep.lb.HealthCheck.Retries != 2 ||
+		lep.lb.HealthCheck.Interval != defaultHealthInterval || lep.lb.HealthCheck.Timeout != defaultHealthTimeout {
+		t.Fatalf("Unexpected load balancer configuration: %v, %v", lep.lb, lep.lb.HealthCheck)
+	}
+
+	getLBService := func(name string) *lbService {
+		nw := n.(*network)
+		nw.Lock()
+		defer nw.Unlock()
+		return c.(*controller).svcDb[nw.id].lbServiceFor(name, "testnet")
+	}
+
+	lb := getLBService("web.testnet")
+	if lb == nil || !lb.vip.Equal(vip) {
+		t.Fatalf("Load balanced service not registered with virtual ip %s: %v", vip, lb)
+	}
+
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lb := getLBService("web"); lb != nil {
+		t.Fatalf("Load balanced service still registered after delete")
+	}
+
+	// Once released the virtual ip can be allocated again
+	ep, err = n.CreateEndpoint("other", CreateOptionSecondaryAddresses([]net.IP{vip}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	bn, err := c.NewNetwork("bridge", "testbr", NetworkOptionGeneric(map[string]interface{}{
+		netlabel.GenericData: options.Generic{"BridgeName": "testbr"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bn.Delete()
+
+	if _, err := bn.CreateEndpoint("web", CreateOptionExposedPorts(ports), CreateOptionLoadBalancer("", nil)); err == nil {
+		t.Fatalf("Expected failure on load balanced service on bridge network")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+}
+
+func TestLoadBalancerHealthReport(t *testing.T) {
+	lb := &lbService{
+		config: lbConfig{HealthCheck: &HealthCheck{Retries: 2}},
+		health: make(map[string]*backendHealth),
+	}
+	ip := net.ParseIP("192.168.100.10")
+
+	for i, tc := range []struct {
+		ok      bool
+		changed bool
+		healthy bool
+		weight  int
+	}{
+		{ok: true, changed: false, healthy: true, weight: 1},
+		{ok: false, changed: false, healthy: true, weight: 1},
+		{ok: false, changed: true, healthy: false, weight: 0},
+		{ok: false, changed: false, healthy: false, weight: 0},
+		{ok: true, changed: true, healthy: true, weight: 1},
+	} {
+		changed, healthy := lb.report(ip, tc.ok)
+		if changed != tc.changed || healthy != tc.healthy {
+			t.Fatalf("Probe %d: expected changed %t healthy %t, got %t %t", i, tc.changed, tc.healthy, changed, healthy)
+		}
+		if w := lb.weight(ip); w != tc.weight {
+			t.Fatalf("Probe %d: expected weight %d, got %d", i, tc.weight, w)
+		}
+	}
+}
+
+type fakePolicyDriver struct {
+	fakeDriver
+	sync.Mutex
+	rules []driverapi.PolicyRule
+	calls int
+}
+
+func (f *fakePolicyDriver) ProgramPolicy(nid string, rules []driverapi.PolicyRule) error {
+	f.Lock()
+	defer f.Unlock()
+	f.rules = rules
+	f.calls++
+	return nil
+}
+
+func (f *fakePolicyDriver) programmed() ([]driverapi.PolicyRule, int) {
+	f.Lock()
+	defer f.Unlock()
+	return f.rules, f.calls
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	pd := &fakePolicyDriver{}
+	if err := c.(*controller).RegisterDriver("fakepolicy", pd, driverapi.Capability{DataScope: datastore.LocalScope}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.(*controller).RegisterDriver("fakedriver", &fakeDriver{}, driverapi.Capability{DataScope: datastore.LocalScope}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []types.PolicyRule{
+		{
+			Action:      types.PolicyAllow,
+			Source:      types.EndpointSelector{Labels: []string{"tier=front"}},
+			Destination: types.EndpointSelector{Names: []string{"db"}},
+			Proto:       types.TCP,
+			Port:        5432,
+		},
+		{Action: types.PolicyDeny},
+	}
+
+	if _, err := c.NewNetwork("fakedriver", "nopolicy", NetworkOptionPolicy(rules)); err == nil {
+		t.Fatalf("Expected failure on policy for driver without policy support")
+	} else if _, ok := err.(types.NotImplementedError); !ok {
+		t.Fatalf("Unexpected error type: %T", err)
+	}
+
+	if _, err := c.NewNetwork("fakepolicy", "badpolicy",
+		NetworkOptionPolicy([]types.PolicyRule{{Action: "reject"}})); err == nil {
+		t.Fatalf("Expected failure on invalid policy action")
+	}
+
+	n, err := c.NewNetwork("fakepolicy", "testnet",
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{{PreferredPool: "192.168.100.0/24"}}, nil),
+		NetworkOptionPolicy(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if _, calls := pd.programmed(); calls != 1 {
+		t.Fatalf("Expected the policy to be programmed on network creation, got %d calls", calls)
+	}
+
+	web, err := n.CreateEndpoint("web", CreateOptionLabels(map[string]string{"tier": "front"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := n.CreateEndpoint("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drules, _ := pd.programmed()
+	if len(drules) != 2 {
+		t.Fatalf("Expected 2 driver policy rules, got %v", drules)
+	}
+	if !drules[0].Allow || drules[0].Proto != types.TCP || drules[0].Port != 5432 ||
+		len(drules[0].Sources) != 1 || drules[0].Sources[0] != web.ID() ||
+		len(drules[0].Destinations) != 1 || drules[0].Destinations[0] != db.ID() {
+		t.Fatalf("Unexpected allow rule: %v", drules[0])
+	}
+	if drules[1].Allow || len(drules[1].Sources) != 2 || len(drules[1].Destinations) != 2 {
+		t.Fatalf("Unexpected deny rule: %v", drules[1])
+	}
+
+	if err := db.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if drules, _ = pd.programmed(); len(drules[0].Destinations) != 0 || len(drules[1].Sources) != 1 {
+		t.Fatalf("Deleted endpoint still in the policy: %v", drules)
+	}
+
+	if err := n.UpdatePolicy([]types.PolicyRule{{Action: types.PolicyDeny, Proto: types.ICMP, Port: 1}}); err == nil {
+		t.Fatalf("Expected failure on port without tcp or udp protocol")
+	}
+	if len(n.Policy()) != 2 {
+		t.Fatalf("Policy changed on failed update: %v", n.Policy())
+	}
+
+	if err := n.UpdatePolicy(rules[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if drules, _ = pd.programmed(); len(drules) != 1 {
+		t.Fatalf("Expected 1 driver policy rule after update, got %v", drules)
+	}
+
+	sn, err := c.NetworkByID(n.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := sn.Policy(); len(p) != 1 || p[0].Destination.Names[0] != "db" {
+		t.Fatalf("Unexpected stored policy: %v", p)
+	}
+
+	if err := n.UpdatePolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	if drules, _ = pd.programmed(); len(drules) != 0 {
+		t.Fatalf("Expected empty driver policy after update, got %v", drules)
+	}
+
+	if err := web.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type fakeReconcilerDriver struct {
+	fakeDriver
+}
+
+func (f *fakeReconcilerDriver) Reconcile() ([]driverapi.Drift, error) {
+	return []driverapi.Drift{{Kind: driverapi.DriftMissing, NetworkID: "nid", Object: "rule"}}, fmt.Errorf("partial failure")
+}
+
+func TestReconcileDrivers(t *testing.T) {
+	c, err := New(config.OptionReconcileInterval(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	if err := c.(*controller).RegisterDriver("fakereconciler", &fakeReconcilerDriver{}, driverapi.Capability{DataScope: datastore.LocalScope}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := c.Subscribe(EventTypeFilter(EventStateDrift))
+	defer cancel()
+
+	c.(*controller).reconcile()
+
+	report := c.Drift()
+	if len(report.Drift) != 1 || len(report.Errors) != 1 {
+		t.Fatalf("Unexpected drift report: %v", report)
+	}
+	if d := report.Drift[0]; d.Driver != "fakereconciler" || d.NetworkID != "nid" || d.Kind != driverapi.DriftMissing || d.Object != "rule" {
+		t.Fatalf("Unexpected drift: %v", d)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Driver != "fakereconciler" || ev.NetworkID != "nid" || ev.Detail != "missing rule" {
+			t.Fatalf("Unexpected drift event: %v", ev)
+		}
+	default:
+		t.Fatal("No drift event was published")
+	}
+}
+
+func TestMatchSelector(t *testing.T) {
+	labels := map[string]string{"tier": "front", "tenant": "blue"}
+
+	for i, tc := range []struct {
+		sel types.EndpointSelector
+		exp bool
+	}{
+		{sel: types.EndpointSelector{}, exp: true},
+		{sel: types.EndpointSelector{Names: []string{"db", "web"}}, exp: true},
+		{sel: types.EndpointSelector{Names: []string{"db"}}, exp: false},
+		{sel: types.EndpointSelector{Labels: []string{"tier=front", "tenant"}}, exp: true},
+		{sel: types.EndpointSelector{Labels: []string{"tier=front", "tenant=red"}}, exp: false},
+		{sel: types.EndpointSelector{Names: []string{"db"}, Labels: []string{"tier"}}, exp: true},
+	} {
+		if matchSelector(tc.sel, "web", labels) != tc.exp {
+			t.Fatalf("Selector %d: expected %t", i, tc.exp)
+		}
+	}
+}
+
+func TestConnectedDefaultRoute(t *testing.T) {
+	ep := &endpoint{iface: &endpointInterface{}, joinInfo: &endpointJoinInfo{}}
+	if ep.hasConnectedDefaultRoute() {
+		t.Fatalf("Unexpected connected default route without routes")
+	}
+
+	if err := ep.AddStaticRoute(&net.IPNet{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(16, 32)}, types.CONNECTED, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.AddStaticRoute(&net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, types.NEXTHOP, net.ParseIP("10.1.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if ep.hasConnectedDefaultRoute() {
+		t.Fatalf("Unexpected connected default route")
+	}
+
+	if err := ep.AddStaticRoute(&net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, types.CONNECTED, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !ep.hasConnectedDefaultRoute() {
+		t.Fatalf("Expected connected default route")
+	}
+}
+
+func TestMatchLabel(t *testing.T) {
+	labels := map[string]string{"tenant": "blue", "project": ""}
+
+	for sel, exp := range map[string]bool{
+		"tenant":        true,
+		"tenant=blue":   true,
+		"tenant=red":    false,
+		"project":       true,
+		"project=":      true,
+		"project=viola": false,
+		"owner":         false,
+	} {
+		if matchLabel(labels, sel) != exp {
+			t.Fatalf("Unexpected result for selector %q: expected %t", sel, exp)
+		}
+	}
+
+	if matchLabel(nil, "tenant") {
+		t.Fatalf("Unexpected match on nil labels")
+	}
+}
+
 func compareEndpointInterface(a, b *endpointInterface) bool {
 	if a == b {
 		return true
@@ -223,6 +740,14 @@ func compareEndpointInterface(a, b *endpointInterface) bool {
 	if a == nil || b == nil {
 		return false
 	}
+	if len(a.addrs) != len(b.addrs) {
+		return false
+	}
+	for i := range a.addrs {
+		if a.addrs[i].poolID != b.addrs[i].poolID || !types.CompareIPNet(a.addrs[i].addr, b.addrs[i].addr) {
+			return false
+		}
+	}
 	return a.srcName == b.srcName && a.dstPrefix == b.dstPrefix && a.poolID == b.poolID &&
 		types.CompareIPNet(a.addr, b.addr) && types.CompareIPNet(a.addrv6, b.addrv6)
 }
@@ -15,6 +15,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/plugins"
@@ -397,6 +398,73 @@ func TestNetworkName(t *testing.T) {
 	}
 }
 
+func TestNetworkInternal(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	n, err := controller.NewNetwork(bridgeNetType, "testinternal",
+		libnetwork.NetworkOptionGeneric(options.Generic{
+			netlabel.GenericData: options.Generic{
+				"BridgeName": "testinternal",
+			},
+		}),
+		libnetwork.NetworkOptionInternal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if !n.Internal() {
+		t.Fatalf("Expected network %s to be internal", n.Name())
+	}
+
+	ep, err := n.CreateEndpoint("testep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	sb, err := controller.NewSandbox(containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := sb.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	err = ep.Join(sb)
+	runtime.LockOSThread()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = ep.Leave(sb)
+		runtime.LockOSThread()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if gw := ep.Info().Gateway(); gw != nil {
+		t.Fatalf("Expected no gateway for an endpoint on an internal network. Instead found: %v", gw)
+	}
+
+	if _, err := controller.NetworkByName("docker_gwbridge"); err == nil {
+		t.Fatalf("Unexpected default gateway network for a container connected to an internal network only")
+	}
+}
+
 func TestNetworkType(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
@@ -850,6 +918,83 @@ func TestControllerQuery(t *testing.T) {
 	}
 }
 
+func TestNetworkLabels(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	net1, err := controller.NewNetwork(bridgeNetType, "network1",
+		libnetwork.NetworkOptionGeneric(options.Generic{
+			netlabel.GenericData: options.Generic{
+				"BridgeName": "network1",
+			},
+		}),
+		libnetwork.NetworkOptionLabels(map[string]string{"tenant": "blue", "project": "web"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := net1.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	net2, err := controller.NewNetwork(bridgeNetType, "network2",
+		libnetwork.NetworkOptionGeneric(options.Generic{
+			netlabel.GenericData: options.Generic{
+				"BridgeName": "network2",
+			},
+		}),
+		libnetwork.NetworkOptionLabels(map[string]string{"tenant": "red"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := net2.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	n, err := controller.NetworkByID(net1.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := n.Labels(); len(l) != 2 || l["tenant"] != "blue" || l["project"] != "web" {
+		t.Fatalf("Unexpected network labels: %v", l)
+	}
+
+	if l := controller.NetworksByLabel("tenant"); len(l) != 2 {
+		t.Fatalf("Expected 2 networks with label tenant. Got %d", len(l))
+	}
+
+	l := controller.NetworksByLabel("tenant=red")
+	if len(l) != 1 || l[0].ID() != net2.ID() {
+		t.Fatalf("Unexpected networks for selector tenant=red: %v", l)
+	}
+
+	if l := controller.NetworksByLabel("project=db"); len(l) != 0 {
+		t.Fatalf("Unexpected networks for selector project=db: %v", l)
+	}
+
+	ep, err := net1.CreateEndpoint("ep1", libnetwork.CreateOptionLabels(map[string]string{"role": "db"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	e, err := net1.EndpointByID(ep.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := e.Labels(); len(l) != 1 || l["role"] != "db" {
+		t.Fatalf("Unexpected endpoint labels: %v", l)
+	}
+}
+
 func TestNetworkQuery(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
@@ -935,6 +1080,80 @@ func TestNetworkQuery(t *testing.T) {
 	}
 }
 
+func TestEvents(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	evCh, cancel := controller.Subscribe(libnetwork.EventTypeFilter(
+		libnetwork.EventNetworkCreate, libnetwork.EventNetworkDelete,
+		libnetwork.EventEndpointCreate, libnetwork.EventEndpointDelete,
+		libnetwork.EventEndpointJoin, libnetwork.EventEndpointLeave))
+	defer cancel()
+
+	n, err := createTestNetwork(bridgeNetType, "testevents", options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "testevents",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnt, err := controller.NewSandbox("events_container")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(cnt); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Leave(cnt); err != nil {
+		t.Fatal(err)
+	}
+	if err := cnt.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []libnetwork.EventType{
+		libnetwork.EventNetworkCreate,
+		libnetwork.EventEndpointCreate,
+		libnetwork.EventEndpointJoin,
+		libnetwork.EventEndpointLeave,
+		libnetwork.EventEndpointDelete,
+		libnetwork.EventNetworkDelete,
+	}
+	for _, et := range expected {
+		ev := <-evCh
+		if ev.Type != et {
+			t.Fatalf("Expected %s event. Got %s: %v", et, ev.Type, ev)
+		}
+		if ev.NetworkID != n.ID() {
+			t.Fatalf("Unexpected network id in %s event: %s", ev.Type, ev.NetworkID)
+		}
+		if (et == libnetwork.EventEndpointJoin || et == libnetwork.EventEndpointLeave) &&
+			(ev.EndpointID != ep.ID() || ev.SandboxID != cnt.ID()) {
+			t.Fatalf("Unexpected endpoint or sandbox in %s event: %v", ev.Type, ev)
+		}
+	}
+
+	cancel()
+	if _, ok := <-evCh; ok {
+		t.Fatalf("Expected event channel to be closed after cancel")
+	}
+}
+
 const containerID = "valid_c"
 
 func checkSandbox(t *testing.T, info libnetwork.EndpointInfo) {
@@ -1669,6 +1888,150 @@ func TestEndpointUpdateParent(t *testing.T) {
 	}
 }
 
+func TestEndpointAliases(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	n, err := createTestNetwork("bridge", "testnetwork", options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "testnetwork",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ep1, err := n.CreateEndpoint("ep1", libnetwork.CreateOptionAlias("db", "primary-db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep1.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ep2, err := n.CreateEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep2.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ep3, err := n.CreateEndpoint("ep3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep3.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	hostsPath := "/var/lib/docker/test_network/container3/hosts"
+	sbx1, err := controller.NewSandbox("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := sbx1.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	sbx2, err := controller.NewSandbox("c2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := sbx2.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	sbx3, err := controller.NewSandbox("c3", libnetwork.OptionHostsPath(hostsPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := sbx3.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := ep3.Join(sbx3); err != nil {
+		t.Fatal(err)
+	}
+	defer ep3.Leave(sbx3)
+
+	if err := ep1.Join(sbx1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep2.Join(sbx2, libnetwork.JoinOptionAlias("db")); err != nil {
+		t.Fatal(err)
+	}
+	defer ep2.Leave(sbx2)
+
+	ip1 := ep1.Info().Iface().Address().IP.String()
+	ip2 := ep2.Info().Iface().Address().IP.String()
+
+	for _, rec := range []string{
+		ip1 + "\tdb\n",
+		ip1 + "\tprimary-db\n",
+		ip1 + "\tprimary-db.testnetwork\n",
+		ip2 + "\tdb\n",
+		ip2 + "\tdb.testnetwork\n",
+	} {
+		waitHostsRecord(t, hostsPath, rec, true)
+	}
+
+	// The alias must keep resolving to the endpoints still joined
+	if err := ep1.Leave(sbx1); err != nil {
+		t.Fatal(err)
+	}
+	waitHostsRecord(t, hostsPath, ip1+"\tdb\n", false)
+	waitHostsRecord(t, hostsPath, ip1+"\tprimary-db\n", false)
+	waitHostsRecord(t, hostsPath, ip2+"\tdb\n", true)
+
+	// The join aliases do not outlive the join
+	if err := ep2.Leave(sbx2); err != nil {
+		t.Fatal(err)
+	}
+	waitHostsRecord(t, hostsPath, ip2+"\tdb\n", false)
+	if err := ep2.Join(sbx2); err != nil {
+		t.Fatal(err)
+	}
+	waitHostsRecord(t, hostsPath, ip2+"\tep2\n", true)
+	waitHostsRecord(t, hostsPath, ip2+"\tdb\n", false)
+}
+
+// waitHostsRecord waits for the service record updates, which are
+// asynchronous, to be reflected in the hosts file.
+func waitHostsRecord(t *testing.T, path, rec string, present bool) {
+	var content []byte
+	for i := 0; i < 50; i++ {
+		var err error
+		if content, err = ioutil.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(content, []byte(rec)) == present {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Expected record %q present: %t in hosts file:\n%s", rec, present, content)
+}
+
 func TestEnableIPv6(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
@@ -25,17 +25,29 @@ const (
 	// ExposedPorts constant represents exposedports of a Container
 	ExposedPorts = Prefix + ".endpoint.exposedports"
 
+	// PortMapConnStats constant represents the connection counters of the port mappings of a Container
+	PortMapConnStats = Prefix + ".endpoint.portmap_connstats"
+
 	//EnableIPv6 constant represents enabling IPV6 at network level
 	EnableIPv6 = Prefix + ".enable_ipv6"
 
+	// Internal constant represents a network without external connectivity
+	Internal = Prefix + ".internal"
+
 	// OverlayBindInterface constant represents overlay driver bind interface
 	OverlayBindInterface = DriverPrefix + ".overlay.bind_interface"
 
 	// OverlayNeighborIP constant represents overlay driver neighbor IP
 	OverlayNeighborIP = DriverPrefix + ".overlay.neighbor_ip"
 
+	// OverlayPeerDistribution constant represents how the overlay driver distributes the peers, serf or kv
+	OverlayPeerDistribution = DriverPrefix + ".overlay.peer_distribution"
+
 	// Gateway represents the gateway for the network
 	Gateway = Prefix + ".gateway"
+
+	// FirewallBackend constant represents the firewall backend the drivers program their rules with
+	FirewallBackend = DriverPrivatePrefix + ".firewall_backend"
 )
 
 var (
@@ -56,6 +68,12 @@ var (
 
 	// LocalKVProviderConfig constant represents the KV provider Config
 	LocalKVProviderConfig = MakeKVProviderConfig("local")
+
+	// LocalKVClient constant represents the datastore client handle of the controller
+	LocalKVClient = MakeKVClient("local")
+
+	// GlobalKVClient constant represents the datastore client handle of the controller
+	GlobalKVClient = MakeKVClient("global")
 )
 
 // MakeKVProvider returns the kvprovider label for the scope
@@ -73,6 +91,11 @@ func MakeKVProviderConfig(scope string) string {
 	return DriverPrivatePrefix + scope + "kv_provider_config"
 }
 
+// MakeKVClient returns the datastore client label for the scope
+func MakeKVClient(scope string) string {
+	return DriverPrivatePrefix + scope + "kv_client"
+}
+
 // Key extracts the key portion of the label
 func Key(label string) string {
 	kv := strings.SplitN(label, "=", 2)
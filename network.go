@@ -29,6 +29,12 @@ type Network interface {
 	// The type of network, which corresponds to its managing driver.
 	Type() string
 
+	// Labels returns the user labels associated with this network.
+	Labels() map[string]string
+
+	// Internal returns whether the network has no external connectivity.
+	Internal() bool
+
 	// Create a new endpoint to this network symbolically identified by the
 	// specified unique name. The options parameter carry driver specific options.
 	// Labels support will be added in the near future.
@@ -48,13 +54,45 @@ type Network interface {
 
 	// EndpointByID returns the Endpoint which has the passed id. If not found, the error ErrNoSuchEndpoint is returned.
 	EndpointByID(id string) (Endpoint, error)
+
+	// Policy returns the policy rules of the network, in order of precedence.
+	Policy() []types.PolicyRule
+
+	// UpdatePolicy replaces the policy rules of the network.
+	UpdatePolicy(rules []types.PolicyRule) error
 }
 
 // EndpointWalker is a client provided function which will be used to walk the Endpoints.
 // When the function returns true, the walk will stop.
 type EndpointWalker func(ep Endpoint) bool
 
-type svcMap map[string]net.IP
+type svcMap map[string][]net.IP
+
+// servicePorts are the exposed ports of an endpoint
+// providing a service, by its fully qualified name.
+type servicePorts struct {
+	target string
+	ports  []types.TransportPort
+}
+
+// svcInfo holds the service records of a network: the IPv4 and IPv6
+// addresses and the exposed ports of the endpoints by their names
+// and aliases, and the load balanced services by their names.
+type svcInfo struct {
+	svcMap     svcMap
+	svcIPv6Map svcMap
+	service    map[string][]servicePorts
+	lbServices map[string]*lbService
+}
+
+func newSvcInfo() *svcInfo {
+	return &svcInfo{
+		svcMap:     svcMap{},
+		svcIPv6Map: svcMap{},
+		service:    make(map[string][]servicePorts),
+		lbServices: make(map[string]*lbService),
+	}
+}
 
 // IpamConf contains all the ipam related configurations for a network
 type IpamConf struct {
@@ -134,8 +172,11 @@ type network struct {
 	ipamV4Info   []*IpamInfo
 	ipamV6Info   []*IpamInfo
 	enableIPv6   bool
+	internal     bool
 	endpointCnt  uint64
 	generic      options.Generic
+	labels       map[string]string
+	policy       []types.PolicyRule
 	dbIndex      uint64
 	svcRecords   svcMap
 	dbExists     bool
@@ -167,6 +208,20 @@ func (n *network) Type() string {
 	return n.networkType
 }
 
+func (n *network) Labels() map[string]string {
+	n.Lock()
+	defer n.Unlock()
+
+	return copyLabels(n.labels)
+}
+
+func (n *network) Internal() bool {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.internal
+}
+
 func (n *network) Key() []string {
 	n.Lock()
 	defer n.Unlock()
@@ -261,6 +316,7 @@ func (n *network) CopyTo(o datastore.KVObject) error {
 	dstN.ipamType = n.ipamType
 	dstN.endpointCnt = n.endpointCnt
 	dstN.enableIPv6 = n.enableIPv6
+	dstN.internal = n.internal
 	dstN.persist = n.persist
 	dstN.dbIndex = n.dbIndex
 	dstN.dbExists = n.dbExists
@@ -272,11 +328,20 @@ func (n *network) CopyTo(o datastore.KVObject) error {
 		dstN.ipamV4Info = append(dstN.ipamV4Info, dstV4Info)
 	}
 
+	for _, v6info := range n.ipamV6Info {
+		dstV6Info := &IpamInfo{}
+		v6info.CopyTo(dstV6Info)
+		dstN.ipamV6Info = append(dstN.ipamV6Info, dstV6Info)
+	}
+
 	dstN.generic = options.Generic{}
 	for k, v := range n.generic {
 		dstN.generic[k] = v
 	}
 
+	dstN.labels = copyLabels(n.labels)
+	dstN.policy = copyPolicy(n.policy)
+
 	return nil
 }
 
@@ -316,10 +381,17 @@ func (n *network) MarshalJSON() ([]byte, error) {
 	netMap["addrSpace"] = n.addrSpace
 	netMap["endpointCnt"] = n.endpointCnt
 	netMap["enableIPv6"] = n.enableIPv6
+	netMap["internal"] = n.internal
 	if n.generic != nil {
 		netMap["generic"] = n.generic
 	}
 	netMap["persist"] = n.persist
+	if n.labels != nil {
+		netMap["labels"] = n.labels
+	}
+	if len(n.policy) > 0 {
+		netMap["policy"] = n.policy
+	}
 	if len(n.ipamV4Config) > 0 {
 		ics, err := json.Marshal(n.ipamV4Config)
 		if err != nil {
@@ -364,12 +436,27 @@ func (n *network) UnmarshalJSON(b []byte) (err error) {
 	n.networkType = netMap["networkType"].(string)
 	n.endpointCnt = uint64(netMap["endpointCnt"].(float64))
 	n.enableIPv6 = netMap["enableIPv6"].(bool)
+	if v, ok := netMap["internal"]; ok {
+		n.internal = v.(bool)
+	}
 	if v, ok := netMap["generic"]; ok {
 		n.generic = v.(map[string]interface{})
 	}
 	if v, ok := netMap["persist"]; ok {
 		n.persist = v.(bool)
 	}
+	if v, ok := netMap["labels"]; ok {
+		n.labels = make(map[string]string)
+		for k, l := range v.(map[string]interface{}) {
+			n.labels[k] = l.(string)
+		}
+	}
+	if v, ok := netMap["policy"]; ok {
+		b, _ := json.Marshal(v)
+		if err := json.Unmarshal(b, &n.policy); err != nil {
+			return err
+		}
+	}
 	if v, ok := netMap["ipamV4Config"]; ok {
 		if err := json.Unmarshal([]byte(v.(string)), &n.ipamV4Config); err != nil {
 			return err
@@ -409,6 +496,14 @@ func NetworkOptionGeneric(generic map[string]interface{}) NetworkOption {
 	}
 }
 
+// NetworkOptionInternal returns an option setter to make the network internal,
+// that is without connectivity to the outside world
+func NetworkOptionInternal() NetworkOption {
+	return func(n *network) {
+		n.internal = true
+	}
+}
+
 // NetworkOptionPersist returns an option setter to set persistence policy for a network
 func NetworkOptionPersist(persist bool) NetworkOption {
 	return func(n *network) {
@@ -416,6 +511,23 @@ func NetworkOptionPersist(persist bool) NetworkOption {
 	}
 }
 
+// NetworkOptionLabels function returns an option setter for the user labels
+// to be associated with the network
+func NetworkOptionLabels(labels map[string]string) NetworkOption {
+	return func(n *network) {
+		n.labels = copyLabels(labels)
+	}
+}
+
+// NetworkOptionPolicy function returns an option setter for the policy rules
+// allowing or denying the traffic between the endpoints of the network.
+// The rules are evaluated in order, the first matching rule applies.
+func NetworkOptionPolicy(rules []types.PolicyRule) NetworkOption {
+	return func(n *network) {
+		n.policy = copyPolicy(rules)
+	}
+}
+
 // NetworkOptionIpam function returns an option setter for the ipam configuration for this network
 func NetworkOptionIpam(ipamDriver string, addrSpace string, ipV4 []*IpamConf, ipV6 []*IpamConf) NetworkOption {
 	return func(n *network) {
@@ -432,6 +544,16 @@ func (n *network) processOptions(options ...NetworkOption) {
 			opt(n)
 		}
 	}
+
+	// Let the driver know about the well-known network options
+	if n.internal {
+		generic := make(map[string]interface{})
+		for k, v := range n.generic {
+			generic[k] = v
+		}
+		generic[netlabel.Internal] = true
+		n.generic = generic
+	}
 }
 
 func (n *network) driverScope() string {
@@ -523,6 +645,8 @@ func (n *network) Delete() error {
 
 	n.ipamRelease()
 
+	c.publishEvent(networkEvent(EventNetworkDelete, n))
+
 	return nil
 }
 
@@ -549,6 +673,7 @@ func (n *network) deleteNetwork() error {
 			return err
 		}
 		log.Warnf("driver error deleting network %s : %v", n.name, err)
+		n.getController().publishEvent(driverErrorEvent(n, "", err))
 	}
 
 	return nil
@@ -573,6 +698,7 @@ func (n *network) addEndpoint(ep *endpoint) error {
 
 	err = d.CreateEndpoint(n.id, ep.id, ep.Interface(), ep.generic)
 	if err != nil {
+		n.getController().publishEvent(driverErrorEvent(n, ep.id, err))
 		return types.InternalErrorf("failed to create endpoint %s on network %s: %v",
 			ep.Name(), n.Name(), err)
 	}
@@ -635,11 +761,29 @@ func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoi
 		}
 	}()
 
+	// The new endpoint may be subject to the network policy
+	if err = n.programPolicy(); err != nil {
+		return nil, err
+	}
+
 	// Increment endpoint count to indicate completion of endpoint addition
 	if err = n.IncEndpointCnt(); err != nil {
 		return nil, err
 	}
 
+	n.addLBService(ep)
+
+	c := n.getController()
+	c.publishEvent(endpointEvent(EventEndpointCreate, n, ep))
+	addrs := append([]*net.IPNet{ep.Iface().Address(), ep.Iface().AddressIPv6()}, ep.Iface().Addresses()...)
+	for _, addr := range addrs {
+		if addr != nil {
+			ev := endpointEvent(EventAddressAllocated, n, ep)
+			ev.Address = addr.String()
+			c.publishEvent(ev)
+		}
+	}
+
 	return ep, nil
 }
 
@@ -704,35 +848,57 @@ func (n *network) EndpointByID(id string) (Endpoint, error) {
 
 func (n *network) updateSvcRecord(ep *endpoint, localEps []*endpoint, isAdd bool) {
 	c := n.getController()
-	sr, ok := c.svcDb[n.ID()]
+	si, ok := c.svcDb[n.ID()]
 	if !ok {
-		c.svcDb[n.ID()] = svcMap{}
-		sr = c.svcDb[n.ID()]
+		si = newSvcInfo()
+		c.svcDb[n.ID()] = si
 	}
 
 	n.Lock()
 	var recs []etchosts.Record
 	if iface := ep.Iface(); iface.Address() != nil {
-		if isAdd {
-			sr[ep.Name()] = iface.Address().IP
-			sr[ep.Name()+"."+n.name] = iface.Address().IP
-		} else {
-			delete(sr, ep.Name())
-			delete(sr, ep.Name()+"."+n.name)
+		ip := iface.Address().IP
+		var ipv6 net.IP
+		if iface.AddressIPv6() != nil {
+			ipv6 = iface.AddressIPv6().IP
 		}
+		target := ep.Name() + "." + n.name
+		ports := ep.getExposedPorts()
+		for _, name := range append([]string{ep.Name()}, ep.getAliases()...) {
+			for _, h := range []string{name, name + "." + n.name} {
+				if isAdd {
+					si.svcMap.add(h, ip)
+					if ipv6 != nil {
+						si.svcIPv6Map.add(h, ipv6)
+					}
+					si.addService(h, target, ports)
+				} else {
+					si.svcMap.remove(h, ip)
+					if ipv6 != nil {
+						si.svcIPv6Map.remove(h, ipv6)
+					}
+					si.removeService(h, target)
+				}
 
-		recs = append(recs, etchosts.Record{
-			Hosts: ep.Name(),
-			IP:    iface.Address().IP.String(),
-		})
-
-		recs = append(recs, etchosts.Record{
-			Hosts: ep.Name() + "." + n.name,
-			IP:    iface.Address().IP.String(),
-		})
+				// The virtual IP stands for the backends
+				// of a load balanced service
+				if si.lbServiceFor(h, n.name) != nil {
+					continue
+				}
+				recs = append(recs, etchosts.Record{
+					Hosts: h,
+					IP:    ip.String(),
+				})
+			}
+		}
 	}
 	n.Unlock()
 
+	if isAdd {
+		n.addLBService(ep)
+	}
+	n.updateLBBackend(ep, isAdd)
+
 	// If there are no records to add or delete then simply return here
 	if len(recs) == 0 {
 		return
@@ -754,18 +920,85 @@ func (n *network) updateSvcRecord(ep *endpoint, localEps []*endpoint, isAdd bool
 	}
 }
 
+// add maps the passed ip to the service name, which may already
+// be resolving to the ips of other endpoints.
+func (sr svcMap) add(name string, ip net.IP) {
+	for _, i := range sr[name] {
+		if i.Equal(ip) {
+			return
+		}
+	}
+	sr[name] = append(sr[name], ip)
+}
+
+// remove unmaps the passed ip from the service name, dropping
+// the name once no endpoint is resolving to it anymore.
+func (sr svcMap) remove(name string, ip net.IP) {
+	ips := sr[name]
+	for i, ipi := range ips {
+		if ipi.Equal(ip) {
+			ips = append(ips[:i], ips[i+1:]...)
+			break
+		}
+	}
+	if len(ips) == 0 {
+		delete(sr, name)
+		return
+	}
+	sr[name] = ips
+}
+
+// addService records the exposed ports of the endpoint, known as
+// target, among the ones providing the service name.
+func (si *svcInfo) addService(name, target string, ports []types.TransportPort) {
+	if len(ports) == 0 {
+		return
+	}
+	si.removeService(name, target)
+	si.service[name] = append(si.service[name], servicePorts{target: target, ports: ports})
+}
+
+// removeService drops the endpoint, known as target,
+// from the ones providing the service name.
+func (si *svcInfo) removeService(name, target string) {
+	spl := si.service[name]
+	for i, sp := range spl {
+		if sp.target == target {
+			spl = append(spl[:i], spl[i+1:]...)
+			break
+		}
+	}
+	if len(spl) == 0 {
+		delete(si.service, name)
+		return
+	}
+	si.service[name] = spl
+}
+
 func (n *network) getSvcRecords() []etchosts.Record {
 	n.Lock()
 	defer n.Unlock()
 
 	var recs []etchosts.Record
-	sr, _ := n.ctrlr.svcDb[n.id]
+	si, ok := n.ctrlr.svcDb[n.id]
+	if !ok {
+		return nil
+	}
 
-	for h, ip := range sr {
-		recs = append(recs, etchosts.Record{
-			Hosts: h,
-			IP:    ip.String(),
-		})
+	for _, lb := range si.lbServices {
+		recs = append(recs, lb.records(n.name)...)
+	}
+
+	for h, ips := range si.svcMap {
+		if si.lbServiceFor(h, n.name) != nil {
+			continue
+		}
+		for _, ip := range ips {
+			recs = append(recs, etchosts.Record{
+				Hosts: h,
+				IP:    ip.String(),
+			})
+		}
 	}
 
 	return recs
@@ -901,6 +1134,16 @@ func (n *network) getIPInfo() []*IpamInfo {
 	return l
 }
 
+func (n *network) getIPInfoV6() []*IpamInfo {
+	n.Lock()
+	defer n.Unlock()
+	l := make([]*IpamInfo, 0, len(n.ipamV6Info))
+	for _, d := range n.ipamV6Info {
+		l = append(l, d)
+	}
+	return l
+}
+
 func (n *network) getIPv4Data() []driverapi.IPAMData {
 	l := make([]driverapi.IPAMData, 0, len(n.ipamV4Info))
 	n.Lock()
@@ -21,6 +21,7 @@ type nwIface struct {
 	dstMaster   string
 	address     *net.IPNet
 	addressIPv6 *net.IPNet
+	ipAliases   []*net.IPNet
 	routes      []*net.IPNet
 	bridge      bool
 	ns          *networkNamespace
@@ -76,6 +77,18 @@ func (i *nwIface) AddressIPv6() *net.IPNet {
 	return types.GetIPNetCopy(i.addressIPv6)
 }
 
+func (i *nwIface) IPAliases() []*net.IPNet {
+	i.Lock()
+	defer i.Unlock()
+
+	aliases := make([]*net.IPNet, len(i.ipAliases))
+	for index, alias := range i.ipAliases {
+		aliases[index] = types.GetIPNetCopy(alias)
+	}
+
+	return aliases
+}
+
 func (i *nwIface) Routes() []*net.IPNet {
 	i.Lock()
 	defer i.Unlock()
@@ -293,6 +306,7 @@ func configureInterface(iface netlink.Link, i *nwIface) error {
 		{setInterfaceName, fmt.Sprintf("error renaming interface %q to %q", ifaceName, i.DstName())},
 		{setInterfaceIP, fmt.Sprintf("error setting interface %q IP to %q", ifaceName, i.Address())},
 		{setInterfaceIPv6, fmt.Sprintf("error setting interface %q IPv6 to %q", ifaceName, i.AddressIPv6())},
+		{setInterfaceIPAliases, fmt.Sprintf("error setting interface %q IP aliases to %q", ifaceName, i.IPAliases())},
 		{setInterfaceMaster, fmt.Sprintf("error setting interface %q master to %q", ifaceName, i.DstMaster())},
 	}
 
@@ -330,6 +344,16 @@ func setInterfaceIPv6(iface netlink.Link, i *nwIface) error {
 	return netlink.AddrAdd(iface, ipAddr)
 }
 
+func setInterfaceIPAliases(iface netlink.Link, i *nwIface) error {
+	for _, alias := range i.IPAliases() {
+		ipAddr := &netlink.Addr{IPNet: alias, Label: ""}
+		if err := netlink.AddrAdd(iface, ipAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func setInterfaceName(iface netlink.Link, i *nwIface) error {
 	return netlink.LinkSetName(iface, i.DstName())
 }
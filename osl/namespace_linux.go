@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -184,6 +185,106 @@ func GetSandboxForExternalKey(basePath string, key string) (Sandbox, error) {
 	return &networkNamespace{path: key}, nil
 }
 
+// RestoreSandbox returns the sandbox object for the network namespace already
+// mounted at key, as left behind by a previous instance of the process. The
+// interfaces found in the namespace whose names are present in the passed
+// ifaces map, which associates the name inside the namespace to the original
+// source name, are adopted along with the default gateways.
+func RestoreSandbox(key string, ifaces map[string]string) (Sandbox, error) {
+	once.Do(createBasePath)
+
+	if _, err := os.Stat(key); err != nil {
+		return nil, fmt.Errorf("failed to find network namespace %s: %v", key, err)
+	}
+
+	n := &networkNamespace{path: key}
+	err := nsInvoke(key, func(nsFD int) error { return nil }, func(callerFD int) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("failed to list links: %v", err)
+		}
+
+		for _, link := range links {
+			dstName := link.Attrs().Name
+			srcName, ok := ifaces[dstName]
+			if !ok {
+				continue
+			}
+
+			// The primary addresses were programmed first,
+			// any other address is an IP alias
+			i := &nwIface{srcName: srcName, dstName: dstName, ns: n}
+			if addrs, err := netlink.AddrList(link, netlink.FAMILY_V4); err == nil {
+				for _, a := range addrs {
+					if i.address == nil {
+						i.address = a.IPNet
+						continue
+					}
+					i.ipAliases = append(i.ipAliases, a.IPNet)
+				}
+			}
+			if addrs, err := netlink.AddrList(link, netlink.FAMILY_V6); err == nil {
+				for _, a := range addrs {
+					if !a.IP.IsGlobalUnicast() {
+						continue
+					}
+					if i.addressIPv6 == nil {
+						i.addressIPv6 = a.IPNet
+						continue
+					}
+					i.ipAliases = append(i.ipAliases, a.IPNet)
+				}
+			}
+			n.iFaces = append(n.iFaces, i)
+
+			// Make sure the names generated for new interfaces do not
+			// clash with the ones of the adopted interfaces
+			if index := ifIndexFromName(dstName); index >= n.nextIfIndex {
+				n.nextIfIndex = index + 1
+			}
+		}
+
+		n.gw = defaultGateway(netlink.FAMILY_V4)
+		n.gwv6 = defaultGateway(netlink.FAMILY_V6)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore network namespace %s: %v", key, err)
+	}
+
+	return n, nil
+}
+
+func ifIndexFromName(name string) int {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+
+	index, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return -1
+	}
+
+	return index
+}
+
+func defaultGateway(family int) net.IP {
+	routes, err := netlink.RouteList(nil, family)
+	if err != nil {
+		return nil
+	}
+
+	for _, r := range routes {
+		if r.Dst == nil && r.Gw != nil {
+			return r.Gw
+		}
+	}
+
+	return nil
+}
+
 func reexecCreateNamespace() {
 	if len(os.Args) < 2 {
 		log.Fatal("no namespace path provided")
@@ -23,6 +23,12 @@ func GetSandboxForExternalKey(path string, key string) (Sandbox, error) {
 	return nil, nil
 }
 
+// RestoreSandbox returns the sandbox for the network namespace already
+// mounted at key
+func RestoreSandbox(key string, ifaces map[string]string) (Sandbox, error) {
+	return nil, nil
+}
+
 // GC triggers garbage collection of namespace path right away
 // and waits for it.
 func GC() {
@@ -82,6 +82,10 @@ type IfaceOptionSetter interface {
 	// Address returns an option setter to set IPv6 address.
 	AddressIPv6(*net.IPNet) IfaceOption
 
+	// IPAliases returns an option setter to set the secondary IPv4
+	// and IPv6 addresses of the interface.
+	IPAliases([]*net.IPNet) IfaceOption
+
 	// Master returns an option setter to set the master interface if any for this
 	// interface. The master interface name should refer to the srcname of a
 	// previously added interface of type bridge.
@@ -135,6 +139,9 @@ type Interface interface {
 	// IPv6 address for the interface.
 	AddressIPv6() *net.IPNet
 
+	// Secondary IPv4 and IPv6 addresses for the interface.
+	IPAliases() []*net.IPNet
+
 	// IP routes for the interface.
 	Routes() []*net.IPNet
 
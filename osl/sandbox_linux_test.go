@@ -70,6 +70,18 @@ func newInfo(t *testing.T) (Sandbox, error) {
 	intf1.addressIPv6 = addrv6
 	intf1.addressIPv6.IP = ip6
 
+	ip4, alias, err := net.ParseCIDR("192.168.1.101/24")
+	if err != nil {
+		return nil, err
+	}
+	alias.IP = ip4
+	ip6, aliasv6, err := net.ParseCIDR("fe80::3/64")
+	if err != nil {
+		return nil, err
+	}
+	aliasv6.IP = ip6
+	intf1.ipAliases = []*net.IPNet{alias, aliasv6}
+
 	_, route, err := net.ParseCIDR("192.168.2.1/32")
 	if err != nil {
 		return nil, err
@@ -138,6 +150,29 @@ func verifySandbox(t *testing.T, s Sandbox, ifaceSuffixes []string) {
 				sboxIfaceName+suffix, err)
 		}
 	}
+
+	for _, i := range s.Info().Interfaces() {
+		link, err := netlink.LinkByName(i.DstName())
+		if err != nil {
+			t.Fatalf("Could not find the interface %s inside the sandbox: %v", i.DstName(), err)
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			t.Fatalf("Could not list the addresses of interface %s: %v", i.DstName(), err)
+		}
+		for _, alias := range i.IPAliases() {
+			found := false
+			for _, a := range addrs {
+				if a.IP.Equal(alias.IP) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("IP alias %s not programmed on interface %s", alias, i.DstName())
+			}
+		}
+	}
 }
 
 func verifyCleanup(t *testing.T, s Sandbox, wait bool) {
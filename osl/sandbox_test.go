@@ -43,7 +43,8 @@ func TestSandboxCreate(t *testing.T) {
 		err = s.AddInterface(i.SrcName(), i.DstName(),
 			tbox.InterfaceOptions().Bridge(i.Bridge()),
 			tbox.InterfaceOptions().Address(i.Address()),
-			tbox.InterfaceOptions().AddressIPv6(i.AddressIPv6()))
+			tbox.InterfaceOptions().AddressIPv6(i.AddressIPv6()),
+			tbox.InterfaceOptions().IPAliases(i.IPAliases()))
 		if err != nil {
 			t.Fatalf("Failed to add interfaces to sandbox: %v", err)
 		}
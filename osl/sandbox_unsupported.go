@@ -15,6 +15,12 @@ func NewSandbox(key string, osCreate bool) (Sandbox, error) {
 	return nil, ErrNotImplemented
 }
 
+// RestoreSandbox returns the sandbox for the network namespace already
+// mounted at key
+func RestoreSandbox(key string, ifaces map[string]string) (Sandbox, error) {
+	return nil, ErrNotImplemented
+}
+
 // GenerateKey generates a sandbox key based on the passed
 // container id.
 func GenerateKey(containerID string) string {
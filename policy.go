@@ -0,0 +1,178 @@
+package libnetwork
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/types"
+)
+
+func (n *network) Policy() []types.PolicyRule {
+	n.Lock()
+	defer n.Unlock()
+
+	return copyPolicy(n.policy)
+}
+
+func (n *network) UpdatePolicy(rules []types.PolicyRule) error {
+	n.Lock()
+	c := n.ctrlr
+	id := n.id
+	n.Unlock()
+
+	n, err := c.getNetworkFromStore(id)
+	if err != nil {
+		return err
+	}
+
+	d, err := n.driver()
+	if err != nil {
+		return err
+	}
+
+	if err := validatePolicy(d, rules); err != nil {
+		return err
+	}
+
+	// Only an empty rule list gets here for
+	// the drivers without policy support
+	pd, ok := d.(driverapi.PolicyDriver)
+	if !ok {
+		return nil
+	}
+
+	n.Lock()
+	old := n.policy
+	n.policy = copyPolicy(rules)
+	n.Unlock()
+
+	if err = n.pushPolicy(pd); err != nil {
+		n.Lock()
+		n.policy = old
+		n.Unlock()
+		return err
+	}
+
+	if err = c.updateToStore(n); err != nil {
+		n.Lock()
+		n.policy = old
+		n.Unlock()
+		if e := n.pushPolicy(pd); e != nil {
+			log.Warnf("Failed to restore the policy of network %s: %v", n.Name(), e)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// validatePolicy checks the rules are well formed and the network
+// driver is able to enforce them.
+func validatePolicy(d driverapi.Driver, rules []types.PolicyRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	if _, ok := d.(driverapi.PolicyDriver); !ok {
+		return types.NotImplementedErrorf("network policies are not supported by driver %s", d.Type())
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// programPolicy hands over the policy rules of the network, if any,
+// to the driver.
+func (n *network) programPolicy() error {
+	n.Lock()
+	hasPolicy := len(n.policy) > 0
+	n.Unlock()
+
+	if !hasPolicy {
+		return nil
+	}
+
+	d, err := n.driver()
+	if err != nil {
+		return err
+	}
+	pd, ok := d.(driverapi.PolicyDriver)
+	if !ok {
+		return types.NotImplementedErrorf("network policies are not supported by driver %s", d.Type())
+	}
+
+	return n.pushPolicy(pd)
+}
+
+// pushPolicy resolves the policy rules of the network to its
+// current endpoints and programs them in the driver.
+func (n *network) pushPolicy(pd driverapi.PolicyDriver) error {
+	n.Lock()
+	rules := n.policy
+	id := n.id
+	n.Unlock()
+
+	epl, err := n.getEndpointsFromStore()
+	if err != nil {
+		return fmt.Errorf("failed to get endpoints of network %s to program its policy: %v", n.Name(), err)
+	}
+
+	var drules []driverapi.PolicyRule
+	for _, r := range rules {
+		dr := driverapi.PolicyRule{
+			Allow: r.Action == types.PolicyAllow,
+			Proto: r.Proto,
+			Port:  r.Port,
+		}
+		for _, ep := range epl {
+			name, labels := ep.Name(), ep.Labels()
+			if matchSelector(r.Source, name, labels) {
+				dr.Sources = append(dr.Sources, ep.ID())
+			}
+			if matchSelector(r.Destination, name, labels) {
+				dr.Destinations = append(dr.Destinations, ep.ID())
+			}
+		}
+		drules = append(drules, dr)
+	}
+
+	return pd.ProgramPolicy(id, drules)
+}
+
+// matchSelector returns whether the endpoint with the passed name
+// and labels is selected by the policy endpoint selector.
+func matchSelector(sel types.EndpointSelector, name string, labels map[string]string) bool {
+	if len(sel.Names) == 0 && len(sel.Labels) == 0 {
+		return true
+	}
+
+	for _, n := range sel.Names {
+		if n == name {
+			return true
+		}
+	}
+
+	if len(sel.Labels) == 0 {
+		return false
+	}
+	for _, l := range sel.Labels {
+		if !matchLabel(labels, l) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyPolicy(rules []types.PolicyRule) []types.PolicyRule {
+	if rules == nil {
+		return nil
+	}
+	cp := make([]types.PolicyRule, 0, len(rules))
+	for i := range rules {
+		cp = append(cp, rules[i].GetCopy())
+	}
+	return cp
+}
@@ -0,0 +1,272 @@
+package portallocator
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+)
+
+// PortRange is an inclusive range of ports, a single port when Begin and
+// End are equal
+type PortRange struct {
+	Begin int
+	End   int
+}
+
+// HostConfig configures the ports pools of a host address
+type HostConfig struct {
+	// DynamicRange is the range the ports are picked from when no
+	// specific port is requested, the default one when unset
+	DynamicRange PortRange
+	// Excluded are the ports which are never allocated
+	Excluded []PortRange
+}
+
+// Config configures the ports pools of the allocator
+type Config struct {
+	// Default applies to all the host addresses. Its dynamic range
+	// defaults to the ephemeral port range of the kernel.
+	Default HostConfig
+	// Hosts are the configurations of specific host addresses, keyed by
+	// address. Their excluded ports add to the default ones.
+	Hosts map[string]HostConfig
+}
+
+// ErrPortExcluded is the returned error information when a requested port
+// is excluded from the allocations
+type ErrPortExcluded struct {
+	ip   string
+	port int
+}
+
+func newErrPortExcluded(ip string, port int) ErrPortExcluded {
+	return ErrPortExcluded{
+		ip:   ip,
+		port: port,
+	}
+}
+
+// IP returns the address the port is excluded on
+func (e ErrPortExcluded) IP() string {
+	return e.ip
+}
+
+// Port returns the value of the excluded port
+func (e ErrPortExcluded) Port() int {
+	return e.port
+}
+
+// Error is the implementation of error.Error interface
+func (e ErrPortExcluded) Error() string {
+	return fmt.Sprintf("Bind for %s failed: port is excluded from the allocations", net.JoinHostPort(e.ip, strconv.Itoa(e.port)))
+}
+
+// Forbidden denotes the type of this error
+func (e ErrPortExcluded) Forbidden() {}
+
+// ParsePortRange parses a port or a range of ports in the begin-end form.
+func ParsePortRange(s string) (PortRange, error) {
+	var (
+		r   PortRange
+		err error
+	)
+
+	begin, end := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		begin, end = s[:i], s[i+1:]
+	}
+	if r.Begin, err = strconv.Atoi(strings.TrimSpace(begin)); err != nil {
+		return r, types.BadRequestErrorf("invalid port range %q", s)
+	}
+	if r.End, err = strconv.Atoi(strings.TrimSpace(end)); err != nil {
+		return r, types.BadRequestErrorf("invalid port range %q", s)
+	}
+	return r, r.validate()
+}
+
+// ParsePortRanges parses a comma separated list of ports and port ranges.
+func ParsePortRanges(s string) ([]PortRange, error) {
+	var ranges []PortRange
+	for _, f := range strings.Split(s, ",") {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+		r, err := ParsePortRange(f)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func (r PortRange) String() string {
+	if r.Begin == r.End {
+		return strconv.Itoa(r.Begin)
+	}
+	return getRangeKey(r.Begin, r.End)
+}
+
+func (r PortRange) isZero() bool {
+	return r.Begin == 0 && r.End == 0
+}
+
+func (r PortRange) contains(port int) bool {
+	return port >= r.Begin && port <= r.End
+}
+
+func (r PortRange) validate() error {
+	if r.Begin < 1 || r.End > 65535 || r.Begin > r.End {
+		return types.BadRequestErrorf("invalid port range %s", r)
+	}
+	return nil
+}
+
+func (hc HostConfig) validate() error {
+	if !hc.DynamicRange.isZero() {
+		if err := hc.DynamicRange.validate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range hc.Excluded {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Configure replaces the configuration of the ports pools of the allocator.
+// The ports already allocated are left allocated, and the configurations
+// added by the owners of the host addresses are kept.
+func (p *PortAllocator) Configure(cfg Config) error {
+	if err := cfg.Default.validate(); err != nil {
+		return err
+	}
+
+	hosts := make(map[string]HostConfig, len(cfg.Hosts))
+	for ip, hc := range cfg.Hosts {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return types.BadRequestErrorf("invalid host address %q in port allocator configuration", ip)
+		}
+		if err := hc.validate(); err != nil {
+			return err
+		}
+		hosts[getIPKey(addr)] = hc
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.config = Config{Default: cfg.Default, Hosts: hosts}
+	p.Begin, p.End = p.ephemeral.Begin, p.ephemeral.End
+	if r := cfg.Default.DynamicRange; !r.isZero() {
+		p.Begin, p.End = r.Begin, r.End
+	}
+	p.updateDynamicRanges()
+
+	return nil
+}
+
+// AddHostConfig adds the configuration of the ports pools of the host
+// address owned by owner, such as a network, until RemoveHostConfig. The
+// excluded ports add to the ones of the allocator configuration and of the
+// other owners of the address. The dynamic range takes precedence over the
+// one of the allocator configuration, and the owners setting one must agree
+// on it.
+func (p *PortAllocator) AddHostConfig(owner string, ip net.IP, hc HostConfig) error {
+	if ip == nil {
+		ip = defaultIP
+	}
+	if err := hc.validate(); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ipKey := getIPKey(ip)
+	if !hc.DynamicRange.isZero() {
+		for o, ohc := range p.owned[ipKey] {
+			if o != owner && !ohc.DynamicRange.isZero() && ohc.DynamicRange != hc.DynamicRange {
+				return types.ForbiddenErrorf("dynamic port range %s conflicts with the range %s of %s on %s", hc.DynamicRange, ohc.DynamicRange, o, ip)
+			}
+		}
+	}
+
+	if p.owned[ipKey] == nil {
+		p.owned[ipKey] = make(map[string]HostConfig)
+	}
+	p.owned[ipKey][owner] = hc
+	p.updateDynamicRanges()
+
+	return nil
+}
+
+// RemoveHostConfig removes the configuration of the ports pools of the host
+// address added by owner.
+func (p *PortAllocator) RemoveHostConfig(owner string, ip net.IP) {
+	if ip == nil {
+		ip = defaultIP
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ipKey := getIPKey(ip)
+	delete(p.owned[ipKey], owner)
+	if len(p.owned[ipKey]) == 0 {
+		delete(p.owned, ipKey)
+	}
+	p.updateDynamicRanges()
+}
+
+// dynamicRange returns the dynamic port range of the host address key.
+func (p *PortAllocator) dynamicRange(ipKey string) (int, int) {
+	for _, hc := range p.owned[ipKey] {
+		if !hc.DynamicRange.isZero() {
+			return hc.DynamicRange.Begin, hc.DynamicRange.End
+		}
+	}
+	if hc, ok := p.config.Hosts[ipKey]; ok && !hc.DynamicRange.isZero() {
+		return hc.DynamicRange.Begin, hc.DynamicRange.End
+	}
+	return p.Begin, p.End
+}
+
+// updateDynamicRanges applies the dynamic port ranges to the existing pools.
+func (p *PortAllocator) updateDynamicRanges() {
+	for ipKey, protomap := range p.ipMap {
+		begin, end := p.dynamicRange(ipKey)
+		for _, pm := range protomap {
+			pm.setDefaultRange(begin, end)
+		}
+	}
+}
+
+// isExcluded tells whether the port is excluded from the allocations on the
+// host address key.
+func (p *PortAllocator) isExcluded(ipKey string, port int) bool {
+	for _, r := range p.config.Default.Excluded {
+		if r.contains(port) {
+			return true
+		}
+	}
+	for _, r := range p.config.Hosts[ipKey].Excluded {
+		if r.contains(port) {
+			return true
+		}
+	}
+	for _, hc := range p.owned[ipKey] {
+		for _, r := range hc.Excluded {
+			if r.contains(port) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
 )
 
 const (
@@ -52,23 +56,31 @@ func (e ErrPortAlreadyAllocated) Port() int {
 	return e.port
 }
 
-// IPPort returns the address and the port in the form ip:port
+// IPPort returns the address and the port in the form ip:port,
+// or [ip]:port for an IPv6 address
 func (e ErrPortAlreadyAllocated) IPPort() string {
-	return fmt.Sprintf("%s:%d", e.ip, e.port)
+	return net.JoinHostPort(e.ip, strconv.Itoa(e.port))
 }
 
 // Error is the implementation of error.Error interface
 func (e ErrPortAlreadyAllocated) Error() string {
-	return fmt.Sprintf("Bind for %s:%d failed: port is already allocated", e.ip, e.port)
+	return fmt.Sprintf("Bind for %s failed: port is already allocated", e.IPPort())
 }
 
 type (
 	// PortAllocator manages the transport ports database
 	PortAllocator struct {
-		mutex sync.Mutex
-		ipMap ipMapping
-		Begin int
-		End   int
+		mutex       sync.Mutex
+		ipMap       ipMapping
+		store       datastore.DataStore
+		allocations map[string]*allocation
+		config      Config
+		// owned are the configurations of the host addresses added by
+		// their owners, by host address and owner
+		owned     map[string]map[string]HostConfig
+		ephemeral PortRange
+		Begin     int
+		End       int
 	}
 	portRange struct {
 		begin int
@@ -100,9 +112,12 @@ func newInstance() *PortAllocator {
 		start, end = DefaultPortRangeStart, DefaultPortRangeEnd
 	}
 	return &PortAllocator{
-		ipMap: ipMapping{},
-		Begin: start,
-		End:   end,
+		ipMap:       ipMapping{},
+		allocations: make(map[string]*allocation),
+		owned:       make(map[string]map[string]HostConfig),
+		ephemeral:   PortRange{Begin: start, End: end},
+		Begin:       start,
+		End:         end,
 	}
 }
 
@@ -139,42 +154,74 @@ func (p *PortAllocator) RequestPort(ip net.IP, proto string, port int) (int, err
 // Otherwise (portStart == portEnd) it checks port availability in the requested proto's port-pool
 // and returns that port or error if port is already busy.
 func (p *PortAllocator) RequestPortInRange(ip net.IP, proto string, portStart, portEnd int) (int, error) {
+	return p.RequestPortForEndpoint("", ip, proto, portStart, portEnd)
+}
+
+// RequestPortForEndpoint requests new port like RequestPortInRange, on behalf
+// of the endpoint. When the allocator is backed by a datastore, the allocation
+// is recorded there along with the endpoint, and a port allocation restored
+// from the datastore is handed back to the endpoint which owned it.
+func (p *PortAllocator) RequestPortForEndpoint(eid string, ip net.IP, proto string, portStart, portEnd int) (int, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if proto != "tcp" && proto != "udp" {
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
 		return 0, ErrUnknownProtocol
 	}
 
 	if ip == nil {
 		ip = defaultIP
 	}
-	ipstr := ip.String()
-	protomap, ok := p.ipMap[ipstr]
-	if !ok {
-		protomap = protoMap{
-			"tcp": p.newPortMap(),
-			"udp": p.newPortMap(),
-		}
-
-		p.ipMap[ipstr] = protomap
-	}
-	mapping := protomap[proto]
+	ipstr := getIPKey(ip)
+	mapping := p.getProtoMap(ipstr)[proto]
 	if portStart > 0 && portStart == portEnd {
-		if _, ok := mapping.p[portStart]; !ok {
-			mapping.p[portStart] = struct{}{}
-			return portStart, nil
+		if p.isExcluded(ipstr, portStart) {
+			return 0, newErrPortExcluded(ip.String(), portStart)
 		}
-		return 0, newErrPortAlreadyAllocated(ipstr, portStart)
+		if _, ok := mapping.p[portStart]; ok {
+			if p.claim(eid, ipstr, proto, portStart) {
+				return portStart, nil
+			}
+			return 0, newErrPortAlreadyAllocated(ip.String(), portStart)
+		}
+		mapping.p[portStart] = struct{}{}
+		if err := p.persist(eid, ipstr, proto, portStart); err != nil {
+			delete(mapping.p, portStart)
+			return 0, err
+		}
+		return portStart, nil
 	}
 
-	port, err := mapping.findPort(portStart, portEnd)
+	port, err := mapping.findPort(portStart, portEnd, func(port int) bool {
+		return p.isExcluded(ipstr, port)
+	})
 	if err != nil {
 		return 0, err
 	}
+	if err := p.persist(eid, ipstr, proto, port); err != nil {
+		delete(mapping.p, port)
+		return 0, err
+	}
 	return port, nil
 }
 
+// getProtoMap returns the ports pools of the host address key, creating them
+// if needed.
+func (p *PortAllocator) getProtoMap(ipKey string) protoMap {
+	protomap, ok := p.ipMap[ipKey]
+	if !ok {
+		begin, end := p.dynamicRange(ipKey)
+		protomap = protoMap{
+			"tcp":  newPortMap(begin, end),
+			"udp":  newPortMap(begin, end),
+			"sctp": newPortMap(begin, end),
+		}
+
+		p.ipMap[ipKey] = protomap
+	}
+	return protomap
+}
+
 // ReleasePort releases port from global ports pool for specified ip and proto.
 func (p *PortAllocator) ReleasePort(ip net.IP, proto string, port int) error {
 	p.mutex.Lock()
@@ -183,31 +230,71 @@ func (p *PortAllocator) ReleasePort(ip net.IP, proto string, port int) error {
 	if ip == nil {
 		ip = defaultIP
 	}
-	protomap, ok := p.ipMap[ip.String()]
+	ipstr := getIPKey(ip)
+	protomap, ok := p.ipMap[ipstr]
 	if !ok {
 		return nil
 	}
+	// The port remains allocated if its record cannot be deleted
+	if err := p.unpersist(ipstr, proto, port); err != nil {
+		return err
+	}
 	delete(protomap[proto].p, port)
 	return nil
 }
 
-func (p *PortAllocator) newPortMap() *portMap {
-	defaultKey := getRangeKey(p.Begin, p.End)
+// getIPKey returns the key of the ports pool of the host address. An
+// IPv4-mapped IPv6 address shares the pool of the IPv4 address, and the
+// IPv6 unspecified address shares the one of the IPv4 unspecified address,
+// as a listener on [::] also accepts the IPv4 connections.
+func getIPKey(ip net.IP) string {
+	if ip.IsUnspecified() {
+		return defaultIP.String()
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.String()
+}
+
+func newPortMap(begin, end int) *portMap {
+	defaultKey := getRangeKey(begin, end)
 	pm := &portMap{
 		p:            map[int]struct{}{},
 		defaultRange: defaultKey,
 		portRanges: map[string]*portRange{
-			defaultKey: newPortRange(p.Begin, p.End),
+			defaultKey: newPortRange(begin, end),
 		},
 	}
 	return pm
 }
 
+// setDefaultRange sets the range the ports are picked from when no range is
+// requested.
+func (pm *portMap) setDefaultRange(begin, end int) {
+	key := getRangeKey(begin, end)
+	if _, ok := pm.portRanges[key]; !ok {
+		pm.portRanges[key] = newPortRange(begin, end)
+	}
+	pm.defaultRange = key
+}
+
 // ReleaseAll releases all ports for all ips.
 func (p *PortAllocator) ReleaseAll() error {
 	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
 	p.ipMap = ipMapping{}
-	p.mutex.Unlock()
+	if p.store == nil {
+		return nil
+	}
+
+	for key, a := range p.allocations {
+		if err := p.store.DeleteObjectAtomic(a); err != nil && err != datastore.ErrKeyNotFound {
+			logrus.Warnf("Failed to delete port allocation %s: %v", a, err)
+		}
+		delete(p.allocations, key)
+	}
 	return nil
 }
 
@@ -247,7 +334,7 @@ func (pm *portMap) getPortRange(portStart, portEnd int) (*portRange, error) {
 	return pr, nil
 }
 
-func (pm *portMap) findPort(portStart, portEnd int) (int, error) {
+func (pm *portMap) findPort(portStart, portEnd int, excluded func(int) bool) (int, error) {
 	pr, err := pm.getPortRange(portStart, portEnd)
 	if err != nil {
 		return 0, err
@@ -260,7 +347,7 @@ func (pm *portMap) findPort(portStart, portEnd int) (int, error) {
 			port = pr.begin
 		}
 
-		if _, ok := pm.p[port]; !ok {
+		if _, ok := pm.p[port]; !ok && !excluded(port) {
 			pm.p[port] = struct{}{}
 			pr.last = port
 			return port, nil
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	_ "github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
 )
 
 func resetPortAllocator() {
@@ -104,6 +105,32 @@ func TestUnknowProtocol(t *testing.T) {
 	}
 }
 
+func TestSCTPPorts(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	if _, err := p.RequestPort(defaultIP, "tcp", 2905); err != nil {
+		t.Fatal(err)
+	}
+	// The protocols have their own pools
+	port, err := p.RequestPort(defaultIP, "sctp", 2905)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 2905 {
+		t.Fatalf("Expected port 2905 got %d", port)
+	}
+	if _, err := p.RequestPort(defaultIP, "sctp", 2905); err == nil {
+		t.Fatal("Expected sctp port allocation error")
+	}
+	if err := p.ReleasePort(defaultIP, "sctp", 2905); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(defaultIP, "sctp", 2905); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestAllocateAllPorts(t *testing.T) {
 	p := Get()
 	defer resetPortAllocator()
@@ -318,3 +345,256 @@ func TestNoDuplicateBPR(t *testing.T) {
 		t.Fatalf("Acquire(0) allocated the same port twice: %d", port)
 	}
 }
+
+func TestIPv6Ports(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	ip := net.ParseIP("2001:db8::1")
+	if _, err := p.RequestPort(ip, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := p.RequestPort(net.ParseIP("2001:db8:0::1"), "tcp", 5000)
+	if err == nil {
+		t.Fatal("Expected an error for an already allocated port of the same IPv6 address")
+	}
+	alreadyAllocatedErr, ok := err.(ErrPortAlreadyAllocated)
+	if !ok {
+		t.Fatalf("Expected port already allocated error, got %T: %v", err, err)
+	}
+	if expected := "[2001:db8::1]:5000"; alreadyAllocatedErr.IPPort() != expected {
+		t.Fatalf("Expected %s, got %s", expected, alreadyAllocatedErr.IPPort())
+	}
+
+	if _, err := p.RequestPort(net.ParseIP("2001:db8::2"), "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ReleasePort(ip, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(ip, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIPv6UnspecifiedAndMappedPorts(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	// A listener on [::] also accepts the IPv4 connections
+	if _, err := p.RequestPort(net.IPv6unspecified, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(defaultIP, "tcp", 5000); err == nil {
+		t.Fatal("Expected an error for a port already allocated on the IPv6 unspecified address")
+	}
+	if _, err := p.RequestPort(nil, "tcp", 5000); err == nil {
+		t.Fatal("Expected an error for a port already allocated on the IPv6 unspecified address")
+	}
+	if err := p.ReleasePort(defaultIP, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(net.IPv6unspecified, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	// IPv4-mapped addresses share the ports of the IPv4 address
+	if _, err := p.RequestPort(net.ParseIP("192.168.0.1").To4(), "udp", 5000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(net.ParseIP("::ffff:192.168.0.1"), "udp", 5000); err == nil {
+		t.Fatal("Expected an error for a port already allocated on the IPv4 address")
+	}
+}
+
+func TestExcludedPorts(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	ip := net.ParseIP("192.168.0.1")
+	cfg := Config{
+		Default: HostConfig{Excluded: []PortRange{{Begin: 22, End: 22}}},
+		Hosts: map[string]HostConfig{
+			ip.String(): {Excluded: []PortRange{{Begin: 8000, End: 8099}}},
+		},
+	}
+	if err := p.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ip   net.IP
+		port int
+	}{
+		{defaultIP, 22},
+		{ip, 22},
+		{ip, 8050},
+	} {
+		_, err := p.RequestPort(tc.ip, "tcp", tc.port)
+		if _, ok := err.(types.ForbiddenError); !ok {
+			t.Fatalf("Expected a forbidden error for port %d on %s, got %v", tc.port, tc.ip, err)
+		}
+		if e, ok := err.(ErrPortExcluded); !ok || e.Port() != tc.port {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if _, err := p.RequestPort(defaultIP, "tcp", 8050); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ports of the requested ranges skip the excluded ones
+	port, err := p.RequestPortInRange(ip, "udp", 7999, 8100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 7999 {
+		t.Fatalf("Expected port 7999 got %d", port)
+	}
+	if port, err = p.RequestPortInRange(ip, "udp", 7999, 8100); err != nil {
+		t.Fatal(err)
+	}
+	if port != 8100 {
+		t.Fatalf("Expected port 8100 got %d", port)
+	}
+	if _, err := p.RequestPortInRange(ip, "udp", 7999, 8100); err != ErrAllPortsAllocated {
+		t.Fatalf("Expected error %s got %v", ErrAllPortsAllocated, err)
+	}
+}
+
+func TestDynamicPortRanges(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	ip := net.ParseIP("192.168.0.1")
+	// Pools created before the configuration switch ranges as well
+	if _, err := p.RequestPort(ip, "tcp", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Default: HostConfig{DynamicRange: PortRange{Begin: 30000, End: 30001}},
+		Hosts: map[string]HostConfig{
+			"::ffff:192.168.0.1": {
+				DynamicRange: PortRange{Begin: 40000, End: 40009},
+				Excluded:     []PortRange{{Begin: 40000, End: 40000}},
+			},
+		},
+	}
+	if err := p.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []int{30000, 30001} {
+		if port, err := p.RequestPort(nil, "tcp", 0); err != nil || port != expected {
+			t.Fatalf("Expected port %d got %d (%v)", expected, port, err)
+		}
+	}
+	if _, err := p.RequestPort(nil, "tcp", 0); err != ErrAllPortsAllocated {
+		t.Fatalf("Expected error %s got %v", ErrAllPortsAllocated, err)
+	}
+
+	if port, err := p.RequestPort(ip, "tcp", 0); err != nil || port != 40001 {
+		t.Fatalf("Expected port 40001 got %d (%v)", port, err)
+	}
+
+	if err := p.AddHostConfig("n1", ip, HostConfig{DynamicRange: PortRange{Begin: 50000, End: 50009}}); err != nil {
+		t.Fatal(err)
+	}
+	if port, err := p.RequestPort(ip, "udp", 0); err != nil || port != 50000 {
+		t.Fatalf("Expected port 50000 got %d (%v)", port, err)
+	}
+
+	for _, cfg := range []Config{
+		{Default: HostConfig{DynamicRange: PortRange{Begin: 2000, End: 1000}}},
+		{Default: HostConfig{Excluded: []PortRange{{Begin: 0, End: 80}}}},
+		{Hosts: map[string]HostConfig{"invalid": {}}},
+	} {
+		if err := p.Configure(cfg); err == nil {
+			t.Fatalf("Expected failure for the invalid configuration %v", cfg)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type %T: %v", err, err)
+		}
+	}
+}
+
+func TestHostConfigOwners(t *testing.T) {
+	p := Get()
+	defer resetPortAllocator()
+
+	ip := net.ParseIP("192.168.0.1")
+	cfg := Config{
+		Hosts: map[string]HostConfig{
+			"192.168.0.1": {Excluded: []PortRange{{Begin: 7000, End: 7000}}},
+		},
+	}
+	if err := p.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.AddHostConfig("n1", ip, HostConfig{
+		DynamicRange: PortRange{Begin: 50000, End: 50009},
+		Excluded:     []PortRange{{Begin: 7001, End: 7001}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddHostConfig("n2", ip, HostConfig{Excluded: []PortRange{{Begin: 7002, End: 7002}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddHostConfig("n3", ip, HostConfig{DynamicRange: PortRange{Begin: 60000, End: 60009}}); err == nil {
+		t.Fatal("Expected failure on a conflicting dynamic range")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type %T: %v", err, err)
+	}
+
+	// The excluded ports of the configuration and of all the owners add up
+	for _, port := range []int{7000, 7001, 7002} {
+		if _, err := p.RequestPort(ip, "tcp", port); err == nil {
+			t.Fatalf("Expected port %d to be excluded", port)
+		}
+	}
+	if port, err := p.RequestPort(ip, "tcp", 0); err != nil || port != 50000 {
+		t.Fatalf("Expected port 50000 got %d (%v)", port, err)
+	}
+
+	// Removing the owners restores the allocator configuration
+	p.RemoveHostConfig("n1", ip)
+	p.RemoveHostConfig("n2", ip)
+	for _, port := range []int{7001, 7002} {
+		if _, err := p.RequestPort(ip, "tcp", port); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.RequestPort(ip, "tcp", 7000); err == nil {
+		t.Fatal("Expected port 7000 to remain excluded")
+	}
+	if port, err := p.RequestPort(ip, "udp", 0); err != nil || port != p.Begin {
+		t.Fatalf("Expected port %d got %d (%v)", p.Begin, port, err)
+	}
+}
+
+func TestParsePortRanges(t *testing.T) {
+	ranges, err := ParsePortRanges("22, 8000-8099,,65535")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PortRange{{22, 22}, {8000, 8099}, {65535, 65535}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("Expected %v got %v", expected, ranges)
+	}
+	for i := range expected {
+		if ranges[i] != expected[i] {
+			t.Fatalf("Expected %v got %v", expected, ranges)
+		}
+	}
+	if s := expected[1].String(); s != "8000-8099" {
+		t.Fatalf("Unexpected port range string %s", s)
+	}
+
+	for _, s := range []string{"a", "80-", "100-80", "0", "65536"} {
+		if _, err := ParsePortRange(s); err == nil {
+			t.Fatalf("Expected failure parsing %q", s)
+		}
+	}
+}
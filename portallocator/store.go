@@ -0,0 +1,232 @@
+package portallocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+)
+
+const allocationPrefix = "port-allocation"
+
+// allocation is a host port allocation recorded in the datastore, along with
+// the endpoint owning it.
+type allocation struct {
+	ip         string
+	proto      string
+	port       int
+	endpointID string
+	// restored is set on the allocations loaded from the datastore until
+	// their endpoint claims them again
+	restored bool
+	dbIndex  uint64
+	dbExists bool
+}
+
+func allocationKey(ipKey, proto string, port int) string {
+	return ipKey + "/" + proto + "/" + strconv.Itoa(port)
+}
+
+func (a *allocation) key() string {
+	return allocationKey(a.ip, a.proto, a.port)
+}
+
+func (a *allocation) String() string {
+	return fmt.Sprintf("%s of endpoint %q", a.key(), a.endpointID)
+}
+
+func (a *allocation) MarshalJSON() ([]byte, error) {
+	aMap := make(map[string]interface{})
+	aMap["IP"] = a.ip
+	aMap["Proto"] = a.proto
+	aMap["Port"] = a.port
+	aMap["EndpointID"] = a.endpointID
+	return json.Marshal(aMap)
+}
+
+func (a *allocation) UnmarshalJSON(b []byte) error {
+	var aMap map[string]interface{}
+	if err := json.Unmarshal(b, &aMap); err != nil {
+		return err
+	}
+
+	a.ip = aMap["IP"].(string)
+	a.proto = aMap["Proto"].(string)
+	a.port = int(aMap["Port"].(float64))
+	a.endpointID = aMap["EndpointID"].(string)
+	return nil
+}
+
+// Key provides the Key to be used in KV Store
+func (a *allocation) Key() []string {
+	return []string{allocationPrefix, a.ip, a.proto, strconv.Itoa(a.port)}
+}
+
+// KeyPrefix returns the parent key of all the allocations
+func (a *allocation) KeyPrefix() []string {
+	return []string{allocationPrefix}
+}
+
+// Value marshals the data to be stored in the KV store
+func (a *allocation) Value() []byte {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// SetValue unmarshalls the data from the KV store
+func (a *allocation) SetValue(value []byte) error {
+	return json.Unmarshal(value, a)
+}
+
+// Index returns the latest DB Index as seen by this object
+func (a *allocation) Index() uint64 {
+	return a.dbIndex
+}
+
+// SetIndex method allows the datastore to store the latest DB Index into this object
+func (a *allocation) SetIndex(index uint64) {
+	a.dbIndex = index
+	a.dbExists = true
+}
+
+// Exists method is true if this object has been stored in the DB.
+func (a *allocation) Exists() bool {
+	return a.dbExists
+}
+
+// Skip provides a way for a KV Object to avoid persisting it in the KV Store
+func (a *allocation) Skip() bool {
+	return false
+}
+
+// New returns a new allocation to be filled from the KV store
+func (a *allocation) New() datastore.KVObject {
+	return &allocation{}
+}
+
+// CopyTo deep copies the allocation to the passed destination object
+func (a *allocation) CopyTo(o datastore.KVObject) error {
+	dstA := o.(*allocation)
+	*dstA = *a
+	return nil
+}
+
+// DataScope indicates the storage scope of the allocations
+func (a *allocation) DataScope() string {
+	return datastore.LocalScope
+}
+
+// SetStore backs the allocator with the local datastore, which records the
+// port allocations along with the endpoint owning them. The allocations
+// found in the datastore are reserved until their endpoint claims them again
+// or Reconcile releases them.
+func (p *PortAllocator) SetStore(ds datastore.DataStore) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.store = ds
+	p.allocations = make(map[string]*allocation)
+	if ds == nil {
+		return nil
+	}
+
+	kvol, err := ds.List(datastore.Key(allocationPrefix), &allocation{})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return fmt.Errorf("failed to get port allocations from store: %v", err)
+	}
+
+	for _, kvo := range kvol {
+		a := &allocation{}
+		kvo.(*allocation).CopyTo(a)
+		mapping, ok := p.getProtoMap(a.ip)[a.proto]
+		if !ok {
+			logrus.Warnf("Ignoring port allocation %s of unknown protocol", a)
+			continue
+		}
+		a.restored = true
+		mapping.p[a.port] = struct{}{}
+		p.allocations[a.key()] = a
+	}
+
+	return nil
+}
+
+// Reconcile releases the allocations restored from the datastore which no
+// port mapping claimed again and whose endpoint is not in the live ones.
+// The allocations of the live endpoints remain reserved, as their ports
+// may still be forwarded to the containers.
+func (p *PortAllocator) Reconcile(liveEndpoints map[string]bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.store == nil {
+		return nil
+	}
+
+	var firstErr error
+	for key, a := range p.allocations {
+		if !a.restored || (a.endpointID != "" && liveEndpoints[a.endpointID]) {
+			continue
+		}
+		if err := p.store.DeleteObjectAtomic(a); err != nil && err != datastore.ErrKeyNotFound {
+			logrus.Warnf("Failed to release stale port allocation %s: %v", a, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		logrus.Debugf("Released stale port allocation %s", a)
+		delete(p.allocations, key)
+		if protomap, ok := p.ipMap[a.ip]; ok {
+			delete(protomap[a.proto].p, a.port)
+		}
+	}
+
+	return firstErr
+}
+
+// persist records the allocation of the port in the datastore, if any.
+func (p *PortAllocator) persist(eid, ipKey, proto string, port int) error {
+	if p.store == nil {
+		return nil
+	}
+
+	a := &allocation{ip: ipKey, proto: proto, port: port, endpointID: eid}
+	if err := p.store.PutObjectAtomic(a); err != nil {
+		return fmt.Errorf("failed to record port allocation %s: %v", a, err)
+	}
+	p.allocations[a.key()] = a
+	return nil
+}
+
+// unpersist deletes the record of the allocation of the port from the
+// datastore, if any.
+func (p *PortAllocator) unpersist(ipKey, proto string, port int) error {
+	key := allocationKey(ipKey, proto, port)
+	a, ok := p.allocations[key]
+	if p.store == nil || !ok {
+		return nil
+	}
+
+	if err := p.store.DeleteObjectAtomic(a); err != nil && err != datastore.ErrKeyNotFound {
+		return fmt.Errorf("failed to delete port allocation %s: %v", a, err)
+	}
+	delete(p.allocations, key)
+	return nil
+}
+
+// claim tells whether the port is the one of an allocation restored from the
+// datastore for the endpoint, which the endpoint then owns again.
+func (p *PortAllocator) claim(eid, ipKey, proto string, port int) bool {
+	a, ok := p.allocations[allocationKey(ipKey, proto, port)]
+	if !ok || !a.restored || eid == "" || a.endpointID != eid {
+		return false
+	}
+	a.restored = false
+	return true
+}
@@ -0,0 +1,151 @@
+package portallocator
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/docker/libnetwork/datastore"
+)
+
+func newTestStore(t *testing.T) (datastore.DataStore, func()) {
+	tmp, err := ioutil.TempFile("", "portallocator-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	ds, err := datastore.NewDataStore(datastore.LocalScope, &datastore.ScopeCfg{
+		Client: datastore.ScopeClientCfg{
+			Provider: "boltdb",
+			Address:  tmp.Name(),
+			Config: &store.Config{
+				Bucket:            "libnetwork",
+				ConnectionTimeout: 3 * time.Second,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.Remove(tmp.Name())
+	}
+}
+
+func TestPersistentAllocations(t *testing.T) {
+	ds, cleanup := newTestStore(t)
+	defer cleanup()
+
+	p := newInstance()
+	if err := p.SetStore(ds); err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.ParseIP("192.168.0.1")
+	if _, err := p.RequestPortForEndpoint("ep1", ip, "tcp", 5000, 5000); err != nil {
+		t.Fatal(err)
+	}
+	port, err := p.RequestPortForEndpoint("ep2", nil, "udp", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPortForEndpoint("ep3", nil, "tcp", 6000, 6000); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReleasePort(nil, "tcp", 6000); err != nil {
+		t.Fatal(err)
+	}
+
+	// The allocator of the restarted daemon knows the allocations
+	p = newInstance()
+	if err := p.SetStore(ds); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(ip, "tcp", 5000); err == nil {
+		t.Fatal("Expected the restored allocation to be reserved")
+	}
+	if _, err := p.RequestPortForEndpoint("ep2", ip, "tcp", 5000, 5000); err == nil {
+		t.Fatal("Expected the restored allocation to be reserved for its endpoint")
+	}
+	if _, err := p.RequestPortForEndpoint("ep3", nil, "tcp", 6000, 6000); err != nil {
+		t.Fatalf("Expected the released port to be available: %v", err)
+	}
+
+	// The owning endpoint maps the same port again
+	if _, err := p.RequestPortForEndpoint("ep1", ip, "tcp", 5000, 5000); err != nil {
+		t.Fatalf("Expected the endpoint to claim its port: %v", err)
+	}
+	if _, err := p.RequestPortForEndpoint("ep1", ip, "tcp", 5000, 5000); err == nil {
+		t.Fatal("Expected a claimed allocation to be reserved")
+	}
+
+	// The endpoint of the udp port is still alive but was not restored
+	if err := p.Reconcile(map[string]bool{"ep2": true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(nil, "udp", port); err == nil {
+		t.Fatal("Expected the allocation of a live endpoint to remain reserved")
+	}
+
+	// Once the endpoint is gone, the next reconciliation releases it
+	if err := p.Reconcile(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(nil, "udp", port); err != nil {
+		t.Fatalf("Expected the stale allocation to be released: %v", err)
+	}
+	if _, err := p.RequestPortForEndpoint("ep4", ip, "tcp", 5000, 5000); err == nil {
+		t.Fatal("Expected the claimed allocation to survive the reconciliation")
+	}
+
+	kvol, err := ds.List(datastore.Key(allocationPrefix), &allocation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := make(map[string]string)
+	for _, kvo := range kvol {
+		a := kvo.(*allocation)
+		owners[a.key()] = a.endpointID
+	}
+	expected := map[string]string{
+		"192.168.0.1/tcp/5000":                "ep1",
+		"0.0.0.0/tcp/6000":                    "ep3",
+		allocationKey("0.0.0.0", "udp", port): "",
+	}
+	if len(owners) != len(expected) {
+		t.Fatalf("Expected allocations %v, got %v", expected, owners)
+	}
+	for k, eid := range expected {
+		if owner, ok := owners[k]; !ok || owner != eid {
+			t.Fatalf("Expected allocations %v, got %v", expected, owners)
+		}
+	}
+}
+
+func TestAllocationsWithoutStore(t *testing.T) {
+	p := newInstance()
+
+	ip := net.ParseIP("192.168.0.1")
+	if _, err := p.RequestPortForEndpoint("ep1", ip, "tcp", 5000, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reconcile(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(ip, "tcp", 5000); err == nil {
+		t.Fatal("Expected the port to remain allocated")
+	}
+
+	if err := p.ReleaseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RequestPort(ip, "tcp", 5000); err != nil {
+		t.Fatal(err)
+	}
+}
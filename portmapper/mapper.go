@@ -4,11 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/conntrack"
+	"github.com/docker/libnetwork/firewall"
 	"github.com/docker/libnetwork/iptables"
 	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/types"
 )
 
 type mapping struct {
@@ -20,6 +24,16 @@ type mapping struct {
 
 var newProxy = newProxyCommand
 
+// ProxyMode selects how the userland proxies of the mapped ports run
+type ProxyMode string
+
+const (
+	// ProxyProcess runs a docker-proxy process per mapped port
+	ProxyProcess ProxyMode = "process"
+	// ProxyInProcess runs the proxies of the mapped ports in the daemon
+	ProxyInProcess ProxyMode = "in-process"
+)
+
 var (
 	// ErrUnknownBackendAddressType refers to an unknown container or unsupported address type
 	ErrUnknownBackendAddressType = errors.New("unknown container address type not supported")
@@ -27,12 +41,18 @@ var (
 	ErrPortMappedForIP = errors.New("port is already mapped to ip")
 	// ErrPortNotMapped refers to an unmapped port
 	ErrPortNotMapped = errors.New("port is not mapped")
+	// ErrNoConnStats refers to a mapping whose proxy keeps no connection counters
+	ErrNoConnStats = errors.New("port mapping has no connection counters")
+	// ErrSCTPNotForwarded refers to an sctp port the iptables rules cannot forward
+	ErrSCTPNotForwarded = errors.New("sctp port mapping requires iptables rules forwarding the host address to the container")
 )
 
 // PortMapper manages the network address translation
 type PortMapper struct {
-	chain      *iptables.ChainInfo
+	chain      firewall.Chain
+	chainV6    firewall.Chain
 	bridgeName string
+	proxyMode  ProxyMode
 
 	// udp:ip:port
 	currentMappings map[string]*mapping
@@ -54,12 +74,52 @@ func NewWithPortAllocator(allocator *portallocator.PortAllocator) *PortMapper {
 	}
 }
 
-// SetIptablesChain sets the specified chain into portmapper
+// SetIptablesChain sets the specified iptables chain into portmapper, as
+// the chain of the address family the chain belongs to
 func (pm *PortMapper) SetIptablesChain(c *iptables.ChainInfo, bridgeName string) {
-	pm.chain = c
+	if c == nil {
+		pm.SetFirewallChain(nil, bridgeName)
+		return
+	}
+	pm.SetFirewallChain(firewall.NewIptablesChain(c), bridgeName)
+}
+
+// SetFirewallChain sets the specified chain into portmapper, as the
+// chain of the address family the chain belongs to
+func (pm *PortMapper) SetFirewallChain(c firewall.Chain, bridgeName string) {
+	if c != nil && c.Family() == firewall.IPv6 {
+		pm.chainV6 = c
+	} else {
+		pm.chain = c
+	}
 	pm.bridgeName = bridgeName
 }
 
+// SetProxyMode sets how the userland proxies of the ports mapped from then
+// on run. The proxies run as separate processes by default.
+func (pm *PortMapper) SetProxyMode(mode ProxyMode) {
+	pm.lock.Lock()
+	pm.proxyMode = mode
+	pm.lock.Unlock()
+}
+
+// ConnStats returns the connection counters of the userland proxy of the
+// specified host transport address, which only the in-process proxies keep
+func (pm *PortMapper) ConnStats(host net.Addr) (ConnStats, error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	m, exists := pm.currentMappings[getKey(host)]
+	if !exists {
+		return ConnStats{}, ErrPortNotMapped
+	}
+	p, ok := m.userlandProxy.(*inProcessProxy)
+	if !ok {
+		return ConnStats{}, ErrNoConnStats
+	}
+	return p.ConnStats(), nil
+}
+
 // Map maps the specified container transport address to the host's network address and transport port
 func (pm *PortMapper) Map(container net.Addr, hostIP net.IP, hostPort int, useProxy bool) (host net.Addr, err error) {
 	return pm.MapRange(container, hostIP, hostPort, hostPort, useProxy)
@@ -67,6 +127,12 @@ func (pm *PortMapper) Map(container net.Addr, hostIP net.IP, hostPort int, usePr
 
 // MapRange maps the specified container transport address to the host's network address and transport port range
 func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart, hostPortEnd int, useProxy bool) (host net.Addr, err error) {
+	return pm.MapRangeForEndpoint("", container, hostIP, hostPortStart, hostPortEnd, useProxy)
+}
+
+// MapRangeForEndpoint maps the specified container transport address like
+// MapRange, allocating the host port on behalf of the endpoint
+func (pm *PortMapper) MapRangeForEndpoint(eid string, container net.Addr, hostIP net.IP, hostPortStart, hostPortEnd int, useProxy bool) (host net.Addr, err error) {
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
 
@@ -79,7 +145,7 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 	switch container.(type) {
 	case *net.TCPAddr:
 		proto = "tcp"
-		if allocatedHostPort, err = pm.Allocator.RequestPortInRange(hostIP, proto, hostPortStart, hostPortEnd); err != nil {
+		if allocatedHostPort, err = pm.Allocator.RequestPortForEndpoint(eid, hostIP, proto, hostPortStart, hostPortEnd); err != nil {
 			return nil, err
 		}
 
@@ -90,13 +156,13 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 		}
 
 		if useProxy {
-			m.userlandProxy = newProxy(proto, hostIP, allocatedHostPort, container.(*net.TCPAddr).IP, container.(*net.TCPAddr).Port)
+			m.userlandProxy = pm.newUserlandProxy(proto, hostIP, allocatedHostPort, container.(*net.TCPAddr).IP, container.(*net.TCPAddr).Port)
 		} else {
 			m.userlandProxy = newDummyProxy(proto, hostIP, allocatedHostPort)
 		}
 	case *net.UDPAddr:
 		proto = "udp"
-		if allocatedHostPort, err = pm.Allocator.RequestPortInRange(hostIP, proto, hostPortStart, hostPortEnd); err != nil {
+		if allocatedHostPort, err = pm.Allocator.RequestPortForEndpoint(eid, hostIP, proto, hostPortStart, hostPortEnd); err != nil {
 			return nil, err
 		}
 
@@ -107,10 +173,27 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 		}
 
 		if useProxy {
-			m.userlandProxy = newProxy(proto, hostIP, allocatedHostPort, container.(*net.UDPAddr).IP, container.(*net.UDPAddr).Port)
+			m.userlandProxy = pm.newUserlandProxy(proto, hostIP, allocatedHostPort, container.(*net.UDPAddr).IP, container.(*net.UDPAddr).Port)
 		} else {
 			m.userlandProxy = newDummyProxy(proto, hostIP, allocatedHostPort)
 		}
+	case *types.SCTPAddr:
+		proto = "sctp"
+		// There is no userland proxy for sctp, the traffic is
+		// only forwarded by the iptables rules
+		if pm.forwardChain(hostIP, container.(*types.SCTPAddr).IP) == nil {
+			return nil, ErrSCTPNotForwarded
+		}
+		if allocatedHostPort, err = pm.Allocator.RequestPortForEndpoint(eid, hostIP, proto, hostPortStart, hostPortEnd); err != nil {
+			return nil, err
+		}
+
+		m = &mapping{
+			proto:         proto,
+			host:          &types.SCTPAddr{IP: hostIP, Port: allocatedHostPort},
+			container:     container,
+			userlandProxy: newDummyProxy(proto, hostIP, allocatedHostPort),
+		}
 	default:
 		return nil, ErrUnknownBackendAddressType
 	}
@@ -128,14 +211,14 @@ func (pm *PortMapper) MapRange(container net.Addr, hostIP net.IP, hostPortStart,
 	}
 
 	containerIP, containerPort := getIPAndPort(m.container)
-	if err := pm.forward(iptables.Append, m.proto, hostIP, allocatedHostPort, containerIP.String(), containerPort); err != nil {
+	if err := pm.forward(firewall.Append, m.proto, hostIP, allocatedHostPort, containerIP, containerPort); err != nil {
 		return nil, err
 	}
 
 	cleanup := func() error {
 		// need to undo the iptables rules before we return
 		m.userlandProxy.Stop()
-		pm.forward(iptables.Delete, m.proto, hostIP, allocatedHostPort, containerIP.String(), containerPort)
+		pm.forward(firewall.Delete, m.proto, hostIP, allocatedHostPort, containerIP, containerPort)
 		if err := pm.Allocator.ReleasePort(hostIP, m.proto, allocatedHostPort); err != nil {
 			return err
 		}
@@ -173,15 +256,29 @@ func (pm *PortMapper) Unmap(host net.Addr) error {
 
 	containerIP, containerPort := getIPAndPort(data.container)
 	hostIP, hostPort := getIPAndPort(data.host)
-	if err := pm.forward(iptables.Delete, data.proto, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
+	if err := pm.forward(firewall.Delete, data.proto, hostIP, hostPort, containerIP, containerPort); err != nil {
 		logrus.Errorf("Error on iptables delete: %s", err)
 	}
 
+	if data.proto == "udp" {
+		// The datagrams of the tracked flows would keep being forwarded to
+		// the container until the entries time out
+		if n, err := conntrack.DeleteForwardedTo(types.UDP, hostIP, hostPort, containerIP, containerPort); err != nil {
+			if !conntrack.IsNotSupported(err) {
+				logrus.Warnf("Failed to flush the conntrack entries of %s: %v", key, err)
+			}
+		} else if n > 0 {
+			logrus.Debugf("Flushed %d conntrack entries of %s", n, key)
+		}
+	}
+
 	switch a := host.(type) {
 	case *net.TCPAddr:
 		return pm.Allocator.ReleasePort(a.IP, "tcp", a.Port)
 	case *net.UDPAddr:
 		return pm.Allocator.ReleasePort(a.IP, "udp", a.Port)
+	case *types.SCTPAddr:
+		return pm.Allocator.ReleasePort(a.IP, "sctp", a.Port)
 	}
 	return nil
 }
@@ -194,18 +291,28 @@ func (pm *PortMapper) ReMapAll() {
 	for _, data := range pm.currentMappings {
 		containerIP, containerPort := getIPAndPort(data.container)
 		hostIP, hostPort := getIPAndPort(data.host)
-		if err := pm.forward(iptables.Append, data.proto, hostIP, hostPort, containerIP.String(), containerPort); err != nil {
+		if err := pm.forward(firewall.Append, data.proto, hostIP, hostPort, containerIP, containerPort); err != nil {
 			logrus.Errorf("Error on iptables add: %s", err)
 		}
 	}
 }
 
+// newUserlandProxy returns the userland proxy of the mode of the port mapper
+func (pm *PortMapper) newUserlandProxy(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int) userlandProxy {
+	if pm.proxyMode == ProxyInProcess {
+		return newInProcessProxy(proto, hostIP, hostPort, containerIP, containerPort)
+	}
+	return newProxy(proto, hostIP, hostPort, containerIP, containerPort)
+}
+
 func getKey(a net.Addr) string {
 	switch t := a.(type) {
 	case *net.TCPAddr:
-		return fmt.Sprintf("%s:%d/%s", t.IP.String(), t.Port, "tcp")
+		return fmt.Sprintf("%s/%s", net.JoinHostPort(t.IP.String(), strconv.Itoa(t.Port)), "tcp")
 	case *net.UDPAddr:
-		return fmt.Sprintf("%s:%d/%s", t.IP.String(), t.Port, "udp")
+		return fmt.Sprintf("%s/%s", net.JoinHostPort(t.IP.String(), strconv.Itoa(t.Port)), "udp")
+	case *types.SCTPAddr:
+		return fmt.Sprintf("%s/%s", net.JoinHostPort(t.IP.String(), strconv.Itoa(t.Port)), "sctp")
 	}
 	return ""
 }
@@ -216,13 +323,32 @@ func getIPAndPort(a net.Addr) (net.IP, int) {
 		return t.IP, t.Port
 	case *net.UDPAddr:
 		return t.IP, t.Port
+	case *types.SCTPAddr:
+		return t.IP, t.Port
 	}
 	return nil, 0
 }
 
-func (pm *PortMapper) forward(action iptables.Action, proto string, sourceIP net.IP, sourcePort int, containerIP string, containerPort int) error {
-	if pm.chain == nil {
+// forward programs the DNAT rules in the chain of the container address
+// family. Translating between families is left to the userland proxy, so
+// nothing is programmed when a specific host address of the other family
+// is mapped.
+func (pm *PortMapper) forward(action firewall.Action, proto string, sourceIP net.IP, sourcePort int, containerIP net.IP, containerPort int) error {
+	chain := pm.forwardChain(sourceIP, containerIP)
+	if chain == nil {
 		return nil
 	}
-	return pm.chain.Forward(action, sourceIP, sourcePort, proto, containerIP, containerPort, pm.bridgeName)
+	return chain.Forward(action, sourceIP, sourcePort, proto, containerIP.String(), containerPort, pm.bridgeName)
+}
+
+// forwardChain returns the chain forwarding the host address to the
+// container address, nil if there is none.
+func (pm *PortMapper) forwardChain(sourceIP, containerIP net.IP) firewall.Chain {
+	if sourceIP != nil && !sourceIP.IsUnspecified() && (sourceIP.To4() == nil) != (containerIP.To4() == nil) {
+		return nil
+	}
+	if containerIP.To4() == nil {
+		return pm.chainV6
+	}
+	return pm.chain
 }
@@ -3,10 +3,14 @@ package portmapper
 import (
 	"net"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/docker/libnetwork/conntrack"
 	"github.com/docker/libnetwork/iptables"
-	_ "github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
 )
 
 func init() {
@@ -31,6 +35,23 @@ func TestSetIptablesChain(t *testing.T) {
 	}
 }
 
+func TestSetIptablesChainIPv6(t *testing.T) {
+	pm := New()
+
+	c := &iptables.ChainInfo{
+		Name:    "TEST",
+		IPTable: iptables.IPTable{Version: iptables.IP6Tables},
+	}
+
+	pm.SetIptablesChain(c, "lo")
+	if pm.chainV6 == nil {
+		t.Fatal("IPv6 chain should not be nil after set")
+	}
+	if pm.chain != nil {
+		t.Fatal("IPv4 chain should be nil after setting the IPv6 chain")
+	}
+}
+
 func TestMapTCPPorts(t *testing.T) {
 	pm := New()
 	dstIP1 := net.ParseIP("192.168.0.1")
@@ -97,6 +118,46 @@ func TestGetTCPKey(t *testing.T) {
 	}
 }
 
+func TestGetTCPKeyIPv6(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("2001:db8::5"), Port: 80}
+
+	key := getKey(addr)
+
+	if expected := "[2001:db8::5]:80/tcp"; key != expected {
+		t.Fatalf("expected key %s got %s", expected, key)
+	}
+}
+
+func TestGetSCTPKey(t *testing.T) {
+	addr := &types.SCTPAddr{IP: net.ParseIP("192.168.1.5"), Port: 5060}
+
+	key := getKey(addr)
+
+	if expected := "192.168.1.5:5060/sctp"; key != expected {
+		t.Fatalf("expected key %s got %s", expected, key)
+	}
+}
+
+func TestMapSCTPWithoutChain(t *testing.T) {
+	pm := New()
+	srcAddr := &types.SCTPAddr{Port: 5060, IP: net.ParseIP("172.16.0.1")}
+
+	// Without the userland proxy, only the DNAT rules forward sctp
+	if _, err := pm.Map(srcAddr, net.ParseIP("0.0.0.0"), 5060, true); err != ErrSCTPNotForwarded {
+		t.Fatalf("Expected ErrSCTPNotForwarded, got %v", err)
+	}
+	if len(pm.currentMappings) != 0 {
+		t.Fatalf("Expected no mapping, got %v", pm.currentMappings)
+	}
+	// The host port was not allocated
+	if _, err := pm.Allocator.RequestPort(net.ParseIP("0.0.0.0"), "sctp", 5060); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Allocator.ReleasePort(net.ParseIP("0.0.0.0"), "sctp", 5060); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestGetUDPIPAndPort(t *testing.T) {
 	addr := &net.UDPAddr{IP: net.ParseIP("192.168.1.5"), Port: 53}
 
@@ -156,6 +217,58 @@ func TestMapUDPPorts(t *testing.T) {
 	}
 }
 
+func TestUnmapUDPFlushesConntrack(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	pm := New()
+	hostIP := net.ParseIP("192.168.0.1")
+	client := net.ParseIP("10.0.0.1")
+	flow := func(host net.IP, container string, clientPort uint16) conntrack.Flow {
+		return conntrack.Flow{
+			Family:   syscall.AF_INET,
+			Protocol: types.UDP,
+			Original: conntrack.Tuple{Src: client, Dst: host, SrcPort: clientPort, DstPort: 53},
+			Reply:    conntrack.Tuple{Src: net.ParseIP(container), Dst: client, SrcPort: 53, DstPort: clientPort},
+		}
+	}
+	// Flows forwarded to the container being unmapped, to another one, and
+	// to the same container port from another host address
+	for _, f := range []conntrack.Flow{
+		flow(hostIP, "172.16.0.1", 40000),
+		flow(hostIP, "172.16.0.2", 40001),
+		flow(net.ParseIP("192.168.0.2"), "172.16.0.1", 40002),
+	} {
+		if err := conntrack.Create(f, time.Minute); err != nil {
+			if conntrack.IsNotSupported(err) {
+				t.Skipf("conntrack netlink interface is not supported: %v", err)
+			}
+			t.Fatal(err)
+		}
+	}
+
+	host, err := pm.Map(&net.UDPAddr{IP: net.ParseIP("172.16.0.1"), Port: 53}, hostIP, 53, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Unmap(host); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the flow forwarded by the unmapped host port is flushed
+	flows, err := conntrack.List(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("Expected the flows of the other mappings only, got %v", flows)
+	}
+	for _, f := range flows {
+		if f.Original.Dst.Equal(hostIP) && f.Reply.Src.Equal(net.ParseIP("172.16.0.1")) {
+			t.Fatalf("Unexpected flow of the unmapped port %s", f)
+		}
+	}
+}
+
 func TestMapAllPortsSingleInterface(t *testing.T) {
 	pm := New()
 	dstIP1 := net.ParseIP("0.0.0.0")
@@ -16,6 +16,7 @@ import (
 
 	"github.com/docker/docker/pkg/proxy"
 	"github.com/docker/docker/pkg/reexec"
+	"github.com/docker/libnetwork/types"
 )
 
 const userlandProxyCommandName = "docker-proxy"
@@ -177,6 +178,9 @@ func newDummyProxy(proto string, hostIP net.IP, hostPort int) userlandProxy {
 	case "udp":
 		addr := &net.UDPAddr{IP: hostIP, Port: hostPort}
 		return &dummyProxy{addr: addr}
+	case "sctp":
+		addr := &types.SCTPAddr{IP: hostIP, Port: hostPort}
+		return &dummyProxy{addr: addr}
 	}
 	return nil
 }
@@ -195,6 +199,12 @@ func (p *dummyProxy) Start() error {
 			return err
 		}
 		p.listener = l
+	case *types.SCTPAddr:
+		l, err := listenSCTP(addr)
+		if err != nil {
+			return err
+		}
+		p.listener = l
 	default:
 		return fmt.Errorf("Unknown addr type: %T", p.addr)
 	}
@@ -207,3 +217,37 @@ func (p *dummyProxy) Stop() error {
 	}
 	return nil
 }
+
+// listenSCTP listens on the sctp address, which the net package does not
+// support.
+func listenSCTP(addr *types.SCTPAddr) (io.Closer, error) {
+	var (
+		family = syscall.AF_INET
+		sa     syscall.Sockaddr
+	)
+	if ip4 := addr.IP.To4(); ip4 != nil || addr.IP == nil {
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		family = syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+		copy(sa6.Addr[:], addr.IP.To16())
+		sa = sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_SCTP)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "sctp", Addr: addr, Err: os.NewSyscallError("socket", err)}
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, &net.OpError{Op: "listen", Net: "sctp", Addr: addr, Err: os.NewSyscallError("bind", err)}
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return nil, &net.OpError{Op: "listen", Net: "sctp", Addr: addr, Err: os.NewSyscallError("listen", err)}
+	}
+
+	return os.NewFile(uintptr(fd), "sctp:"+addr.String()), nil
+}
@@ -0,0 +1,282 @@
+package portmapper
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/proxy"
+)
+
+// ConnStats are the connection counters of a userland proxy running in
+// process. For udp, a connection is the flow of datagrams of a client.
+type ConnStats struct {
+	// Active is the number of connections being forwarded
+	Active uint64
+	// Total is the number of connections accepted since the proxy started
+	Total uint64
+	// Failed is the number of connections the container could not be
+	// reached for
+	Failed uint64
+}
+
+// inProcessProxy forwards the tcp or udp traffic of a mapped port to the
+// container with goroutines of the daemon, instead of a docker-proxy process.
+type inProcessProxy struct {
+	frontend net.Addr
+	backend  net.Addr
+
+	active uint64
+	total  uint64
+	failed uint64
+
+	sync.Mutex
+	listener io.Closer
+	conns    map[io.Closer]struct{}
+	flows    map[string]*net.UDPConn
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+func newInProcessProxy(proto string, hostIP net.IP, hostPort int, containerIP net.IP, containerPort int) userlandProxy {
+	p := &inProcessProxy{
+		conns: make(map[io.Closer]struct{}),
+		flows: make(map[string]*net.UDPConn),
+	}
+	switch proto {
+	case "tcp":
+		p.frontend = &net.TCPAddr{IP: hostIP, Port: hostPort}
+		p.backend = &net.TCPAddr{IP: containerIP, Port: containerPort}
+	case "udp":
+		p.frontend = &net.UDPAddr{IP: hostIP, Port: hostPort}
+		p.backend = &net.UDPAddr{IP: containerIP, Port: containerPort}
+	}
+	return p
+}
+
+func (p *inProcessProxy) Start() error {
+	p.Lock()
+	defer p.Unlock()
+
+	switch addr := p.frontend.(type) {
+	case *net.TCPAddr:
+		l, err := net.ListenTCP("tcp", addr)
+		if err != nil {
+			return err
+		}
+		p.listener = l
+		p.wg.Add(1)
+		go p.serveTCP(l)
+	case *net.UDPAddr:
+		l, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			return err
+		}
+		p.listener = l
+		p.wg.Add(1)
+		go p.serveUDP(l)
+	default:
+		return ErrUnknownBackendAddressType
+	}
+	return nil
+}
+
+// Stop closes the listener and the connections being forwarded, and waits
+// for the forwarding goroutines to return.
+func (p *inProcessProxy) Stop() error {
+	p.Lock()
+	if p.stopped {
+		p.Unlock()
+		return nil
+	}
+	p.stopped = true
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	for c := range p.conns {
+		c.Close()
+	}
+	p.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+// ConnStats returns the connection counters of the proxy.
+func (p *inProcessProxy) ConnStats() ConnStats {
+	return ConnStats{
+		Active: atomic.LoadUint64(&p.active),
+		Total:  atomic.LoadUint64(&p.total),
+		Failed: atomic.LoadUint64(&p.failed),
+	}
+}
+
+// track registers the connections for Stop to close them, unless the proxy
+// is already stopped.
+func (p *inProcessProxy) track(conns ...io.Closer) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.stopped {
+		return false
+	}
+	for _, c := range conns {
+		p.conns[c] = struct{}{}
+	}
+	atomic.AddUint64(&p.active, 1)
+	return true
+}
+
+func (p *inProcessProxy) untrack(conns ...io.Closer) {
+	p.Lock()
+	for _, c := range conns {
+		delete(p.conns, c)
+		c.Close()
+	}
+	p.Unlock()
+	atomic.AddUint64(&p.active, ^uint64(0))
+}
+
+func (p *inProcessProxy) serveTCP(l *net.TCPListener) {
+	defer p.wg.Done()
+	for {
+		client, err := l.AcceptTCP()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			if !isClosedConnError(err) {
+				logrus.Warnf("Stopping proxy on tcp/%v for tcp/%v: %v", p.frontend, p.backend, err)
+			}
+			return
+		}
+		atomic.AddUint64(&p.total, 1)
+		p.wg.Add(1)
+		go p.forwardTCP(client)
+	}
+}
+
+func (p *inProcessProxy) forwardTCP(client *net.TCPConn) {
+	defer p.wg.Done()
+
+	backend, err := net.DialTCP("tcp", nil, p.backend.(*net.TCPAddr))
+	if err != nil {
+		atomic.AddUint64(&p.failed, 1)
+		logrus.Debugf("Can't forward traffic to backend tcp/%v: %v", p.backend, err)
+		client.Close()
+		return
+	}
+	if !p.track(client, backend) {
+		client.Close()
+		backend.Close()
+		return
+	}
+	defer p.untrack(client, backend)
+
+	done := make(chan struct{}, 2)
+	broker := func(to, from *net.TCPConn) {
+		if _, err := io.Copy(to, from); err != nil {
+			// Interrupt the other direction as well
+			client.Close()
+			backend.Close()
+		} else {
+			// Forward the end of the stream to the other end
+			to.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go broker(backend, client)
+	go broker(client, backend)
+	<-done
+	<-done
+}
+
+func (p *inProcessProxy) serveUDP(l *net.UDPConn) {
+	defer p.wg.Done()
+
+	buf := make([]byte, proxy.UDPBufSize)
+	for {
+		n, from, err := l.ReadFromUDP(buf)
+		if err != nil {
+			if !isClosedConnError(err) {
+				logrus.Warnf("Stopping proxy on udp/%v for udp/%v: %v", p.frontend, p.backend, err)
+			}
+			return
+		}
+
+		key := from.String()
+		p.Lock()
+		flow, ok := p.flows[key]
+		p.Unlock()
+		if !ok {
+			atomic.AddUint64(&p.total, 1)
+			if flow, err = net.DialUDP("udp", nil, p.backend.(*net.UDPAddr)); err != nil {
+				atomic.AddUint64(&p.failed, 1)
+				logrus.Debugf("Can't proxy a datagram to udp/%v: %v", p.backend, err)
+				continue
+			}
+			if !p.track(flow) {
+				flow.Close()
+				return
+			}
+			p.Lock()
+			p.flows[key] = flow
+			p.Unlock()
+			p.wg.Add(1)
+			go p.replyUDP(l, flow, from, key)
+		}
+
+		if _, err := flow.Write(buf[:n]); err != nil {
+			logrus.Debugf("Can't proxy a datagram to udp/%v: %v", p.backend, err)
+		}
+	}
+}
+
+// replyUDP forwards the replies of the container to the client, until the
+// flow has been idle for the connection tracking timeout.
+func (p *inProcessProxy) replyUDP(l *net.UDPConn, flow *net.UDPConn, client *net.UDPAddr, key string) {
+	defer p.wg.Done()
+	defer func() {
+		p.Lock()
+		delete(p.flows, key)
+		p.Unlock()
+		p.untrack(flow)
+	}()
+
+	buf := make([]byte, proxy.UDPBufSize)
+	flow.SetReadDeadline(time.Now().Add(proxy.UDPConnTrackTimeout))
+	for {
+		n, err := flow.Read(buf)
+		if err != nil {
+			if oe, ok := err.(*net.OpError); ok && isConnRefused(oe) {
+				// Nothing listens on the container port yet,
+				// keep the flow until it times out
+				continue
+			}
+			return
+		}
+		if _, err := l.WriteToUDP(buf[:n], client); err != nil {
+			return
+		}
+		flow.SetReadDeadline(time.Now().Add(proxy.UDPConnTrackTimeout))
+	}
+}
+
+func isConnRefused(err *net.OpError) bool {
+	if se, ok := err.Err.(*os.SyscallError); ok {
+		return se.Err == syscall.ECONNREFUSED
+	}
+	return err.Err == syscall.ECONNREFUSED
+}
+
+// isClosedConnError tells whether the error is the one of an operation on a
+// closed connection, which the net package does not export.
+func isClosedConnError(err error) bool {
+	return strings.HasSuffix(err.Error(), "use of closed network connection")
+}
@@ -0,0 +1,224 @@
+package portmapper
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a port of the network nothing listens on.
+func freePort(t *testing.T, network string) int {
+	switch network {
+	case "tcp":
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port
+	default:
+		l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		return l.LocalAddr().(*net.UDPAddr).Port
+	}
+}
+
+func waitActive(t *testing.T, pm *PortMapper, host net.Addr, active uint64) ConnStats {
+	var stats ConnStats
+	for i := 0; i < 100; i++ {
+		var err error
+		if stats, err = pm.ConnStats(host); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Active == active {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d active connections, got %+v", active, stats)
+	return stats
+}
+
+func TestInProcessProxyTCP(t *testing.T) {
+	backend, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				line, _ := bufio.NewReader(c).ReadString('\n')
+				c.Write([]byte(line))
+				c.Close()
+			}()
+		}
+	}()
+
+	pm := New()
+	pm.SetProxyMode(ProxyInProcess)
+
+	hostIP := net.ParseIP("127.0.0.1")
+	hostPort := freePort(t, "tcp")
+	host, err := pm.Map(backend.Addr(), hostIP, hostPort, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", host.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello\n" {
+		t.Fatalf("Unexpected reply %q", reply)
+	}
+	conn.Close()
+
+	if stats := waitActive(t, pm, host, 0); stats.Total != 1 || stats.Failed != 0 {
+		t.Fatalf("Unexpected connection counters %+v", stats)
+	}
+
+	if err := pm.Unmap(host); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.Dial("tcp", host.String()); err == nil {
+		t.Fatal("The proxy should not listen anymore once the port is unmapped")
+	}
+	if _, err := pm.ConnStats(host); err != ErrPortNotMapped {
+		t.Fatalf("Expected ErrPortNotMapped, got %v", err)
+	}
+}
+
+func TestInProcessProxyTCPStop(t *testing.T) {
+	backend, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := backend.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+
+	be := backend.Addr().(*net.TCPAddr)
+	hostPort := freePort(t, "tcp")
+	p := newInProcessProxy("tcp", be.IP, hostPort, be.IP, be.Port)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(hostPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := <-accepted
+	defer c.Close()
+
+	// Stop interrupts the idle connection and returns
+	done := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return with a connection open")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("The connection should have been closed by Stop")
+	}
+	if stats := p.(*inProcessProxy).ConnStats(); stats.Active != 0 || stats.Total != 1 {
+		t.Fatalf("Unexpected connection counters %+v", stats)
+	}
+}
+
+func TestInProcessProxyUDP(t *testing.T) {
+	backend, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := backend.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			backend.WriteToUDP(buf[:n], from)
+		}
+	}()
+
+	pm := New()
+	pm.SetProxyMode(ProxyInProcess)
+
+	hostIP := net.ParseIP("127.0.0.1")
+	host, err := pm.Map(backend.LocalAddr(), hostIP, freePort(t, "udp"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", host.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 16)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "ping" {
+			t.Fatalf("Unexpected reply %q", buf[:n])
+		}
+	}
+
+	// The datagrams of the client are a single flow
+	if stats := waitActive(t, pm, host, 1); stats.Total != 1 {
+		t.Fatalf("Unexpected connection counters %+v", stats)
+	}
+
+	if err := pm.Unmap(host); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnStatsProcessProxy(t *testing.T) {
+	pm := New()
+	host, err := pm.Map(&net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 80}, net.ParseIP("127.0.0.1"), freePort(t, "tcp"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Unmap(host)
+
+	if _, err := pm.ConnStats(host); err != ErrNoConnStats {
+		t.Fatalf("Expected ErrNoConnStats, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package libnetwork
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+)
+
+// defaultReconcileInterval is the period the drivers are reconciled at when
+// the configuration does not set one.
+const defaultReconcileInterval = time.Minute
+
+// Drift is a difference a driver found between the state it expects in the
+// host and the live one, and corrected
+type Drift struct {
+	Driver    string              `json:"driver"`
+	NetworkID string              `json:"network_id,omitempty"`
+	Kind      driverapi.DriftKind `json:"kind"`
+	Object    string              `json:"object"`
+}
+
+// DriftReport is the outcome of the last reconciliation of the drivers
+type DriftReport struct {
+	Time   time.Time `json:"time"`
+	Drift  []Drift   `json:"drift"`
+	Errors []string  `json:"errors,omitempty"`
+}
+
+func (c *controller) Drift() DriftReport {
+	c.Lock()
+	defer c.Unlock()
+	return c.drift
+}
+
+// startReconciler reconciles the drivers once, to clean up after a crash,
+// then periodically until the controller is stopped.
+func (c *controller) startReconciler() {
+	c.reconcile()
+
+	interval := c.cfg.Daemon.ReconcileInterval
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = defaultReconcileInterval
+	}
+
+	c.stopReconcile = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.reconcile()
+			case <-stop:
+				return
+			}
+		}
+	}(c.stopReconcile)
+}
+
+func (c *controller) stopReconciler() {
+	c.Lock()
+	defer c.Unlock()
+	if c.stopReconcile != nil {
+		close(c.stopReconcile)
+		c.stopReconcile = nil
+	}
+}
+
+// reconcile has the drivers implementing driverapi.Reconciler correct the
+// drift of their state, then logs and publishes the drift they found.
+func (c *controller) reconcile() {
+	c.Lock()
+	reconcilers := make(map[string]driverapi.Reconciler)
+	for name, d := range c.drivers {
+		if r, ok := d.driver.(driverapi.Reconciler); ok {
+			reconcilers[name] = r
+		}
+	}
+	c.Unlock()
+
+	report := DriftReport{Time: time.Now(), Drift: []Drift{}}
+	for name, r := range reconcilers {
+		drift, err := r.Reconcile()
+		if err != nil {
+			log.Warnf("Failed to reconcile the state of driver %s: %v", name, err)
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", name, err))
+		}
+		for _, d := range drift {
+			log.Warnf("Driver %s corrected the drift of its state: %s %s", name, d.Kind, d.Object)
+			dr := Drift{Driver: name, NetworkID: d.NetworkID, Kind: d.Kind, Object: d.Object}
+			report.Drift = append(report.Drift, dr)
+			c.publishEvent(driftEvent(dr))
+		}
+	}
+
+	c.Lock()
+	c.drift = report
+	c.Unlock()
+}
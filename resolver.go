@@ -0,0 +1,291 @@
+package libnetwork
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+const (
+	resolverIP   = "127.0.0.11"
+	dnsPort      = "53"
+	respTTL      = 600
+	extIOTimeout = 4 * time.Second
+	maxExtDNS    = 3 // max number of external servers to try
+)
+
+// resolver is the embedded DNS server of a sandbox. It listens on a loopback
+// address in the sandbox network namespace, answers the queries for the
+// service records of the networks the sandbox is connected to and forwards
+// all the other queries to the external nameservers.
+type resolver struct {
+	sb        *sandbox
+	extDNS    []string
+	server    *dns.Server
+	conn      *net.UDPConn
+	tcpServer *dns.Server
+	tcpListen *net.TCPListener
+	err       error
+	rrIndex   uint32
+	sync.Mutex
+}
+
+func newResolver(sb *sandbox) *resolver {
+	return &resolver{
+		sb:  sb,
+		err: fmt.Errorf("setup not done yet"),
+	}
+}
+
+// SetupFunc returns the function binding the resolver sockets. It must be
+// invoked in the sandbox network namespace.
+func (r *resolver) SetupFunc() func() {
+	return func() {
+		var err error
+
+		addr := &net.UDPAddr{IP: net.ParseIP(resolverIP), Port: 53}
+		r.conn, err = net.ListenUDP("udp", addr)
+		if err != nil {
+			r.err = fmt.Errorf("error in opening name server socket %v", err)
+			return
+		}
+
+		tcpaddr := &net.TCPAddr{IP: net.ParseIP(resolverIP), Port: 53}
+		r.tcpListen, err = net.ListenTCP("tcp", tcpaddr)
+		if err != nil {
+			r.conn.Close()
+			r.err = fmt.Errorf("error in opening name TCP server socket %v", err)
+			return
+		}
+
+		r.err = nil
+	}
+}
+
+// Start starts serving the queries on the sockets bound by SetupFunc.
+func (r *resolver) Start() error {
+	// make sure the resolver has been setup before starting
+	if r.err != nil {
+		return r.err
+	}
+
+	s := &dns.Server{Handler: r, PacketConn: r.conn}
+	r.server = s
+	go func() {
+		s.ActivateAndServe()
+	}()
+
+	tcpServer := &dns.Server{Handler: r, Listener: r.tcpListen}
+	r.tcpServer = tcpServer
+	go func() {
+		tcpServer.ActivateAndServe()
+	}()
+	return nil
+}
+
+// Stop stops the resolver and closes its sockets.
+func (r *resolver) Stop() {
+	// Shutdown fails if the server did not get to serve yet,
+	// the sockets must be closed in that case.
+	if r.server != nil {
+		if err := r.server.Shutdown(); err != nil {
+			r.conn.Close()
+		}
+	}
+	if r.tcpServer != nil {
+		if err := r.tcpServer.Shutdown(); err != nil {
+			r.tcpListen.Close()
+		}
+	}
+	r.conn = nil
+	r.tcpListen = nil
+	r.server = nil
+	r.tcpServer = nil
+	r.err = fmt.Errorf("setup not done yet")
+}
+
+// SetExtServers sets the nameservers the queries which cannot be answered
+// from the service records are forwarded to.
+func (r *resolver) SetExtServers(dns []string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.extDNS = nil
+	for _, s := range dns {
+		if len(r.extDNS) == maxExtDNS {
+			break
+		}
+		r.extDNS = append(r.extDNS, s)
+	}
+}
+
+// NameServer returns the address the resolver is listening on.
+func (r *resolver) NameServer() string {
+	return resolverIP
+}
+
+// ResolverOptions returns the resolv.conf options the sandbox must use
+// with the resolver. With ndots:0 the unqualified service names are
+// looked up as they are before the search domains are appended.
+func (r *resolver) ResolverOptions() []string {
+	return []string{"ndots:0"}
+}
+
+// rotate returns the index the next answer list of the passed length is to
+// start from, so that the clients picking the first record spread the load
+// across the endpoints providing the service.
+func (r *resolver) rotate(n int) int {
+	return int(atomic.AddUint32(&r.rrIndex, 1) % uint32(n))
+}
+
+func (r *resolver) handleIPQuery(name string, query *dns.Msg, ipv6 bool) *dns.Msg {
+	addr := r.sb.resolveName(name, ipv6)
+	if addr == nil {
+		// A service without IPv6 addresses must not be looked up outside
+		if ipv6 && r.sb.resolveName(name, false) != nil {
+			resp := new(dns.Msg)
+			resp.SetReply(query)
+			return resp
+		}
+		return nil
+	}
+
+	log.Debugf("Lookup for %s: IP %v", name, addr)
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	start := r.rotate(len(addr))
+	for i := range addr {
+		ip := addr[(start+i)%len(addr)]
+		if ipv6 {
+			rr := new(dns.AAAA)
+			rr.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: respTTL}
+			rr.AAAA = ip
+			resp.Answer = append(resp.Answer, rr)
+			continue
+		}
+		rr := new(dns.A)
+		rr.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: respTTL}
+		rr.A = ip
+		resp.Answer = append(resp.Answer, rr)
+	}
+	return resp
+}
+
+func (r *resolver) handleSRVQuery(name string, query *dns.Msg) *dns.Msg {
+	srv, ips := r.sb.resolveService(name)
+	if len(srv) == 0 {
+		return nil
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	start := r.rotate(len(srv))
+	for i := range srv {
+		j := (start + i) % len(srv)
+		rr := new(dns.SRV)
+		rr.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: respTTL}
+		rr.Port = srv[j].Port
+		rr.Target = srv[j].Target
+		resp.Answer = append(resp.Answer, rr)
+
+		if ips[j] == nil {
+			continue
+		}
+		extra := new(dns.A)
+		extra.Hdr = dns.RR_Header{Name: srv[j].Target, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: respTTL}
+		extra.A = ips[j]
+		resp.Extra = append(resp.Extra, extra)
+	}
+	return resp
+}
+
+func (r *resolver) ServeDNS(w dns.ResponseWriter, query *dns.Msg) {
+	var (
+		resp *dns.Msg
+		err  error
+	)
+
+	if query == nil || len(query.Question) == 0 {
+		return
+	}
+
+	name := query.Question[0].Name
+	switch query.Question[0].Qtype {
+	case dns.TypeA:
+		resp = r.handleIPQuery(name, query, false)
+	case dns.TypeAAAA:
+		resp = r.handleIPQuery(name, query, true)
+	case dns.TypeSRV:
+		resp = r.handleSRVQuery(name, query)
+	}
+
+	if resp == nil {
+		resp, err = r.forwardExtDNS(w.LocalAddr().Network(), query)
+		if err != nil {
+			log.Debugf("Failed to resolve %s: %v", name, err)
+			resp = new(dns.Msg)
+			resp.SetRcode(query, dns.RcodeServerFailure)
+		}
+	}
+
+	if err = w.WriteMsg(resp); err != nil {
+		log.Errorf("error writing resolver resp, %s", err)
+	}
+}
+
+// forwardExtDNS forwards the query to the external nameservers, trying them
+// in order. The connections are opened from the sandbox network namespace.
+func (r *resolver) forwardExtDNS(proto string, query *dns.Msg) (*dns.Msg, error) {
+	r.Lock()
+	extDNS := r.extDNS
+	r.Unlock()
+
+	if len(extDNS) == 0 {
+		return nil, fmt.Errorf("no external nameserver configured")
+	}
+
+	var lastErr error
+	for _, ns := range extDNS {
+		var (
+			extConn net.Conn
+			err     error
+		)
+		addr := net.JoinHostPort(ns, dnsPort)
+		execErr := r.sb.execFunc(func() {
+			extConn, err = net.DialTimeout(proto, addr, extIOTimeout)
+		})
+		if execErr != nil {
+			err = execErr
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("connect to %s failed: %v", addr, err)
+			continue
+		}
+
+		resp, err := exchangeExtDNS(extConn, query)
+		extConn.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("query to %s failed: %v", addr, err)
+			continue
+		}
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+func exchangeExtDNS(extConn net.Conn, query *dns.Msg) (*dns.Msg, error) {
+	extConn.SetDeadline(time.Now().Add(extIOTimeout))
+	co := &dns.Conn{Conn: extConn}
+
+	if err := co.WriteMsg(query); err != nil {
+		return nil, err
+	}
+	return co.ReadMsg()
+}
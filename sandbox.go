@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 
 	log "github.com/Sirupsen/logrus"
@@ -61,9 +64,14 @@ type sandbox struct {
 	controller    *controller
 	refCnt        int
 	hostsOnce     sync.Once
+	resolver      *resolver
+	resolverOnce  sync.Once
+	extDNS        []string
 	endpoints     epHeap
 	epPriority    map[string]int
 	joinLeaveDone chan struct{}
+	dbIndex       uint64
+	dbExists      bool
 	sync.Mutex
 }
 
@@ -104,6 +112,7 @@ type containerConfig struct {
 	generic           map[string]interface{}
 	useDefaultSandBox bool
 	useExternalKey    bool
+	useEmbeddedDNS    bool
 	prio              int // higher the value, more the priority
 }
 
@@ -158,14 +167,22 @@ func (sb *sandbox) Delete() error {
 		}
 	}
 
+	sb.stopResolver()
+
 	if sb.osSbox != nil {
 		sb.osSbox.Destroy()
 	}
 
+	if err := sb.storeDelete(); err != nil {
+		log.Warnf("Failed to delete sandbox %s from store: %v", sb.ID(), err)
+	}
+
 	c.Lock()
 	delete(c.sandboxes, sb.ID())
 	c.Unlock()
 
+	c.publishEvent(sandboxEvent(EventSandboxDelete, sb))
+
 	return nil
 }
 
@@ -180,6 +197,14 @@ func (sb *sandbox) Refresh(options ...SandboxOption) error {
 		}
 	}
 
+	// The resolver is started again on the first re-join,
+	// according to the new options
+	sb.stopResolver()
+	sb.Lock()
+	sb.resolverOnce = sync.Once{}
+	sb.extDNS = nil
+	sb.Unlock()
+
 	// Re-apply options
 	sb.config = containerConfig{}
 	sb.processOptions(options...)
@@ -196,7 +221,7 @@ func (sb *sandbox) Refresh(options ...SandboxOption) error {
 		}
 	}
 
-	return nil
+	return sb.storeUpdate()
 }
 
 func (sb *sandbox) MarshalJSON() ([]byte, error) {
@@ -235,6 +260,19 @@ func (sb *sandbox) setupResolutionFiles() error {
 	return nil
 }
 
+// removeResolutionFiles removes the hosts and resolv.conf files set up for
+// the sandbox.
+func (sb *sandbox) removeResolutionFiles() {
+	for _, path := range []string{sb.config.hostsPath, sb.config.resolvConfPath, sb.config.resolvConfHashFile} {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove %s of sandbox %s: %v", path, sb.id, err)
+		}
+	}
+}
+
 func (sb *sandbox) getConnectedEndpoints() []*endpoint {
 	sb.Lock()
 	defer sb.Unlock()
@@ -321,6 +359,11 @@ func (sb *sandbox) SetKey(basePath string) error {
 			return err
 		}
 	}
+
+	if err := sb.storeUpdate(); err != nil {
+		log.Warnf("Failed to update store for sandbox %s: %v", sb.ID(), err)
+	}
+
 	return nil
 }
 
@@ -344,6 +387,9 @@ func (sb *sandbox) populateNetworkResources(ep *endpoint) error {
 		if i.addrv6 != nil && i.addrv6.IP.To16() != nil {
 			ifaceOptions = append(ifaceOptions, sb.osSbox.InterfaceOptions().AddressIPv6(i.addrv6))
 		}
+		if addrs := i.Addresses(); len(addrs) > 0 {
+			ifaceOptions = append(ifaceOptions, sb.osSbox.InterfaceOptions().IPAliases(addrs))
+		}
 
 		if err := sb.osSbox.AddInterface(i.srcName, i.dstPrefix, ifaceOptions...); err != nil {
 			return fmt.Errorf("failed to add interface %s to sandbox: %v", i.srcName, err)
@@ -359,6 +405,8 @@ func (sb *sandbox) populateNetworkResources(ep *endpoint) error {
 		}
 	}
 
+	sb.startResolver(false)
+
 	for _, gwep := range sb.getConnectedEndpoints() {
 		if len(gwep.Gateway()) > 0 {
 			if gwep != ep {
@@ -625,6 +673,14 @@ func (sb *sandbox) updateDNS(ipv6Enabled bool) error {
 		return nil
 	}
 
+	// The resolv.conf points to the embedded DNS server
+	sb.Lock()
+	r := sb.resolver
+	sb.Unlock()
+	if r != nil {
+		return nil
+	}
+
 	currRC, err := resolvconf.GetSpecific(sb.config.resolvConfPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
@@ -685,6 +741,188 @@ func (sb *sandbox) updateDNS(ipv6Enabled bool) error {
 	return os.Rename(tmpResolvFile.Name(), sb.config.resolvConfPath)
 }
 
+// startResolver starts the embedded DNS server in the sandbox network namespace,
+// if the sandbox was configured to use it. The nameservers found in the sandbox
+// resolv.conf become its external servers and resolv.conf is rebuilt to point
+// to it. On restore the external servers are already known and the resolv.conf
+// is already pointing to the server.
+func (sb *sandbox) startResolver(restore bool) {
+	sb.resolverOnce.Do(func() {
+		if !sb.config.useEmbeddedDNS || sb.config.useDefaultSandBox ||
+			sb.config.originResolvConfPath != "" || sb.osSbox == nil {
+			return
+		}
+
+		if !restore {
+			currRC, err := resolvconf.GetSpecific(sb.config.resolvConfPath)
+			if err != nil {
+				log.Errorf("Failed to read resolv.conf of container %s: %v", sb.ContainerID(), err)
+				return
+			}
+			sb.extDNS = resolvconf.GetNameservers(currRC.Content)
+		}
+
+		r := newResolver(sb)
+		r.SetExtServers(sb.extDNS)
+		if err := sb.osSbox.InvokeFunc(r.SetupFunc()); err != nil {
+			log.Errorf("Resolver setup failed for container %s: %v", sb.ContainerID(), err)
+			return
+		}
+		if err := r.Start(); err != nil {
+			log.Errorf("Resolver start failed for container %s: %v", sb.ContainerID(), err)
+			return
+		}
+
+		if !restore {
+			if err := sb.rebuildDNS(r); err != nil {
+				log.Errorf("Updating resolv.conf failed for container %s: %v", sb.ContainerID(), err)
+				r.Stop()
+				return
+			}
+		}
+
+		sb.Lock()
+		sb.resolver = r
+		sb.Unlock()
+	})
+}
+
+func (sb *sandbox) stopResolver() {
+	sb.Lock()
+	r := sb.resolver
+	sb.resolver = nil
+	sb.Unlock()
+
+	if r != nil {
+		r.Stop()
+	}
+}
+
+// rebuildDNS rewrites the sandbox resolv.conf so that the embedded DNS
+// server is the only nameserver, keeping the search domains and options.
+func (sb *sandbox) rebuildDNS(r *resolver) error {
+	currRC, err := resolvconf.GetSpecific(sb.config.resolvConfPath)
+	if err != nil {
+		return err
+	}
+
+	dnsSearchList := resolvconf.GetSearchDomains(currRC.Content)
+	dnsOptionsList := append(resolvconf.GetOptions(currRC.Content), r.ResolverOptions()...)
+
+	newRC, err := resolvconf.Build(sb.config.resolvConfPath, []string{r.NameServer()}, dnsSearchList, dnsOptionsList)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(sb.config.resolvConfHashFile, []byte(newRC.Hash), filePerm)
+}
+
+// resolveName returns the IPv4 or IPv6 addresses the passed name resolves to
+// in the service records of the networks the sandbox is connected to.
+func (sb *sandbox) resolveName(name string, ipv6 bool) []net.IP {
+	name = strings.TrimSuffix(name, ".")
+
+	for _, ep := range sb.getConnectedEndpoints() {
+		n := ep.getNetwork()
+
+		n.Lock()
+		var ips []net.IP
+		if si, ok := n.ctrlr.svcDb[n.id]; ok {
+			sm := si.svcMap
+			if ipv6 {
+				sm = si.svcIPv6Map
+			}
+			if lb := si.lbServiceFor(name, n.name); lb != nil {
+				// Load balanced services are only reachable via their IPv4 virtual IP
+				if !ipv6 {
+					ips = append(ips, types.GetIPCopy(lb.vip))
+				}
+				sm = nil
+			}
+			for _, ip := range sm[name] {
+				ips = append(ips, types.GetIPCopy(ip))
+			}
+		}
+		n.Unlock()
+
+		if len(ips) > 0 {
+			return ips
+		}
+	}
+
+	return nil
+}
+
+// resolveService returns the SRV records for the passed name, of the form
+// _service._proto.name where service is either a port number or a well known
+// service name, out of the exposed ports of the endpoints providing the
+// service. The IPv4 addresses of the records targets are returned as well,
+// in the same order.
+func (sb *sandbox) resolveService(name string) ([]*net.SRV, []net.IP) {
+	parts := strings.SplitN(strings.TrimSuffix(name, "."), ".", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "_") || !strings.HasPrefix(parts[1], "_") {
+		return nil, nil
+	}
+
+	protoName := strings.TrimPrefix(parts[1], "_")
+	proto := types.ParseProtocol(protoName)
+	if proto != types.TCP && proto != types.UDP {
+		return nil, nil
+	}
+
+	svc := strings.TrimPrefix(parts[0], "_")
+	port, err := strconv.Atoi(svc)
+	if err != nil {
+		if port, err = net.LookupPort(protoName, svc); err != nil {
+			return nil, nil
+		}
+	}
+
+	for _, ep := range sb.getConnectedEndpoints() {
+		n := ep.getNetwork()
+
+		n.Lock()
+		var (
+			srv []*net.SRV
+			ips []net.IP
+		)
+		if si, ok := n.ctrlr.svcDb[n.id]; ok {
+			for _, sp := range si.service[parts[2]] {
+				for _, tp := range sp.ports {
+					if tp.Proto != proto || int(tp.Port) != port {
+						continue
+					}
+					var ip net.IP
+					if tIPs := si.svcMap[sp.target]; len(tIPs) > 0 {
+						ip = types.GetIPCopy(tIPs[0])
+					}
+					srv = append(srv, &net.SRV{Target: sp.target + ".", Port: tp.Port})
+					ips = append(ips, ip)
+				}
+			}
+		}
+		n.Unlock()
+
+		if len(srv) > 0 {
+			return srv, ips
+		}
+	}
+
+	return nil, nil
+}
+
+// execFunc runs the passed function in the sandbox network namespace.
+func (sb *sandbox) execFunc(f func()) error {
+	sb.Lock()
+	osSbox := sb.osSbox
+	sb.Unlock()
+
+	if osSbox == nil {
+		return fmt.Errorf("no network namespace for sandbox %s", sb.ID())
+	}
+	return osSbox.InvokeFunc(f)
+}
+
 // joinLeaveStart waits to ensure there are no joins or leaves in progress and
 // marks this join/leave in progress without race
 func (sb *sandbox) joinLeaveStart() {
@@ -813,6 +1051,14 @@ func OptionUseDefaultSandbox() SandboxOption {
 	}
 }
 
+// OptionUseEmbeddedDNS function returns an option setter for running the
+// embedded DNS server in the sandbox, the container resolv.conf pointing to it.
+func OptionUseEmbeddedDNS() SandboxOption {
+	return func(sb *sandbox) {
+		sb.config.useEmbeddedDNS = true
+	}
+}
+
 // OptionUseExternalKey function returns an option setter for using provided namespace
 // instead of creating one.
 func OptionUseExternalKey() SandboxOption {
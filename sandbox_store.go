@@ -0,0 +1,410 @@
+package libnetwork
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
+)
+
+// epState is the persisted state of an endpoint joined to a sandbox
+type epState struct {
+	Eid          string
+	Nid          string
+	SrcName      string
+	DstName      string
+	Prio         int
+	Gw           net.IP
+	Gw6          net.IP
+	StaticRoutes []*types.StaticRoute
+}
+
+// sbState is the persisted state of a sandbox. The sandbox object itself
+// cannot be a KVObject as its Key method returns the osl sandbox key.
+type sbState struct {
+	ID                   string
+	Cid                  string
+	OsKey                string
+	UseDefaultSandbox    bool
+	UseExternalKey       bool
+	UseEmbeddedDNS       bool
+	ExtDNS               []string
+	HostName             string
+	DomainName           string
+	HostsPath            string
+	OriginHostsPath      string
+	ExtraHosts           []sbExtraHost
+	ResolvConfPath       string
+	OriginResolvConfPath string
+	ResolvConfHashFile   string
+	DNS                  []string
+	DNSSearch            []string
+	DNSOptions           []string
+	Eps                  []epState
+	c                    *controller
+	dbIndex              uint64
+	dbExists             bool
+}
+
+type sbExtraHost struct {
+	Name string
+	IP   string
+}
+
+func (sbs *sbState) Key() []string {
+	return []string{datastore.SandboxKeyPrefix, sbs.ID}
+}
+
+func (sbs *sbState) KeyPrefix() []string {
+	return []string{datastore.SandboxKeyPrefix}
+}
+
+func (sbs *sbState) Value() []byte {
+	b, err := json.Marshal(sbs)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (sbs *sbState) SetValue(value []byte) error {
+	return json.Unmarshal(value, sbs)
+}
+
+func (sbs *sbState) Index() uint64 {
+	return sbs.dbIndex
+}
+
+func (sbs *sbState) SetIndex(index uint64) {
+	sbs.dbIndex = index
+	sbs.dbExists = true
+}
+
+func (sbs *sbState) Exists() bool {
+	return sbs.dbExists
+}
+
+func (sbs *sbState) Skip() bool {
+	return false
+}
+
+func (sbs *sbState) DataScope() string {
+	return datastore.LocalScope
+}
+
+func (sbs *sbState) New() datastore.KVObject {
+	return &sbState{c: sbs.c}
+}
+
+func (sbs *sbState) CopyTo(o datastore.KVObject) error {
+	dstSbs := o.(*sbState)
+	*dstSbs = *sbs
+
+	dstSbs.ExtraHosts = append([]sbExtraHost(nil), sbs.ExtraHosts...)
+	dstSbs.DNS = append([]string(nil), sbs.DNS...)
+	dstSbs.DNSSearch = append([]string(nil), sbs.DNSSearch...)
+	dstSbs.DNSOptions = append([]string(nil), sbs.DNSOptions...)
+	dstSbs.ExtDNS = append([]string(nil), sbs.ExtDNS...)
+	dstSbs.Eps = append([]epState(nil), sbs.Eps...)
+
+	return nil
+}
+
+func (sb *sandbox) state() *sbState {
+	sb.Lock()
+	sbs := &sbState{
+		ID:                   sb.id,
+		Cid:                  sb.containerID,
+		UseDefaultSandbox:    sb.config.useDefaultSandBox,
+		UseExternalKey:       sb.config.useExternalKey,
+		UseEmbeddedDNS:       sb.config.useEmbeddedDNS,
+		ExtDNS:               sb.extDNS,
+		HostName:             sb.config.hostName,
+		DomainName:           sb.config.domainName,
+		HostsPath:            sb.config.hostsPath,
+		OriginHostsPath:      sb.config.originHostsPath,
+		ResolvConfPath:       sb.config.resolvConfPath,
+		OriginResolvConfPath: sb.config.originResolvConfPath,
+		ResolvConfHashFile:   sb.config.resolvConfHashFile,
+		DNS:                  sb.config.dnsList,
+		DNSSearch:            sb.config.dnsSearchList,
+		DNSOptions:           sb.config.dnsOptionsList,
+		c:                    sb.controller,
+		dbIndex:              sb.dbIndex,
+		dbExists:             sb.dbExists,
+	}
+	for _, eh := range sb.config.extraHosts {
+		sbs.ExtraHosts = append(sbs.ExtraHosts, sbExtraHost{Name: eh.name, IP: eh.IP})
+	}
+	osSbox := sb.osSbox
+	prio := make(map[string]int, len(sb.epPriority))
+	for k, v := range sb.epPriority {
+		prio[k] = v
+	}
+	sb.Unlock()
+
+	var ifaces []osl.Interface
+	if osSbox != nil {
+		sbs.OsKey = osSbox.Key()
+		ifaces = osSbox.Info().Interfaces()
+	}
+
+	for _, ep := range sb.getConnectedEndpoints() {
+		ep.Lock()
+		eps := epState{
+			Eid:  ep.id,
+			Nid:  ep.network.ID(),
+			Prio: prio[ep.id],
+		}
+		if ep.iface != nil {
+			eps.SrcName = ep.iface.srcName
+		}
+		if ep.joinInfo != nil {
+			eps.Gw = ep.joinInfo.gw
+			eps.Gw6 = ep.joinInfo.gw6
+			eps.StaticRoutes = ep.joinInfo.StaticRoutes
+		}
+		ep.Unlock()
+
+		for _, i := range ifaces {
+			if eps.SrcName != "" && i.SrcName() == eps.SrcName {
+				eps.DstName = i.DstName()
+				break
+			}
+		}
+
+		sbs.Eps = append(sbs.Eps, eps)
+	}
+
+	return sbs
+}
+
+// storeUpdate persists the current state of the sandbox in the local store
+func (sb *sandbox) storeUpdate() error {
+	sbs := sb.state()
+	if err := sb.controller.updateToStore(sbs); err != nil {
+		return err
+	}
+
+	sb.Lock()
+	sb.dbIndex = sbs.dbIndex
+	sb.dbExists = sbs.dbExists
+	sb.Unlock()
+
+	return nil
+}
+
+// storeDelete removes the persisted state of the sandbox from the local store
+func (sb *sandbox) storeDelete() error {
+	sb.Lock()
+	sbs := &sbState{
+		ID:       sb.id,
+		c:        sb.controller,
+		dbIndex:  sb.dbIndex,
+		dbExists: sb.dbExists,
+	}
+	sb.Unlock()
+
+	return sb.controller.deleteFromStore(sbs)
+}
+
+func (c *controller) getSandboxStatesFromStore() ([]*sbState, error) {
+	store := c.getStore(datastore.LocalScope)
+	if store == nil {
+		return nil, nil
+	}
+
+	kvol, err := store.List(datastore.Key(datastore.SandboxKeyPrefix), &sbState{c: c})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return nil, fmt.Errorf("failed to get sandboxes from store: %v", err)
+	}
+
+	var sbsl []*sbState
+	for _, kvo := range kvol {
+		sbs := kvo.(*sbState)
+		sbs.c = c
+		sbsl = append(sbsl, sbs)
+	}
+
+	return sbsl, nil
+}
+
+// sandboxRestore reloads the sandboxes persisted by a previous instance of
+// the controller, adopting their network namespaces. The sandboxes whose
+// network namespace is gone are cleaned up.
+func (c *controller) sandboxRestore() error {
+	sbsl, err := c.getSandboxStatesFromStore()
+	if err != nil {
+		return err
+	}
+
+	for _, sbs := range sbsl {
+		if err := c.restoreSandbox(sbs); err != nil {
+			log.Warnf("Failed to restore sandbox %s for container %s, cleaning it up: %v", sbs.ID, sbs.Cid, err)
+			c.sandboxCleanup(sbs)
+		}
+	}
+
+	return nil
+}
+
+func (c *controller) restoreSandbox(sbs *sbState) error {
+	sb := &sandbox{
+		id:          sbs.ID,
+		containerID: sbs.Cid,
+		endpoints:   epHeap{},
+		epPriority:  map[string]int{},
+		controller:  c,
+		dbIndex:     sbs.dbIndex,
+		dbExists:    sbs.dbExists,
+		config: containerConfig{
+			hostsPathConfig: hostsPathConfig{
+				hostName:        sbs.HostName,
+				domainName:      sbs.DomainName,
+				hostsPath:       sbs.HostsPath,
+				originHostsPath: sbs.OriginHostsPath,
+			},
+			resolvConfPathConfig: resolvConfPathConfig{
+				resolvConfPath:       sbs.ResolvConfPath,
+				originResolvConfPath: sbs.OriginResolvConfPath,
+				resolvConfHashFile:   sbs.ResolvConfHashFile,
+				dnsList:              sbs.DNS,
+				dnsSearchList:        sbs.DNSSearch,
+				dnsOptionsList:       sbs.DNSOptions,
+			},
+			useDefaultSandBox: sbs.UseDefaultSandbox,
+			useExternalKey:    sbs.UseExternalKey,
+			useEmbeddedDNS:    sbs.UseEmbeddedDNS,
+		},
+		extDNS: sbs.ExtDNS,
+	}
+	for _, eh := range sbs.ExtraHosts {
+		sb.config.extraHosts = append(sb.config.extraHosts, extraHost{name: eh.Name, IP: eh.IP})
+	}
+	heap.Init(&sb.endpoints)
+
+	// The namespace key is not set for a sandbox which is
+	// still waiting for its external key to be provided
+	if sbs.OsKey != "" {
+		var peerSb Sandbox
+		c.WalkSandboxes(SandboxKeyWalker(&peerSb, sb.Key()))
+		if peerSb != nil {
+			sb.osSbox = peerSb.(*sandbox).osSbox
+		} else {
+			ifaces := make(map[string]string)
+			for _, eps := range sbs.Eps {
+				if eps.DstName != "" {
+					ifaces[eps.DstName] = eps.SrcName
+				}
+			}
+
+			osSbox, err := osl.RestoreSandbox(sbs.OsKey, ifaces)
+			if err != nil {
+				return err
+			}
+			sb.osSbox = osSbox
+		}
+	}
+
+	// The endpoints heap needs the sandbox to be
+	// reachable from the controller
+	c.Lock()
+	c.sandboxes[sb.id] = sb
+	c.Unlock()
+
+	for _, eps := range sbs.Eps {
+		ep, err := c.getSandboxEndpoint(sb.id, eps)
+		if err != nil {
+			log.Warnf("Failed to restore endpoint %s in sandbox %s: %v", eps.Eid, sb.id, err)
+			continue
+		}
+
+		ep.Lock()
+		ep.joinInfo = &endpointJoinInfo{gw: eps.Gw, gw6: eps.Gw6, StaticRoutes: eps.StaticRoutes}
+		ep.Unlock()
+
+		sb.Lock()
+		sb.epPriority[ep.id] = eps.Prio
+		heap.Push(&sb.endpoints, ep)
+		sb.Unlock()
+
+		c.watchSvcRecord(ep)
+	}
+
+	// The hosts file is already populated, it must not be rebuilt on the next join.
+	// The resolv.conf already points to the embedded DNS server, which has to be
+	// started again as it was running in the previous life of the controller.
+	if len(sb.getConnectedEndpoints()) > 0 {
+		sb.hostsOnce.Do(func() {})
+		sb.startResolver(true)
+	}
+
+	log.Debugf("Restored sandbox %s for container %s", sb.id, sb.containerID)
+
+	return nil
+}
+
+// getSandboxEndpoint returns the endpoint described by the passed state if it
+// is still joined to the sandbox identified by sid
+func (c *controller) getSandboxEndpoint(sid string, eps epState) (*endpoint, error) {
+	n, err := c.getNetworkFromStore(eps.Nid)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := n.getEndpointFromStore(eps.Eid)
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.sandboxID != sid {
+		return nil, fmt.Errorf("endpoint %s is not joined to sandbox %s", eps.Eid, sid)
+	}
+
+	return ep, nil
+}
+
+// sandboxCleanup releases the resources held by a sandbox which could not be
+// restored, typically because its network namespace has vanished, so that the
+// endpoints can be deleted or joined by other sandboxes.
+func (c *controller) sandboxCleanup(sbs *sbState) {
+	for _, eps := range sbs.Eps {
+		ep, err := c.getSandboxEndpoint(sbs.ID, eps)
+		if err != nil {
+			continue
+		}
+
+		n := ep.getNetwork()
+		if d, err := n.driver(); err == nil {
+			if err := d.Leave(n.ID(), ep.ID()); err != nil {
+				log.Debugf("driver leave failed while cleaning up sandbox %s: %v", sbs.ID, err)
+			}
+		}
+
+		ep.Lock()
+		ep.sandboxID = ""
+		ep.Unlock()
+
+		if err := c.updateToStore(ep); err != nil {
+			log.Warnf("Failed to detach endpoint %s from stale sandbox %s: %v", ep.ID(), sbs.ID, err)
+		}
+	}
+
+	// The namespace file of a non shared namespace may have been
+	// left behind unmounted, it is of no use anymore
+	if sbs.OsKey != "" && !sbs.UseDefaultSandbox {
+		if err := os.Remove(sbs.OsKey); err != nil && !os.IsNotExist(err) {
+			log.Debugf("Failed to remove namespace file %s: %v", sbs.OsKey, err)
+		}
+	}
+
+	if err := c.deleteFromStore(sbs); err != nil {
+		log.Warnf("Failed to delete stale sandbox %s from store: %v", sbs.ID, err)
+	}
+}
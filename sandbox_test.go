@@ -1,13 +1,23 @@
 package libnetwork
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/libnetwork/config"
+	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/osl"
 	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/miekg/dns"
 )
 
 func createEmptyCtrlr() *controller {
@@ -211,3 +221,430 @@ func TestSandboxAddSamePrio(t *testing.T) {
 
 	osl.GC()
 }
+
+func TestSandboxStoreRestore(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	netOption := options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "restorenw",
+		},
+	}
+	nw, err := c.NewNetwork("bridge", "restorenw", NetworkOptionGeneric(netOption))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := nw.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbx, err := c.NewSandbox("restore-container", OptionHostname("restore"), OptionDNS("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sbx); err != nil {
+		t.Fatal(err)
+	}
+
+	sid := sbx.ID()
+	key := sbx.Key()
+	c.Stop()
+
+	c, err = New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	s, err := c.SandboxByID(sid)
+	if err != nil {
+		t.Fatalf("Sandbox was not restored: %v", err)
+	}
+
+	rsb := s.(*sandbox)
+	if rsb.ContainerID() != "restore-container" || rsb.Key() != key {
+		t.Fatalf("Unexpected restored sandbox: %s, %s", rsb.ContainerID(), rsb.Key())
+	}
+
+	if rsb.config.hostName != "restore" || len(rsb.config.dnsList) != 1 || rsb.config.dnsList[0] != "8.8.8.8" {
+		t.Fatalf("Sandbox configuration was not restored: %v", rsb.config)
+	}
+
+	eps := rsb.getConnectedEndpoints()
+	if len(eps) != 1 || eps[0].ID() != ep.ID() {
+		t.Fatalf("Sandbox endpoints were not restored: %v", eps)
+	}
+
+	if rsb.osSbox == nil {
+		t.Fatalf("Sandbox namespace was not adopted")
+	}
+
+	ifaces := rsb.osSbox.Info().Interfaces()
+	if len(ifaces) != 1 || !eps[0].hasInterface(ifaces[0].SrcName()) {
+		t.Fatalf("Sandbox interfaces were not adopted: %v", ifaces)
+	}
+
+	if err := rsb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	osl.GC()
+}
+
+func TestSandboxStoreCleanup(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nw, err := c.NewNetwork("null", "cleanupnw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := nw.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbx, err := c.NewSandbox("cleanup-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sbx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the namespace vanish as on a host reboot
+	sid := sbx.ID()
+	if err := sbx.(*sandbox).osSbox.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	osl.GC()
+	c.Stop()
+
+	c, err = New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	if _, err := c.SandboxByID(sid); err == nil {
+		t.Fatalf("Sandbox with a vanished namespace was restored")
+	}
+
+	if sbsl, err := c.(*controller).getSandboxStatesFromStore(); err != nil || len(sbsl) != 0 {
+		t.Fatalf("Stale sandbox was not removed from the store: %v, %v", sbsl, err)
+	}
+
+	n, err := c.NetworkByID(nw.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := n.EndpointByID(ep.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rep.Delete(); err != nil {
+		t.Fatalf("Endpoint was not released by the sandbox cleanup: %v", err)
+	}
+}
+
+// netnsMounts returns the network namespaces of the sandboxes mounted.
+func netnsMounts(t *testing.T) []string {
+	b, err := ioutil.ReadFile("/proc/self/mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(osl.GenerateKey("x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mounts []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && strings.HasPrefix(fields[1], dir+"/") {
+			mounts = append(mounts, fields[1])
+		}
+	}
+	return mounts
+}
+
+func TestSandboxStoreUpdateFailure(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	dir, err := ioutil.TempDir("", "sandbox-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mounts := len(netnsMounts(t))
+
+	// The sandbox state cannot be persisted
+	c.(*controller).getStore(datastore.LocalScope).Close()
+
+	hostsPath, resolvConfPath := filepath.Join(dir, "hosts"), filepath.Join(dir, "resolv.conf")
+	if _, err := c.NewSandbox("failing-container", OptionHostsPath(hostsPath), OptionResolvConfPath(resolvConfPath)); err == nil {
+		t.Fatal("Expected the sandbox creation to fail")
+	}
+
+	if len(c.Sandboxes()) != 0 {
+		t.Fatalf("Expected no sandbox, got %v", c.Sandboxes())
+	}
+	if m := netnsMounts(t); len(m) != mounts {
+		t.Fatalf("Expected the namespace of the failed sandbox to be destroyed, got %v", m)
+	}
+	for _, path := range []string{hostsPath, resolvConfPath, resolvConfPath + ".hash"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Expected %s of the failed sandbox to be removed: %v", path, err)
+		}
+	}
+}
+
+func TestSandboxEmbeddedDNS(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	c, nw, _ := getTestEnv(t)
+	defer c.Stop()
+
+	resolvConfPath := "/tmp/libnetwork_test/embedded_dns/resolv.conf"
+	defer os.RemoveAll(filepath.Dir(resolvConfPath))
+
+	sbx, err := c.NewSandbox("dns-container", OptionUseEmbeddedDNS(),
+		OptionResolvConfPath(resolvConfPath), OptionDNSSearch("example.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := sbx.(*sandbox)
+
+	ep, err := nw.CreateEndpoint("ep1", CreateOptionAlias("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sbx); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"nameserver " + resolverIP + "\n", "search example.org\n", "ndots:0"} {
+		if !strings.Contains(string(content), expected) {
+			t.Fatalf("Expected %q in resolv.conf, got:\n%s", expected, content)
+		}
+	}
+	if sb.resolver == nil {
+		t.Fatalf("Embedded DNS server was not started")
+	}
+
+	// Fake the upstream nameserver inside the sandbox namespace
+	upstream := &dns.Server{Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, q *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 10},
+			A:   net.ParseIP("1.2.3.4"),
+		})
+		w.WriteMsg(resp)
+	})}
+	if err := sb.execFunc(func() {
+		upstream.PacketConn, err = net.ListenPacket("udp", "127.0.0.12:53")
+	}); err != nil || upstream.PacketConn == nil {
+		t.Fatalf("Failed to setup the upstream nameserver: %v", err)
+	}
+	go upstream.ActivateAndServe()
+	defer upstream.Shutdown()
+	sb.resolver.SetExtServers([]string{"127.0.0.12"})
+
+	ip := ep.Info().Iface().Address().IP
+	for _, name := range []string{"ep1.", "db.", "db." + nw.Name() + "."} {
+		var resp *dns.Msg
+		// The service records are updated asynchronously
+		for i := 0; i < 50; i++ {
+			resp = queryEmbeddedDNS(t, sb, name, dns.TypeA)
+			if len(resp.Answer) > 0 {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if len(resp.Answer) != 1 || !resp.Answer[0].(*dns.A).A.Equal(ip) {
+			t.Fatalf("Unexpected answer for %s: %v", name, resp.Answer)
+		}
+	}
+
+	resp := queryEmbeddedDNS(t, sb, "www.docker.com.", dns.TypeA)
+	if len(resp.Answer) != 1 || !resp.Answer[0].(*dns.A).A.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("Query was not forwarded to the upstream nameserver: %v", resp)
+	}
+
+	if err := ep.Leave(sbx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sbx.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if sb.resolver != nil {
+		t.Fatalf("Embedded DNS server was not stopped")
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func queryEmbeddedDNS(t *testing.T, sb *sandbox, name string, qtype uint16) *dns.Msg {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if execErr := sb.execFunc(func() {
+		conn, err = net.Dial("udp", resolverIP+":53")
+	}); execErr != nil {
+		t.Fatal(execErr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	q := new(dns.Msg)
+	q.SetQuestion(name, qtype)
+	resp, err := exchangeExtDNS(conn, q)
+	if err != nil {
+		t.Fatalf("Query for %s failed: %v", name, err)
+	}
+	return resp
+}
+
+func TestSandboxDNSRoundRobin(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	c, nw, _ := getTestEnv(t)
+	defer c.Stop()
+
+	resolvConfPath := "/tmp/libnetwork_test/dns_rr/resolv.conf"
+	defer os.RemoveAll(filepath.Dir(resolvConfPath))
+
+	ports := []types.TransportPort{{Proto: types.TCP, Port: 80}, {Proto: types.UDP, Port: 53}}
+	var (
+		eps  []Endpoint
+		sbxs []Sandbox
+	)
+	for i, name := range []string{"web1", "web2", "client"} {
+		var opts []EndpointOption
+		if name != "client" {
+			opts = append(opts, CreateOptionAlias("web"), CreateOptionExposedPorts(ports))
+		}
+		ep, err := nw.CreateEndpoint(name, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sbx, err := c.NewSandbox(fmt.Sprintf("rr-container%d", i), OptionUseEmbeddedDNS(),
+			OptionResolvConfPath(resolvConfPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ep.Join(sbx); err != nil {
+			t.Fatal(err)
+		}
+		eps = append(eps, ep)
+		sbxs = append(sbxs, sbx)
+	}
+	defer func() {
+		for i := range eps {
+			if err := sbxs[i].Delete(); err != nil {
+				t.Fatal(err)
+			}
+			if err := eps[i].Delete(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+	sb := sbxs[2].(*sandbox)
+
+	var resp *dns.Msg
+	// The service records are updated asynchronously
+	for i := 0; i < 50; i++ {
+		resp = queryEmbeddedDNS(t, sb, "web.", dns.TypeA)
+		if len(resp.Answer) == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(resp.Answer) != 2 {
+		t.Fatalf("Expected two A records for the service, got: %v", resp.Answer)
+	}
+	first := resp.Answer[0].(*dns.A).A
+	resp = queryEmbeddedDNS(t, sb, "web.", dns.TypeA)
+	if len(resp.Answer) != 2 || resp.Answer[0].(*dns.A).A.Equal(first) {
+		t.Fatalf("Expected the A records to be rotated, got: %v after %s", resp.Answer, first)
+	}
+
+	resp = queryEmbeddedDNS(t, sb, "web.", dns.TypeAAAA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Fatalf("Expected no AAAA record for the service, got: %v", resp)
+	}
+
+	for _, name := range []string{"_80._tcp.web.", "_http._tcp.web.", "_53._udp.web." + nw.Name() + "."} {
+		resp = queryEmbeddedDNS(t, sb, name, dns.TypeSRV)
+		if len(resp.Answer) != 2 || len(resp.Extra) != 2 {
+			t.Fatalf("Expected two SRV records for %s, got: %v", name, resp)
+		}
+		targets := map[string]bool{}
+		for i, rr := range resp.Answer {
+			srv := rr.(*dns.SRV)
+			targets[srv.Target] = true
+			if resp.Extra[i].Header().Name != srv.Target {
+				t.Fatalf("Unexpected additional record for %s: %v", srv.Target, resp.Extra[i])
+			}
+		}
+		if !targets["web1."+nw.Name()+"."] || !targets["web2."+nw.Name()+"."] {
+			t.Fatalf("Unexpected SRV records for %s: %v", name, resp.Answer)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/portallocator"
 )
 
 func (c *controller) initStores() error {
@@ -31,11 +32,60 @@ func (c *controller) initStores() error {
 }
 
 func (c *controller) closeStores() {
+	// The port allocator outlives the controller
+	if c.getStore(datastore.LocalScope) != nil {
+		portallocator.Get().SetStore(nil)
+	}
+
 	for _, store := range c.getStores() {
 		store.Close()
 	}
 }
 
+// initPortAllocator backs the port allocator with the local store, so that
+// the host ports still forwarded to the containers are not handed out again
+// after a restart.
+func (c *controller) initPortAllocator() {
+	store := c.getStore(datastore.LocalScope)
+	if store == nil {
+		return
+	}
+
+	if err := portallocator.Get().SetStore(store); err != nil {
+		log.Warnf("Failed to restore port allocations: %v", err)
+	}
+}
+
+// reconcilePortAllocations releases the port allocations restored from the
+// local store which neither a port mapping claimed again nor an endpoint
+// still owns.
+func (c *controller) reconcilePortAllocations() {
+	if c.getStore(datastore.LocalScope) == nil {
+		return
+	}
+
+	live := make(map[string]bool)
+	nl, err := c.getNetworksFromStore()
+	if err != nil {
+		log.Warnf("Could not reconcile port allocations: %v", err)
+		return
+	}
+	for _, n := range nl {
+		epl, err := n.getEndpointsFromStore()
+		if err != nil {
+			log.Warnf("Could not reconcile port allocations: %v", err)
+			return
+		}
+		for _, ep := range epl {
+			live[ep.id] = true
+		}
+	}
+
+	if err := portallocator.Get().Reconcile(live); err != nil {
+		log.Warnf("Failed to release stale port allocations: %v", err)
+	}
+}
+
 func (c *controller) getStore(scope string) datastore.DataStore {
 	c.Lock()
 	defer c.Unlock()
@@ -234,29 +284,59 @@ func (c *controller) networkWatchLoop(nw *netWatch, ep *endpoint, nCh <-chan dat
 					continue
 				}
 
-				if _, ok := nw.remoteEps[lEp.ID()]; ok {
-					delete(delEpMap, lEp.ID())
-					continue
+				if rEp, ok := nw.remoteEps[lEp.ID()]; ok {
+					// Unless the remote endpoint got new aliases on join,
+					// there is nothing to update for it. Otherwise its old
+					// records are replaced with the new ones.
+					if sameAliases(rEp.getAliases(), lEp.getAliases()) {
+						delete(delEpMap, lEp.ID())
+						continue
+					}
 				}
 
 				nw.remoteEps[lEp.ID()] = lEp
 				addEp = append(addEp, lEp)
 
 			}
-			c.Unlock()
 
-			for _, lEp := range addEp {
-				ep.getNetwork().updateSvcRecord(lEp, c.getLocalEps(nw), true)
+			// The load balanced services of the endpoints which are
+			// gone are removed, not the ones of the replaced endpoints
+			var rmLBEp []*endpoint
+			for k, v := range delEpMap {
+				if nw.remoteEps[k] == v {
+					delete(nw.remoteEps, k)
+					rmLBEp = append(rmLBEp, v)
+				}
 			}
+			c.Unlock()
 
 			for _, lEp := range delEpMap {
 				ep.getNetwork().updateSvcRecord(lEp, c.getLocalEps(nw), false)
+			}
+
+			for _, lEp := range rmLBEp {
+				ep.getNetwork().removeLBService(lEp)
+			}
 
+			for _, lEp := range addEp {
+				ep.getNetwork().updateSvcRecord(lEp, c.getLocalEps(nw), true)
 			}
 		}
 	}
 }
 
+func sameAliases(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *controller) processEndpointCreate(nmap map[string]*netWatch, ep *endpoint) {
 	c.Lock()
 	nw, ok := nmap[ep.getNetwork().ID()]
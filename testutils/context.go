@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/docker/libnetwork/ns"
+	"github.com/vishvananda/netns"
 )
 
 // SetupTestOSContext joins a new network namespace, and returns its associated
@@ -17,6 +18,10 @@ import (
 //
 func SetupTestOSContext(t *testing.T) func() {
 	runtime.LockOSThread()
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("Failed to get the current netns: %v", err)
+	}
 	if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
 		t.Fatalf("Failed to enter netns: %v", err)
 	}
@@ -34,6 +39,13 @@ func SetupTestOSContext(t *testing.T) func() {
 		if err := syscall.Close(fd); err != nil {
 			t.Logf("Warning: netns closing failed (%v)", err)
 		}
+		// Return the thread to the original namespace, for the
+		// goroutines it runs next not to be left in the test one
+		if err := netns.Set(origns); err != nil {
+			t.Logf("Warning: failed to restore the original netns (%v)", err)
+		}
+		origns.Close()
+		ns.Init()
 		runtime.UnlockOSThread()
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 )
 
@@ -39,6 +40,8 @@ func (p PortBinding) HostAddr() (net.Addr, error) {
 		return &net.UDPAddr{IP: p.HostIP, Port: int(p.HostPort)}, nil
 	case TCP:
 		return &net.TCPAddr{IP: p.HostIP, Port: int(p.HostPort)}, nil
+	case SCTP:
+		return &SCTPAddr{IP: p.HostIP, Port: int(p.HostPort)}, nil
 	default:
 		return nil, ErrInvalidProtocolBinding(p.Proto.String())
 	}
@@ -51,6 +54,8 @@ func (p PortBinding) ContainerAddr() (net.Addr, error) {
 		return &net.UDPAddr{IP: p.IP, Port: int(p.Port)}, nil
 	case TCP:
 		return &net.TCPAddr{IP: p.IP, Port: int(p.Port)}, nil
+	case SCTP:
+		return &SCTPAddr{IP: p.IP, Port: int(p.Port)}, nil
 	default:
 		return nil, ErrInvalidProtocolBinding(p.Proto.String())
 	}
@@ -106,6 +111,25 @@ func (p *PortBinding) Equal(o *PortBinding) bool {
 	return true
 }
 
+// SCTPAddr represents the address of an SCTP end point, which
+// the standard library does not provide
+type SCTPAddr struct {
+	IP   net.IP
+	Port int
+}
+
+// Network returns the address's network name, "sctp"
+func (a *SCTPAddr) Network() string {
+	return "sctp"
+}
+
+func (a *SCTPAddr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+}
+
 // ErrInvalidProtocolBinding is returned when the port binding protocol is not valid.
 type ErrInvalidProtocolBinding string
 
@@ -120,6 +144,8 @@ const (
 	TCP = 6
 	// UDP is for the UDP ip protocol
 	UDP = 17
+	// SCTP is for the SCTP ip protocol
+	SCTP = 132
 )
 
 // Protocol represents a IP protocol number
@@ -133,6 +159,8 @@ func (p Protocol) String() string {
 		return "tcp"
 	case UDP:
 		return "udp"
+	case SCTP:
+		return "sctp"
 	default:
 		return fmt.Sprintf("%d", p)
 	}
@@ -147,6 +175,8 @@ func ParseProtocol(s string) Protocol {
 		return UDP
 	case "tcp":
 		return TCP
+	case "sctp":
+		return SCTP
 	default:
 		return 0
 	}
@@ -321,6 +351,57 @@ func (r *StaticRoute) GetCopy() *StaticRoute {
 	}
 }
 
+// PolicyAction is the verdict of a network policy rule
+type PolicyAction string
+
+const (
+	// PolicyAllow lets the matching traffic through
+	PolicyAllow PolicyAction = "allow"
+	// PolicyDeny drops the matching traffic
+	PolicyDeny PolicyAction = "deny"
+)
+
+// EndpointSelector selects the endpoints of a network by name or by labels.
+// Each label selector is either a label key or a key=value pair. An endpoint
+// matches if its name is listed or if it satisfies all the label selectors.
+// The empty selector matches all the endpoints.
+type EndpointSelector struct {
+	Names  []string `json:"names,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// PolicyRule allows or denies the traffic from the source endpoints to the
+// destination endpoints of a network. The rule can be restricted to an ip
+// protocol and, for tcp, udp and sctp, to a destination port.
+type PolicyRule struct {
+	Action      PolicyAction     `json:"action"`
+	Source      EndpointSelector `json:"source"`
+	Destination EndpointSelector `json:"destination"`
+	Proto       Protocol         `json:"proto,omitempty"`
+	Port        uint16           `json:"port,omitempty"`
+}
+
+// Validate checks whether the policy rule is well formed
+func (r *PolicyRule) Validate() error {
+	if r.Action != PolicyAllow && r.Action != PolicyDeny {
+		return BadRequestErrorf("invalid policy action %q", r.Action)
+	}
+	if r.Port != 0 && r.Proto != TCP && r.Proto != UDP && r.Proto != SCTP {
+		return BadRequestErrorf("policy port %d requires tcp, udp or sctp protocol", r.Port)
+	}
+	return nil
+}
+
+// GetCopy returns a copy of this PolicyRule structure
+func (r *PolicyRule) GetCopy() PolicyRule {
+	cp := *r
+	cp.Source.Names = append([]string(nil), r.Source.Names...)
+	cp.Source.Labels = append([]string(nil), r.Source.Labels...)
+	cp.Destination.Names = append([]string(nil), r.Destination.Names...)
+	cp.Destination.Labels = append([]string(nil), r.Destination.Labels...)
+	return cp
+}
+
 // InterfaceStatistics represents the interface's statistics
 type InterfaceStatistics struct {
 	RxBytes   uint64
@@ -3,6 +3,7 @@ package types
 import (
 	"flag"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -340,3 +341,55 @@ func TestParseCIDR(t *testing.T) {
 		}
 	}
 }
+
+func TestPolicyRuleValidate(t *testing.T) {
+	for i, tc := range []struct {
+		rule  PolicyRule
+		valid bool
+	}{
+		{rule: PolicyRule{Action: PolicyAllow}, valid: true},
+		{rule: PolicyRule{Action: PolicyDeny, Proto: UDP, Port: 53}, valid: true},
+		{rule: PolicyRule{Action: PolicyAllow, Proto: SCTP, Port: 2905}, valid: true},
+		{rule: PolicyRule{Action: PolicyAllow, Proto: ICMP}, valid: true},
+		{rule: PolicyRule{Action: "reject"}, valid: false},
+		{rule: PolicyRule{Action: PolicyAllow, Port: 80}, valid: false},
+		{rule: PolicyRule{Action: PolicyAllow, Proto: ICMP, Port: 8}, valid: false},
+	} {
+		err := tc.rule.Validate()
+		if tc.valid && err != nil {
+			t.Fatalf("Rule %d: unexpected failure: %v", i, err)
+		}
+		if !tc.valid {
+			if _, ok := err.(BadRequestError); !ok {
+				t.Fatalf("Rule %d: expected bad request error, got %v", i, err)
+			}
+		}
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	for _, p := range []Protocol{ICMP, TCP, UDP, SCTP} {
+		if ParseProtocol(strings.ToUpper(p.String())) != p {
+			t.Fatalf("Protocol %d does not parse back from %q", p, p.String())
+		}
+	}
+	if ParseProtocol("dccp") != 0 {
+		t.Fatal("Expected unknown protocol to parse to 0")
+	}
+
+	pb := PortBinding{Proto: SCTP, IP: net.ParseIP("172.17.0.2"), Port: 2905, HostIP: net.ParseIP("::1"), HostPort: 32905}
+	host, err := pb.HostAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Network() != "sctp" || host.String() != "[::1]:32905" {
+		t.Fatalf("Unexpected sctp host address %s %s", host.Network(), host)
+	}
+	container, err := pb.ContainerAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := container.(*SCTPAddr); !ok || !a.IP.Equal(pb.IP) || a.Port != 2905 {
+		t.Fatalf("Unexpected sctp container address %v", container)
+	}
+}